@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
@@ -9,9 +10,15 @@ import (
 	log "github.com/sirupsen/logrus"
 	compute "google.golang.org/api/compute/v1"
 
+	"github.com/arryved/app-ctrl/api/audit"
 	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/groups"
+	"github.com/arryved/app-ctrl/api/metrics"
 	"github.com/arryved/app-ctrl/api/queue"
+	"github.com/arryved/app-ctrl/api/rbac/utility"
 	"github.com/arryved/app-ctrl/api/runners"
+	"github.com/arryved/app-ctrl/api/secrets"
+	"github.com/arryved/app-ctrl/api/tokens"
 )
 
 // TODO replace with API or canon lookup or fix tools/internal and sandbox/dev incongruities
@@ -26,13 +33,20 @@ var fqdnMap = map[string]string{
 }
 
 type Api struct {
-	cfg      *config.Config
-	gceCache *runners.GCECache
+	cfg          *config.Config
+	gceCache     *runners.GCECache
+	staleSecrets *runners.StaleSecretsCache
 }
 
 func (a *Api) Start() error {
 	cfg := a.cfg
 
+	err := checkOIDCConfig(cfg)
+	if err != nil {
+		log.Errorf("invalid oidc config, error=%s", err.Error())
+		return err
+	}
+
 	queueClient, err := queue.NewClient(cfg.Queue)
 	if err != nil {
 		log.Errorf("could not get a queue client, error=%s", err.Error())
@@ -40,16 +54,66 @@ func (a *Api) Start() error {
 	}
 	jobQueue := queue.NewQueue(cfg.Queue, queueClient)
 
+	jobStore, err := queue.NewJobStore(cfg.JobStore)
+	if err != nil {
+		log.Errorf("could not get a job store, error=%s", err.Error())
+		return err
+	}
+
+	auditLog, err := audit.NewLog(cfg.Audit)
+	if err != nil {
+		log.Errorf("could not get an audit log, error=%s", err.Error())
+		return err
+	}
+
+	tokenStore, err = tokens.NewStore(cfg.Tokens)
+	if err != nil {
+		log.Errorf("could not get a token store, error=%s", err.Error())
+		return err
+	}
+
+	fingerprinter, err := secrets.NewFingerprinter(cfg.Secrets.FingerprintKeyPath)
+	if err != nil {
+		log.Errorf("could not get a secrets fingerprinter, error=%s", err.Error())
+		return err
+	}
+	if fingerprinter == nil {
+		log.Warn("no secrets fingerprint key configured; secret fingerprinting and comparison are disabled")
+	}
+
+	groupResolver, err := groups.NewResolver(context.Background(), cfg)
+	if err != nil {
+		log.Errorf("could not get a group resolver, error=%s", err.Error())
+		return err
+	}
+	utility.SetGroupResolver(groupResolver)
+
+	metrics.StartAdminListener(cfg.AdminPort)
+
+	limiters := newRateLimiters(cfg.Limits)
 	mux := http.NewServeMux()
-	mux.HandleFunc("/status/", ConfiguredHandlerStatus(cfg, a.gceCache))
-	mux.HandleFunc("/deploy/", ConfiguredHandlerDeploy(cfg, a.gceCache, jobQueue))
-	mux.HandleFunc("/secrets/", ConfiguredHandlerSecrets(cfg))
+	mux.HandleFunc("/status/", metrics.Instrument("/status/", rateLimited(cfg, limiters, "/status/", ConfiguredHandlerStatus(cfg, a.gceCache))))
+	mux.HandleFunc("/deploy/", metrics.Instrument("/deploy/", rateLimited(cfg, limiters, "/deploy/", ConfiguredHandlerDeploy(cfg, a.gceCache, jobQueue, jobStore, auditLog))))
+	mux.HandleFunc("/restart/", metrics.Instrument("/restart/", rateLimited(cfg, limiters, "/restart/", ConfiguredHandlerRestart(cfg, a.gceCache, jobQueue, jobStore, auditLog))))
+	mux.HandleFunc("/rollback/", metrics.Instrument("/rollback/", rateLimited(cfg, limiters, "/rollback/", ConfiguredHandlerRollback(cfg, a.gceCache, jobQueue, jobStore, auditLog))))
+	mux.HandleFunc("/secrets/", metrics.Instrument("/secrets/", rateLimited(cfg, limiters, "/secrets/", ConfiguredHandlerSecrets(cfg, auditLog, a.staleSecrets, fingerprinter))))
+	mux.HandleFunc("/secrets-backup/", metrics.Instrument("/secrets-backup/", rateLimited(cfg, limiters, "/secrets-backup/", ConfiguredHandlerSecretsBackup(cfg, auditLog))))
+	mux.HandleFunc("/audit", metrics.Instrument("/audit", rateLimited(cfg, limiters, "/audit", ConfiguredHandlerAudit(cfg, auditLog))))
+	mux.HandleFunc("/tokens", metrics.Instrument("/tokens", rateLimited(cfg, limiters, "/tokens", ConfiguredHandlerTokens(cfg, tokenStore, auditLog))))
+	mux.HandleFunc("/whoami", metrics.Instrument("/whoami", rateLimited(cfg, limiters, "/whoami", ConfiguredHandlerWhoami(cfg))))
+	mux.HandleFunc("/authz/check", metrics.Instrument("/authz/check", rateLimited(cfg, limiters, "/authz/check", ConfiguredHandlerAuthzCheck(cfg))))
+	mux.HandleFunc("/tokens/", metrics.Instrument("/tokens/", rateLimited(cfg, limiters, "/tokens/", ConfiguredHandlerTokens(cfg, tokenStore, auditLog))))
 
 	tlsConfig := &tls.Config{
 		CipherSuites:             CipherSuitesFromConfig(cfg.TLS.Ciphers),
 		MinVersion:               TLSVersionFromConfig(cfg.TLS.MinVersion),
 		PreferServerCipherSuites: true,
 	}
+	err = configureClientAuth(cfg, tlsConfig)
+	if err != nil {
+		log.Errorf("could not set up mTLS, error=%s", err.Error())
+		return err
+	}
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
@@ -72,10 +136,11 @@ func (a *Api) Start() error {
 	return err
 }
 
-func New(cfg *config.Config, cache *runners.GCECache) *Api {
+func New(cfg *config.Config, cache *runners.GCECache, staleSecrets *runners.StaleSecretsCache) *Api {
 	api := &Api{
-		cfg:      cfg,
-		gceCache: cache,
+		cfg:          cfg,
+		gceCache:     cache,
+		staleSecrets: staleSecrets,
 	}
 	return api
 }
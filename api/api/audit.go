@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+const auditUrn = "urn:arryved:audit"
+
+// Wraps a handler's ResponseWriter to capture the status it responds with, and records the request to the
+// audit log once the handler is done. Handlers fill in Target and Params as they learn them.
+type auditRecorder struct {
+	http.ResponseWriter
+	auditLog audit.Log
+	request  *http.Request
+	status   int
+	entry    audit.Entry
+}
+
+func startAudit(auditLog audit.Log, w http.ResponseWriter, r *http.Request, action config.Permission) *auditRecorder {
+	return &auditRecorder{
+		ResponseWriter: w,
+		auditLog:       auditLog,
+		request:        r,
+		entry: audit.Entry{
+			Action: action,
+			Params: map[string]string{},
+		},
+	}
+}
+
+func (a *auditRecorder) WriteHeader(status int) {
+	if a.status == 0 {
+		a.status = status
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *auditRecorder) Write(data []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	return a.ResponseWriter.Write(data)
+}
+
+// The authenticated principal; until set, the entry's principal is unknown
+func (a *auditRecorder) Principal(urn string) {
+	a.entry.Principal = urn
+}
+
+func (a *auditRecorder) Target(urn string) {
+	a.entry.Target = urn
+}
+
+func (a *auditRecorder) Param(key, value string) {
+	a.entry.Params[key] = value
+}
+
+// Append the entry; meant to be deferred right after startAudit
+func (a *auditRecorder) Commit() {
+	if a.auditLog == nil {
+		return
+	}
+	entry := a.entry
+	entry.Timestamp = time.Now().Unix()
+	if entry.Principal == "" {
+		// nothing's been verified, so the ID token's email claim is only recorded as a claim; anyone can make one
+		entry.Principal = "urn:arryved:user:unknown"
+		if email, ok := getClaims(a.request)["email"].(string); ok && email != "" {
+			entry.Params["claimedEmail"] = email
+		}
+	}
+	entry.Status = a.status
+	switch {
+	case a.status == http.StatusUnauthorized || a.status == http.StatusForbidden:
+		entry.Outcome = audit.Denied
+	case a.status >= 400 || a.status == 0:
+		entry.Outcome = audit.Failed
+	default:
+		entry.Outcome = audit.Success
+	}
+
+	// the request context may already be cancelled; the audit write shouldn't be
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.auditLog.Append(ctx, &entry); err != nil {
+		log.Errorf("could not append audit entry principal=%s action=%s target=%s outcome=%s err=%s",
+			entry.Principal, entry.Action, entry.Target, entry.Outcome, err.Error())
+	}
+}
+
+// GET /audit?principal=&action=&target=&outcome=&since=&until=; since/until are unix seconds
+func ConfiguredHandlerAudit(cfg *config.Config, auditLog audit.Log) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		httpStatus := http.StatusOK
+		log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+
+		if r.Method != http.MethodGet {
+			msg := fmt.Sprintf("%s not allowed for this endpoint", r.Method)
+			handleMethodNotAllowed(w, msg)
+			return
+		}
+
+		// user authenticated?
+		identity, err := authenticate(cfg, r)
+		if err != nil {
+			msg := fmt.Sprintf("user not authenticated: %s", err.Error())
+			handleUnauthorized(w, msg)
+			return
+		}
+
+		// user authorized to read the audit log?
+		if err := authorize(r.Context(), cfg, nil, identity, config.AuditRead, auditUrn); err != nil {
+			log.Infof("user not authorized for audit read err=%s", err.Error())
+			msg := fmt.Sprintf("user not authorized for audit read")
+			handleForbidden(w, msg)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := audit.Filter{
+			Principal: query.Get("principal"),
+			Action:    config.Permission(query.Get("action")),
+			Target:    query.Get("target"),
+			Outcome:   query.Get("outcome"),
+		}
+		for name, dest := range map[string]*int64{"since": &filter.Since, "until": &filter.Until} {
+			value := query.Get(name)
+			if value == "" {
+				continue
+			}
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				msg := fmt.Sprintf("invalid %s=%s; expected unix seconds", name, strings.ReplaceAll(value, "\"", ""))
+				handleBadRequest(w, msg)
+				return
+			}
+			*dest = parsed
+		}
+
+		entries, err := auditLog.List(r.Context())
+		if err != nil {
+			log.Errorf("error listing audit entries: %v", err.Error())
+			handleInternalServerError(w, fmt.Errorf("error listing audit entries; have the app administrator check the logs"))
+			return
+		}
+		matched := []*audit.Entry{}
+		for _, entry := range entries {
+			if filter.Match(entry) {
+				matched = append(matched, entry)
+			}
+		}
+
+		responseBody, err := json.Marshal(matched)
+		if err != nil {
+			log.Errorf("error marshaling response body: %v", err.Error())
+			handleInternalServerError(w, err)
+			return
+		}
+		w.WriteHeader(httpStatus)
+		w.Write(responseBody)
+	}
+}
@@ -0,0 +1,83 @@
+//go:build !integration
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/queue"
+)
+
+func TestMutatingActionsAreAudited(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	auditLog := audit.NewMemoryLog()
+	deployHandler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, queue.NewMemoryJobStore(), auditLog))
+	fake_token, err := generateFakeIDToken()
+	assert.NoError(err)
+
+	// one deploy that goes through, one against a cluster that doesn't exist
+	for _, uri := range []string{"/deploy/dev/arryved-api/central/default", "/deploy/dev/no-such-app/central/default"} {
+		body := bytes.NewBufferString(`{"concurrency": "1", "version": "0.1.1"}`)
+		req := httptest.NewRequest("POST", uri, body)
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fake_token))
+		deployHandler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// status reads aren't audited
+	deployHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/deploy/some-job-id", nil))
+
+	auditHandler := http.HandlerFunc(ConfiguredHandlerAudit(cfg, auditLog))
+	recorder := httptest.NewRecorder()
+	auditHandler.ServeHTTP(recorder, httptest.NewRequest("GET", "/audit?action=deploy", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	entries := []*audit.Entry{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(entries, 2)
+	assert.NoError(audit.Verify(entries))
+
+	assert.Equal("urn:arryved:user:mockuser@example.com", entries[0].Principal)
+	assert.Equal("urn:arryved:app:arryved-api", entries[0].Target)
+	assert.Equal(audit.Success, entries[0].Outcome)
+	assert.Equal("deploy", entries[0].Params["operation"])
+	assert.Equal("0.1.1", entries[0].Params["version"])
+	assert.NotEmpty(entries[0].Params["jobId"])
+	assert.Equal(audit.Failed, entries[1].Outcome)
+	assert.Equal(http.StatusNotFound, entries[1].Status)
+
+	// filters narrow the result
+	recorder = httptest.NewRecorder()
+	auditHandler.ServeHTTP(recorder, httptest.NewRequest("GET", "/audit?outcome=failed", nil))
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(entries, 1)
+	assert.Equal("urn:arryved:app:no-such-app", entries[0].Target)
+
+	recorder = httptest.NewRecorder()
+	auditHandler.ServeHTTP(recorder, httptest.NewRequest("GET", "/audit?since=yesterday", nil))
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+
+	// a token that can't be verified doesn't get to name the principal
+	cfg.AuthnEnabled = true
+	cfg.OIDC.Issuers = []string{"https://issuer.example.com"}
+	req := httptest.NewRequest("POST", "/deploy/dev/arryved-api/central/default", bytes.NewBufferString(`{"concurrency": "1", "version": "0.1.1"}`))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fake_token))
+	recorder = httptest.NewRecorder()
+	deployHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+	cfg.AuthnEnabled = false
+	recorder = httptest.NewRecorder()
+	auditHandler.ServeHTTP(recorder, httptest.NewRequest("GET", "/audit?outcome=denied", nil))
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(entries, 1)
+	assert.Equal("urn:arryved:user:unknown", entries[0].Principal)
+	assert.Equal("mockuser@example.com", entries[0].Params["claimedEmail"])
+}
@@ -9,68 +9,131 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/coreos/go-oidc"
-
 	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/rbac"
+	"github.com/arryved/app-ctrl/api/rbac/utility"
+	"github.com/arryved/app-ctrl/api/tokens"
 )
 
-func authenticated(cfg *config.Config, r *http.Request) bool {
+// where API tokens are looked up; Start swaps in the configured store
+var tokenStore tokens.Store = tokens.NewMemoryStore()
+
+// context key for passing the outcome of authenticating a request along with it, so it's only verified once
+const AuthnKey = "authn"
+
+type authnResult struct {
+	identity model.Identity
+	err      error
+}
+
+// Verifies the caller of a request and returns who they are. Callers present either an API token or an ID token
+// as a bearer token, or, without an Authorization header, a client cert (mTLS). With authn disabled, ID tokens
+// aren't verified, and their claims are taken as-is (if any); API tokens and client certs are always verified.
+// A request that's already been through withAuthentication isn't verified again.
+func authenticate(cfg *config.Config, r *http.Request) (model.Identity, error) {
+	if result, ok := r.Context().Value(AuthnKey).(authnResult); ok {
+		return result.identity, result.err
+	}
+	return verifyCaller(cfg, r)
+}
+
+// Authenticates r and carries the outcome along in the returned request's context, for authenticate further down
+func withAuthentication(cfg *config.Config, r *http.Request) (*http.Request, model.Identity, error) {
+	identity, err := authenticate(cfg, r)
+	ctx := context.WithValue(r.Context(), AuthnKey, authnResult{identity: identity, err: err})
+	return r.WithContext(ctx), identity, err
+}
+
+func verifyCaller(cfg *config.Config, r *http.Request) (model.Identity, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return certIdentity(r.Context(), cfg, r.TLS)
+	}
+	authValue := strings.Split(authHeader, "Bearer")
+	if len(authValue) >= 2 && tokens.IsToken(strings.TrimSpace(authValue[1])) {
+		return tokenIdentity(r.Context(), cfg, strings.TrimSpace(authValue[1]))
+	}
+
 	if !cfg.AuthnEnabled {
 		log.Warnf("Authentication disabled, no login is required!")
-		return true
+		return requestIdentity(r.Context(), cfg, getClaims(r)), nil
 	}
-	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		log.Warnf("Authorization header missing")
-		return false
+		return model.Identity{}, fmt.Errorf("authorization header missing")
 	}
-
-	authValue := strings.Split(authHeader, "Bearer")
 	if len(authValue) < 2 {
 		log.Warnf("Authorization header value not in correct format for bearer token")
-		return false
+		return model.Identity{}, fmt.Errorf("authorization header is not a bearer token")
 	}
 
 	idToken := strings.TrimSpace(authValue[1])
-	claims, err := parseGoogleIDToken(idToken)
+	claims, err := verifyIDToken(r.Context(), cfg.OIDC, idToken)
 	if err != nil {
-		log.Warnf("Authorization header token value could not be parsed err=%s", err.Error())
-		return false
+		log.Warnf("Authorization header token value could not be verified err=%s", err.Error())
+		return model.Identity{}, err
 	}
 
 	log.Debugf("claims=%v", claims)
-	return true
+	return requestIdentity(r.Context(), cfg, claims), nil
 }
 
-func parseGoogleIDToken(token string) (map[string]interface{}, error) {
-	ctx := context.Background()
-
-	// Set up the OIDC provider using Google's endpoints
-	provider, err := oidc.NewProvider(ctx, "https://accounts.google.com")
-	if err != nil {
-		return nil, fmt.Errorf("Failed to get provider: %s", err.Error())
+// Builds the Identity an action is attributed to from ID token claims
+func requestIdentity(ctx context.Context, cfg *config.Config, claims map[string]interface{}) model.Identity {
+	identity := model.Identity{
+		Email:      "unknown",
+		AuthMethod: model.AuthMethodOIDC,
 	}
+	if !cfg.AuthnEnabled {
+		identity.AuthMethod = model.AuthMethodNone
+	}
+	if email, ok := claims["email"].(string); ok && email != "" {
+		identity.Email = email
+	}
+	identity.Groups = groupsOf(ctx, cfg, identity.PrincipalUrn())
+	return identity
+}
 
-	decoded := decodeIDToken(token)
-
-	// Configure an ID token verifier using the provider and the client ID
-	verifier := provider.Verifier(&oidc.Config{
-		ClientID: decoded["aud"].(string),
-	})
-
-	// Parse and verify the ID token
-	tokenObj, err := verifier.Verify(ctx, token)
+// Builds the Identity for an API token, if it checks out
+func tokenIdentity(ctx context.Context, cfg *config.Config, secret string) (model.Identity, error) {
+	token, err := tokens.Verify(ctx, tokenStore, secret)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to verify ID token: %s", err.Error())
+		// reminder: do not log the token value
+		log.Warnf("API token could not be verified err=%s", err.Error())
+		return model.Identity{}, err
+	}
+	identity := model.Identity{
+		Urn:         string(token.Principal),
+		Groups:      groupsOf(ctx, cfg, string(token.Principal)),
+		AuthMethod:  model.AuthMethodToken,
+		TokenId:     token.Id,
+		Permissions: []string{},
+		Targets:     token.Targets,
+	}
+	for _, permission := range token.Permissions {
+		identity.Permissions = append(identity.Permissions, string(permission))
 	}
+	log.Debugf("API token id=%s verified for principal=%s", token.Id, token.Principal)
+	return identity, nil
+}
 
-	// Extract the claims
-	var claims map[string]interface{}
-	if err := tokenObj.Claims(&claims); err != nil {
-		return nil, fmt.Errorf("Failed to extract claims: %s", err.Error())
+// the groups principal is a member of, per the group resolver
+func groupsOf(ctx context.Context, cfg *config.Config, principal string) []string {
+	groups := []string{}
+	for _, group := range utility.GroupsOf(ctx, cfg, config.PrincipalUrn(principal)) {
+		groups = append(groups, string(group))
 	}
+	return groups
+}
 
-	return claims, nil
+// Checks that action on target is within the identity's (API token) scope, then asks RBAC as for anyone else
+func authorize(ctx context.Context, cfg *config.Config, client interface{}, identity model.Identity,
+	action config.Permission, target string) error {
+	if !identity.InScope(string(action), target) {
+		return fmt.Errorf("not in token scope principal=%s action=%s target=%s", identity.PrincipalUrn(), action, target)
+	}
+	return rbac.Authorized(ctx, cfg, client, config.PrincipalUrn(identity.PrincipalUrn()), action, target)
 }
 
 func decodeIDToken(idToken string) map[string]interface{} {
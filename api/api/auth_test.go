@@ -94,7 +94,8 @@ func TestAuthenticated(t *testing.T) {
 	req := httptest.NewRequest("GET", "/", nil)
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fake_token))
 
-	result := authenticated(cfg, req)
+	// mock config allows no audiences, so nothing gets in; no network needed to find that out
+	_, err = authenticate(cfg, req)
 
-	assert.False(result)
+	assert.EqualError(err, "no audiences configured")
 }
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/rbac"
+	"github.com/arryved/app-ctrl/api/rbac/utility"
+	"github.com/arryved/app-ctrl/api/secrets"
+)
+
+// Who the caller is, as authorization sees them
+type WhoamiResponse struct {
+	Principal   string        `json:"principal"`
+	Email       string        `json:"email,omitempty"` // logged-in users only
+	AuthMethod  string        `json:"authMethod"`
+	Groups      []string      `json:"groups"`
+	Roles       []config.Role `json:"roles"`
+	TokenId     string        `json:"tokenId,omitempty"`     // API tokens only
+	Permissions []string      `json:"permissions,omitempty"` // API tokens only: the token's scope
+	Targets     []string      `json:"targets,omitempty"`     // API tokens only: the token's scope
+}
+
+// Body format for an authorization check; env is required for secret targets (it picks the project), and
+// qualifies other targets the way the deploy/restart/rollback handlers do
+type AuthzCheckRequest struct {
+	Action config.Permission `json:"action"`
+	Target string            `json:"target"` // e.g. urn:arryved:app:arryved-api or urn:arryved:secret:db-password
+	Env    string            `json:"env"`
+}
+
+// The decision for the caller, and what it was based on
+type AuthzCheckResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"` // why not, when not allowed
+	rbac.Explanation
+}
+
+// GET /whoami
+func ConfiguredHandlerWhoami(cfg *config.Config) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		httpStatus := http.StatusOK
+		log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+
+		if r.Method != http.MethodGet {
+			msg := fmt.Sprintf("%s not allowed for this endpoint", r.Method)
+			handleMethodNotAllowed(w, msg)
+			return
+		}
+
+		// user authenticated?
+		identity, err := authenticate(cfg, r)
+		if err != nil {
+			msg := fmt.Sprintf("user not authenticated: %s", err.Error())
+			handleUnauthorized(w, msg)
+			return
+		}
+
+		response := WhoamiResponse{
+			Principal:   identity.PrincipalUrn(),
+			Email:       identity.Email,
+			AuthMethod:  identity.AuthMethod,
+			Groups:      identity.Groups,
+			Roles:       utility.RolesOf(r.Context(), cfg, config.PrincipalUrn(identity.PrincipalUrn())),
+			TokenId:     identity.TokenId,
+			Permissions: identity.Permissions,
+			Targets:     identity.Targets,
+		}
+		responseBody, err := json.Marshal(response)
+		if err != nil {
+			log.Errorf("error marshaling response body: %v", err.Error())
+			handleInternalServerError(w, err)
+			return
+		}
+		w.WriteHeader(httpStatus)
+		w.Write(responseBody)
+	}
+}
+
+// POST /authz/check; the decision comes from the same authorize call the handlers make
+func ConfiguredHandlerAuthzCheck(cfg *config.Config) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		httpStatus := http.StatusOK
+		log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+
+		if r.Method != http.MethodPost {
+			msg := fmt.Sprintf("%s not allowed for this endpoint", r.Method)
+			handleMethodNotAllowed(w, msg)
+			return
+		}
+
+		// user authenticated?
+		identity, err := authenticate(cfg, r)
+		if err != nil {
+			msg := fmt.Sprintf("user not authenticated: %s", err.Error())
+			handleUnauthorized(w, msg)
+			return
+		}
+
+		var requestBody AuthzCheckRequest
+		err = json.NewDecoder(r.Body).Decode(&requestBody)
+		if err != nil || requestBody.Action == "" || requestBody.Target == "" {
+			msg := fmt.Sprintf("invalid request body; action and target are required")
+			log.Infof(msg)
+			handleBadRequest(w, msg)
+			return
+		}
+		if requestBody.Env != "" {
+			if _, ok := envsFromConfig(cfg)[requestBody.Env]; !ok {
+				msg := fmt.Sprintf("requested env=%s not supported by this instance", requestBody.Env)
+				handleBadRequest(w, msg)
+				return
+			}
+		}
+
+		ctx := r.Context()
+		target := requestBody.Target
+		var client interface{}
+		if strings.HasPrefix(target, "urn:arryved:secret") {
+			// secret ownership lives in the env's secret store, as for the secrets handler
+			if requestBody.Env == "" {
+				handleBadRequest(w, "env is required for secret targets")
+				return
+			}
+			ctx = context.WithValue(ctx, IdentityKey, identity)
+			ctx = context.WithValue(ctx, EnvKey, requestBody.Env)
+			store, err := secrets.NewEnvStore(ctx, cfg, requestBody.Env)
+			if err != nil {
+				log.Errorf("error getting a secret store: err=%s", err.Error())
+				handleInternalServerError(w, fmt.Errorf("error checking authorization; have the app administrator check the logs"))
+				return
+			}
+			defer store.Close()
+			client = store
+		} else if requestBody.Env != "" && !strings.HasPrefix(target, "urn:arryved:env:") {
+			target = config.EnvUrn(requestBody.Env, target)
+		}
+
+		response := AuthzCheckResponse{Allowed: true}
+		if err := authorize(ctx, cfg, client, identity, requestBody.Action, target); err != nil {
+			response.Allowed = false
+			response.Reason = err.Error()
+		}
+		response.Explanation, err = rbac.Explain(ctx, cfg, client, config.PrincipalUrn(identity.PrincipalUrn()), requestBody.Action, target)
+		if err != nil {
+			if strings.Contains(err.Error(), "NotFound") {
+				handleNotFound(w, "could not find the target secret")
+				return
+			}
+			log.Errorf("error explaining authorization: err=%s", err.Error())
+			handleInternalServerError(w, fmt.Errorf("error checking authorization; have the app administrator check the logs"))
+			return
+		}
+
+		responseBody, err := json.Marshal(response)
+		if err != nil {
+			log.Errorf("error marshaling response body: %v", err.Error())
+			handleInternalServerError(w, err)
+			return
+		}
+		w.WriteHeader(httpStatus)
+		w.Write(responseBody)
+	}
+}
@@ -0,0 +1,101 @@
+//go:build !integration
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// mock config, with RBAC on and mockuser@example.com a developer who may deploy pay-* apart from pay-ledger in dev
+func authzConfig() *config.Config {
+	cfg := config.Load("../config/mock-config.yml")
+	cfg.RBACEnabled = true
+	cfg.UsersByGroups["urn:arryved:group:devs@example.com"] = []config.PrincipalUrn{"urn:arryved:user:mockuser@example.com"}
+	cfg.RoleMemberships["developer"] = append(cfg.RoleMemberships["developer"], "urn:arryved:group:devs@example.com")
+	cfg.AccessEntries = []config.AccessEntry{
+		{Role: "developer", Permission: config.Deploy, Target: "urn:arryved:app:pay-*", Effect: config.Allow},
+		{Role: "developer", Permission: config.Deploy, Target: "urn:arryved:env:dev:app:pay-ledger", Effect: config.Deny},
+		{Role: "operator", Permission: config.Deploy, Target: "*", Effect: config.Allow},
+	}
+	return cfg
+}
+
+func TestWhoami(t *testing.T) {
+	assert := assert.New(t)
+	cfg := authzConfig()
+	handler := http.HandlerFunc(ConfiguredHandlerWhoami(cfg))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+
+	req := httptest.NewRequest("GET", "/whoami", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code)
+	response := WhoamiResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal("urn:arryved:user:mockuser@example.com", response.Principal)
+	assert.Equal("mockuser@example.com", response.Email)
+	assert.Equal([]string{"urn:arryved:group:devs@example.com"}, response.Groups)
+	assert.Equal([]config.Role{"developer"}, response.Roles)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/whoami", nil))
+	assert.Equal(http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestAuthzCheck(t *testing.T) {
+	assert := assert.New(t)
+	cfg := authzConfig()
+	handler := http.HandlerFunc(ConfiguredHandlerAuthzCheck(cfg))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+	check := func(body string) (int, AuthzCheckResponse) {
+		req := httptest.NewRequest("POST", "/authz/check", bytes.NewBufferString(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		response := AuthzCheckResponse{}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response
+	}
+
+	// allowed, and by which entry
+	code, response := check(`{"action": "deploy", "target": "urn:arryved:app:pay-api", "env": "dev"}`)
+	assert.Equal(http.StatusOK, code)
+	assert.True(response.Allowed)
+	assert.Equal("urn:arryved:env:dev:app:pay-api", response.Target)
+	assert.Equal([]config.Role{"developer"}, response.Roles)
+	assert.Equal([]config.AccessEntry{cfg.AccessEntries[0]}, response.Entries)
+
+	// denied, showing the deny alongside the allow it beat
+	code, response = check(`{"action": "deploy", "target": "urn:arryved:app:pay-ledger", "env": "dev"}`)
+	assert.Equal(http.StatusOK, code)
+	assert.False(response.Allowed)
+	assert.Contains(response.Reason, "denied")
+	assert.Equal([]config.AccessEntry{cfg.AccessEntries[0], cfg.AccessEntries[1]}, response.Entries)
+
+	// nothing matching at all
+	code, response = check(`{"action": "deploy", "target": "urn:arryved:app:ledger", "env": "dev"}`)
+	assert.Equal(http.StatusOK, code)
+	assert.False(response.Allowed)
+	assert.Contains(response.Reason, "not authorized")
+	assert.Empty(response.Entries)
+
+	// bad requests
+	code, _ = check(`{"action": "deploy"}`)
+	assert.Equal(http.StatusBadRequest, code)
+	code, _ = check(`{"action": "deploy", "target": "urn:arryved:app:pay-api", "env": "nowhere"}`)
+	assert.Equal(http.StatusBadRequest, code)
+	code, _ = check(`{"action": "secretsUpdate", "target": "urn:arryved:secret:db-password"}`)
+	assert.Equal(http.StatusBadRequest, code)
+}
@@ -2,22 +2,25 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/arryved/app-ctrl/api/audit"
 	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
 	"github.com/arryved/app-ctrl/api/queue"
-	"github.com/arryved/app-ctrl/api/rbac"
 	"github.com/arryved/app-ctrl/api/runners"
 )
 
 type DeployRequest struct {
 	Concurrency string `json:"concurrency"`
-	Principal   string `json:"principal"`
+	Principal   string `json:"principal"` // optional; if given, must match the authenticated principal
 	Version     string `json:"version"`
+	DryRun      bool   `json:"dryRun"` // if set, return a DeployPlan instead of enqueuing
 }
 
 type DeployResponse struct {
@@ -25,119 +28,154 @@ type DeployResponse struct {
 	Message  string `json:"message"`  // message is either of success or failure
 }
 
-func ConfiguredHandlerDeploy(cfg *config.Config, gceCache *runners.GCECache, jobQueue *queue.Queue) func(http.ResponseWriter, *http.Request) {
+func ConfiguredHandlerDeploy(cfg *config.Config, gceCache *runners.GCECache, jobQueue *queue.Queue, jobStore queue.JobStore, auditLog audit.Log) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		httpStatus := http.StatusOK
 		log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
 
-		if r.Method != http.MethodPost {
-			msg := fmt.Sprintf("%s not allowed for this endpoint", r.Method)
-			handleMethodNotAllowed(w, msg)
+		if r.Method == http.MethodGet {
+			JobStatus(cfg, jobStore, w, r)
 			return
 		}
 
-		// user authenticated?
-		if !authenticated(cfg, r) {
-			msg := fmt.Sprintf("user not authenticated")
-			handleUnauthorized(w, msg)
+		if r.Method != http.MethodPost {
+			msg := fmt.Sprintf("%s not allowed for this endpoint", r.Method)
+			handleMethodNotAllowed(w, msg)
 			return
 		}
-		claims := getClaims(r)
-		log.Debugf("claims=%v", claims)
 
-		// parse the POST json request body (via r *http.Request) into a DeployRequest
 		var requestBody DeployRequest
-		err := json.NewDecoder(r.Body).Decode(&requestBody)
-		if err != nil {
-			msg := fmt.Sprintf("invalid request body: %s", r.URL)
-			log.Infof(msg)
-			handleBadRequest(w, msg)
-			return
-		}
-		log.Debugf("body=%v", requestBody)
-
-		urlElements := strings.Split(r.URL.String(), "/")
-		if len(urlElements) != 6 {
-			msg := fmt.Sprintf("invalid request path: %s", r.URL)
-			log.Infof(msg)
-			handleBadRequest(w, msg)
-			return
-		}
-
-		env := urlElements[2]
-		app := urlElements[3]
-		region := urlElements[4]
-		variant := urlElements[5]
-		clusterId := config.ClusterId{
-			App:     app,
-			Region:  region,
-			Variant: variant,
-		}
+		submitJob(cfg, gceCache, jobQueue, jobStore, auditLog, w, r, jobSubmission{
+			operation:  "deploy",
+			permission: config.Deploy,
+			body:       &requestBody,
+			accept: func(identity model.Identity, auditEntry *auditRecorder) error {
+				auditEntry.Param("version", requestBody.Version)
+				auditEntry.Param("concurrency", requestBody.Concurrency)
+				// the job is attributed to the authenticated user; a body principal can't claim to be someone else
+				if requestBody.Principal != "" && requestBody.Principal != identity.Name() {
+					log.Infof("body principal=%s does not match authenticated principal=%s", requestBody.Principal, identity.Name())
+					return errors.New("principal does not match authenticated user")
+				}
+				return nil
+			},
+			request: func(w http.ResponseWriter, r *http.Request, auditEntry *auditRecorder, env string, cluster *config.Cluster) queue.JobRequest {
+				if !requestBody.DryRun {
+					return queue.DeployJobRequest{
+						Cluster:     *cluster,
+						Concurrency: requestBody.Concurrency,
+						Version:     requestBody.Version,
+					}
+				}
+
+				// plan only
+				auditEntry.Param("dryRun", "true")
+				plan, err := planDeploy(r.Context(), newArtifactChecker(cfg), env, cluster, requestBody.Version, requestBody.Concurrency)
+				if err != nil {
+					log.Infof("could not plan deploy for cluster id=%v err=%s", cluster.Id, err.Error())
+					handleBadRequest(w, err.Error())
+					return nil
+				}
+				responseBody, err := json.Marshal(plan)
+				if err != nil {
+					log.Errorf("error marshaling response body: %v", err.Error())
+					handleInternalServerError(w, err)
+					return nil
+				}
+				w.WriteHeader(http.StatusOK)
+				w.Write(responseBody)
+				return nil
+			},
+			response: func(job *queue.Job) interface{} {
+				return DeployResponse{
+					DeployId: job.Id,
+					Message:  "deploy job enqueued",
+				}
+			},
+		})
+	}
+}
 
-		// user authorized for action on target?
-		// TODO replace w/ claims results
-		principalUrn := config.PrincipalUrn(fmt.Sprintf("urn:arryved:user:%s", claims["email"]))
-		appUrn := fmt.Sprintf("urn:arryved:app:%s", app)
-		if err := rbac.Authorized(r.Context(), cfg, nil, principalUrn, config.Deploy, appUrn); err != nil {
-			log.Infof("user not authorized for deploy action err=%s", err.Error())
-			msg := fmt.Sprintf("user not authorized for deploy action")
-			handleForbidden(w, msg)
-			return
-		}
-		log.Debugf("Authorization granted for principal=%v, action=Deploy, app=%v", principalUrn, appUrn)
+// GET /{action}/{jobId}; reports the recorded state of a job
+func JobStatus(cfg *config.Config, jobStore queue.JobStore, w http.ResponseWriter, r *http.Request) {
+	urlElements := strings.Split(r.URL.Path, "/")
+	if len(urlElements) == 4 && urlElements[3] == "events" {
+		JobEvents(cfg, jobStore, w, r)
+		return
+	}
+	if len(urlElements) != 3 || urlElements[2] == "" {
+		msg := fmt.Sprintf("invalid request path: %s", r.URL)
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+	record, ok := authorizedJobRecord(cfg, jobStore, w, r, urlElements[1], urlElements[2])
+	if !ok {
+		return
+	}
 
-		// if no such cluster, return 404
-		cluster, err := findClusterById(cfg, gceCache, env, clusterId)
-		if err != nil {
-			log.Errorf("error fetching cluster status, cannot submit deploy: %v", err.Error())
-			handleInternalServerError(w, err)
-			return
-		}
-		if cluster == nil {
-			msg := fmt.Sprintf("no such cluster matching id=%v", clusterId)
-			log.Infof(msg)
-			handleNotFound(w, msg)
-			return
-		}
+	responseBody, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("error marshaling response body: %v", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	log.Debugf("response body=%s", string(responseBody))
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
 
-		// enqueue the job onto a job queue for worker pickup
-		job, err := queue.NewJob(requestBody.Principal, queue.DeployJobRequest{
-			Cluster:     *cluster,
-			Concurrency: requestBody.Concurrency,
-			Version:     requestBody.Version,
-		})
-		if err != nil {
-			log.Errorf("error creating new job request, cannot submit deploy: %v", err.Error())
-			handleInternalServerError(w, err)
-			return
-		}
+// the permission a job record's action was authorized with; rollbacks are deploys of an older version
+var jobPermissions = map[string]config.Permission{
+	"DEPLOY":   config.Deploy,
+	"RESTART":  config.Restart,
+	"ROLLBACK": config.Deploy,
+}
 
-		if jobQueue != nil {
-			pubid, err := jobQueue.Enqueue(job)
-			if err != nil {
-				log.Errorf("error enqueing deploy job error=%s", err.Error())
-				handleInternalServerError(w, err)
-				return
-			}
-			log.Infof("enqueued job jobid=%s pubid=%s", job.Id, pubid)
-		} else {
-			log.Warnf("job *not* enqueued since no jobQueue available id=%s", job.Id)
-		}
+// Fetch a job record for GET /{action}/{jobId}[/events], if the caller could have started the job: they need the
+// job's permission on its app in its env (so a token scoped to one app only sees that app's jobs), and the record
+// has to be of the route's action. Otherwise the response has been written and ok is false.
+func authorizedJobRecord(cfg *config.Config, jobStore queue.JobStore, w http.ResponseWriter, r *http.Request,
+	route, jobId string) (*queue.JobRecord, bool) {
+	// user authenticated?
+	identity, err := authenticate(cfg, r)
+	if err != nil {
+		msg := fmt.Sprintf("user not authenticated: %s", err.Error())
+		handleUnauthorized(w, msg)
+		return nil, false
+	}
 
-		// TODO get the id and set a reasonable message
-		responseBody, err := json.Marshal(DeployResponse{
-			DeployId: job.Id,
-			Message:  "deploy job enqueued",
-		})
-		if err != nil {
-			log.Errorf("error marshaling response body: %v", err.Error())
-			handleInternalServerError(w, err)
-			return
-		}
+	msg := fmt.Sprintf("no job record for id=%s", jobId)
+	if jobStore == nil {
+		handleNotFound(w, msg)
+		return nil, false
+	}
+	record, err := jobStore.Get(r.Context(), jobId)
+	if errors.Is(err, queue.ErrJobNotFound) {
+		log.Infof(msg)
+		handleNotFound(w, msg)
+		return nil, false
+	}
+	if err != nil {
+		log.Errorf("error fetching job record id=%s: %v", jobId, err.Error())
+		handleInternalServerError(w, err)
+		return nil, false
+	}
+	// a job of another action is as good as missing from this route
+	permission, known := jobPermissions[record.Action]
+	if !known || record.Action != strings.ToUpper(route) {
+		log.Infof("job id=%s action=%s requested through route=%s", jobId, record.Action, route)
+		handleNotFound(w, msg)
+		return nil, false
+	}
 
-		log.Debugf("response body=%v", responseBody)
-		w.WriteHeader(httpStatus)
-		w.Write(responseBody)
+	// user authorized for the job's action on its app?
+	appUrn := fmt.Sprintf("urn:arryved:app:%s", record.Cluster.App)
+	if err := authorize(r.Context(), cfg, nil, identity, permission, config.EnvUrn(record.Env, appUrn)); err != nil {
+		log.Infof("user not authorized to view job id=%s err=%s", jobId, err.Error())
+		handleForbidden(w, fmt.Sprintf("user not authorized for %s jobs on app=%s", route, record.Cluster.App))
+		return nil, false
 	}
+	return record, true
 }
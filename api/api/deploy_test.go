@@ -4,6 +4,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,6 +16,8 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/queue"
 )
 
 func TestSubmitAndObtainDeployId(t *testing.T) {
@@ -25,11 +28,12 @@ func TestSubmitAndObtainDeployId(t *testing.T) {
 
 	// set up interaction request and recorder for deploy handler
 	recorder := httptest.NewRecorder()
-	handler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil))
+	jobStore := queue.NewMemoryJobStore()
+	handler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
 	requestBody := DeployRequest{
 		Concurrency: "1",
 		Version:     "0.1.0",
-		Principal:   "example@arryved.com",
+		Principal:   "mockuser@example.com",
 	}
 	bodyBytes, err := json.Marshal(requestBody)
 	if err != nil {
@@ -56,6 +60,75 @@ func TestSubmitAndObtainDeployId(t *testing.T) {
 	assert.Equal("deploy job enqueued", response.Message)
 	_, err = uuid.Parse(response.DeployId)
 	assert.Nil(err)
+
+	// the submitted job is recorded as queued
+	record, err := jobStore.Get(req.Context(), response.DeployId)
+	assert.NoError(err)
+	assert.Equal(queue.JobQueued, record.State)
+	assert.Equal("dev", record.Env)
+	assert.Equal("0.1.0", record.Version)
+	assert.Equal("arryved-api", record.Cluster.App)
+
+	// attributed to the token's principal, not whatever the body says
+	assert.Equal("mockuser@example.com", record.Principal)
+	assert.Equal("mockuser@example.com", record.Identity.Email)
+	assert.Equal(model.AuthMethodNone, record.Identity.AuthMethod)
+}
+
+func TestDeployRejectsMismatchedPrincipal(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	jobStore := queue.NewMemoryJobStore()
+	handler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
+
+	bodyBytes, err := json.Marshal(DeployRequest{
+		Concurrency: "1",
+		Version:     "0.1.0",
+		Principal:   "someoneelse@example.com",
+	})
+	assert.NoError(err)
+	fake_token, err := generateFakeIDToken()
+	assert.NoError(err)
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/deploy/dev/arryved-api/central/default", bytes.NewBuffer(bodyBytes))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fake_token))
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(http.StatusForbidden, recorder.Code)
+	records, err := jobStore.List(context.Background())
+	assert.NoError(err)
+	assert.Len(records, 0)
 }
 
-// TODO - check to see that jobs submitted for an app already being acted on are rejected
+func TestDeployStatus(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	jobStore := queue.NewMemoryJobStore()
+	handler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
+
+	record := &queue.JobRecord{
+		Id:     "5d6e1c3a-0f0e-4a4b-9a55-3f0f3a1b2c3d",
+		Action: "DEPLOY",
+		State:  queue.JobFailed,
+		Hosts: map[string]*queue.HostResult{
+			"dev-api.dev.arryved.com": {Code: 500, Err: "apt update failed"},
+		},
+	}
+	assert.NoError(jobStore.Put(context.Background(), record))
+
+	// known job
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/deploy/"+record.Id, nil)
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code)
+	result := queue.JobRecord{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal(queue.JobFailed, result.State)
+	assert.Equal(500, result.Hosts["dev-api.dev.arryved.com"].Code)
+
+	// unknown job
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/deploy/no-such-job", nil)
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/queue"
+)
+
+// how often the job record is re-read for new events while streaming
+var eventPollInterval = time.Second
+
+// how often a comment line is sent to keep idle proxies from dropping the stream
+const eventKeepaliveInterval = 15 * time.Second
+
+// GET /{action}/{jobId}/events; streams the job's progress events as Server-Sent Events until the job is done.
+// Reconnecting clients can send Last-Event-ID to resume after the last event they saw.
+func JobEvents(cfg *config.Config, jobStore queue.JobStore, w http.ResponseWriter, r *http.Request) {
+	urlElements := strings.Split(r.URL.Path, "/")
+	jobId := urlElements[2]
+	record, ok := authorizedJobRecord(cfg, jobStore, w, r, urlElements[1], jobId)
+	if !ok {
+		return
+	}
+
+	lastSeq := 0
+	if lastEventId := r.Header.Get("Last-Event-ID"); lastEventId != "" {
+		var err error
+		lastSeq, err = strconv.Atoi(lastEventId)
+		if err != nil {
+			msg := fmt.Sprintf("invalid Last-Event-ID=%s", strings.ReplaceAll(lastEventId, "\"", ""))
+			handleBadRequest(w, msg)
+			return
+		}
+	}
+
+	// streams outlive the listener's write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debugf("could not clear write deadline for event stream err=%s", err.Error())
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+	lastWrite := time.Now()
+	for {
+		for _, event := range record.Events {
+			if event.Seq <= lastSeq {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Errorf("error marshaling job event id=%s seq=%d err=%s", jobId, event.Seq, err.Error())
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+			lastSeq = event.Seq
+			lastWrite = time.Now()
+		}
+		if record.State.Done() {
+			controller.Flush()
+			return
+		}
+		if time.Since(lastWrite) >= eventKeepaliveInterval {
+			fmt.Fprint(w, ": keepalive\n\n")
+			lastWrite = time.Now()
+		}
+		if err := controller.Flush(); err != nil {
+			log.Debugf("event stream closed id=%s err=%s", jobId, err.Error())
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		updated, err := jobStore.Get(r.Context(), jobId)
+		if err != nil {
+			log.Warnf("could not refresh job record for event stream id=%s err=%s", jobId, err.Error())
+			continue
+		}
+		record = updated
+	}
+}
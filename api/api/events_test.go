@@ -0,0 +1,68 @@
+//go:build !integration
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/queue"
+)
+
+func TestJobEventsStream(t *testing.T) {
+	assert := assert.New(t)
+	eventPollInterval = 10 * time.Millisecond
+	cfg := config.Load("../config/mock-config.yml")
+	ctx := context.Background()
+
+	jobStore := queue.NewMemoryJobStore()
+	record := &queue.JobRecord{Id: "job-1", Action: "DEPLOY", State: queue.JobQueued, Hosts: map[string]*queue.HostResult{}}
+	record.MarkRunning()
+	record.AddEvent(queue.JobEvent{Type: queue.EventBatchStart, Batch: 1, Hosts: []string{"host-1"}})
+	jobStore.Put(ctx, record)
+
+	// the worker finishes the job while the stream is open
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		jobStore.Update(ctx, "job-1", func(r *queue.JobRecord) error {
+			r.AddEvent(queue.JobEvent{Type: queue.EventHostFinish, Host: "host-1", Code: 500, Err: "unhealthy"})
+			r.MarkComplete(errors.New("deploy failed on 1 of 1 instances: host-1"))
+			return nil
+		})
+	}()
+
+	handler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/deploy/job-1/events", nil))
+
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Equal("text/event-stream", recorder.Header().Get("Content-Type"))
+	body := recorder.Body.String()
+	assert.Equal(4, strings.Count(body, "\n\n"))
+	assert.Contains(body, "id: 1\nevent: running\n")
+	assert.Contains(body, "id: 2\nevent: batch_start\n")
+	assert.Contains(body, `"host":"host-1","code":500,"err":"unhealthy"`)
+	assert.Contains(body, "id: 4\nevent: complete\n")
+	assert.Contains(body, `"state":"FAILED"`)
+
+	// resuming only replays what was missed
+	req := httptest.NewRequest("GET", "/deploy/job-1/events", nil)
+	req.Header.Set("Last-Event-ID", "3")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(1, strings.Count(recorder.Body.String(), "\n\n"))
+	assert.Contains(recorder.Body.String(), "event: complete")
+
+	// unknown job
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/deploy/nope/events", nil))
+	assert.Equal(http.StatusNotFound, recorder.Code)
+}
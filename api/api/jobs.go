@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/metrics"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/queue"
+	"github.com/arryved/app-ctrl/api/runners"
+)
+
+// The parts of a job submission that differ by action; submitJob does the rest
+type jobSubmission struct {
+	operation  string            // deploy, restart or rollback; audited, and used in logs and messages
+	permission config.Permission // needed on the app in the env; also the audited action
+	body       interface{}       // the request body is decoded into this
+	uncapped   bool              // not held to the cluster's in-flight cap (the env's still applies)
+
+	// checks the decoded body against the caller and audits its params; an error is a 403
+	accept func(identity model.Identity, auditEntry *auditRecorder) error
+	// the job request for cluster; it may respond itself and return nil to stop short of enqueuing (e.g. a dry run)
+	request func(w http.ResponseWriter, r *http.Request, auditEntry *auditRecorder, env string, cluster *config.Cluster) queue.JobRequest
+	// the response body for the enqueued job
+	response func(job *queue.Job) interface{}
+}
+
+// POST /{action}/{env}/{app}/{region}/{variant}; audits, authenticates and authorizes the submission, then records
+// and enqueues the job the submission builds for the cluster, within the in-flight caps
+func submitJob(cfg *config.Config, gceCache *runners.GCECache, jobQueue *queue.Queue, jobStore queue.JobStore,
+	auditLog audit.Log, w http.ResponseWriter, r *http.Request, submission jobSubmission) {
+	// every attempt at a mutating action is audited, whatever the outcome
+	auditEntry := startAudit(auditLog, w, r, submission.permission)
+	defer auditEntry.Commit()
+	auditEntry.Param("operation", submission.operation)
+	w = auditEntry
+
+	// user authenticated?
+	identity, err := authenticate(cfg, r)
+	if err != nil {
+		msg := fmt.Sprintf("user not authenticated: %s", err.Error())
+		handleUnauthorized(w, msg)
+		return
+	}
+	auditEntry.Principal(identity.PrincipalUrn())
+	log.Debugf("identity=%v", identity)
+
+	// parse the POST json request body (via r *http.Request) into the action's request
+	err = json.NewDecoder(r.Body).Decode(submission.body)
+	if err != nil {
+		msg := fmt.Sprintf("invalid request body: %s", r.URL)
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+	log.Debugf("body=%v", submission.body)
+	if err := submission.accept(identity, auditEntry); err != nil {
+		handleForbidden(w, err.Error())
+		return
+	}
+
+	urlElements := strings.Split(r.URL.String(), "/")
+	if len(urlElements) != 6 {
+		msg := fmt.Sprintf("invalid request path: %s", r.URL)
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+
+	env := urlElements[2]
+	app := urlElements[3]
+	region := urlElements[4]
+	variant := urlElements[5]
+	clusterId := config.ClusterId{
+		App:     app,
+		Region:  region,
+		Variant: variant,
+	}
+
+	// user authorized for action on target?
+	principalUrn := config.PrincipalUrn(identity.PrincipalUrn())
+	appUrn := fmt.Sprintf("urn:arryved:app:%s", app)
+	auditEntry.Target(appUrn)
+	auditEntry.Param("env", env)
+	auditEntry.Param("app", app)
+	auditEntry.Param("region", region)
+	auditEntry.Param("variant", variant)
+	if err := authorize(r.Context(), cfg, nil, identity, submission.permission, config.EnvUrn(env, appUrn)); err != nil {
+		log.Infof("user not authorized for %s action err=%s", submission.operation, err.Error())
+		msg := fmt.Sprintf("user not authorized for %s action", submission.operation)
+		handleForbidden(w, msg)
+		return
+	}
+	log.Debugf("Authorization granted for principal=%v, action=%s, app=%v", principalUrn, submission.permission, appUrn)
+
+	// if no such cluster, return 404
+	cluster, err := findClusterById(cfg, gceCache, env, clusterId)
+	if err != nil {
+		log.Errorf("error fetching cluster status, cannot submit %s: %v", submission.operation, err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	if cluster == nil {
+		msg := fmt.Sprintf("no such cluster matching id=%v", clusterId)
+		log.Infof(msg)
+		handleNotFound(w, msg)
+		return
+	}
+
+	request := submission.request(w, r, auditEntry, env, cluster)
+	if request == nil {
+		return
+	}
+
+	// enqueue the job onto a job queue for worker pickup
+	job, err := queue.NewJob(identity, request)
+	if err != nil {
+		log.Errorf("error creating new job request, cannot submit %s: %v", submission.operation, err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+
+	// too much already in flight?
+	if !allowJob(r.Context(), cfg, jobStore, w, env, clusterId, job.Id, !submission.uncapped) {
+		return
+	}
+
+	// record the job before it's enqueued so the worker always has something to update
+	record := queue.NewJobRecord(job, env)
+	if jobStore != nil {
+		err = jobStore.Put(r.Context(), record)
+		if err != nil {
+			log.Errorf("error recording %s job, cannot submit %s: %v", submission.operation, submission.operation, err.Error())
+			releaseJob(r.Context(), jobStore, env, clusterId, job.Id)
+			handleInternalServerError(w, err)
+			return
+		}
+	} else {
+		log.Warnf("job *not* recorded since no jobStore available id=%s", job.Id)
+	}
+
+	auditEntry.Param("jobId", job.Id)
+	if jobQueue != nil {
+		pubid, err := jobQueue.Enqueue(job)
+		if err != nil {
+			log.Errorf("error enqueing %s job error=%s", submission.operation, err.Error())
+			metrics.PublishFailures.WithLabelValues(job.Action).Inc()
+			if jobStore != nil {
+				record.MarkComplete(err)
+				if err := jobStore.Put(r.Context(), record); err != nil {
+					log.Warnf("could not mark job failed id=%s err=%s", job.Id, err.Error())
+				}
+			}
+			handleInternalServerError(w, err)
+			return
+		}
+		log.Infof("enqueued job jobid=%s pubid=%s", job.Id, pubid)
+		metrics.JobsEnqueued.WithLabelValues(job.Action, env).Inc()
+	} else {
+		log.Warnf("job *not* enqueued since no jobQueue available id=%s", job.Id)
+	}
+
+	responseBody, err := json.Marshal(submission.response(job))
+	if err != nil {
+		log.Errorf("error marshaling response body: %v", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+
+	log.Debugf("response body=%v", responseBody)
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
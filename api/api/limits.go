@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/metrics"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/queue"
+	"github.com/arryved/app-ctrl/api/ratelimit"
+)
+
+// Endpoint classes for rate limiting; status fans out to every host so it gets its own budget
+const (
+	rateClassStatus = "status"
+	rateClassRead   = "read"
+	rateClassWrite  = "write"
+)
+
+type rateLimiters map[string]*ratelimit.Limiter
+
+func newRateLimiters(cfg config.LimitsConfig) rateLimiters {
+	limiters := rateLimiters{}
+	for class, rate := range cfg.Rates {
+		if rate.PerMinute <= 0 {
+			log.Warnf("no rate limit for class=%s", class)
+			continue
+		}
+		limiters[class] = ratelimit.New(rate.PerMinute, rate.Burst)
+	}
+	return limiters
+}
+
+func rateClass(route string, method string) string {
+	if route == "/status/" {
+		return rateClassStatus
+	}
+	// a check is a POST, but changes nothing
+	if method == http.MethodGet || method == http.MethodHead || route == "/authz/check" {
+		return rateClassRead
+	}
+	return rateClassWrite
+}
+
+// Who a request's rate limit is charged to: the authenticated principal, or the client address for anyone else
+func rateKey(r *http.Request, identity model.Identity, err error) string {
+	if err == nil && identity.Name() != "unknown" {
+		return identity.PrincipalUrn()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return fmt.Sprintf("addr:%s", host)
+}
+
+// Wraps a handler with the per-principal rate limit for its route's class
+func rateLimited(cfg *config.Config, limiters rateLimiters, route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		class := rateClass(route, r.Method)
+		limiter, ok := limiters[class]
+		if !ok {
+			next(w, r)
+			return
+		}
+		// the handler gets the identity along with the request rather than verifying the caller again
+		r, identity, err := withAuthentication(cfg, r)
+		key := rateKey(r, identity, err)
+		allowed, wait := limiter.Allow(key, time.Now())
+		if !allowed {
+			log.Infof("rate limited key=%s class=%s route=%s retryAfter=%s", key, class, route, wait)
+			metrics.Throttled.WithLabelValues(class).Inc()
+			handleTooManyRequests(w, fmt.Sprintf("rate limit exceeded for %s requests", class), wait)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// One in-flight cap: at most limit jobs hold slots under key at once; msg says so when a job is turned away
+type jobCap struct {
+	key   string
+	limit int
+	msg   string
+}
+
+// Claims job an in-flight slot in its env and, unless clusterCapped is off, its cluster, turning it away if either
+// already has as many in flight as allowed. Returns false (having responded) if the job shouldn't go ahead. The slots
+// free up once the job is done or stale; releaseJob gives them back for a job that never got recorded.
+func allowJob(ctx context.Context, cfg *config.Config, jobStore queue.JobStore, w http.ResponseWriter,
+	env string, clusterId config.ClusterId, jobId string, clusterCapped bool) bool {
+	limits := cfg.Limits
+	if jobStore == nil {
+		return true
+	}
+	caps := []jobCap{}
+	if clusterCapped && limits.MaxJobsPerCluster >= 0 {
+		msg := fmt.Sprintf("cluster already has %d job(s) in flight; at most %d allowed", limits.MaxJobsPerCluster, limits.MaxJobsPerCluster)
+		caps = append(caps, jobCap{clusterSlotKey(env, clusterId), limits.MaxJobsPerCluster, msg})
+	}
+	if limits.MaxJobsPerEnv >= 0 {
+		msg := fmt.Sprintf("env=%s already has %d job(s) in flight; at most %d allowed", env, limits.MaxJobsPerEnv, limits.MaxJobsPerEnv)
+		caps = append(caps, jobCap{envSlotKey(env), limits.MaxJobsPerEnv, msg})
+	}
+
+	staleBefore := time.Now().Add(-time.Duration(limits.JobStaleS) * time.Second).Unix()
+	for i, capped := range caps {
+		claimed, err := jobStore.ClaimSlot(ctx, capped.key, capped.limit, jobId, staleBefore)
+		if err == nil && claimed {
+			continue
+		}
+		// don't hold on to the slots already claimed for a job that isn't going ahead
+		for _, held := range caps[:i] {
+			if err := jobStore.ReleaseSlot(ctx, held.key, jobId); err != nil {
+				log.Warnf("could not release in-flight slot key=%s id=%s err=%s", held.key, jobId, err.Error())
+			}
+		}
+		if err != nil {
+			log.Errorf("error claiming in-flight slot key=%s: %v", capped.key, err.Error())
+			handleInternalServerError(w, err)
+			return false
+		}
+		log.Infof("job cap reached for env=%s cluster=%v: %s", env, clusterId, capped.msg)
+		metrics.Throttled.WithLabelValues("jobs").Inc()
+		handleTooManyRequests(w, capped.msg, time.Duration(limits.JobRetryAfterS)*time.Second)
+		return false
+	}
+	return true
+}
+
+// Gives back the slots allowJob claimed for a job that never got recorded
+func releaseJob(ctx context.Context, jobStore queue.JobStore, env string, clusterId config.ClusterId, jobId string) {
+	if jobStore == nil {
+		return
+	}
+	for _, key := range []string{clusterSlotKey(env, clusterId), envSlotKey(env)} {
+		if err := jobStore.ReleaseSlot(ctx, key, jobId); err != nil {
+			log.Warnf("could not release in-flight slot key=%s id=%s err=%s", key, jobId, err.Error())
+		}
+	}
+}
+
+func clusterSlotKey(env string, clusterId config.ClusterId) string {
+	return fmt.Sprintf("cluster/%s/%s/%s/%s", env, clusterId.App, clusterId.Region, clusterId.Variant)
+}
+
+func envSlotKey(env string) string {
+	return fmt.Sprintf("env/%s", env)
+}
+
+func handleTooManyRequests(w http.ResponseWriter, msg string, retryAfter time.Duration) {
+	httpStatus := http.StatusTooManyRequests
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	errorBody := fmt.Sprintf("{\"error\": \"%s\"}", msg)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	w.WriteHeader(httpStatus)
+	w.Write([]byte(errorBody))
+	return
+}
@@ -0,0 +1,146 @@
+//go:build !integration
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/queue"
+)
+
+func TestRateLimited(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	cfg.Limits.Rates["status"] = config.RateLimit{PerMinute: 60, Burst: 2}
+	cfg.Limits.Rates["read"] = config.RateLimit{PerMinute: 0}
+	limiters := newRateLimiters(cfg.Limits)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	status := rateLimited(cfg, limiters, "/status/", ok)
+	audit := rateLimited(cfg, limiters, "/audit", ok)
+
+	call := func(handler http.HandlerFunc, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/status/dev/any/any/any", nil)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		handler(recorder, req)
+		return recorder
+	}
+
+	// the burst goes through, then callers have to wait
+	assert.Equal(http.StatusOK, call(status, "10.0.0.1:1234").Code)
+	assert.Equal(http.StatusOK, call(status, "10.0.0.1:1235").Code)
+	recorder := call(status, "10.0.0.1:1236")
+	assert.Equal(http.StatusTooManyRequests, recorder.Code)
+	assert.Equal("1", recorder.Header().Get("Retry-After"))
+
+	// someone else has their own budget
+	assert.Equal(http.StatusOK, call(status, "10.0.0.2:1234").Code)
+
+	// classes with no limit aren't limited
+	for i := 0; i < 10; i++ {
+		assert.Equal(http.StatusOK, call(audit, "10.0.0.1:1234").Code)
+	}
+}
+
+func TestRateLimitedAuthenticatesOnce(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	limiters := newRateLimiters(cfg.Limits)
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+
+	// the handler is handed the identity the limiter charged, and authenticate doesn't verify the caller again
+	var handed authnResult
+	handler := rateLimited(cfg, limiters, "/whoami", func(w http.ResponseWriter, r *http.Request) {
+		handed, _ = r.Context().Value(AuthnKey).(authnResult)
+		identity, err := authenticate(cfg, r)
+		assert.NoError(err)
+		assert.Equal(handed.identity, identity)
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest("GET", "/whoami", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Equal("urn:arryved:user:mockuser@example.com", handed.identity.PrincipalUrn())
+}
+
+func TestJobCaps(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	jobStore := queue.NewMemoryJobStore()
+	handler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
+
+	deploy := func() *httptest.ResponseRecorder {
+		body := bytes.NewBufferString(`{"concurrency": "1", "version": "0.1.0"}`)
+		req := httptest.NewRequest("POST", "/deploy/dev/arryved-api/central/default", body)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// one job per cluster by default
+	first := deploy()
+	assert.Equal(http.StatusOK, first.Code)
+	recorder := deploy()
+	assert.Equal(http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(fmt.Sprintf("%d", cfg.Limits.JobRetryAfterS), recorder.Header().Get("Retry-After"))
+
+	// once it's done, the next can go
+	response := DeployResponse{}
+	assert.NoError(json.Unmarshal(first.Body.Bytes(), &response))
+	assert.NoError(jobStore.Update(context.Background(), response.DeployId, func(record *queue.JobRecord) error {
+		record.MarkComplete(nil)
+		return nil
+	}))
+	assert.Equal(http.StatusOK, deploy().Code)
+
+	// the env cap applies too, and negative caps turn them off
+	cfg.Limits.MaxJobsPerCluster = -1
+	cfg.Limits.MaxJobsPerEnv = 2
+	assert.Equal(http.StatusOK, deploy().Code)
+	assert.Equal(http.StatusTooManyRequests, deploy().Code)
+	cfg.Limits.MaxJobsPerEnv = -1
+	assert.Equal(http.StatusOK, deploy().Code)
+}
+
+func TestJobCapsUnderConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	jobStore := queue.NewMemoryJobStore()
+	handler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
+
+	// simultaneous deploys to one cluster can't all squeeze in under its cap
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := bytes.NewBufferString(`{"concurrency": "1", "version": "0.1.0"}`)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/deploy/dev/arryved-api/central/default", body))
+			codes <- recorder.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	accepted := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			accepted++
+		}
+	}
+	assert.Equal(cfg.Limits.MaxJobsPerCluster, accepted)
+}
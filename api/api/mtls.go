@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+)
+
+// Client CA pool for mTLS from a PEM bundle
+func ClientCAsFromConfig(clientCAPath string) (*x509.CertPool, error) {
+	bundle, err := ioutil.ReadFile(clientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA bundle path=%s err=%s", clientCAPath, err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle path=%s", clientCAPath)
+	}
+	return pool, nil
+}
+
+// Turns on optional client cert verification if a client CA bundle is configured. Clients without a cert still
+// get in, and authenticate with a bearer token as usual.
+func configureClientAuth(cfg *config.Config, tlsConfig *tls.Config) error {
+	if cfg.TLS.ClientCAPath == "" {
+		return nil
+	}
+	pool, err := ClientCAsFromConfig(cfg.TLS.ClientCAPath)
+	if err != nil {
+		return err
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	log.Infof("mTLS enabled with client CA bundle path=%s", cfg.TLS.ClientCAPath)
+	return nil
+}
+
+// Builds the Identity for a verified client cert from the principal its SAN maps to
+func certIdentity(ctx context.Context, cfg *config.Config, state *tls.ConnectionState) (model.Identity, error) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return model.Identity{}, errors.New("client certificate not verified")
+	}
+	leaf := state.VerifiedChains[0][0]
+
+	sans := []string{}
+	for _, uri := range leaf.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, leaf.DNSNames...)
+	sans = append(sans, leaf.EmailAddresses...)
+	for _, san := range sans {
+		principal, ok := cfg.TLS.ClientPrincipals[san]
+		if !ok && strings.HasPrefix(san, "urn:arryved:service:") {
+			principal, ok = config.PrincipalUrn(san), true
+		}
+		if !ok {
+			continue
+		}
+		log.Debugf("client certificate san=%s serial=%s maps to principal=%s", san, leaf.SerialNumber, principal)
+		return model.Identity{
+			Urn:        string(principal),
+			Groups:     groupsOf(ctx, cfg, string(principal)),
+			AuthMethod: model.AuthMethodMTLS,
+		}, nil
+	}
+	log.Warnf("client certificate subject=%s sans=%v not mapped to a principal", leaf.Subject, sans)
+	return model.Identity{}, errors.New("client certificate not mapped to a principal")
+}
@@ -0,0 +1,162 @@
+//go:build !integration
+
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate CA key err=%s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create CA cert err=%s", err.Error())
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue a client cert with the given SANs
+func (ca *testCA) clientCert(t *testing.T, dnsNames []string, uris []string) tls.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate client key err=%s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:     dnsNames,
+	}
+	for _, uri := range uris {
+		parsed, _ := url.Parse(uri)
+		template.URIs = append(template.URIs, parsed)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("could not create client cert err=%s", err.Error())
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	assert := assert.New(t)
+	ca := newTestCA(t)
+	caPath := filepath.Join(t.TempDir(), "client-ca.pem")
+	assert.NoError(os.WriteFile(caPath, ca.pem, 0600))
+
+	cfg := config.Load("../config/mock-config.yml")
+	cfg.AuthnEnabled = true
+	cfg.TLS.ClientCAPath = caPath
+	cfg.TLS.ClientPrincipals = map[string]config.PrincipalUrn{
+		"worker.app-control.internal": "urn:arryved:service:app-control-worker",
+	}
+
+	// report who the server thinks the caller is
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := authenticate(cfg, r)
+		if err != nil {
+			handleUnauthorized(w, err.Error())
+			return
+		}
+		assert.Equal(model.AuthMethodMTLS, identity.AuthMethod)
+		w.Write([]byte(identity.PrincipalUrn()))
+	}))
+	server.TLS = &tls.Config{}
+	assert.NoError(configureClientAuth(cfg, server.TLS))
+	assert.Equal(tls.VerifyClientCertIfGiven, server.TLS.ClientAuth)
+	server.StartTLS()
+	defer server.Close()
+
+	call := func(certs ...tls.Certificate) (int, string) {
+		// fresh transport each time so no connection (and so no earlier handshake) is reused
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		body := make([]byte, 512)
+		n, _ := resp.Body.Read(body)
+		return resp.StatusCode, string(body[:n])
+	}
+
+	// SAN mapped in config
+	code, body := call(ca.clientCert(t, []string{"worker.app-control.internal"}, nil))
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("urn:arryved:service:app-control-worker", body)
+
+	// URI SAN that's already a service URN
+	code, body = call(ca.clientCert(t, nil, []string{"urn:arryved:service:ci-deployer"}))
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("urn:arryved:service:ci-deployer", body)
+
+	// valid cert, but nobody we know
+	code, body = call(ca.clientCert(t, []string{"stranger.example.com"}, nil))
+	assert.Equal(http.StatusUnauthorized, code)
+	assert.Contains(body, "client certificate not mapped to a principal")
+
+	// no cert falls through to bearer auth, which wants a header
+	code, body = call()
+	assert.Equal(http.StatusUnauthorized, code)
+	assert.Contains(body, "authorization header missing")
+
+	// a cert from some other CA doesn't get past the handshake
+	code, _ = call(newTestCA(t).clientCert(t, []string{"worker.app-control.internal"}, nil))
+	assert.Equal(0, code)
+}
+
+func TestClientCAsFromConfig(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "empty.pem")
+	assert.NoError(os.WriteFile(path, []byte("not a cert"), 0600))
+
+	_, err := ClientCAsFromConfig(path)
+	assert.Error(err)
+	_, err = ClientCAsFromConfig(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(err)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// Discovered OIDC providers by issuer. A provider holds the issuer's JWKS, which go-oidc caches and re-fetches
+// when it sees a key id it doesn't know; re-discovering after cfg.ProviderRefreshS picks up endpoint changes too.
+var oidcProviders = &providerCache{providers: map[string]*cachedProvider{}}
+
+// One issuer's provider; its mutex is held while discovering, so a slow issuer only holds up its own tokens
+type cachedProvider struct {
+	mutex     sync.Mutex
+	provider  *oidc.Provider
+	fetchedAt time.Time
+}
+
+type providerCache struct {
+	mutex     sync.Mutex
+	providers map[string]*cachedProvider
+}
+
+func (c *providerCache) get(issuer string, maxAge time.Duration) (*oidc.Provider, error) {
+	c.mutex.Lock()
+	cached, ok := c.providers[issuer]
+	if !ok {
+		cached = &cachedProvider{}
+		c.providers[issuer] = cached
+	}
+	c.mutex.Unlock()
+
+	cached.mutex.Lock()
+	defer cached.mutex.Unlock()
+	if cached.provider != nil && time.Since(cached.fetchedAt) < maxAge {
+		return cached.provider, nil
+	}
+
+	// the provider keeps this context for later JWKS fetches, so it can't be the request's
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: 10 * time.Second})
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		if cached.provider != nil {
+			// keep using what we have rather than locking everyone out; try again after another maxAge
+			log.Warnf("could not refresh OIDC provider issuer=%s, keeping cached one err=%s", issuer, err.Error())
+			cached.fetchedAt = time.Now()
+			return cached.provider, nil
+		}
+		return nil, err
+	}
+	log.Infof("discovered OIDC provider issuer=%s", issuer)
+	cached.provider = provider
+	cached.fetchedAt = time.Now()
+	return provider, nil
+}
+
+// Checks the OIDC settings at startup: with authn on, ID tokens can't be accepted unless some audiences are allowed
+func checkOIDCConfig(cfg *config.Config) error {
+	if cfg.AuthnEnabled && len(cfg.OIDC.Audiences) == 0 {
+		return errors.New("oidc.audiences is empty; list the OAuth client ids ID tokens are issued for, or no ID token will be accepted")
+	}
+	return nil
+}
+
+// Verifies an ID token against the configured issuers, audiences and hosted domains and returns its claims. The
+// error says why a token was rejected in terms that are safe to return to the caller; details are logged.
+func verifyIDToken(ctx context.Context, cfg config.OIDCConfig, token string) (map[string]interface{}, error) {
+	unverified := decodeIDToken(token)
+	if unverified == nil {
+		return nil, errors.New("malformed id token")
+	}
+
+	// only talk to issuers we trust
+	issuer, _ := unverified["iss"].(string)
+	if issuer == "accounts.google.com" {
+		// Google sometimes leaves the scheme off; go-oidc allows for it
+		issuer = "https://accounts.google.com"
+	}
+	if !contains(cfg.Issuers, issuer) {
+		log.Warnf("id token issuer not allowed iss=%s", issuer)
+		return nil, errors.New("id token issuer not allowed")
+	}
+	if len(cfg.Audiences) == 0 {
+		log.Errorf("no oidc audiences configured; every id token will be rejected")
+		return nil, errors.New("no audiences configured")
+	}
+
+	provider, err := oidcProviders.get(issuer, time.Duration(cfg.ProviderRefreshS)*time.Second)
+	if err != nil {
+		log.Errorf("could not discover OIDC provider issuer=%s err=%s", issuer, err.Error())
+		return nil, errors.New("id token issuer unavailable")
+	}
+
+	// the audience is checked below, against all of the allowed ones
+	verifier := provider.Verifier(&oidc.Config{SkipClientIDCheck: true})
+	idToken, err := verifier.Verify(ctx, token)
+	if err != nil {
+		log.Warnf("id token failed verification err=%s", err.Error())
+		if strings.Contains(err.Error(), "expired") {
+			return nil, errors.New("id token expired")
+		}
+		return nil, errors.New("id token could not be verified")
+	}
+
+	audienceAllowed := false
+	for _, audience := range idToken.Audience {
+		if contains(cfg.Audiences, audience) {
+			audienceAllowed = true
+			break
+		}
+	}
+	if !audienceAllowed {
+		log.Warnf("id token audience not allowed aud=%v", idToken.Audience)
+		return nil, errors.New("id token audience not allowed")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("id token claims could not be read")
+	}
+
+	if len(cfg.HostedDomains) > 0 {
+		hd, _ := claims["hd"].(string)
+		if !contains(cfg.HostedDomains, hd) {
+			log.Warnf("id token hosted domain not allowed hd=%s email=%v", hd, claims["email"])
+			return nil, errors.New("id token hosted domain not allowed")
+		}
+	}
+	return claims, nil
+}
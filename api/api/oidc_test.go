@@ -0,0 +1,210 @@
+//go:build !integration
+
+package api
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+)
+
+const fakeAudience = "123-abc.apps.googleusercontent.com"
+
+// A local OIDC issuer: serves discovery and a JWKS, and mints ID tokens signed with its key
+type fakeIssuer struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	discoveryHits int32
+	jwksHits      int32
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := generateSecretKey()
+	if err != nil {
+		t.Fatalf("could not generate issuer key err=%s", err.Error())
+	}
+	issuer := &fakeIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&issuer.discoveryHits, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.server.URL,
+			"jwks_uri":                              issuer.server.URL + "/jwks",
+			"authorization_endpoint":                issuer.server.URL + "/auth",
+			"token_endpoint":                        issuer.server.URL + "/token",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&issuer.jwksHits, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "fake-key",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// mint a token; overrides replace the default claims
+func (i *fakeIssuer) token(t *testing.T, key *rsa.PrivateKey, overrides jwt.MapClaims) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            i.server.URL,
+		"aud":            fakeAudience,
+		"sub":            "1234567890",
+		"email":          "mockuser@example.com",
+		"email_verified": true,
+		"hd":             "example.com",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+	for name, value := range overrides {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "fake-key"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("could not sign token err=%s", err.Error())
+	}
+	return signed
+}
+
+func (i *fakeIssuer) config() *config.Config {
+	cfg := config.Load("../config/mock-config.yml")
+	cfg.AuthnEnabled = true
+	cfg.OIDC.Issuers = []string{i.server.URL}
+	cfg.OIDC.Audiences = []string{fakeAudience}
+	cfg.OIDC.HostedDomains = []string{"example.com"}
+	return cfg
+}
+
+func authenticateBearer(cfg *config.Config, token string) (model.Identity, error) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	return authenticate(cfg, req)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	assert := assert.New(t)
+	issuer := newFakeIssuer(t)
+	cfg := issuer.config()
+
+	// a good token
+	identity, err := authenticateBearer(cfg, issuer.token(t, issuer.key, nil))
+	assert.NoError(err)
+	assert.Equal("mockuser@example.com", identity.Email)
+	assert.Equal(model.AuthMethodOIDC, identity.AuthMethod)
+
+	// discovery and keys are fetched once, then served from cache
+	_, err = authenticateBearer(cfg, issuer.token(t, issuer.key, nil))
+	assert.NoError(err)
+	assert.Equal(int32(1), atomic.LoadInt32(&issuer.discoveryHits))
+	assert.Equal(int32(1), atomic.LoadInt32(&issuer.jwksHits))
+
+	// each way a token can be wrong, with the reason it's rejected
+	otherKey, err := generateSecretKey()
+	assert.NoError(err)
+	cases := map[string]struct {
+		token  string
+		reason string
+	}{
+		"other audience":   {issuer.token(t, issuer.key, jwt.MapClaims{"aud": "someone-else"}), "id token audience not allowed"},
+		"other issuer":     {issuer.token(t, issuer.key, jwt.MapClaims{"iss": "https://evil.example.com"}), "id token issuer not allowed"},
+		"other domain":     {issuer.token(t, issuer.key, jwt.MapClaims{"hd": "gmail.com"}), "id token hosted domain not allowed"},
+		"no domain":        {issuer.token(t, issuer.key, jwt.MapClaims{"hd": nil}), "id token hosted domain not allowed"},
+		"expired":          {issuer.token(t, issuer.key, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}), "id token expired"},
+		"forged signature": {issuer.token(t, otherKey, nil), "id token could not be verified"},
+		"not a jwt at all": {"garbage", "malformed id token"},
+	}
+	for name, c := range cases {
+		_, err := authenticateBearer(cfg, c.token)
+		assert.EqualError(err, c.reason, name)
+	}
+
+	// no audiences configured means nothing is accepted
+	cfg.OIDC.Audiences = nil
+	_, err = authenticateBearer(cfg, issuer.token(t, issuer.key, nil))
+	assert.EqualError(err, "no audiences configured")
+
+	// a signature that doesn't check out makes go-oidc re-fetch the keys (in case they rotated), not rediscover
+	assert.Equal(int32(1), atomic.LoadInt32(&issuer.discoveryHits))
+	assert.Greater(atomic.LoadInt32(&issuer.jwksHits), int32(1))
+}
+
+func TestUnauthenticatedReason(t *testing.T) {
+	assert := assert.New(t)
+	issuer := newFakeIssuer(t)
+	cfg := issuer.config()
+	handler := http.HandlerFunc(ConfiguredHandlerAudit(cfg, nil))
+
+	req := httptest.NewRequest("GET", "/audit", nil)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", issuer.token(t, issuer.key, jwt.MapClaims{"aud": "someone-else"})))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+	assert.Contains(recorder.Body.String(), "id token audience not allowed")
+}
+
+func TestProviderCacheLocksPerIssuer(t *testing.T) {
+	assert := assert.New(t)
+	issuer := newFakeIssuer(t)
+	cache := &providerCache{providers: map[string]*cachedProvider{}}
+
+	// an issuer whose discovery hangs until released
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.NotFound(w, r)
+	}))
+	defer hanging.Close()
+	defer close(release)
+	go cache.get(hanging.URL, time.Hour)
+	time.Sleep(50 * time.Millisecond)
+
+	// doesn't hold up the others
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.get(issuer.server.URL, time.Hour)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-time.After(2 * time.Second):
+		assert.Fail("discovery for one issuer waited on another's")
+	}
+}
+
+func TestCheckOIDCConfig(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	assert.NoError(checkOIDCConfig(cfg))
+
+	// authn with no audiences is a config error, not a 401 for everyone
+	cfg.AuthnEnabled = true
+	assert.Error(checkOIDCConfig(cfg))
+	cfg.OIDC.Audiences = []string{fakeAudience}
+	assert.NoError(checkOIDCConfig(cfg))
+}
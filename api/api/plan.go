@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	artifactspb "cloud.google.com/go/artifactregistry/apiv1/artifactregistrypb"
+	"cloud.google.com/go/storage"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/queue"
+)
+
+// Result of looking for one deployable artifact
+type ArtifactCheck struct {
+	Kind   string `json:"kind"` // aptPackage, containerTag or configBall
+	Name   string `json:"name"` // what was looked for
+	Exists bool   `json:"exists"`
+	Err    string `json:"err,omitempty"` // set if the lookup itself failed, in which case Exists is unknown
+}
+
+// What a deploy would do, returned instead of enqueuing when DeployRequest.DryRun is set
+type DeployPlan struct {
+	DryRun      bool             `json:"dryRun"`
+	Env         string           `json:"env"`
+	Cluster     config.ClusterId `json:"cluster"`
+	Runtime     string           `json:"runtime"`
+	Version     string           `json:"version"`
+	Concurrency string           `json:"concurrency"`
+	BatchCount  int              `json:"batchCount"`
+	Batches     [][]string       `json:"batches"`
+	Canaries    []string         `json:"canaries"`
+	Artifacts   []ArtifactCheck  `json:"artifacts"`
+	Ready       bool             `json:"ready"` // every artifact exists and there's something to deploy to
+	Message     string           `json:"message"`
+}
+
+// Looks up deployable artifacts for a version
+type ArtifactChecker interface {
+	AptPackage(ctx context.Context, repo, app, version string) ArtifactCheck
+	ContainerTag(ctx context.Context, app, version string) ArtifactCheck
+	ConfigBall(ctx context.Context, app, version string) ArtifactCheck
+}
+
+// swapped out in tests
+var newArtifactChecker = func(cfg *config.Config) ArtifactChecker {
+	return &registryArtifactChecker{cfg: cfg.Artifacts}
+}
+
+// Work out what deploying version to cluster would do, without doing any of it
+func planDeploy(ctx context.Context, checker ArtifactChecker, env string, cluster *config.Cluster, version, concurrency string) (*DeployPlan, error) {
+	plan := &DeployPlan{
+		DryRun:      true,
+		Env:         env,
+		Cluster:     cluster.Id,
+		Runtime:     cluster.Runtime,
+		Version:     version,
+		Concurrency: concurrency,
+		Batches:     [][]string{},
+		Canaries:    []string{},
+		Artifacts:   []ArtifactCheck{},
+	}
+	app := cluster.Id.App
+
+	switch cluster.Runtime {
+	case "GCE":
+		hosts := make([]string, 0, len(cluster.Hosts))
+		for name, host := range cluster.Hosts {
+			hosts = append(hosts, name)
+			if host.Canary {
+				plan.Canaries = append(plan.Canaries, name)
+			}
+		}
+		sort.Strings(plan.Canaries)
+		batchCount, err := queue.BatchCount(concurrency, len(hosts))
+		if err != nil {
+			return nil, err
+		}
+		plan.BatchCount = batchCount
+		plan.Batches = queue.Batches(hosts, batchCount)
+		plan.Artifacts = append(plan.Artifacts, checker.AptPackage(ctx, cluster.Repo, app, version))
+	case "GKE":
+		// kubernetes does the rolling, so there are no batches to show
+		plan.Artifacts = append(plan.Artifacts, checker.ContainerTag(ctx, app, version))
+	default:
+		return nil, fmt.Errorf("unsupported runtime=%s for cluster id=%v", cluster.Runtime, cluster.Id)
+	}
+	plan.Artifacts = append(plan.Artifacts, checker.ConfigBall(ctx, app, version))
+
+	problems := []string{}
+	if cluster.Runtime == "GCE" && len(plan.Batches) == 0 {
+		problems = append(problems, "no hosts found for cluster")
+	}
+	for _, artifact := range plan.Artifacts {
+		if artifact.Err != "" {
+			problems = append(problems, fmt.Sprintf("could not check %s %s: %s", artifact.Kind, artifact.Name, artifact.Err))
+		} else if !artifact.Exists {
+			problems = append(problems, fmt.Sprintf("%s %s not found", artifact.Kind, artifact.Name))
+		}
+	}
+	plan.Ready = len(problems) == 0
+	plan.Message = "dry run; nothing was enqueued"
+	if !plan.Ready {
+		plan.Message = fmt.Sprintf("dry run; deploy would fail: %s", strings.Join(problems, "; "))
+	}
+	return plan, nil
+}
+
+// ArtifactChecker backed by Artifact Registry (apt packages, images) and the configball bucket
+type registryArtifactChecker struct {
+	cfg config.ArtifactsConfig
+}
+
+func (c *registryArtifactChecker) AptPackage(ctx context.Context, repo, app, version string) ArtifactCheck {
+	name := fmt.Sprintf("projects/%s/locations/%s/repositories/%s/packages/%s/versions/%s",
+		c.cfg.Project, c.cfg.Location, repo, app, version)
+	check := ArtifactCheck{Kind: "aptPackage", Name: name}
+	client, err := createArtifactsClient(ctx)
+	if err != nil {
+		check.Err = err.Error()
+		return check
+	}
+	defer client.Close()
+	_, err = client.GetVersion(ctx, &artifactspb.GetVersionRequest{Name: name})
+	return registryResult(check, err)
+}
+
+func (c *registryArtifactChecker) ContainerTag(ctx context.Context, app, version string) ArtifactCheck {
+	name := fmt.Sprintf("projects/%s/locations/%s/repositories/%s/packages/%s/tags/%s",
+		c.cfg.Project, c.cfg.Location, c.cfg.DockerRepo, app, version)
+	check := ArtifactCheck{Kind: "containerTag", Name: name}
+	client, err := createArtifactsClient(ctx)
+	if err != nil {
+		check.Err = err.Error()
+		return check
+	}
+	defer client.Close()
+	_, err = client.GetTag(ctx, &artifactspb.GetTagRequest{Name: name})
+	return registryResult(check, err)
+}
+
+// same naming the worker matches on when it fetches the configball
+func (c *registryArtifactChecker) ConfigBall(ctx context.Context, app, version string) ArtifactCheck {
+	check := ArtifactCheck{
+		Kind: "configBall",
+		Name: fmt.Sprintf("gs://%s/config-app=%s,hash=*,version=%s.tar.gz", c.cfg.ConfigBucket, app, version),
+	}
+	pattern := regexp.MustCompile(fmt.Sprintf("^config-app=%s,hash=.*,version=%s.tar.gz$", regexp.QuoteMeta(app), regexp.QuoteMeta(version)))
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		check.Err = err.Error()
+		return check
+	}
+	defer client.Close()
+	iter := client.Bucket(c.cfg.ConfigBucket).Objects(ctx, &storage.Query{Prefix: fmt.Sprintf("config-app=%s,", app)})
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			check.Err = err.Error()
+			return check
+		}
+		if pattern.MatchString(attrs.Name) {
+			check.Exists = true
+			break
+		}
+	}
+	return check
+}
+
+func registryResult(check ArtifactCheck, err error) ArtifactCheck {
+	if err == nil {
+		check.Exists = true
+		return check
+	}
+	if strings.Contains(err.Error(), "NotFound") {
+		return check
+	}
+	log.Warnf("could not check for artifact name=%s err=%s", check.Name, err.Error())
+	check.Err = err.Error()
+	return check
+}
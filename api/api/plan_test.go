@@ -0,0 +1,106 @@
+//go:build !integration
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/queue"
+)
+
+// finds whatever versions it's told about
+type fakeArtifactChecker struct {
+	versions map[string]bool
+}
+
+func (f *fakeArtifactChecker) AptPackage(ctx context.Context, repo, app, version string) ArtifactCheck {
+	return ArtifactCheck{Kind: "aptPackage", Name: repo + "/" + app + "/" + version, Exists: f.versions[version]}
+}
+
+func (f *fakeArtifactChecker) ContainerTag(ctx context.Context, app, version string) ArtifactCheck {
+	return ArtifactCheck{Kind: "containerTag", Name: app + ":" + version, Exists: f.versions[version]}
+}
+
+func (f *fakeArtifactChecker) ConfigBall(ctx context.Context, app, version string) ArtifactCheck {
+	return ArtifactCheck{Kind: "configBall", Name: app + "/" + version, Exists: f.versions[version]}
+}
+
+func TestPlanDeployGCE(t *testing.T) {
+	assert := assert.New(t)
+	checker := &fakeArtifactChecker{versions: map[string]bool{"0.1.1": true}}
+	cluster := &config.Cluster{
+		Id:      config.ClusterId{App: "arryved-api", Region: "central", Variant: "default"},
+		Runtime: "GCE",
+		Repo:    "arryved-apt",
+		Hosts: map[string]config.Host{
+			"host-c": {},
+			"host-a": {Canary: true},
+			"host-b": {},
+		},
+	}
+
+	plan, err := planDeploy(context.Background(), checker, "dev", cluster, "0.1.1", "50%")
+	assert.NoError(err)
+	assert.True(plan.Ready)
+	assert.Equal(1, plan.BatchCount)
+	assert.Equal([][]string{{"host-a"}, {"host-b"}, {"host-c"}}, plan.Batches)
+	assert.Equal([]string{"host-a"}, plan.Canaries)
+	assert.Len(plan.Artifacts, 2)
+
+	// missing artifacts make the plan not ready
+	plan, err = planDeploy(context.Background(), checker, "dev", cluster, "9.9.9", "2")
+	assert.NoError(err)
+	assert.False(plan.Ready)
+	assert.Equal([][]string{{"host-a", "host-b"}, {"host-c"}}, plan.Batches)
+	assert.Contains(plan.Message, "aptPackage arryved-apt/arryved-api/9.9.9 not found")
+
+	_, err = planDeploy(context.Background(), checker, "dev", cluster, "0.1.1", "lots")
+	assert.Error(err)
+}
+
+func TestPlanDeployGKE(t *testing.T) {
+	assert := assert.New(t)
+	checker := &fakeArtifactChecker{versions: map[string]bool{"0.1.1": true}}
+	cluster := &config.Cluster{
+		Id:      config.ClusterId{App: "poserp-app", Region: "central", Variant: "default"},
+		Runtime: "GKE",
+	}
+	plan, err := planDeploy(context.Background(), checker, "dev", cluster, "0.1.1", "1")
+	assert.NoError(err)
+	assert.True(plan.Ready)
+	assert.Empty(plan.Batches)
+	assert.Equal("containerTag", plan.Artifacts[0].Kind)
+}
+
+func TestDeployDryRunDoesNotEnqueue(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	newArtifactChecker = func(cfg *config.Config) ArtifactChecker {
+		return &fakeArtifactChecker{versions: map[string]bool{"0.1.1": true}}
+	}
+	jobStore := queue.NewMemoryJobStore()
+	handler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
+
+	body := bytes.NewBufferString(`{"concurrency": "1", "version": "0.1.1", "dryRun": true}`)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/deploy/dev/arryved-api/central/default", body))
+	assert.Equal(http.StatusOK, recorder.Code)
+
+	plan := DeployPlan{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &plan))
+	assert.True(plan.DryRun)
+	assert.True(plan.Ready)
+	assert.Equal([][]string{{"dev-api.dev.arryved.com"}, {"dev-api2.dev.arryved.com"}}, plan.Batches)
+
+	records, err := jobStore.List(context.Background())
+	assert.NoError(err)
+	assert.Empty(records)
+}
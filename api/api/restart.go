@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/queue"
+	"github.com/arryved/app-ctrl/api/runners"
+)
+
+type RestartRequest struct {
+	Concurrency string `json:"concurrency"`
+}
+
+type RestartResponse struct {
+	RestartId string `json:"restartId"` // restartId (blank if not available)
+	Message   string `json:"message"`   // message is either of success or failure
+}
+
+func ConfiguredHandlerRestart(cfg *config.Config, gceCache *runners.GCECache, jobQueue *queue.Queue, jobStore queue.JobStore, auditLog audit.Log) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		httpStatus := http.StatusOK
+		log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+
+		if r.Method == http.MethodGet {
+			JobStatus(cfg, jobStore, w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			msg := fmt.Sprintf("%s not allowed for this endpoint", r.Method)
+			handleMethodNotAllowed(w, msg)
+			return
+		}
+
+		var requestBody RestartRequest
+		submitJob(cfg, gceCache, jobQueue, jobStore, auditLog, w, r, jobSubmission{
+			operation:  "restart",
+			permission: config.Restart,
+			body:       &requestBody,
+			accept: func(identity model.Identity, auditEntry *auditRecorder) error {
+				if requestBody.Concurrency == "" {
+					requestBody.Concurrency = "1"
+				}
+				auditEntry.Param("concurrency", requestBody.Concurrency)
+				return nil
+			},
+			request: func(w http.ResponseWriter, r *http.Request, auditEntry *auditRecorder, env string, cluster *config.Cluster) queue.JobRequest {
+				return queue.RestartJobRequest{
+					Cluster:     *cluster,
+					Concurrency: requestBody.Concurrency,
+				}
+			},
+			response: func(job *queue.Job) interface{} {
+				return RestartResponse{
+					RestartId: job.Id,
+					Message:   "restart job enqueued",
+				}
+			},
+		})
+	}
+}
@@ -0,0 +1,70 @@
+//go:build !integration
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/queue"
+)
+
+func TestSubmitAndObtainRestartId(t *testing.T) {
+	assert := assert.New(t)
+
+	// set up a server config
+	cfg := config.Load("../config/mock-config.yml")
+
+	// set up interaction request and recorder for restart handler
+	recorder := httptest.NewRecorder()
+	jobStore := queue.NewMemoryJobStore()
+	handler := http.HandlerFunc(ConfiguredHandlerRestart(cfg, nil, nil, jobStore, nil))
+	bodyBytes, err := json.Marshal(RestartRequest{Concurrency: "50%"})
+	assert.NoError(err)
+
+	// simulate the API call
+	uri := "/restart/dev/arryved-api/central/default"
+	fake_token, err := generateFakeIDToken()
+	assert.NoError(err)
+	req := httptest.NewRequest("POST", uri, bytes.NewBuffer(bodyBytes))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fake_token))
+	handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(err)
+
+	response := RestartResponse{}
+	assert.NoError(json.Unmarshal(responseBody, &response))
+	assert.Equal("restart job enqueued", response.Message)
+	_, err = uuid.Parse(response.RestartId)
+	assert.NoError(err)
+
+	// the job is recorded as a queued restart
+	record, err := jobStore.Get(req.Context(), response.RestartId)
+	assert.NoError(err)
+	assert.Equal("RESTART", record.Action)
+	assert.Equal(queue.JobQueued, record.State)
+	assert.Equal("50%", record.Concurrency)
+	assert.Equal("mockuser@example.com", record.Principal)
+}
+
+func TestRestartUnknownCluster(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	handler := http.HandlerFunc(ConfiguredHandlerRestart(cfg, nil, nil, queue.NewMemoryJobStore(), nil))
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/restart/dev/no-such-app/central/default", bytes.NewBufferString("{}"))
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(http.StatusNotFound, recorder.Code)
+}
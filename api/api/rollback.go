@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/queue"
+	"github.com/arryved/app-ctrl/api/runners"
+)
+
+type RollbackRequest struct {
+	Concurrency string `json:"concurrency"`
+}
+
+type RollbackResponse struct {
+	RollbackId string `json:"rollbackId"` // rollbackId (blank if not available)
+	Version    string `json:"version"`    // version being rolled back to
+	Message    string `json:"message"`    // message is either of success or failure
+}
+
+func ConfiguredHandlerRollback(cfg *config.Config, gceCache *runners.GCECache, jobQueue *queue.Queue, jobStore queue.JobStore, auditLog audit.Log) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		httpStatus := http.StatusOK
+		log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+
+		if r.Method == http.MethodGet {
+			JobStatus(cfg, jobStore, w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			msg := fmt.Sprintf("%s not allowed for this endpoint", r.Method)
+			handleMethodNotAllowed(w, msg)
+			return
+		}
+
+		// a rollback is a deploy of an older version, so it needs deploy permission; it's audited as operation=rollback.
+		// It's the way out of a bad deploy, so a deploy hung on the cluster mustn't hold it up until that goes stale.
+		var requestBody RollbackRequest
+		var previous string
+		submitJob(cfg, gceCache, jobQueue, jobStore, auditLog, w, r, jobSubmission{
+			operation:  "rollback",
+			permission: config.Deploy,
+			body:       &requestBody,
+			uncapped:   true,
+			accept: func(identity model.Identity, auditEntry *auditRecorder) error {
+				if requestBody.Concurrency == "" {
+					requestBody.Concurrency = "1"
+				}
+				auditEntry.Param("concurrency", requestBody.Concurrency)
+				return nil
+			},
+			request: func(w http.ResponseWriter, r *http.Request, auditEntry *auditRecorder, env string, cluster *config.Cluster) queue.JobRequest {
+				// work out what to roll back to from the deploy history
+				clusterId := cluster.Id
+				if jobStore == nil {
+					msg := fmt.Sprintf("no deploy history available for cluster id=%v", clusterId)
+					log.Infof(msg)
+					handleNotFound(w, msg)
+					return nil
+				}
+				records, err := jobStore.List(r.Context())
+				if err != nil {
+					log.Errorf("error fetching deploy history, cannot submit rollback: %v", err.Error())
+					handleInternalServerError(w, err)
+					return nil
+				}
+				current, version, err := queue.RollbackVersion(records, env, clusterId)
+				if errors.Is(err, queue.ErrNoRollbackVersion) {
+					msg := fmt.Sprintf("no previous known-good version for cluster id=%v current=%s", clusterId, current)
+					log.Infof(msg)
+					handleNotFound(w, msg)
+					return nil
+				}
+				log.Infof("rolling back cluster id=%v from version=%s to version=%s", clusterId, current, version)
+				auditEntry.Param("fromVersion", current)
+				auditEntry.Param("version", version)
+				previous = version
+				return queue.RollbackJobRequest{
+					Cluster:     *cluster,
+					Concurrency: requestBody.Concurrency,
+					Version:     version,
+					FromVersion: current,
+				}
+			},
+			response: func(job *queue.Job) interface{} {
+				return RollbackResponse{
+					RollbackId: job.Id,
+					Version:    previous,
+					Message:    "rollback job enqueued",
+				}
+			},
+		})
+	}
+}
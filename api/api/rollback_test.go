@@ -0,0 +1,121 @@
+//go:build !integration
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/queue"
+)
+
+func seedDeployRecord(store queue.JobStore, id, version string, state queue.JobState, queuedAt int64) {
+	store.Put(context.Background(), &queue.JobRecord{
+		Id:       id,
+		Action:   "DEPLOY",
+		Env:      "dev",
+		Cluster:  config.ClusterId{App: "arryved-api", Region: "central", Variant: "default"},
+		Version:  version,
+		State:    state,
+		Hosts:    map[string]*queue.HostResult{},
+		QueuedAt: queuedAt,
+	})
+}
+
+func TestSubmitRollback(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+
+	now := time.Now().Unix()
+	jobStore := queue.NewMemoryJobStore()
+	seedDeployRecord(jobStore, "deploy-1", "0.1.1", queue.JobSucceeded, now-300)
+	seedDeployRecord(jobStore, "deploy-2", "0.1.2", queue.JobSucceeded, now-200)
+
+	auditLog := audit.NewMemoryLog()
+	handler := http.HandlerFunc(ConfiguredHandlerRollback(cfg, nil, nil, jobStore, auditLog))
+	fake_token, err := generateFakeIDToken()
+	assert.NoError(err)
+	req := httptest.NewRequest("POST", "/rollback/dev/arryved-api/central/default", bytes.NewBufferString("{}"))
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fake_token))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code)
+
+	responseBody, err := ioutil.ReadAll(recorder.Result().Body)
+	assert.NoError(err)
+	response := RollbackResponse{}
+	assert.NoError(json.Unmarshal(responseBody, &response))
+	assert.Equal("rollback job enqueued", response.Message)
+	assert.Equal("0.1.1", response.Version)
+
+	// the rollback is recorded with the version it restores
+	record, err := jobStore.Get(req.Context(), response.RollbackId)
+	assert.NoError(err)
+	assert.Equal("ROLLBACK", record.Action)
+	assert.Equal("0.1.1", record.Version)
+	assert.Equal(queue.JobQueued, record.State)
+
+	// audited under deploy permission, but told apart from deploys
+	entries, err := auditLog.List(context.Background())
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal(config.Deploy, entries[0].Action)
+	assert.Equal("rollback", entries[0].Params["operation"])
+	assert.Equal("0.1.2", entries[0].Params["fromVersion"])
+}
+
+func TestRollbackWithoutHistory(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+
+	jobStore := queue.NewMemoryJobStore()
+	seedDeployRecord(jobStore, "deploy-1", "0.1.1", queue.JobSucceeded, time.Now().Unix())
+
+	handler := http.HandlerFunc(ConfiguredHandlerRollback(cfg, nil, nil, jobStore, nil))
+	req := httptest.NewRequest("POST", "/rollback/dev/arryved-api/central/default", bytes.NewBufferString("{}"))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusNotFound, recorder.Code)
+
+	// unknown cluster
+	req = httptest.NewRequest("POST", "/rollback/dev/no-such-app/central/default", bytes.NewBufferString("{}"))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusNotFound, recorder.Code)
+}
+
+func TestRollbackPastHungDeploy(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+
+	now := time.Now().Unix()
+	jobStore := queue.NewMemoryJobStore()
+	seedDeployRecord(jobStore, "deploy-1", "0.1.1", queue.JobSucceeded, now-300)
+	seedDeployRecord(jobStore, "deploy-2", "0.1.2", queue.JobSucceeded, now-200)
+	deployHandler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
+	rollbackHandler := http.HandlerFunc(ConfiguredHandlerRollback(cfg, nil, nil, jobStore, nil))
+	submit := func(handler http.Handler, uri, body string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("POST", uri, bytes.NewBufferString(body)))
+		return recorder.Code
+	}
+
+	// a deploy that never finishes holds the cluster's only slot
+	deploy := `{"concurrency": "1", "version": "0.1.3"}`
+	assert.Equal(http.StatusOK, submit(deployHandler, "/deploy/dev/arryved-api/central/default", deploy))
+	assert.Equal(http.StatusTooManyRequests, submit(deployHandler, "/deploy/dev/arryved-api/central/default", deploy))
+
+	// but a rollback still goes ahead
+	assert.Equal(http.StatusOK, submit(rollbackHandler, "/rollback/dev/arryved-api/central/default", "{}"))
+}
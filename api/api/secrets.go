@@ -6,15 +6,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/arryved/app-ctrl/api/audit"
 	"github.com/arryved/app-ctrl/api/config"
-	"github.com/arryved/app-ctrl/api/gce"
-	"github.com/arryved/app-ctrl/api/rbac"
+	"github.com/arryved/app-ctrl/api/config/product"
+	"github.com/arryved/app-ctrl/api/config/storage"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/runners"
 	"github.com/arryved/app-ctrl/api/secrets"
 )
 
@@ -26,18 +29,115 @@ const accessorRole = "roles/secretmanager.secretAccessor"
 // necessary at the outset
 const listIamConcurrency = 32
 
-// context key for passing the authentication claims with the request
-const AuthnClaimsKey = "authnClaims"
+// context key for passing the authenticated model.Identity with the request
+const IdentityKey = "identity"
 const EnvKey = "env"
-const ProjectIdKey = "projectId"
-const ProjectNumberKey = "projectNumber"
+
+// client for the configball bucket, scanned for secret references; replaced in tests
+var newConfigStorageClient = func(ctx context.Context) (storage.StorageClient, error) {
+	return storage.New(ctx)
+}
 
 // Body format for an app-control-api secret request
 type SecretRequest struct {
-	Id         string `json:"id"`         // a secret name matching `^[a-zA-Z0-9-_]+$`; 255 byte max length
-	OwnerGroup string `json:"ownerGroup"` // just the plain email address
-	OwnerUser  string `json:"ownerUser"`  // just the plain email address
-	Value      string `json:"value"`      // expects b64-encoded bytes in a json string; decoded size limit is 64k bytes
+	Id          string   `json:"id"`                    // a secret name matching `^[a-zA-Z0-9-_]+$`; 255 byte max length
+	OwnerGroup  string   `json:"ownerGroup"`            // just the plain email address
+	OwnerUser   string   `json:"ownerUser"`             // just the plain email address
+	OwnerGroups []string `json:"ownerGroups,omitempty"` // more owner groups, in addition to ownerGroup
+	OwnerUsers  []string `json:"ownerUsers,omitempty"`  // more owner users, in addition to ownerUser (the creator)
+	Value       string   `json:"value"`                 // expects b64-encoded bytes in a json string; decoded size limit is 64k bytes
+
+	// optional rotation policy, kept with the secret; on update, only the fields present are changed and zero clears
+	RotationPeriodDays *int    `json:"rotationPeriodDays,omitempty"` // how often the value should be replaced
+	ExpiresEpochNs     *int64  `json:"expiresEpochNs,omitempty"`     // when the value stops being usable
+	Description        *string `json:"description,omitempty"`        // what it is and how to rotate it; 1k byte max length
+}
+
+// Whether the request sets any of the rotation policy
+func (r SecretRequest) HasRotation() bool {
+	return r.RotationPeriodDays != nil || r.ExpiresEpochNs != nil || r.Description != nil
+}
+
+func (r SecretRequest) rotationUpdate() secrets.SecretRotationUpdate {
+	return secrets.SecretRotationUpdate{
+		RotationPeriodDays: r.RotationPeriodDays,
+		ExpiresEpochNs:     r.ExpiresEpochNs,
+		Description:        r.Description,
+	}
+}
+
+func (r SecretRequest) rotation() secrets.SecretRotation {
+	rotation := secrets.SecretRotation{}
+	if r.RotationPeriodDays != nil {
+		rotation.RotationPeriodDays = *r.RotationPeriodDays
+	}
+	if r.ExpiresEpochNs != nil {
+		rotation.ExpiresEpochNs = *r.ExpiresEpochNs
+	}
+	if r.Description != nil {
+		rotation.Description = *r.Description
+	}
+	return rotation
+}
+
+// every owner the request names
+func (r SecretRequest) owners() secrets.Owners {
+	return secrets.Owners{
+		Users:  append([]string{r.OwnerUser}, r.OwnerUsers...),
+		Groups: append([]string{r.OwnerGroup}, r.OwnerGroups...),
+	}.Normalized()
+}
+
+// Body format for changing a secret's owners; plain email addresses
+type SecretOwnersRequest struct {
+	OwnerUsers  []string `json:"ownerUsers"`
+	OwnerGroups []string `json:"ownerGroups"`
+	Add         bool     `json:"add"` // add these to the current owners, instead of replacing them (a transfer)
+}
+
+// Body format for copying a secret's latest value into another env
+type SecretCopyRequest struct {
+	DestinationEnv string `json:"destinationEnv"`
+	DestinationId  string `json:"destinationId,omitempty"` // defaults to the source id
+	ReplaceOwners  bool   `json:"replaceOwners,omitempty"` // an existing copy keeps its owners unless this is set
+}
+
+type SecretCopyResponse struct {
+	Urn     string `json:"urn"` // of the copy
+	Env     string `json:"env"`
+	Created bool   `json:"created"` // false if an existing secret got the value as a new version
+}
+
+// Keyed fingerprint of one version of a secret; see secrets.Fingerprinter
+type SecretFingerprint struct {
+	Urn         string `json:"urn"`
+	Env         string `json:"env"`
+	Version     string `json:"version"` // as requested: latest or a number
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Whether two secret versions hold the same value
+type SecretComparison struct {
+	Secret SecretFingerprint `json:"secret"`
+	Other  SecretFingerprint `json:"other"`
+	Equal  bool              `json:"equal"`
+}
+
+// Body format for rolling a secret back to an old version
+type SecretRollbackRequest struct {
+	Version int64 `json:"version"`
+}
+
+type SecretRollbackResponse struct {
+	Version      int64 `json:"version"`      // the new latest version
+	RestoredFrom int64 `json:"restoredFrom"` // the version whose value it holds
+}
+
+// Body of the 409 for deleting a secret that compiled configs still reference, or might
+type SecretInUseResponse struct {
+	Error     string                `json:"error"`
+	Usages    []product.SecretUsage `json:"usages"`
+	Unchecked []string              `json:"unchecked"` // configs that couldn't be read or compiled, so might
 }
 
 // Abstraction for an app-control-api secret. Hides implementation details. Think before allowing them to leak in.
@@ -45,13 +145,18 @@ type SecretEntry struct {
 	Urn string `json:"urn"`
 	// I don't think this code will be here in 290 years so int64 is probably fine
 	// as of 2024 the delivered precision from GCP is ms, this just honoring their aspirational precision format (ns, int64 + int32)
-	CreatedEpochNs int64  `json:"createdEpochNs"`
-	OwnerGroup     string `json:"ownerGroup"`
-	OwnerUser      string `json:"ownerUser"`
+	CreatedEpochNs int64    `json:"createdEpochNs"`
+	OwnerGroup     string   `json:"ownerGroup"` // the first of OwnerGroups, for clients that only know of one
+	OwnerUser      string   `json:"ownerUser"`  // the first of OwnerUsers, likewise
+	OwnerGroups    []string `json:"ownerGroups"`
+	OwnerUsers     []string `json:"ownerUsers"`
+	secrets.SecretRotation
 }
 
-// Web handler for the endpoint
-func ConfiguredHandlerSecrets(cfg *config.Config) func(http.ResponseWriter, *http.Request) {
+// Web handler for the endpoint; GET /secrets/{env}?stale=true answers from staleSecrets once it has checked the env,
+// and fingerprints are keyed by fingerprinter
+func ConfiguredHandlerSecrets(cfg *config.Config, auditLog audit.Log, staleSecrets *runners.StaleSecretsCache,
+	fingerprinter *secrets.Fingerprinter) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		var action config.Permission
@@ -60,22 +165,13 @@ func ConfiguredHandlerSecrets(cfg *config.Config) func(http.ResponseWriter, *htt
 		// Initial validation
 
 		// valid path form?
-		urlElements := strings.Split(r.URL.String(), "/")
+		urlElements := strings.Split(r.URL.Path, "/")
 		if len(urlElements) < 3 {
 			msg := fmt.Sprintf("invalid number of path elements in request")
 			handleBadRequest(w, msg)
 			return
 		}
 
-		// user authenticated?
-		if !authenticated(cfg, r) {
-			msg := fmt.Sprintf("user not authenticated")
-			handleUnauthorized(w, msg)
-			return
-		}
-		claims := getClaims(r)
-		log.Debugf("claims=%v", claims)
-
 		// determine action/permission being requested
 		if r.Method == http.MethodGet && len(urlElements) == 3 {
 			action = config.SecretsList
@@ -93,6 +189,53 @@ func ConfiguredHandlerSecrets(cfg *config.Config) func(http.ResponseWriter, *htt
 			action = config.SecretsDelete
 		}
 
+		// version history: GET .../versions, GET .../versions/{n}, POST .../rollback; ownership: PUT .../owners
+		subresource := ""
+		if len(urlElements) > 4 {
+			subresource = urlElements[4]
+		}
+		if r.Method == http.MethodGet && subresource == "versions" && (len(urlElements) == 5 || len(urlElements) == 6) {
+			action = config.SecretsVersions
+		}
+		if r.Method == http.MethodPost && subresource == "rollback" && len(urlElements) == 5 {
+			action = config.SecretsUpdate
+		}
+		if r.Method == http.MethodPut && subresource == "owners" && len(urlElements) == 5 {
+			action = config.SecretsUpdate
+		}
+		if r.Method == http.MethodPost && subresource == "copy" && len(urlElements) == 5 {
+			action = config.SecretsCopy
+		}
+		// which configs reference a secret, and keyed fingerprints, are no more sensitive than the list
+		if r.Method == http.MethodGet && len(urlElements) == 5 &&
+			(subresource == "usages" || subresource == "fingerprint" || subresource == "compare") {
+			action = config.SecretsList
+		}
+
+		// every attempt at a mutating action is audited, whatever the outcome
+		if action == config.SecretsCreate || action == config.SecretsUpdate || action == config.SecretsDelete ||
+			action == config.SecretsCopy {
+			auditEntry := startAudit(auditLog, w, r, action)
+			defer auditEntry.Commit()
+			auditEntry.Param("env", urlElements[2])
+			if len(urlElements) > 3 {
+				auditEntry.Target(fmt.Sprintf("urn:arryved:secret:%s", urlElements[3]))
+			}
+			w = auditEntry
+		}
+
+		// user authenticated?
+		identity, err := authenticate(cfg, r)
+		if err != nil {
+			msg := fmt.Sprintf("user not authenticated: %s", err.Error())
+			handleUnauthorized(w, msg)
+			return
+		}
+		if auditEntry, ok := w.(*auditRecorder); ok {
+			auditEntry.Principal(identity.PrincipalUrn())
+		}
+		log.Debugf("identity=%v", identity)
+
 		// valid env?
 		env := urlElements[2]
 		envMap := envsFromConfig(cfg)
@@ -104,35 +247,23 @@ func ConfiguredHandlerSecrets(cfg *config.Config) func(http.ResponseWriter, *htt
 			return
 		}
 
-		// can get project metadata?
-		projectId := gce.ProjectMap[env]
-		projectNumber, err := gce.GetProjectNumber(projectId)
-		if err != nil {
-			log.Errorf("error getting a project number: err=%s", err.Error())
-			msg := fmt.Errorf("error listing secrets; have the app administrator check the logs")
-			handleInternalServerError(w, msg)
-			return
-		}
-
-		// extend request context with the authenticated principal, env and GCP project id and number attached
-		ctx := context.WithValue(r.Context(), AuthnClaimsKey, claims)
+		// extend request context with the authenticated principal and env attached
+		ctx := context.WithValue(r.Context(), IdentityKey, identity)
 		ctx = context.WithValue(ctx, EnvKey, env)
-		ctx = context.WithValue(ctx, ProjectIdKey, projectId)
-		ctx = context.WithValue(ctx, ProjectNumberKey, projectNumber)
 		r = r.WithContext(ctx)
 
-		// get a secret client to inject
-		client, err := secretmanager.NewClient(ctx)
+		// get the env's secret store to inject
+		store, err := secrets.NewEnvStore(ctx, cfg, env)
 		if err != nil {
-			log.Errorf("error getting a secret client: err=%s", err.Error())
+			log.Errorf("error getting a secret store: err=%s", err.Error())
 			msg := fmt.Errorf("error listing secrets; have the app administrator check the logs")
 			handleInternalServerError(w, msg)
 			return
 		}
-		defer client.Close()
+		defer store.Close()
 
 		// authorization checks for read/create/update/delete
-		principalUrn := config.PrincipalUrn(fmt.Sprintf("urn:arryved:user:%s", claims["email"]))
+		principalUrn := identity.PrincipalUrn()
 		var secretId string
 		if len(urlElements) == 3 {
 			secretId = ""
@@ -140,7 +271,7 @@ func ConfiguredHandlerSecrets(cfg *config.Config) func(http.ResponseWriter, *htt
 			secretId = urlElements[3]
 		}
 		secretUrn := fmt.Sprintf("urn:arryved:secret:%s", secretId)
-		if err := rbac.Authorized(r.Context(), cfg, client, principalUrn, action, secretUrn); err != nil {
+		if err := authorize(r.Context(), cfg, store, identity, action, secretUrn); err != nil {
 			if err != nil && strings.Contains(err.Error(), "NotFound") {
 				// capture the 404 case
 				log.Infof("when acting on secret: err=%s", err.Error())
@@ -156,24 +287,60 @@ func ConfiguredHandlerSecrets(cfg *config.Config) func(http.ResponseWriter, *htt
 		log.Debugf("Authorization granted for principal=%v, action=Deploy, app=%v", principalUrn, secretUrn)
 
 		// dispatch to routine appropriate for action
+		if action == config.SecretsVersions && len(urlElements) == 5 {
+			SecretsVersionList(cfg, store, w, r, secretId)
+			return
+		}
+		if action == config.SecretsVersions {
+			SecretsReadVersion(cfg, store, w, r, secretId, urlElements[5])
+			return
+		}
+		if action == config.SecretsUpdate && subresource == "rollback" {
+			SecretsRollback(cfg, store, w, r, secretId)
+			return
+		}
+		if action == config.SecretsUpdate && subresource == "owners" {
+			SecretsSetOwners(cfg, store, w, r, secretId)
+			return
+		}
+		if action == config.SecretsCopy {
+			SecretsCopy(cfg, store, w, r, secretId)
+			return
+		}
+		if action == config.SecretsList && subresource == "usages" {
+			SecretsUsages(cfg, w, r, secretId)
+			return
+		}
+		if action == config.SecretsList && subresource == "fingerprint" {
+			SecretsFingerprint(cfg, store, fingerprinter, w, r, secretId)
+			return
+		}
+		if action == config.SecretsList && subresource == "compare" {
+			SecretsCompare(cfg, store, fingerprinter, w, r, secretId)
+			return
+		}
+		if action == config.SecretsList && r.URL.Query().Get("stale") == "true" {
+			SecretsListStale(cfg, store, staleSecrets, w, r)
+			return
+		}
 		if action == config.SecretsList {
-			SecretsList(cfg, client, w, r, secretId, projectNumber)
+			SecretsList(cfg, store, w, r, secretId)
 			return
 		}
 		if action == config.SecretsRead {
-			SecretsRead(cfg, client, w, r, secretId, projectNumber)
+			SecretsRead(cfg, store, w, r, secretId)
 			return
 		}
 		if action == config.SecretsCreate {
-			SecretsCreate(cfg, client, w, r, secretId, projectNumber)
+			SecretsCreate(cfg, store, w, r, secretId)
 			return
 		}
 		if action == config.SecretsUpdate {
-			SecretsUpdate(cfg, client, w, r, secretId, projectNumber)
+			SecretsUpdate(cfg, store, w, r, secretId)
 			return
 		}
 		if action == config.SecretsDelete {
-			SecretsDelete(cfg, client, w, r, secretId, projectNumber)
+			SecretsDelete(cfg, store, w, r, secretId)
 			return
 		}
 		// catch-all failure for unsupported method/uri combos
@@ -184,8 +351,8 @@ func ConfiguredHandlerSecrets(cfg *config.Config) func(http.ResponseWriter, *htt
 }
 
 // LIST secrets
-func SecretsList(cfg *config.Config, client secrets.SecretManagerClient, w http.ResponseWriter, r *http.Request, secretId, projectNumber string) {
-	secretEntries, err := secrets.SecretList(r.Context(), client, projectNumber)
+func SecretsList(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
+	secretEntries, err := store.List(r.Context())
 	if err != nil {
 		log.Errorf("error listing secrets: err=%s", err.Error())
 		msg := fmt.Errorf("error listing secrets; have the app administrator check the logs")
@@ -207,9 +374,43 @@ func SecretsList(cfg *config.Config, client secrets.SecretManagerClient, w http.
 	return
 }
 
+// LIST secrets past their rotation date or expiry, as of the last runner check (or now, before the first one)
+func SecretsListStale(
+	cfg *config.Config, store secrets.Store, staleSecrets *runners.StaleSecretsCache,
+	w http.ResponseWriter, r *http.Request) {
+	env := r.Context().Value(EnvKey).(string)
+	var stale []secrets.StaleSecret
+	ok := false
+	if staleSecrets != nil {
+		stale, _, ok = staleSecrets.Get(env)
+	}
+	if !ok {
+		var err error
+		stale, err = secrets.SecretsStale(r.Context(), store, time.Now())
+		if err != nil {
+			log.Errorf("error listing stale secrets: err=%s", err.Error())
+			msg := fmt.Errorf("error listing secrets; have the app administrator check the logs")
+			handleInternalServerError(w, msg)
+			return
+		}
+	}
+	responseBody, err := json.Marshal(stale)
+	if err != nil {
+		log.Errorf("error marshalling stale secrets: err=%s", err.Error())
+		msg := fmt.Errorf("error listing secrets; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+	return
+}
+
 // READ secret by id
-func SecretsRead(cfg *config.Config, client secrets.SecretManagerClient, w http.ResponseWriter, r *http.Request, secretId, projectNumber string) {
-	value, err := secrets.SecretRead(r.Context(), client, projectNumber, secretId)
+func SecretsRead(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
+	value, err := store.Read(r.Context(), secretId, "latest")
 	if err != nil {
 		log.Errorf("error getting secretId=%s: err=%s", secretId, err.Error())
 		msg := fmt.Errorf("error getting secret; have the app administrator check the logs")
@@ -233,7 +434,7 @@ func SecretsRead(cfg *config.Config, client secrets.SecretManagerClient, w http.
 }
 
 // CREATE secret
-func SecretsCreate(cfg *config.Config, client secrets.SecretManagerClient, w http.ResponseWriter, r *http.Request, secretId, projectNumber string) {
+func SecretsCreate(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
 	// parse the POST json request body (via r *http.Request) into a SecretRequest
 	var requestBody SecretRequest
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
@@ -246,13 +447,20 @@ func SecretsCreate(cfg *config.Config, client secrets.SecretManagerClient, w htt
 	}
 
 	// set ownerUser to the authenticated principal; ignores whatever the user sent, if anything
-	claims := r.Context().Value(AuthnClaimsKey).(map[string]interface{})
-	if claims == nil {
-		msg := fmt.Errorf("error creating secret; authn claims are missing")
+	identity, ok := r.Context().Value(IdentityKey).(model.Identity)
+	if !ok {
+		msg := fmt.Errorf("error creating secret; authenticated identity is missing")
 		handleInternalServerError(w, msg)
 		return
 	}
-	requestBody.OwnerUser = claims["email"].(string)
+	requestBody.OwnerUser = identity.Email
+	owners := requestBody.owners()
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		// the id only arrives in the body for a create; the value is never audited
+		auditEntry.Target(fmt.Sprintf("urn:arryved:secret:%s", requestBody.Id))
+		auditOwners(auditEntry, owners)
+		auditRotation(auditEntry, requestBody)
+	}
 
 	// validate
 	err = SecretRequestCreateValidate(requestBody)
@@ -265,7 +473,7 @@ func SecretsCreate(cfg *config.Config, client secrets.SecretManagerClient, w htt
 		return
 	}
 	valueBytes, _ := base64.StdEncoding.DecodeString(requestBody.Value)
-	err = secrets.SecretCreate(r.Context(), client, projectNumber, requestBody.Id, valueBytes)
+	err = store.Create(r.Context(), requestBody.Id, valueBytes, owners, requestBody.rotation())
 	if err != nil && strings.Contains(err.Error(), "AlreadyExists") {
 		// already exists case should 409
 		log.Infof("error creating secret: err=%s", err.Error())
@@ -280,19 +488,13 @@ func SecretsCreate(cfg *config.Config, client secrets.SecretManagerClient, w htt
 		return
 	}
 
-	// secret was created, so set the resource permissions
-	secretName := fmt.Sprintf("projects/%s/secrets/%s", projectNumber, requestBody.Id)
-	err = secrets.SecretIamSet(r.Context(), client, secretName, requestBody.OwnerUser, requestBody.OwnerGroup, cfg.SecretsServiceAccounts)
-	if err != nil {
-		log.Warnf("error setting permissions on secret err=%s", err.Error())
-	}
-
-	responseBody, err := json.Marshal(secrets.SecretEntry{
+	entry := secrets.SecretEntry{
 		Urn:            fmt.Sprintf("urn:arryved:secret:%s", requestBody.Id),
-		OwnerGroup:     requestBody.OwnerGroup,
-		OwnerUser:      requestBody.OwnerUser,
 		CreatedEpochNs: time.Now().UnixNano(),
-	})
+		SecretRotation: requestBody.rotation(),
+	}
+	entry.SetOwners(owners)
+	responseBody, err := json.Marshal(entry)
 	if err != nil {
 		log.Errorf("error marshalling secret entry: err=%s", err.Error())
 		msg := fmt.Errorf("error marshalling secret; have the app administrator check the logs")
@@ -306,9 +508,46 @@ func SecretsCreate(cfg *config.Config, client secrets.SecretManagerClient, w htt
 	return
 }
 
-// DELETE secret
-func SecretsDelete(cfg *config.Config, client secrets.SecretManagerClient, w http.ResponseWriter, r *http.Request, secretId, projectNumber string) {
-	err := secrets.SecretDelete(r.Context(), client, projectNumber, secretId)
+// DELETE secret; refused while any compiled config references it, or any can't be checked, unless ?force=true
+func SecretsDelete(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
+	force := r.URL.Query().Get("force") == "true"
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditEntry.Param("force", strconv.FormatBool(force))
+	}
+	if !force {
+		env := r.Context().Value(EnvKey).(string)
+		usages, unchecked, err := secretUsages(r.Context(), cfg, env, secretId)
+		if err != nil {
+			log.Errorf("error finding usages of secretId=%s env=%s: err=%s", secretId, env, err.Error())
+			msg := fmt.Errorf("error checking whether the secret is in use; have the app administrator check the logs, or delete with force=true")
+			handleInternalServerError(w, msg)
+			return
+		}
+		if len(usages) > 0 || len(unchecked) > 0 {
+			log.Infof("refusing to delete secretId=%s env=%s referenced by %d configs, %d unchecked",
+				secretId, env, len(usages), len(unchecked))
+			msg := fmt.Sprintf("secret is referenced by %d configs; update them first or delete with force=true", len(usages))
+			if len(usages) == 0 {
+				msg = fmt.Sprintf("%d configs couldn't be checked for references to the secret; fix them first or delete with force=true", len(unchecked))
+			}
+			responseBody, err := json.Marshal(SecretInUseResponse{
+				Error:     msg,
+				Usages:    usages,
+				Unchecked: unchecked,
+			})
+			if err != nil {
+				log.Errorf("error marshalling usages: err=%s", err.Error())
+				handleInternalServerError(w, err)
+				return
+			}
+			httpStatus := http.StatusConflict // 409
+			log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+			w.WriteHeader(httpStatus)
+			w.Write(responseBody)
+			return
+		}
+	}
+	err := store.Delete(r.Context(), secretId)
 	if err != nil {
 		log.Errorf("error deleting secret: err=%s", err.Error())
 		msg := fmt.Errorf("error deleting secret; have the app administrator check the logs")
@@ -322,7 +561,7 @@ func SecretsDelete(cfg *config.Config, client secrets.SecretManagerClient, w htt
 }
 
 // UPDATE secret
-func SecretsUpdate(cfg *config.Config, client secrets.SecretManagerClient, w http.ResponseWriter, r *http.Request, secretId, projectNumber string) {
+func SecretsUpdate(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
 	// parse the PATCH json request body (via r *http.Request) into a SecretRequest
 	var requestBody SecretRequest
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
@@ -334,8 +573,16 @@ func SecretsUpdate(cfg *config.Config, client secrets.SecretManagerClient, w htt
 		handleBadRequest(w, msg)
 		return
 	}
-	valueBytes, _ := base64.StdEncoding.DecodeString(requestBody.Value)
-	err = secrets.SecretUpdate(r.Context(), client, projectNumber, secretId, valueBytes)
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditRotation(auditEntry, requestBody)
+	}
+	if requestBody.HasRotation() {
+		_, err = store.SetRotation(r.Context(), secretId, requestBody.rotationUpdate())
+	}
+	if err == nil && len(requestBody.Value) > 0 {
+		valueBytes, _ := base64.StdEncoding.DecodeString(requestBody.Value)
+		err = store.Update(r.Context(), secretId, valueBytes)
+	}
 	if err != nil && strings.Contains(err.Error(), "NotFound") {
 		// capture the 404 case
 		log.Errorf("error updating secret: err=%s", err.Error())
@@ -355,6 +602,478 @@ func SecretsUpdate(cfg *config.Config, client secrets.SecretManagerClient, w htt
 	return
 }
 
+// LIST a secret's versions; no values, only salted fingerprints
+func SecretsVersionList(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
+	versions, err := store.Versions(r.Context(), secretId)
+	if err != nil && strings.Contains(err.Error(), "NotFound") {
+		log.Infof("error listing secret versions: err=%s", err.Error())
+		handleNotFound(w, "error listing secret versions; could not find it")
+		return
+	}
+	if err != nil {
+		log.Errorf("error listing versions of secretId=%s: err=%s", secretId, err.Error())
+		msg := fmt.Errorf("error listing secret versions; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	responseBody, err := json.Marshal(versions)
+	if err != nil {
+		log.Errorf("error marshalling secret versions: err=%s", err.Error())
+		msg := fmt.Errorf("error listing secret versions; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+	return
+}
+
+// READ a specific version of a secret
+func SecretsReadVersion(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId, version string) {
+	if _, err := strconv.ParseInt(version, 10, 64); err != nil {
+		msg := fmt.Sprintf("invalid version=%s; expected a version number", strings.ReplaceAll(version, "\"", ""))
+		handleBadRequest(w, msg)
+		return
+	}
+	value, err := store.Read(r.Context(), secretId, version)
+	if err != nil && strings.Contains(err.Error(), "NotFound") {
+		log.Infof("error getting secret version: err=%s", err.Error())
+		handleNotFound(w, "error getting secret version; could not find it")
+		return
+	}
+	if err != nil && strings.Contains(err.Error(), "FailedPrecondition") {
+		// disabled or destroyed
+		log.Infof("error getting secret version: err=%s", err.Error())
+		handleConflict(w, "error getting secret version; it is disabled or destroyed")
+		return
+	}
+	if err != nil {
+		log.Errorf("error getting secretId=%s version=%s: err=%s", secretId, version, err.Error())
+		msg := fmt.Errorf("error getting secret; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	// same format as SecretsRead, a json string of base64-encoded bytes
+	responseBody, err := json.Marshal(value)
+	if err != nil {
+		log.Errorf("error marshalling secret: err=%s", err.Error())
+		msg := fmt.Errorf("error getting secret; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+	return
+}
+
+// ROLLBACK a secret, by adding an old version's value as the latest
+func SecretsRollback(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
+	var requestBody SecretRollbackRequest
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil || requestBody.Version < 1 {
+		msg := fmt.Sprintf("invalid request body; expected a version number to roll back to")
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditEntry.Param("rollbackTo", strconv.FormatInt(requestBody.Version, 10))
+	}
+	newVersion, err := store.Rollback(r.Context(), secretId, requestBody.Version)
+	if err != nil && strings.Contains(err.Error(), "NotFound") {
+		log.Infof("error rolling back secret: err=%s", err.Error())
+		handleNotFound(w, "error rolling back secret; could not find the secret or version")
+		return
+	}
+	if err != nil && strings.Contains(err.Error(), "FailedPrecondition") {
+		log.Infof("error rolling back secret: err=%s", err.Error())
+		handleConflict(w, "error rolling back secret; the version is disabled or destroyed")
+		return
+	}
+	if err != nil {
+		log.Errorf("error rolling back secretId=%s to version=%d: err=%s", secretId, requestBody.Version, err.Error())
+		msg := fmt.Errorf("error rolling back secret; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	responseBody, err := json.Marshal(SecretRollbackResponse{Version: newVersion, RestoredFrom: requestBody.Version})
+	if err != nil {
+		log.Errorf("error marshalling rollback response: err=%s", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+	return
+}
+
+// USAGES of a secret: every app/version/region/variant whose compiled config in env references it
+func SecretsUsages(cfg *config.Config, w http.ResponseWriter, r *http.Request, secretId string) {
+	env := r.Context().Value(EnvKey).(string)
+	usages, _, err := secretUsages(r.Context(), cfg, env, secretId)
+	if err != nil {
+		log.Errorf("error finding usages of secretId=%s env=%s: err=%s", secretId, env, err.Error())
+		msg := fmt.Errorf("error finding secret usages; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	responseBody, err := json.Marshal(usages)
+	if err != nil {
+		log.Errorf("error marshalling usages: err=%s", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+	return
+}
+
+func secretUsages(ctx context.Context, cfg *config.Config, env, secretId string) ([]product.SecretUsage, []string, error) {
+	storageClient, err := newConfigStorageClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return product.SecretUsages(storageClient, cfg.Artifacts.ConfigBucket, cfg.Topology, env, secretId)
+}
+
+// SET OWNERS of a secret, replacing them (a transfer to another team) or adding to them; responds with the new owners
+func SecretsSetOwners(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
+	var requestBody SecretOwnersRequest
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil {
+		msg := fmt.Sprintf("could not decode request body; err=%s", err.Error())
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+	owners := secrets.Owners{Users: requestBody.OwnerUsers, Groups: requestBody.OwnerGroups}.Normalized()
+	if requestBody.Add {
+		current, err := store.Owners(r.Context(), secretId)
+		if err != nil {
+			log.Errorf("error getting owners of secretId=%s: err=%s", secretId, err.Error())
+			msg := fmt.Errorf("error setting secret owners; have the app administrator check the logs")
+			handleInternalServerError(w, msg)
+			return
+		}
+		owners = current.Union(owners)
+	}
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditEntry.Param("add", strconv.FormatBool(requestBody.Add))
+		auditOwners(auditEntry, owners)
+	}
+	if err := SecretOwnersRequestValidate(requestBody, owners); err != nil {
+		msg := fmt.Sprintf("invalid request body; err=%s", err.Error())
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+	err = store.SetOwners(r.Context(), secretId, owners)
+	if err != nil && strings.Contains(err.Error(), "NotFound") {
+		log.Infof("error setting secret owners: err=%s", err.Error())
+		handleNotFound(w, "error setting secret owners; could not find the secret")
+		return
+	}
+	if err != nil {
+		log.Errorf("error setting owners of secretId=%s: err=%s", secretId, err.Error())
+		msg := fmt.Errorf("error setting secret owners; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	responseBody, err := json.Marshal(owners)
+	if err != nil {
+		log.Errorf("error marshalling owners: err=%s", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+	return
+}
+
+// COPY a secret's latest value, with its owners, into another env; the caller owns the source (checked by the
+// handler) and must be allowed to create in the destination, and to update there if the copy already exists
+func SecretsCopy(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, secretId string) {
+	var requestBody SecretCopyRequest
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil {
+		msg := fmt.Sprintf("could not decode request body; err=%s", err.Error())
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+	if requestBody.DestinationId == "" {
+		requestBody.DestinationId = secretId
+	}
+	env := r.Context().Value(EnvKey).(string)
+	destinationUrn := fmt.Sprintf("urn:arryved:secret:%s", requestBody.DestinationId)
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditEntry.Param("destinationEnv", requestBody.DestinationEnv)
+		auditEntry.Param("destinationId", requestBody.DestinationId)
+		auditEntry.Param("replaceOwners", strconv.FormatBool(requestBody.ReplaceOwners))
+	}
+	if err := SecretCopyRequestValidate(requestBody, env, secretId, envsFromConfig(cfg)); err != nil {
+		msg := fmt.Sprintf("invalid request body; err=%s", err.Error())
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+
+	destination, err := secrets.NewEnvStore(r.Context(), cfg, requestBody.DestinationEnv)
+	if err != nil {
+		log.Errorf("error getting a secret store env=%s: err=%s", requestBody.DestinationEnv, err.Error())
+		msg := fmt.Errorf("error copying secret; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	defer destination.Close()
+	identity := r.Context().Value(IdentityKey).(model.Identity)
+	if err := authorize(r.Context(), cfg, destination, identity, config.SecretsCreate, destinationUrn); err != nil {
+		log.Infof("user not authorized to create copy env=%s err=%s", requestBody.DestinationEnv, err.Error())
+		handleForbidden(w, fmt.Sprintf("user not authorized to create secrets in env=%s", requestBody.DestinationEnv))
+		return
+	}
+
+	value, err := store.Read(r.Context(), secretId, "latest")
+	var owners secrets.Owners
+	if err == nil {
+		owners, err = store.Owners(r.Context(), secretId)
+	}
+	if err != nil && strings.Contains(err.Error(), "NotFound") {
+		log.Infof("error copying secret: err=%s", err.Error())
+		handleNotFound(w, "error copying secret; could not find it")
+		return
+	}
+	if err != nil {
+		log.Errorf("error reading secretId=%s to copy: err=%s", secretId, err.Error())
+		msg := fmt.Errorf("error copying secret; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	err = destination.Create(r.Context(), requestBody.DestinationId, value, owners, secrets.SecretRotation{})
+	if err != nil && strings.Contains(err.Error(), "AlreadyExists") {
+		copySecretVersion(cfg, destination, w, r, requestBody, value, owners)
+		return
+	}
+	if err != nil {
+		log.Errorf("error copying secretId=%s to env=%s: err=%s", secretId, requestBody.DestinationEnv, err.Error())
+		msg := fmt.Errorf("error copying secret; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditOwners(auditEntry, owners)
+	}
+	log.Infof("copied secretId=%s env=%s to secretId=%s env=%s", secretId, env, requestBody.DestinationId, requestBody.DestinationEnv)
+	writeSecretCopied(w, r, SecretCopyResponse{Urn: destinationUrn, Env: requestBody.DestinationEnv, Created: true})
+}
+
+// the copy already exists in the destination, so it gets the value as a new version, provided the caller could update
+// it. It keeps its owners unless the request says to replace them with the source's; a replacement is audited.
+func copySecretVersion(cfg *config.Config, destination secrets.Store, w http.ResponseWriter, r *http.Request,
+	requestBody SecretCopyRequest, value []byte, owners secrets.Owners) {
+	destinationUrn := fmt.Sprintf("urn:arryved:secret:%s", requestBody.DestinationId)
+	identity := r.Context().Value(IdentityKey).(model.Identity)
+	if err := authorize(r.Context(), cfg, destination, identity, config.SecretsUpdate, destinationUrn); err != nil {
+		log.Infof("user not authorized to update copy env=%s err=%s", requestBody.DestinationEnv, err.Error())
+		handleForbidden(w, fmt.Sprintf("secret already exists in env=%s and user is not authorized to update it", requestBody.DestinationEnv))
+		return
+	}
+	var previousOwners secrets.Owners
+	err := destination.Update(r.Context(), requestBody.DestinationId, value)
+	if err == nil && requestBody.ReplaceOwners {
+		previousOwners, err = destination.Owners(r.Context(), requestBody.DestinationId)
+		if err == nil {
+			err = destination.SetOwners(r.Context(), requestBody.DestinationId, owners)
+		}
+	}
+	if err != nil {
+		log.Errorf("error updating copy secretId=%s env=%s: err=%s", requestBody.DestinationId, requestBody.DestinationEnv, err.Error())
+		msg := fmt.Errorf("error copying secret; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	if auditEntry, ok := w.(*auditRecorder); ok && requestBody.ReplaceOwners {
+		auditEntry.Param("previousOwnerUsers", strings.Join(previousOwners.Users, ","))
+		auditEntry.Param("previousOwnerGroups", strings.Join(previousOwners.Groups, ","))
+		auditOwners(auditEntry, owners)
+	}
+	log.Infof("copied to existing secretId=%s env=%s replaceOwners=%t", requestBody.DestinationId, requestBody.DestinationEnv,
+		requestBody.ReplaceOwners)
+	writeSecretCopied(w, r, SecretCopyResponse{Urn: destinationUrn, Env: requestBody.DestinationEnv, Created: false})
+}
+
+func writeSecretCopied(w http.ResponseWriter, r *http.Request, response SecretCopyResponse) {
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		log.Errorf("error marshalling copy response: err=%s", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+}
+
+// FINGERPRINT a secret version (?version=n; latest by default)
+func SecretsFingerprint(cfg *config.Config, store secrets.Store, fingerprinter *secrets.Fingerprinter,
+	w http.ResponseWriter, r *http.Request, secretId string) {
+	if fingerprinter == nil {
+		handleBadRequest(w, "secret fingerprints are not configured on this instance")
+		return
+	}
+	env := r.Context().Value(EnvKey).(string)
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		version = "latest"
+	}
+	if err := SecretVersionValidate(version); err != nil {
+		handleBadRequest(w, err.Error())
+		return
+	}
+	result, err := secretFingerprint(r.Context(), store, fingerprinter, env, secretId, version)
+	if err != nil && strings.Contains(err.Error(), "NotFound") {
+		log.Infof("error fingerprinting secret: err=%s", err.Error())
+		handleNotFound(w, "error fingerprinting secret; could not find the secret or version")
+		return
+	}
+	if err != nil {
+		log.Errorf("error fingerprinting secretId=%s version=%s: err=%s", secretId, version, err.Error())
+		msg := fmt.Errorf("error fingerprinting secret; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	responseBody, err := json.Marshal(result)
+	if err != nil {
+		log.Errorf("error marshalling fingerprint: err=%s", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+	return
+}
+
+// COMPARE a secret version (?version=) with another (?otherEnv=&otherId=&otherVersion=), each defaulting to this
+// env, this secret and the latest version
+func SecretsCompare(cfg *config.Config, store secrets.Store, fingerprinter *secrets.Fingerprinter,
+	w http.ResponseWriter, r *http.Request, secretId string) {
+	if fingerprinter == nil {
+		handleBadRequest(w, "secret fingerprints are not configured on this instance")
+		return
+	}
+	env := r.Context().Value(EnvKey).(string)
+	query := r.URL.Query()
+	version := valueOr(query.Get("version"), "latest")
+	otherEnv := valueOr(query.Get("otherEnv"), env)
+	otherId := valueOr(query.Get("otherId"), secretId)
+	otherVersion := valueOr(query.Get("otherVersion"), "latest")
+	for _, err := range []error{SecretVersionValidate(version), SecretVersionValidate(otherVersion)} {
+		if err != nil {
+			handleBadRequest(w, err.Error())
+			return
+		}
+	}
+	if !envsFromConfig(cfg)[otherEnv] {
+		handleBadRequest(w, fmt.Sprintf("otherEnv=%s not supported by this instance", otherEnv))
+		return
+	}
+
+	otherStore := store
+	if otherEnv != env {
+		var err error
+		otherStore, err = secrets.NewEnvStore(r.Context(), cfg, otherEnv)
+		if err != nil {
+			log.Errorf("error getting a secret store env=%s: err=%s", otherEnv, err.Error())
+			msg := fmt.Errorf("error comparing secrets; have the app administrator check the logs")
+			handleInternalServerError(w, msg)
+			return
+		}
+		defer otherStore.Close()
+	}
+	comparison := SecretComparison{}
+	secret, err := secretFingerprint(r.Context(), store, fingerprinter, env, secretId, version)
+	if err == nil {
+		comparison.Secret = secret
+		comparison.Other, err = secretFingerprint(r.Context(), otherStore, fingerprinter, otherEnv, otherId, otherVersion)
+	}
+	if err != nil && strings.Contains(err.Error(), "NotFound") {
+		log.Infof("error comparing secrets: err=%s", err.Error())
+		handleNotFound(w, "error comparing secrets; could not find a secret or version")
+		return
+	}
+	if err != nil {
+		log.Errorf("error comparing secretId=%s with env=%s secretId=%s: err=%s", secretId, otherEnv, otherId, err.Error())
+		msg := fmt.Errorf("error comparing secrets; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	comparison.Equal = secrets.FingerprintsEqual(comparison.Secret.Fingerprint, comparison.Other.Fingerprint)
+	responseBody, err := json.Marshal(comparison)
+	if err != nil {
+		log.Errorf("error marshalling comparison: err=%s", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+	return
+}
+
+func secretFingerprint(ctx context.Context, store secrets.Store, fingerprinter *secrets.Fingerprinter,
+	env, secretId, version string) (SecretFingerprint, error) {
+	value, err := store.Read(ctx, secretId, version)
+	if err != nil {
+		return SecretFingerprint{}, err
+	}
+	return SecretFingerprint{
+		Urn:         fmt.Sprintf("urn:arryved:secret:%s", secretId),
+		Env:         env,
+		Version:     version,
+		Fingerprint: fingerprinter.Fingerprint(value),
+	}, nil
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// the owners a request leaves a secret with, as audit params
+func auditOwners(auditEntry *auditRecorder, owners secrets.Owners) {
+	auditEntry.Param("ownerUsers", strings.Join(owners.Users, ","))
+	auditEntry.Param("ownerGroups", strings.Join(owners.Groups, ","))
+}
+
+// the rotation policy fields a request sets, as audit params
+func auditRotation(auditEntry *auditRecorder, requestBody SecretRequest) {
+	if requestBody.RotationPeriodDays != nil {
+		auditEntry.Param("rotationPeriodDays", strconv.Itoa(*requestBody.RotationPeriodDays))
+	}
+	if requestBody.ExpiresEpochNs != nil {
+		auditEntry.Param("expiresEpochNs", strconv.FormatInt(*requestBody.ExpiresEpochNs, 10))
+	}
+	if requestBody.Description != nil {
+		auditEntry.Param("description", *requestBody.Description)
+	}
+}
+
 func envsFromConfig(cfg *config.Config) map[string]bool {
 	envs := map[string]bool{}
 	for env, _ := range cfg.Topology {
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/secrets"
+)
+
+// Web handler for the endpoint: GET /secrets-backup/{env} exports every secret in env as a bundle encrypted to the
+// configured recipient, POST /secrets-backup/{env}?onConflict=skip|overwrite|fail imports one. Both are audited.
+func ConfiguredHandlerSecretsBackup(cfg *config.Config, auditLog audit.Log) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		urlElements := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+		if len(urlElements) != 3 || urlElements[2] == "" ||
+			(r.Method != http.MethodGet && r.Method != http.MethodPost) {
+			msg := fmt.Sprintf("%s and/or uri not valid for this endpoint", r.Method)
+			handleMethodNotAllowed(w, msg)
+			return
+		}
+		env := urlElements[2]
+		backupUrn := fmt.Sprintf("urn:arryved:env:%s:backup:secrets", env)
+
+		// exports carry every value in the env, so they're audited along with imports
+		auditEntry := startAudit(auditLog, w, r, config.SecretsBackup)
+		defer auditEntry.Commit()
+		auditEntry.Target(backupUrn)
+		auditEntry.Param("env", env)
+		if r.Method == http.MethodGet {
+			auditEntry.Param("operation", "export")
+		} else {
+			auditEntry.Param("operation", "import")
+			auditEntry.Param("onConflict", r.URL.Query().Get("onConflict"))
+		}
+		w = auditEntry
+
+		// user authenticated?
+		identity, err := authenticate(cfg, r)
+		if err != nil {
+			msg := fmt.Sprintf("user not authenticated: %s", err.Error())
+			handleUnauthorized(w, msg)
+			return
+		}
+		auditEntry.Principal(identity.PrincipalUrn())
+
+		// valid env?
+		if !envsFromConfig(cfg)[env] {
+			msg := fmt.Sprintf("requested env=%s not supported by this instance", env)
+			log.Info(msg)
+			handleBadRequest(w, msg)
+			return
+		}
+
+		// user authorized to back up secrets? granted only through access entries, never by secret ownership
+		if err := authorize(r.Context(), cfg, nil, identity, config.SecretsBackup, backupUrn); err != nil {
+			log.Infof("user not authorized for secrets backup err=%s", err.Error())
+			msg := fmt.Sprintf("user not authorized for secrets backup")
+			handleForbidden(w, msg)
+			return
+		}
+
+		store, err := secrets.NewEnvStore(r.Context(), cfg, env)
+		if err != nil {
+			log.Errorf("error getting a secret store: err=%s", err.Error())
+			msg := fmt.Errorf("error backing up secrets; have the app administrator check the logs")
+			handleInternalServerError(w, msg)
+			return
+		}
+		defer store.Close()
+
+		if r.Method == http.MethodGet {
+			SecretsExport(cfg, store, w, r, env)
+			return
+		}
+		SecretsImport(cfg, store, w, r, env)
+	}
+}
+
+// EXPORT every secret in env
+func SecretsExport(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, env string) {
+	if cfg.Secrets.BackupRecipientKeyPath == "" {
+		handleBadRequest(w, "secret export is not configured on this instance")
+		return
+	}
+	recipient, err := secrets.LoadBundleRecipient(cfg.Secrets.BackupRecipientKeyPath)
+	if err != nil {
+		log.Errorf("error loading the backup recipient key: err=%s", err.Error())
+		msg := fmt.Errorf("error exporting secrets; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	bundle, err := secrets.Export(r.Context(), store, env)
+	if err != nil {
+		log.Errorf("error exporting secrets env=%s: err=%s", env, err.Error())
+		msg := fmt.Errorf("error exporting secrets; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	encrypted, err := secrets.SealBundle(bundle, recipient)
+	if err != nil {
+		log.Errorf("error encrypting secrets bundle env=%s: err=%s", env, err.Error())
+		msg := fmt.Errorf("error exporting secrets; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditEntry.Param("count", fmt.Sprintf("%d", encrypted.Count))
+	}
+	responseBody, err := json.Marshal(encrypted)
+	if err != nil {
+		log.Errorf("error marshalling secrets bundle: err=%s", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	log.Infof("exported secrets env=%s count=%d", env, encrypted.Count)
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+}
+
+// IMPORT a bundle (the body, as exported) into env
+func SecretsImport(cfg *config.Config, store secrets.Store, w http.ResponseWriter, r *http.Request, env string) {
+	onConflict := r.URL.Query().Get("onConflict")
+	if onConflict == "" {
+		onConflict = secrets.OnConflictFail
+	}
+	if err := SecretImportValidate(onConflict); err != nil {
+		handleBadRequest(w, err.Error())
+		return
+	}
+	if cfg.Secrets.BackupPrivateKeyPath == "" {
+		handleBadRequest(w, "secret import is not configured on this instance")
+		return
+	}
+	var encrypted secrets.EncryptedBundle
+	if err := json.NewDecoder(r.Body).Decode(&encrypted); err != nil {
+		msg := fmt.Sprintf("invalid request body: %s", r.URL)
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+	key, err := secrets.LoadBundleKey(cfg.Secrets.BackupPrivateKeyPath)
+	if err != nil {
+		log.Errorf("error loading the backup private key: err=%s", err.Error())
+		msg := fmt.Errorf("error importing secrets; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	bundle, err := secrets.OpenBundle(&encrypted, key)
+	if err != nil {
+		log.Infof("could not open secrets bundle: err=%s", err.Error())
+		handleBadRequest(w, "could not decrypt the bundle; it's damaged or wasn't encrypted to this instance's key")
+		return
+	}
+	if err := SecretBundleValidate(bundle); err != nil {
+		handleBadRequest(w, strings.ReplaceAll(err.Error(), "\"", ""))
+		return
+	}
+	if bundle.Env != env {
+		log.Warnf("importing secrets exported from env=%s into env=%s", bundle.Env, env)
+	}
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditEntry.Param("sourceEnv", bundle.Env)
+		auditEntry.Param("count", fmt.Sprintf("%d", len(bundle.Secrets)))
+	}
+
+	result, err := secrets.Import(r.Context(), store, bundle, onConflict)
+	if err != nil && errors.Is(err, secrets.ErrConflict) {
+		log.Infof("refusing secrets import env=%s: err=%s", env, err.Error())
+		handleConflict(w, strings.ReplaceAll(err.Error(), "\"", ""))
+		return
+	}
+	if err != nil {
+		log.Errorf("error importing secrets env=%s: err=%s", env, err.Error())
+		msg := fmt.Errorf("error importing secrets; have the app administrator check the logs")
+		handleInternalServerError(w, msg)
+		return
+	}
+	responseBody, err := json.Marshal(result)
+	if err != nil {
+		log.Errorf("error marshalling import result: err=%s", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	httpStatus := http.StatusOK
+	log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+	w.WriteHeader(httpStatus)
+	w.Write(responseBody)
+}
@@ -0,0 +1,108 @@
+//go:build !integration
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/secrets"
+)
+
+// point cfg's backup settings at a fresh RSA key pair
+func withBackupKeys(t *testing.T, cfg *config.Config) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	cfg.Secrets.BackupRecipientKeyPath = filepath.Join(dir, "backup.pub")
+	cfg.Secrets.BackupPrivateKeyPath = filepath.Join(dir, "backup.key")
+	assert.NoError(t, os.WriteFile(cfg.Secrets.BackupRecipientKeyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}), 0600))
+	assert.NoError(t, os.WriteFile(cfg.Secrets.BackupPrivateKeyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+}
+
+func TestSecretsBackup(t *testing.T) {
+	assert := assert.New(t)
+	cfg := localSecretsConfig(t)
+	cfg.Topology["staging"] = config.Environment{}
+	auditLog := audit.NewMemoryLog()
+	secretsHandler := http.HandlerFunc(ConfiguredHandlerSecrets(cfg, audit.NewMemoryLog(), nil, testFingerprinter(t)))
+	backupHandler := http.HandlerFunc(ConfiguredHandlerSecretsBackup(cfg, auditLog))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+	call := func(handler http.Handler, method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	value := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+	create := fmt.Sprintf(`{"id": "db-password", "ownerGroup": "team@arryved.com", "value": "%s"}`, value)
+	assert.Equal(http.StatusOK, call(secretsHandler, "POST", "/secrets/dev", create).Code)
+
+	// refused until a recipient is configured
+	recorder := call(backupHandler, "GET", "/secrets-backup/dev", "")
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+	withBackupKeys(t, cfg)
+
+	recorder = call(backupHandler, "GET", "/secrets-backup/dev", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.NotContains(recorder.Body.String(), value)
+	exported := recorder.Body.String()
+	encrypted := secrets.EncryptedBundle{}
+	assert.NoError(json.Unmarshal([]byte(exported), &encrypted))
+	assert.Equal("dev", encrypted.Env)
+	assert.Equal(1, encrypted.Count)
+
+	// restore into another env
+	recorder = call(backupHandler, "POST", "/secrets-backup/staging", exported)
+	assert.Equal(http.StatusOK, recorder.Code)
+	result := secrets.ImportResult{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal([]string{"db-password"}, result.Created)
+	recorder = call(secretsHandler, "GET", "/secrets/staging/db-password", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Equal(fmt.Sprintf(`"%s"`, value), recorder.Body.String())
+
+	// conflicts fail by default
+	recorder = call(backupHandler, "POST", "/secrets-backup/staging", exported)
+	assert.Equal(http.StatusConflict, recorder.Code)
+	assert.Contains(recorder.Body.String(), "db-password")
+	recorder = call(backupHandler, "POST", "/secrets-backup/staging?onConflict=skip", exported)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.Equal([]string{"db-password"}, result.Skipped)
+
+	assert.Equal(http.StatusBadRequest, call(backupHandler, "POST", "/secrets-backup/staging?onConflict=merge", exported).Code)
+	assert.Equal(http.StatusBadRequest, call(backupHandler, "POST", "/secrets-backup/staging", `{"format": "nope"}`).Code)
+	assert.Equal(http.StatusBadRequest, call(backupHandler, "GET", "/secrets-backup/prod", "").Code)
+	assert.Equal(http.StatusMethodNotAllowed, call(backupHandler, "DELETE", "/secrets-backup/dev", "").Code)
+
+	// exports are audited as well as imports
+	entries, err := auditLog.List(context.Background())
+	assert.NoError(err)
+	assert.Len(entries, 8)
+	assert.Equal(config.SecretsBackup, entries[1].Action)
+	assert.Equal("urn:arryved:env:dev:backup:secrets", entries[1].Target)
+	assert.Equal("export", entries[1].Params["operation"])
+	assert.Equal("1", entries[1].Params["count"])
+	assert.Equal("dev", entries[2].Params["sourceEnv"])
+}
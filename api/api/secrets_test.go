@@ -0,0 +1,411 @@
+//go:build !integration
+
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/config/product"
+	"github.com/arryved/app-ctrl/api/config/storage"
+	"github.com/arryved/app-ctrl/api/secrets"
+)
+
+// mock config, with secrets kept in a local store under a temp dir
+func localSecretsConfig(t *testing.T) *config.Config {
+	cfg := config.Load("../config/mock-config.yml")
+	key := make([]byte, 32)
+	rand.Read(key)
+	keyPath := filepath.Join(t.TempDir(), "master.key")
+	assert.NoError(t, os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)), 0600))
+	cfg.Secrets = config.SecretsConfig{Backend: "local", Path: t.TempDir(), MasterKeyPath: keyPath}
+	return cfg
+}
+
+// fingerprints keyed with a random key
+func testFingerprinter(t *testing.T) *secrets.Fingerprinter {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "fingerprint.key")
+	assert.NoError(t, os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)), 0600))
+	fingerprinter, err := secrets.NewFingerprinter(keyPath)
+	assert.NoError(t, err)
+	return fingerprinter
+}
+
+// a config bucket holding configballs by object name
+type fakeConfigBucket map[string][]byte
+
+func (b fakeConfigBucket) ListObjects(bucketName string) ([]storage.StorageObject, error) {
+	objects := []storage.StorageObject{}
+	for name, contents := range b {
+		objects = append(objects, fakeConfigObject{name: name, contents: contents})
+	}
+	return objects, nil
+}
+
+type fakeConfigObject struct {
+	name     string
+	contents []byte
+}
+
+func (o fakeConfigObject) GetContents() ([]byte, error) { return o.contents, nil }
+func (o fakeConfigObject) GetName() string              { return o.name }
+
+// a configball with just a defaults layer
+func defaultsConfigBall(t *testing.T, defaults string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	assert.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: ".arryved/config/defaults.yaml", Mode: 0644, Size: int64(len(defaults))}))
+	_, err := tarWriter.Write([]byte(defaults))
+	assert.NoError(t, err)
+	assert.NoError(t, tarWriter.Close())
+	assert.NoError(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+// serve the config bucket from bucket for the duration of the test
+func withConfigBucket(t *testing.T, bucket fakeConfigBucket) {
+	original := newConfigStorageClient
+	newConfigStorageClient = func(ctx context.Context) (storage.StorageClient, error) {
+		return bucket, nil
+	}
+	t.Cleanup(func() { newConfigStorageClient = original })
+}
+
+func TestSecretsLocalBackend(t *testing.T) {
+	assert := assert.New(t)
+	cfg := localSecretsConfig(t)
+	withConfigBucket(t, fakeConfigBucket{})
+	handler := http.HandlerFunc(ConfiguredHandlerSecrets(cfg, audit.NewMemoryLog(), nil, testFingerprinter(t)))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+	call := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	value := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+
+	create := fmt.Sprintf(`{"id": "db-password", "ownerGroup": "team@arryved.com", "value": "%s", "rotationPeriodDays": 30}`, value)
+	recorder := call("POST", "/secrets/dev", create)
+	assert.Equal(http.StatusOK, recorder.Code)
+	recorder = call("POST", "/secrets/dev", create)
+	assert.Equal(http.StatusConflict, recorder.Code)
+
+	recorder = call("GET", "/secrets/dev/db-password", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	read := []byte{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &read))
+	assert.Equal([]byte("hunter2"), read)
+
+	// a rotation policy change alone leaves the value be
+	recorder = call("PATCH", "/secrets/dev/db-password", `{"description": "rotate in the vendor portal"}`)
+	assert.Equal(http.StatusNoContent, recorder.Code)
+	recorder = call("GET", "/secrets/dev", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	entries := []secrets.SecretEntry{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(entries, 1)
+	assert.Equal("mockuser@example.com", entries[0].OwnerUser)
+	assert.Equal(secrets.SecretRotation{RotationPeriodDays: 30, Description: "rotate in the vendor portal"}, entries[0].SecretRotation)
+	recorder = call("GET", "/secrets/dev/db-password/versions", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	versions := secrets.SecretVersionList{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &versions))
+	assert.Len(versions.Versions, 1)
+
+	// just rotated, so not stale
+	recorder = call("GET", "/secrets/dev?stale=true", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.JSONEq(`[]`, recorder.Body.String())
+
+	recorder = call("DELETE", "/secrets/dev/db-password", "")
+	assert.Equal(http.StatusNoContent, recorder.Code)
+	recorder = call("GET", "/secrets/dev/db-password/versions", "")
+	assert.Equal(http.StatusNotFound, recorder.Code)
+}
+
+func TestSecretsUsages(t *testing.T) {
+	assert := assert.New(t)
+	cfg := localSecretsConfig(t)
+	bucket := fakeConfigBucket{
+		"config-app=arryved-api,hash=abc,version=0.1.1.tar.gz": defaultsConfigBall(t,
+			"name: arryved-api\nfiles:\n  conf/db.pw: ${urn:arryved:secret:db-password}\n"),
+	}
+	withConfigBucket(t, bucket)
+	handler := http.HandlerFunc(ConfiguredHandlerSecrets(cfg, audit.NewMemoryLog(), nil, testFingerprinter(t)))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+	call := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	value := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+	recorder := call("POST", "/secrets/dev", fmt.Sprintf(`{"id": "db-password", "ownerGroup": "team@arryved.com", "value": "%s"}`, value))
+	assert.Equal(http.StatusOK, recorder.Code)
+
+	recorder = call("GET", "/secrets/dev/db-password/usages", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	usages := []product.SecretUsage{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &usages))
+	assert.Equal([]product.SecretUsage{
+		{App: "arryved-api", Version: "0.1.1", Env: "dev", Region: "central", Variant: "default", File: "conf/db.pw"},
+	}, usages)
+	recorder = call("GET", "/secrets/dev/other-secret/usages", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.JSONEq(`[]`, recorder.Body.String())
+
+	// still referenced, so only a forced delete goes through
+	recorder = call("DELETE", "/secrets/dev/db-password", "")
+	assert.Equal(http.StatusConflict, recorder.Code)
+	inUse := SecretInUseResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &inUse))
+	assert.Equal(usages, inUse.Usages)
+	recorder = call("GET", "/secrets/dev/db-password", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	recorder = call("DELETE", "/secrets/dev/db-password?force=true", "")
+	assert.Equal(http.StatusNoContent, recorder.Code)
+	recorder = call("GET", "/secrets/dev/db-password/versions", "")
+	assert.Equal(http.StatusNotFound, recorder.Code)
+
+	// a config that can't be checked might reference it, so that needs forcing too
+	recorder = call("POST", "/secrets/dev", fmt.Sprintf(`{"id": "unused", "ownerGroup": "team@arryved.com", "value": "%s"}`, value))
+	assert.Equal(http.StatusOK, recorder.Code)
+	bucket["config-app=arryved-api,hash=def,version=0.1.2.tar.gz"] = []byte("not a configball")
+	recorder = call("DELETE", "/secrets/dev/unused", "")
+	assert.Equal(http.StatusConflict, recorder.Code)
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &inUse))
+	assert.Empty(inUse.Usages)
+	assert.Equal([]string{"config-app=arryved-api,hash=def,version=0.1.2.tar.gz"}, inUse.Unchecked)
+	recorder = call("DELETE", "/secrets/dev/unused?force=true", "")
+	assert.Equal(http.StatusNoContent, recorder.Code)
+}
+
+func TestSecretsOwners(t *testing.T) {
+	assert := assert.New(t)
+	cfg := localSecretsConfig(t)
+	handler := http.HandlerFunc(ConfiguredHandlerSecrets(cfg, audit.NewMemoryLog(), nil, testFingerprinter(t)))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+	call := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	value := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+	create := fmt.Sprintf(`{"id": "db-password", "ownerGroup": "team@arryved.com", "ownerGroups": ["sre@arryved.com"], "ownerUsers": ["second@arryved.com"], "value": "%s"}`, value)
+	recorder := call("POST", "/secrets/dev", create)
+	assert.Equal(http.StatusOK, recorder.Code)
+	entry := secrets.SecretEntry{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entry))
+	assert.Equal([]string{"sre@arryved.com", "team@arryved.com"}, entry.OwnerGroups)
+	assert.Equal([]string{"mockuser@example.com", "second@arryved.com"}, entry.OwnerUsers)
+
+	// add an owner
+	recorder = call("PUT", "/secrets/dev/db-password/owners", `{"ownerGroups": ["ops@arryved.com"], "add": true}`)
+	assert.Equal(http.StatusOK, recorder.Code)
+	owners := secrets.Owners{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &owners))
+	assert.Equal([]string{"ops@arryved.com", "sre@arryved.com", "team@arryved.com"}, owners.Groups)
+	assert.Len(owners.Users, 2)
+
+	// transfer to another team
+	recorder = call("PUT", "/secrets/dev/db-password/owners", `{"ownerGroups": ["other-team@arryved.com"]}`)
+	assert.Equal(http.StatusOK, recorder.Code)
+	recorder = call("GET", "/secrets/dev", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	entries := []secrets.SecretEntry{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(entries, 1)
+	assert.Equal("other-team@arryved.com", entries[0].OwnerGroup)
+	assert.Equal([]string{"other-team@arryved.com"}, entries[0].OwnerGroups)
+	assert.Empty(entries[0].OwnerUsers)
+
+	// a secret keeps an owner group, and owners are arryved addresses
+	recorder = call("PUT", "/secrets/dev/db-password/owners", `{"ownerUsers": ["someone@arryved.com"]}`)
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+	recorder = call("PUT", "/secrets/dev/db-password/owners", `{"ownerGroups": ["team@example.com"]}`)
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+	recorder = call("PUT", "/secrets/dev/missing/owners", `{"ownerGroups": ["team@arryved.com"]}`)
+	assert.Equal(http.StatusNotFound, recorder.Code)
+
+	// owners aren't changed through an update
+	recorder = call("PATCH", "/secrets/dev/db-password", fmt.Sprintf(`{"ownerGroups": ["team@arryved.com"], "value": "%s"}`, value))
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+}
+
+func TestSecretsCopy(t *testing.T) {
+	assert := assert.New(t)
+	cfg := localSecretsConfig(t)
+	cfg.Topology["staging"] = config.Environment{}
+	auditLog := audit.NewMemoryLog()
+	handler := http.HandlerFunc(ConfiguredHandlerSecrets(cfg, auditLog, nil, testFingerprinter(t)))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+	call := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	read := func(url string) []byte {
+		recorder := call("GET", url, "")
+		assert.Equal(http.StatusOK, recorder.Code)
+		value := []byte{}
+		assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &value))
+		return value
+	}
+	value := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+	create := fmt.Sprintf(`{"id": "db-password", "ownerGroup": "team@arryved.com", "value": "%s"}`, value)
+	recorder := call("POST", "/secrets/dev", create)
+	assert.Equal(http.StatusOK, recorder.Code)
+
+	recorder = call("POST", "/secrets/dev/db-password/copy", `{"destinationEnv": "staging"}`)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.JSONEq(`{"urn": "urn:arryved:secret:db-password", "env": "staging", "created": true}`, recorder.Body.String())
+	assert.Equal([]byte("hunter2"), read("/secrets/staging/db-password"))
+	recorder = call("GET", "/secrets/staging", "")
+	entries := []secrets.SecretEntry{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(entries, 1)
+	assert.Equal([]string{"team@arryved.com"}, entries[0].OwnerGroups)
+	assert.Equal([]string{"mockuser@example.com"}, entries[0].OwnerUsers)
+
+	// copying again adds a version to the copy
+	recorder = call("PATCH", "/secrets/dev/db-password", fmt.Sprintf(`{"value": "%s"}`, base64.StdEncoding.EncodeToString([]byte("correct-horse"))))
+	assert.Equal(http.StatusNoContent, recorder.Code)
+	recorder = call("POST", "/secrets/dev/db-password/copy", `{"destinationEnv": "staging"}`)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.JSONEq(`{"urn": "urn:arryved:secret:db-password", "env": "staging", "created": false}`, recorder.Body.String())
+	assert.Equal([]byte("correct-horse"), read("/secrets/staging/db-password"))
+
+	// an existing copy keeps its owners, unless they're explicitly replaced
+	recorder = call("PUT", "/secrets/staging/db-password/owners", `{"ownerGroups": ["staging-team@arryved.com"]}`)
+	assert.Equal(http.StatusOK, recorder.Code)
+	owners := func() []string {
+		recorder := call("GET", "/secrets/staging", "")
+		entries := []secrets.SecretEntry{}
+		assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entries))
+		return entries[0].OwnerGroups
+	}
+	assert.Equal(http.StatusOK, call("POST", "/secrets/dev/db-password/copy", `{"destinationEnv": "staging"}`).Code)
+	assert.Equal([]string{"staging-team@arryved.com"}, owners())
+	recorder = call("POST", "/secrets/dev/db-password/copy", `{"destinationEnv": "staging", "replaceOwners": true}`)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Equal([]string{"team@arryved.com"}, owners())
+	auditEntries, err := auditLog.List(context.Background())
+	assert.NoError(err)
+	replaced := auditEntries[len(auditEntries)-1]
+	assert.Equal(config.SecretsCopy, replaced.Action)
+	assert.Equal("true", replaced.Params["replaceOwners"])
+	assert.Equal("staging-team@arryved.com", replaced.Params["previousOwnerGroups"])
+	assert.Equal("team@arryved.com", replaced.Params["ownerGroups"])
+
+	// under a new id in the same env
+	recorder = call("POST", "/secrets/dev/db-password/copy", `{"destinationEnv": "dev", "destinationId": "db-password-old"}`)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Equal([]byte("correct-horse"), read("/secrets/dev/db-password-old"))
+
+	recorder = call("POST", "/secrets/dev/db-password/copy", `{"destinationEnv": "dev"}`)
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+	recorder = call("POST", "/secrets/dev/db-password/copy", `{"destinationEnv": "prod"}`)
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+	recorder = call("POST", "/secrets/dev/missing/copy", `{"destinationEnv": "staging"}`)
+	assert.Equal(http.StatusNotFound, recorder.Code)
+}
+
+func TestSecretsFingerprintCompare(t *testing.T) {
+	assert := assert.New(t)
+	cfg := localSecretsConfig(t)
+	cfg.Topology["staging"] = config.Environment{}
+	handler := http.HandlerFunc(ConfiguredHandlerSecrets(cfg, audit.NewMemoryLog(), nil, testFingerprinter(t)))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+	call := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	create := func(env, id, value string) {
+		body := fmt.Sprintf(`{"id": "%s", "ownerGroup": "team@arryved.com", "value": "%s"}`, id, base64.StdEncoding.EncodeToString([]byte(value)))
+		assert.Equal(http.StatusOK, call("POST", "/secrets/"+env, body).Code)
+	}
+	compare := func(url string) SecretComparison {
+		recorder := call("GET", url, "")
+		assert.Equal(http.StatusOK, recorder.Code)
+		comparison := SecretComparison{}
+		assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &comparison))
+		return comparison
+	}
+	create("dev", "db-password", "hunter2")
+	create("staging", "db-password", "hunter2")
+	create("staging", "api-key", "something else")
+
+	recorder := call("GET", "/secrets/dev/db-password/fingerprint", "")
+	assert.Equal(http.StatusOK, recorder.Code)
+	fingerprint := SecretFingerprint{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &fingerprint))
+	assert.Equal(SecretFingerprint{Urn: "urn:arryved:secret:db-password", Env: "dev", Version: "latest", Fingerprint: fingerprint.Fingerprint}, fingerprint)
+	assert.Len(fingerprint.Fingerprint, 64)
+	assert.NotContains(recorder.Body.String(), base64.StdEncoding.EncodeToString([]byte("hunter2")))
+
+	// across envs
+	comparison := compare("/secrets/dev/db-password/compare?otherEnv=staging")
+	assert.True(comparison.Equal)
+	assert.Equal(fingerprint.Fingerprint, comparison.Secret.Fingerprint)
+	assert.Equal("staging", comparison.Other.Env)
+	assert.False(compare("/secrets/dev/db-password/compare?otherEnv=staging&otherId=api-key").Equal)
+
+	// across versions: did the rotation land?
+	recorder = call("PATCH", "/secrets/dev/db-password", fmt.Sprintf(`{"value": "%s"}`, base64.StdEncoding.EncodeToString([]byte("correct-horse"))))
+	assert.Equal(http.StatusNoContent, recorder.Code)
+	comparison = compare("/secrets/dev/db-password/compare?otherVersion=1")
+	assert.False(comparison.Equal)
+	assert.Equal("1", comparison.Other.Version)
+	assert.True(compare("/secrets/dev/db-password/compare?version=1&otherEnv=staging").Equal)
+
+	assert.Equal(http.StatusBadRequest, call("GET", "/secrets/dev/db-password/fingerprint?version=0", "").Code)
+	assert.Equal(http.StatusBadRequest, call("GET", "/secrets/dev/db-password/compare?otherEnv=prod", "").Code)
+	assert.Equal(http.StatusNotFound, call("GET", "/secrets/dev/db-password/fingerprint?version=9", "").Code)
+	assert.Equal(http.StatusNotFound, call("GET", "/secrets/dev/db-password/compare?otherId=missing", "").Code)
+
+	// fingerprints are no more sensitive than the list, so they don't take ownership
+	recorder = call("PUT", "/secrets/staging/api-key/owners", `{"ownerGroups": ["other-team@arryved.com"]}`)
+	assert.Equal(http.StatusOK, recorder.Code)
+	cfg.RBACEnabled = true
+	assert.Equal(http.StatusOK, call("GET", "/secrets/staging/api-key/fingerprint", "").Code)
+	assert.False(compare("/secrets/dev/db-password/compare?otherEnv=staging&otherId=api-key").Equal)
+
+	// and are refused, not made up, without a configured key
+	handler = http.HandlerFunc(ConfiguredHandlerSecrets(cfg, audit.NewMemoryLog(), nil, nil))
+	assert.Equal(http.StatusBadRequest, call("GET", "/secrets/dev/db-password/fingerprint", "").Code)
+	assert.Equal(http.StatusBadRequest, call("GET", "/secrets/dev/db-password/compare?otherEnv=staging", "").Code)
+}
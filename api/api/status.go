@@ -21,6 +21,7 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/metrics"
 	"github.com/arryved/app-ctrl/api/model"
 	"github.com/arryved/app-ctrl/api/runners"
 )
@@ -256,6 +257,14 @@ func GetClusterStatusGCE(env string, cfg *config.Config, cluster *config.Cluster
 }
 
 func GetHostStatus(scheme string, host string, port int, pskPath string, timeoutS int) (*HostStatus, error) {
+	status, err := fetchHostStatus(scheme, host, port, pskPath, timeoutS)
+	if err != nil {
+		metrics.HostStatusErrors.WithLabelValues(host).Inc()
+	}
+	return status, err
+}
+
+func fetchHostStatus(scheme string, host string, port int, pskPath string, timeoutS int) (*HostStatus, error) {
 	url := fmt.Sprintf("%s://%s:%d/status", scheme, host, port)
 	tr := http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
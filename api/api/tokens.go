@@ -0,0 +1,259 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/rbac"
+	"github.com/arryved/app-ctrl/api/tokens"
+)
+
+const tokensUrn = "urn:arryved:tokens"
+
+// permissions an API token can be scoped to
+var tokenPermissions = map[config.Permission]bool{
+	config.Deploy:          true,
+	config.Restart:         true,
+	config.SecretsList:     true,
+	config.SecretsRead:     true,
+	config.SecretsCreate:   true,
+	config.SecretsUpdate:   true,
+	config.SecretsDelete:   true,
+	config.SecretsVersions: true,
+	config.SecretsCopy:     true,
+	config.AuditRead:       true,
+}
+
+// Body format for creating an API token
+type TokenRequest struct {
+	Principal   string              `json:"principal"`   // e.g. urn:arryved:service:ci-deployer
+	Description string              `json:"description"` // what the token is for; shown when listing
+	Permissions []config.Permission `json:"permissions"` // e.g. ["deploy"]
+	Targets     []string            `json:"targets"`     // e.g. ["urn:arryved:app:arryved-api"]
+	TTLS        int64               `json:"ttlS"`        // lifetime in seconds; 0 for no expiry
+}
+
+// An API token as shown to callers; never includes the hash
+type TokenEntry struct {
+	Id          string              `json:"id"`
+	Principal   config.PrincipalUrn `json:"principal"`
+	Description string              `json:"description"`
+	Permissions []config.Permission `json:"permissions"`
+	Targets     []string            `json:"targets"`
+	CreatedBy   string              `json:"createdBy"`
+	CreatedAt   int64               `json:"createdAt"`
+	ExpiresAt   int64               `json:"expiresAt"`
+	RevokedAt   int64               `json:"revokedAt"`
+}
+
+type TokenCreateResponse struct {
+	Token string     `json:"token"` // the secret; only ever returned here, so the caller must keep it
+	Entry TokenEntry `json:"entry"`
+}
+
+func newTokenEntry(token *tokens.Token) TokenEntry {
+	return TokenEntry{
+		Id:          token.Id,
+		Principal:   token.Principal,
+		Description: token.Description,
+		Permissions: token.Permissions,
+		Targets:     token.Targets,
+		CreatedBy:   token.CreatedBy,
+		CreatedAt:   token.CreatedAt,
+		ExpiresAt:   token.ExpiresAt,
+		RevokedAt:   token.RevokedAt,
+	}
+}
+
+// GET /tokens lists, POST /tokens creates, DELETE /tokens/{id} revokes
+func ConfiguredHandlerTokens(cfg *config.Config, tokenStore tokens.Store, auditLog audit.Log) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		httpStatus := http.StatusOK
+		log.Infof("%s %s %s %d", r.RemoteAddr, r.Method, r.URL, httpStatus)
+
+		urlElements := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+		isCollection := len(urlElements) == 2
+		isItem := len(urlElements) == 3 && urlElements[2] != ""
+		if !(isCollection && (r.Method == http.MethodGet || r.Method == http.MethodPost)) &&
+			!(isItem && r.Method == http.MethodDelete) {
+			msg := fmt.Sprintf("%s and/or uri not valid for this endpoint", r.Method)
+			handleMethodNotAllowed(w, msg)
+			return
+		}
+
+		// every attempt at a mutating action is audited, whatever the outcome
+		if r.Method != http.MethodGet {
+			auditEntry := startAudit(auditLog, w, r, config.TokensManage)
+			defer auditEntry.Commit()
+			if isItem {
+				auditEntry.Target(fmt.Sprintf("urn:arryved:token:%s", urlElements[2]))
+			}
+			w = auditEntry
+		}
+
+		// user authenticated?
+		identity, err := authenticate(cfg, r)
+		if err != nil {
+			msg := fmt.Sprintf("user not authenticated: %s", err.Error())
+			handleUnauthorized(w, msg)
+			return
+		}
+		if auditEntry, ok := w.(*auditRecorder); ok {
+			auditEntry.Principal(identity.PrincipalUrn())
+		}
+
+		// user authorized to manage tokens?
+		if err := authorize(r.Context(), cfg, nil, identity, config.TokensManage, tokensUrn); err != nil {
+			log.Infof("user not authorized for tokens action err=%s", err.Error())
+			msg := fmt.Sprintf("user not authorized for tokens action")
+			handleForbidden(w, msg)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			TokensList(tokenStore, w, r)
+		case http.MethodPost:
+			TokensCreate(cfg, tokenStore, w, r, identity)
+		case http.MethodDelete:
+			TokensRevoke(tokenStore, w, r, urlElements[2])
+		}
+	}
+}
+
+// LIST tokens
+func TokensList(tokenStore tokens.Store, w http.ResponseWriter, r *http.Request) {
+	list, err := tokenStore.List(r.Context())
+	if err != nil {
+		log.Errorf("error listing api tokens: err=%s", err.Error())
+		handleInternalServerError(w, fmt.Errorf("error listing tokens; have the app administrator check the logs"))
+		return
+	}
+	entries := make([]TokenEntry, 0, len(list))
+	for _, token := range list {
+		entries = append(entries, newTokenEntry(token))
+	}
+	responseBody, err := json.Marshal(entries)
+	if err != nil {
+		log.Errorf("error marshaling response body: %v", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
+
+// CREATE token; a token can't carry more than its creator holds, so the creator needs every permission it grants
+// on every target it's scoped to
+func TokensCreate(cfg *config.Config, tokenStore tokens.Store, w http.ResponseWriter, r *http.Request, identity model.Identity) {
+	createdBy := identity.PrincipalUrn()
+	var requestBody TokenRequest
+	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if err != nil {
+		msg := fmt.Sprintf("invalid request body: %s", r.URL)
+		log.Infof(msg)
+		handleBadRequest(w, msg)
+		return
+	}
+	for _, permission := range requestBody.Permissions {
+		if !tokenPermissions[permission] {
+			msg := fmt.Sprintf("api tokens can't be granted permission=%s", permission)
+			log.Infof(msg)
+			handleBadRequest(w, msg)
+			return
+		}
+	}
+	if requestBody.TTLS < 0 {
+		handleBadRequest(w, "ttlS can't be negative")
+		return
+	}
+
+	token, secret, err := tokens.New(config.PrincipalUrn(requestBody.Principal), requestBody.Description,
+		requestBody.Permissions, requestBody.Targets, createdBy, time.Duration(requestBody.TTLS)*time.Second)
+	if err != nil {
+		log.Infof("invalid api token request err=%s", err.Error())
+		handleBadRequest(w, err.Error())
+		return
+	}
+	if auditEntry, ok := w.(*auditRecorder); ok {
+		auditEntry.Target(fmt.Sprintf("urn:arryved:token:%s", token.Id))
+		auditEntry.Param("principal", requestBody.Principal)
+		auditEntry.Param("permissions", fmt.Sprintf("%v", requestBody.Permissions))
+		auditEntry.Param("targets", strings.Join(requestBody.Targets, ","))
+	}
+	for _, permission := range token.Permissions {
+		for _, target := range token.Targets {
+			err := rbac.AuthorizedAll(r.Context(), cfg, nil, config.PrincipalUrn(createdBy), permission, target)
+			if err != nil || !identity.InScope(string(permission), target) {
+				log.Infof("refusing api token beyond creator=%s permission=%s target=%s err=%v", createdBy, permission, target, err)
+				msg := fmt.Sprintf("can't grant permission=%s on target=%s without holding it", permission, target)
+				handleForbidden(w, msg)
+				return
+			}
+		}
+	}
+	err = tokenStore.Put(r.Context(), token)
+	if err != nil {
+		log.Errorf("error storing api token: err=%s", err.Error())
+		handleInternalServerError(w, fmt.Errorf("error creating token; have the app administrator check the logs"))
+		return
+	}
+	log.Infof("created api token id=%s principal=%s createdBy=%s", token.Id, token.Principal, createdBy)
+
+	responseBody, err := json.Marshal(TokenCreateResponse{
+		Token: secret,
+		Entry: newTokenEntry(token),
+	})
+	if err != nil {
+		log.Errorf("error marshaling response body: %v", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(responseBody)
+}
+
+// REVOKE token by id; revoked tokens are kept so they still show up when listing
+func TokensRevoke(tokenStore tokens.Store, w http.ResponseWriter, r *http.Request, id string) {
+	token, err := tokenStore.Get(r.Context(), id)
+	if errors.Is(err, tokens.ErrTokenNotFound) {
+		msg := fmt.Sprintf("no api token with id=%s", id)
+		log.Infof(msg)
+		handleNotFound(w, msg)
+		return
+	}
+	if err != nil {
+		log.Errorf("error getting api token id=%s: err=%s", id, err.Error())
+		handleInternalServerError(w, fmt.Errorf("error revoking token; have the app administrator check the logs"))
+		return
+	}
+	if token.RevokedAt == 0 {
+		token.RevokedAt = time.Now().Unix()
+		err = tokenStore.Put(r.Context(), token)
+		if err != nil {
+			log.Errorf("error revoking api token id=%s: err=%s", id, err.Error())
+			handleInternalServerError(w, fmt.Errorf("error revoking token; have the app administrator check the logs"))
+			return
+		}
+	}
+	log.Infof("revoked api token id=%s principal=%s", token.Id, token.Principal)
+
+	responseBody, err := json.Marshal(newTokenEntry(token))
+	if err != nil {
+		log.Errorf("error marshaling response body: %v", err.Error())
+		handleInternalServerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
@@ -0,0 +1,159 @@
+//go:build !integration
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/api/queue"
+	"github.com/arryved/app-ctrl/api/tokens"
+)
+
+func TestAPITokenLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	tokenStore = tokens.NewMemoryStore()
+	tokensHandler := http.HandlerFunc(ConfiguredHandlerTokens(cfg, tokenStore, nil))
+	jobStore := queue.NewMemoryJobStore()
+	deployHandler := http.HandlerFunc(ConfiguredHandlerDeploy(cfg, nil, nil, jobStore, nil))
+	restartHandler := http.HandlerFunc(ConfiguredHandlerRestart(cfg, nil, nil, jobStore, nil))
+	fake_token, err := generateFakeIDToken()
+	assert.NoError(err)
+
+	// create a token scoped to deploying one app
+	body := bytes.NewBufferString(`{"principal": "urn:arryved:service:ci-deployer", "description": "ci",
+		"permissions": ["deploy"], "targets": ["urn:arryved:app:arryved-api"]}`)
+	req := httptest.NewRequest("POST", "/tokens", body)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fake_token))
+	recorder := httptest.NewRecorder()
+	tokensHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusCreated, recorder.Code)
+	created := TokenCreateResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &created))
+	assert.True(tokens.IsToken(created.Token))
+	assert.Equal("urn:arryved:user:mockuser@example.com", created.Entry.CreatedBy)
+	bearer := fmt.Sprintf("Bearer %s", created.Token)
+
+	// it can deploy that app, as the service principal
+	req = httptest.NewRequest("POST", "/deploy/dev/arryved-api/central/default", bytes.NewBufferString(`{"concurrency": "1", "version": "0.1.0"}`))
+	req.Header.Add("Authorization", bearer)
+	recorder = httptest.NewRecorder()
+	deployHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code)
+	response := DeployResponse{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &response))
+	record, err := jobStore.Get(context.Background(), response.DeployId)
+	assert.NoError(err)
+	assert.Equal("urn:arryved:service:ci-deployer", record.Principal)
+	assert.Equal(model.AuthMethodToken, record.Identity.AuthMethod)
+
+	// it can follow its own job, but only through the deploy route
+	req = httptest.NewRequest("GET", "/deploy/"+response.DeployId, nil)
+	req.Header.Add("Authorization", bearer)
+	recorder = httptest.NewRecorder()
+	deployHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code)
+	req = httptest.NewRequest("GET", "/restart/"+response.DeployId, nil)
+	req.Header.Add("Authorization", bearer)
+	recorder = httptest.NewRecorder()
+	restartHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusNotFound, recorder.Code)
+
+	// and not another app's jobs
+	other := &queue.JobRecord{Id: "other-app-job", Action: "DEPLOY", Env: "dev", State: queue.JobQueued,
+		Cluster: config.ClusterId{App: "other-app", Region: "central", Variant: "default"}}
+	assert.NoError(jobStore.Put(context.Background(), other))
+	for _, path := range []string{"/deploy/other-app-job", "/deploy/other-app-job/events"} {
+		req = httptest.NewRequest("GET", path, nil)
+		req.Header.Add("Authorization", bearer)
+		recorder = httptest.NewRecorder()
+		deployHandler.ServeHTTP(recorder, req)
+		assert.Equal(http.StatusForbidden, recorder.Code)
+	}
+
+	// but nothing outside its scope
+	req = httptest.NewRequest("POST", "/restart/dev/arryved-api/central/default", bytes.NewBufferString(`{}`))
+	req.Header.Add("Authorization", bearer)
+	recorder = httptest.NewRecorder()
+	restartHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusForbidden, recorder.Code)
+
+	// listing never shows the secret or its hash
+	req = httptest.NewRequest("GET", "/tokens", nil)
+	recorder = httptest.NewRecorder()
+	tokensHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.NotContains(recorder.Body.String(), created.Token)
+	assert.NotContains(recorder.Body.String(), "hash")
+	entries := []TokenEntry{}
+	assert.NoError(json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(entries, 1)
+
+	// nor can the token manage tokens
+	req = httptest.NewRequest("GET", "/tokens", nil)
+	req.Header.Add("Authorization", bearer)
+	recorder = httptest.NewRecorder()
+	tokensHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusForbidden, recorder.Code)
+
+	// once revoked it stops working
+	req = httptest.NewRequest("DELETE", "/tokens/"+created.Entry.Id, nil)
+	recorder = httptest.NewRecorder()
+	tokensHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code)
+	req = httptest.NewRequest("POST", "/deploy/dev/arryved-api/central/default", bytes.NewBufferString(`{"concurrency": "1", "version": "0.1.0"}`))
+	req.Header.Add("Authorization", bearer)
+	recorder = httptest.NewRecorder()
+	deployHandler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+
+	// unknown ids and bad requests
+	recorder = httptest.NewRecorder()
+	tokensHandler.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/tokens/no-such-token", nil))
+	assert.Equal(http.StatusNotFound, recorder.Code)
+	recorder = httptest.NewRecorder()
+	body = bytes.NewBufferString(`{"principal": "urn:arryved:service:ci", "permissions": ["tokensManage"], "targets": ["*"]}`)
+	tokensHandler.ServeHTTP(recorder, httptest.NewRequest("POST", "/tokens", body))
+	assert.Equal(http.StatusBadRequest, recorder.Code)
+}
+
+func TestAPITokenCreateWithinCreatorsGrants(t *testing.T) {
+	assert := assert.New(t)
+	cfg := authzConfig()
+	cfg.AccessEntries = append(cfg.AccessEntries,
+		config.AccessEntry{Role: "developer", Permission: config.TokensManage, Target: tokensUrn, Effect: config.Allow})
+	tokensHandler := http.HandlerFunc(ConfiguredHandlerTokens(cfg, tokens.NewMemoryStore(), nil))
+	fakeToken, err := generateFakeIDToken()
+	assert.NoError(err)
+	create := func(body string) int {
+		req := httptest.NewRequest("POST", "/tokens", bytes.NewBufferString(body))
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", fakeToken))
+		recorder := httptest.NewRecorder()
+		tokensHandler.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	// mockuser may deploy pay-* apart from pay-ledger in dev, and hand that on
+	assert.Equal(http.StatusCreated, create(`{"principal": "urn:arryved:service:ci", "permissions": ["deploy"],
+		"targets": ["urn:arryved:app:pay-api"]}`))
+
+	// but not permissions, targets or patterns beyond it
+	assert.Equal(http.StatusForbidden, create(`{"principal": "urn:arryved:service:ci", "permissions": ["restart"],
+		"targets": ["urn:arryved:app:pay-api"]}`))
+	assert.Equal(http.StatusForbidden, create(`{"principal": "urn:arryved:service:ci", "permissions": ["deploy"],
+		"targets": ["urn:arryved:app:pay-api", "urn:arryved:app:arryved-api"]}`))
+	assert.Equal(http.StatusForbidden, create(`{"principal": "urn:arryved:service:ci", "permissions": ["deploy"],
+		"targets": ["urn:arryved:app:pay-*"]}`))
+	assert.Equal(http.StatusForbidden, create(`{"principal": "urn:arryved:service:ci", "permissions": ["deploy"],
+		"targets": ["*"]}`))
+}
@@ -4,20 +4,29 @@ import (
 	"encoding/base64"
 	"fmt"
 	"regexp"
+	"strconv"
+
+	"github.com/arryved/app-ctrl/api/secrets"
 )
 
 var MaxSecretIdLength = 255
 var MaxDecodedValueLength = 64 * 1024
 var SecretRequestIdPattern = regexp.MustCompile(`^[a-zA-Z0-9-_]+$`)
 var SecretRequestOwnerPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@arryved\.com$`)
+var MaxRotationPeriodDays = 10 * 365
+var MaxDescriptionLength = 1024
 
 func SecretRequestCreateValidate(r SecretRequest) error {
-	// required for this: id, ownerGroup, value; ownerUser should not be set, will be populated from authn claims
-	if r.Id == "" || r.OwnerGroup == "" || len(r.Value) == 0 {
+	// required for this: id, ownerGroup (or ownerGroups), value; ownerUser should not be set, will be populated from
+	// authn claims
+	if r.Id == "" || (r.OwnerGroup == "" && len(r.OwnerGroups) == 0) || len(r.Value) == 0 {
 		return fmt.Errorf("one or more required fields missing for create")
 	}
-	if !(SecretRequestOwnerPattern.MatchString(r.OwnerGroup) && SecretRequestOwnerPattern.MatchString(r.OwnerGroup)) {
-		return fmt.Errorf("one or both of ownerUser, ownerGroup isn't a valid email address")
+	if r.OwnerGroup != "" && !SecretRequestOwnerPattern.MatchString(r.OwnerGroup) {
+		return fmt.Errorf("ownerGroup=%s isn't a valid email address", r.OwnerGroup)
+	}
+	if err := secretOwnersValidate(r.OwnerUsers, r.OwnerGroups); err != nil {
+		return err
 	}
 	if !(SecretRequestIdPattern.MatchString(r.Id) && len(r.Id) < MaxSecretIdLength) {
 		return fmt.Errorf("id must only containe letters, numbers, hyphens and underscores, max len is %d", MaxSecretIdLength)
@@ -30,13 +39,21 @@ func SecretRequestCreateValidate(r SecretRequest) error {
 	if decodedBytes > MaxDecodedValueLength {
 		return fmt.Errorf("value decodes to %d bytes, max is %d", decodedBytes, MaxDecodedValueLength)
 	}
-	return nil
+	return secretRotationValidate(r)
 }
 
 func SecretRequestUpdateValidate(r SecretRequest) error {
-	// only the value field should be present; id is in URL, owner and group are immutable by convention
-	if r.Id != "" || r.OwnerGroup != "" || r.OwnerUser != "" || len(r.Value) == 0 {
-		return fmt.Errorf("only value should be present for update, or value is empty")
+	// only the value and rotation fields should be present; id is in URL, owners are changed with PUT .../owners
+	if r.Id != "" || r.OwnerGroup != "" || r.OwnerUser != "" || len(r.OwnerGroups) > 0 || len(r.OwnerUsers) > 0 ||
+		(len(r.Value) == 0 && !r.HasRotation()) {
+		return fmt.Errorf("only value and rotation fields should be present for update, or both are empty")
+	}
+	if err := secretRotationValidate(r); err != nil {
+		return err
+	}
+	if len(r.Value) == 0 {
+		// a rotation policy change only
+		return nil
 	}
 	// value should be a b64 string with a size limit
 	decodedBytes, decodeErr := validateAndDecodeBase64(r.Value)
@@ -49,6 +66,89 @@ func SecretRequestUpdateValidate(r SecretRequest) error {
 	return nil
 }
 
+// owners is what the secret is left with; a secret always keeps an owner group, so it can't be orphaned
+func SecretOwnersRequestValidate(r SecretOwnersRequest, owners secrets.Owners) error {
+	if len(r.OwnerUsers) == 0 && len(r.OwnerGroups) == 0 {
+		return fmt.Errorf("at least one of ownerUsers, ownerGroups is required")
+	}
+	if err := secretOwnersValidate(r.OwnerUsers, r.OwnerGroups); err != nil {
+		return err
+	}
+	if len(owners.Groups) == 0 {
+		return fmt.Errorf("a secret must keep at least one owner group")
+	}
+	return nil
+}
+
+// a version to read: latest or a version number
+func SecretVersionValidate(version string) error {
+	if version == "latest" {
+		return nil
+	}
+	if number, err := strconv.ParseInt(version, 10, 64); err != nil || number < 1 {
+		return fmt.Errorf("version=%s must be latest or a version number", version)
+	}
+	return nil
+}
+
+// the destination must be another env this instance serves, or another id in the same one
+func SecretCopyRequestValidate(r SecretCopyRequest, env, secretId string, envs map[string]bool) error {
+	if !envs[r.DestinationEnv] {
+		return fmt.Errorf("destinationEnv=%s not supported by this instance", r.DestinationEnv)
+	}
+	if !(SecretRequestIdPattern.MatchString(r.DestinationId) && len(r.DestinationId) < MaxSecretIdLength) {
+		return fmt.Errorf("destinationId must only contain letters, numbers, hyphens and underscores, max len is %d", MaxSecretIdLength)
+	}
+	if r.DestinationEnv == env && r.DestinationId == secretId {
+		return fmt.Errorf("destination is the secret itself")
+	}
+	return nil
+}
+
+func SecretImportValidate(onConflict string) error {
+	switch onConflict {
+	case secrets.OnConflictSkip, secrets.OnConflictOverwrite, secrets.OnConflictFail:
+		return nil
+	}
+	return fmt.Errorf("onConflict=%s must be skip, overwrite or fail", onConflict)
+}
+
+// a bundle is only as trustworthy as whoever held the recipient key, so hold ids and values to the create rules
+func SecretBundleValidate(bundle *secrets.Bundle) error {
+	for _, secret := range bundle.Secrets {
+		if !(SecretRequestIdPattern.MatchString(secret.Id) && len(secret.Id) < MaxSecretIdLength) {
+			return fmt.Errorf("bundle holds an invalid secret id=%s", secret.Id)
+		}
+		if len(secret.Value) == 0 || len(secret.Value) > MaxDecodedValueLength {
+			return fmt.Errorf("bundle holds secret id=%s with an empty or too long value", secret.Id)
+		}
+	}
+	return nil
+}
+
+func secretOwnersValidate(users, groups []string) error {
+	for _, owner := range append(append([]string{}, users...), groups...) {
+		if !SecretRequestOwnerPattern.MatchString(owner) {
+			return fmt.Errorf("owner=%s isn't a valid email address", owner)
+		}
+	}
+	return nil
+}
+
+// rotation fields are optional; zero clears them on update
+func secretRotationValidate(r SecretRequest) error {
+	if r.RotationPeriodDays != nil && (*r.RotationPeriodDays < 0 || *r.RotationPeriodDays > MaxRotationPeriodDays) {
+		return fmt.Errorf("rotationPeriodDays must be between 0 and %d", MaxRotationPeriodDays)
+	}
+	if r.ExpiresEpochNs != nil && *r.ExpiresEpochNs < 0 {
+		return fmt.Errorf("expiresEpochNs must not be negative")
+	}
+	if r.Description != nil && len(*r.Description) > MaxDescriptionLength {
+		return fmt.Errorf("description is %d bytes, max is %d", len(*r.Description), MaxDescriptionLength)
+	}
+	return nil
+}
+
 func validateAndDecodeBase64(b64 string) (int, error) {
 	decoded, err := base64.StdEncoding.DecodeString(b64)
 	if err != nil {
@@ -38,14 +38,28 @@ func main() {
 		log.SetLevel(level)
 	}
 
+	// one-off subcommands (e.g. audit verify) don't start the listener
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(cfg, flag.Args()))
+	}
+
 	// TODO - ship logs to fluentd/log aggregation
-	// TODO - collect and expose metrics
+
+	// load the RBAC policy and watch it for changes; refuse to start on an invalid one
+	policyRunner := runners.NewPolicyRunner(cfg)
+	if err := policyRunner.Start(); err != nil {
+		log.Fatalf("could not load policy path=%s err=%s", cfg.PolicyPath, err.Error())
+	}
 
 	// initialize a GCE cache and refresh runner
 	gceCacheRunner := runners.NewGCECacheRunner(cfg)
 	gceCacheRunner.Start()
 
+	// look for secrets past their rotation date or expiry
+	staleSecretsRunner := runners.NewStaleSecretsRunner(cfg)
+	staleSecretsRunner.Start()
+
 	// start app-control-api listener
-	api := api.New(cfg, gceCacheRunner.Cache)
+	api := api.New(cfg, gceCacheRunner.Cache, staleSecretsRunner.Cache)
 	api.Start()
 }
@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// Outcomes recorded against an audit entry
+const (
+	Success = "success"
+	Denied  = "denied"
+	Failed  = "failed"
+)
+
+// One mutating action taken through app-control-api. Entries are chained: each carries the hash of the one
+// before it, so editing, dropping or reordering any entry breaks every hash after it.
+type Entry struct {
+	Seq       int64             `json:"seq"`
+	Timestamp int64             `json:"timestamp"`
+	Principal string            `json:"principal"`
+	Action    config.Permission `json:"action"`
+	Target    string            `json:"target"`
+	Params    map[string]string `json:"params"` // request parameters; never secret values
+	Outcome   string            `json:"outcome"`
+	Status    int               `json:"status"`
+	PrevHash  string            `json:"prevHash"`
+	Hash      string            `json:"hash"`
+}
+
+// sha256 over the entry's JSON encoding with Hash blanked; map keys marshal sorted so this is stable
+func (e *Entry) ComputeHash() string {
+	c := *e
+	c.Hash = ""
+	data, _ := json.Marshal(&c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Attach the entry to the end of a chain whose last entry is prev (nil for an empty chain)
+func (e *Entry) link(prev *Entry) {
+	e.Seq = 1
+	e.PrevHash = ""
+	if prev != nil {
+		e.Seq = prev.Seq + 1
+		e.PrevHash = prev.Hash
+	}
+	e.Hash = e.ComputeHash()
+}
+
+// Describes where and how a chain is broken
+type ChainError struct {
+	Seq    int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at seq=%d: %s", e.Seq, e.Reason)
+}
+
+// Check a full chain, oldest first; returns a *ChainError for the first entry that doesn't add up
+func Verify(entries []*Entry) error {
+	var prev *Entry
+	for _, entry := range entries {
+		expectedSeq := int64(1)
+		expectedPrevHash := ""
+		if prev != nil {
+			expectedSeq = prev.Seq + 1
+			expectedPrevHash = prev.Hash
+		}
+		if entry.Seq != expectedSeq {
+			return &ChainError{Seq: entry.Seq, Reason: fmt.Sprintf("expected seq=%d", expectedSeq)}
+		}
+		if entry.PrevHash != expectedPrevHash {
+			return &ChainError{Seq: entry.Seq, Reason: "prevHash does not match the preceding entry"}
+		}
+		if entry.Hash != entry.ComputeHash() {
+			return &ChainError{Seq: entry.Seq, Reason: "hash does not match entry contents"}
+		}
+		prev = entry
+	}
+	return nil
+}
+
+// Selects entries for GET /audit; zero values match everything
+type Filter struct {
+	Principal string
+	Action    config.Permission
+	Target    string
+	Outcome   string
+	Since     int64
+	Until     int64
+}
+
+func (f Filter) Match(e *Entry) bool {
+	if f.Principal != "" && f.Principal != e.Principal {
+		return false
+	}
+	if f.Action != "" && f.Action != e.Action {
+		return false
+	}
+	if f.Target != "" && f.Target != e.Target {
+		return false
+	}
+	if f.Outcome != "" && f.Outcome != e.Outcome {
+		return false
+	}
+	if f.Since != 0 && e.Timestamp < f.Since {
+		return false
+	}
+	if f.Until != 0 && e.Timestamp > f.Until {
+		return false
+	}
+	return true
+}
+
+// Append-only storage for the audit chain
+type Log interface {
+	// Link the entry onto the end of the chain and store it; Seq, PrevHash and Hash are set on the way in
+	Append(ctx context.Context, entry *Entry) error
+	// All entries, oldest first
+	List(ctx context.Context) ([]*Entry, error)
+}
+
+// In-memory Log; not persistent, used for tests and when no bucket is configured
+type MemoryLog struct {
+	mutex   sync.RWMutex
+	entries []*Entry
+}
+
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{
+		entries: []*Entry{},
+	}
+}
+
+func (l *MemoryLog) Append(ctx context.Context, entry *Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var prev *Entry
+	if len(l.entries) > 0 {
+		prev = l.entries[len(l.entries)-1]
+	}
+	entry.link(prev)
+	stored := *entry
+	l.entries = append(l.entries, &stored)
+	return nil
+}
+
+func (l *MemoryLog) List(ctx context.Context) ([]*Entry, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	entries := make([]*Entry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		c := *entry
+		entries = append(entries, &c)
+	}
+	return entries, nil
+}
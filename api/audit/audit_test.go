@@ -0,0 +1,90 @@
+//go:build !integration
+
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+func seedLog(t *testing.T) *MemoryLog {
+	auditLog := NewMemoryLog()
+	for i, target := range []string{"urn:arryved:app:arryved-api", "urn:arryved:secret:db-password", "urn:arryved:app:arryved-pos"} {
+		err := auditLog.Append(context.Background(), &Entry{
+			Timestamp: int64(1000 + i),
+			Principal: "urn:arryved:user:alice.sre@example.com",
+			Action:    config.Deploy,
+			Target:    target,
+			Params:    map[string]string{"env": "dev"},
+			Outcome:   Success,
+			Status:    200,
+		})
+		assert.NoError(t, err)
+	}
+	return auditLog
+}
+
+func TestAppendChains(t *testing.T) {
+	assert := assert.New(t)
+	entries, err := seedLog(t).List(context.Background())
+	assert.NoError(err)
+	assert.Len(entries, 3)
+
+	assert.Equal(int64(1), entries[0].Seq)
+	assert.Equal("", entries[0].PrevHash)
+	assert.Equal(entries[0].Hash, entries[1].PrevHash)
+	assert.Equal(entries[1].Hash, entries[2].PrevHash)
+	assert.NoError(Verify(entries))
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	assert := assert.New(t)
+	var chainErr *ChainError
+
+	// edited contents
+	entries, _ := seedLog(t).List(context.Background())
+	entries[1].Outcome = Denied
+	assert.ErrorAs(Verify(entries), &chainErr)
+	assert.Equal(int64(2), chainErr.Seq)
+
+	// edited contents with the entry's own hash recomputed
+	entries, _ = seedLog(t).List(context.Background())
+	entries[1].Params["env"] = "prod"
+	entries[1].Hash = entries[1].ComputeHash()
+	assert.ErrorAs(Verify(entries), &chainErr)
+	assert.Equal(int64(3), chainErr.Seq)
+
+	// dropped entry
+	entries, _ = seedLog(t).List(context.Background())
+	assert.ErrorAs(Verify([]*Entry{entries[0], entries[2]}), &chainErr)
+	assert.Equal(int64(3), chainErr.Seq)
+
+	// reordered
+	entries, _ = seedLog(t).List(context.Background())
+	assert.ErrorAs(Verify([]*Entry{entries[1], entries[0], entries[2]}), &chainErr)
+
+	// truncating the head is caught too since the chain must start at seq 1
+	entries, _ = seedLog(t).List(context.Background())
+	assert.ErrorAs(Verify(entries[1:]), &chainErr)
+}
+
+func TestFilterMatch(t *testing.T) {
+	assert := assert.New(t)
+	entry := &Entry{
+		Timestamp: 1000,
+		Principal: "urn:arryved:user:alice.sre@example.com",
+		Action:    config.SecretsDelete,
+		Target:    "urn:arryved:secret:db-password",
+		Outcome:   Denied,
+	}
+	assert.True(Filter{}.Match(entry))
+	assert.True(Filter{Action: config.SecretsDelete, Outcome: Denied, Since: 1000, Until: 1000}.Match(entry))
+	assert.False(Filter{Principal: "urn:arryved:user:bob.dev@example.com"}.Match(entry))
+	assert.False(Filter{Target: "urn:arryved:secret:other"}.Match(entry))
+	assert.False(Filter{Since: 1001}.Match(entry))
+	assert.False(Filter{Until: 999}.Match(entry))
+}
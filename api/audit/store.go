@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// how many times to retry an append when another API instance extended the chain first
+const appendAttempts = 5
+
+// Log backed by a GCS bucket, one object per entry named by zero-padded seq. Objects are only ever created, never
+// overwritten (DoesNotExist precondition), so two API instances can't fork the chain. Pair with a bucket retention
+// policy so entries can't be deleted either.
+type GCSLog struct {
+	client *storage.Client
+	cfg    config.AuditConfig
+	mutex  sync.Mutex
+	last   *Entry
+}
+
+func (l *GCSLog) objectName(seq int64) string {
+	return path.Join(l.cfg.Prefix, fmt.Sprintf("%020d.json", seq))
+}
+
+func (l *GCSLog) read(ctx context.Context, name string) (*Entry, error) {
+	reader, err := l.client.Bucket(l.cfg.Bucket).Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{}
+	err = json.Unmarshal(data, entry)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// object names in lexical (= seq) order
+func (l *GCSLog) names(ctx context.Context) ([]string, error) {
+	names := []string{}
+	iter := l.client.Bucket(l.cfg.Bucket).Objects(ctx, &storage.Query{Prefix: l.cfg.Prefix + "/"})
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return []string{}, err
+		}
+		names = append(names, attrs.Name)
+	}
+	return names, nil
+}
+
+func (l *GCSLog) tail(ctx context.Context) (*Entry, error) {
+	names, err := l.names(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return l.read(ctx, names[len(names)-1])
+}
+
+func (l *GCSLog) Append(ctx context.Context, entry *Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for attempt := 1; attempt <= appendAttempts; attempt++ {
+		if l.last == nil {
+			last, err := l.tail(ctx)
+			if err != nil {
+				return err
+			}
+			l.last = last
+		}
+		entry.link(l.last)
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		object := l.client.Bucket(l.cfg.Bucket).Object(l.objectName(entry.Seq)).If(storage.Conditions{DoesNotExist: true})
+		writer := object.NewWriter(ctx)
+		writer.ContentType = "application/json"
+		if _, err := writer.Write(data); err != nil {
+			writer.Close()
+			return err
+		}
+		err = writer.Close()
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			// someone else took this seq; re-read the tail and try again
+			log.Debugf("audit seq=%d already taken, retrying attempt=%d", entry.Seq, attempt)
+			l.last = nil
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		stored := *entry
+		l.last = &stored
+		return nil
+	}
+	return fmt.Errorf("could not append audit entry after %d attempts", appendAttempts)
+}
+
+func (l *GCSLog) List(ctx context.Context) ([]*Entry, error) {
+	names, err := l.names(ctx)
+	if err != nil {
+		log.Errorf("failed to list audit entries bucket=%s err=%s", l.cfg.Bucket, err.Error())
+		return []*Entry{}, err
+	}
+	entries := make([]*Entry, 0, len(names))
+	for _, name := range names {
+		entry, err := l.read(ctx, name)
+		if err != nil {
+			// an unreadable entry is itself a break in the chain, so don't skip it
+			return []*Entry{}, fmt.Errorf("could not read audit entry object=%s err=%s", name, err.Error())
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Pick a Log implementation based on config; falls back to memory if no bucket is configured
+func NewLog(cfg config.AuditConfig) (Log, error) {
+	if cfg.Bucket == "" {
+		log.Warnf("no audit bucket configured, audit entries will not persist across restarts")
+		return NewMemoryLog(), nil
+	}
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		log.Errorf("Failed to create storage client for cfg=%v, err=%s", cfg, err.Error())
+		return nil, err
+	}
+	return &GCSLog{
+		client: client,
+		cfg:    cfg,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/arryved/app-ctrl/api/audit"
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/rbac"
+)
+
+// Run a one-off subcommand instead of the listener, e.g. `app-control-api -config <path> audit verify`.
+// Returns the process exit code.
+func runCommand(cfg *config.Config, args []string) int {
+	switch {
+	case len(args) == 2 && args[0] == "audit" && args[1] == "verify":
+		return auditVerify(cfg)
+	case len(args) == 4 && args[0] == "policy" && args[1] == "test":
+		return policyTest(args[2], args[3])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %v\nusage: app-control-api [-config path] [audit verify | policy test <policy.yml> <cases.yml>]\n", args)
+		return 2
+	}
+}
+
+// Walk the whole audit chain and report the first break, if any
+func auditVerify(cfg *config.Config) int {
+	auditLog, err := audit.NewLog(cfg.Audit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open audit log: %s\n", err.Error())
+		return 1
+	}
+	entries, err := auditLog.List(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not read audit log: %s\n", err.Error())
+		return 1
+	}
+	err = audit.Verify(entries)
+	var chainErr *audit.ChainError
+	if errors.As(err, &chainErr) {
+		fmt.Fprintf(os.Stderr, "FAIL %s\n", chainErr.Error())
+		return 1
+	}
+	fmt.Printf("OK audit chain intact entries=%d\n", len(entries))
+	return 0
+}
+
+// Evaluate a table of expected decisions against a policy file, without the rest of the config or any network
+// access, so policy changes can be checked before they're rolled out
+func policyTest(policyPath string, casesPath string) int {
+	policy, err := config.LoadPolicy(policyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL %s\n", err.Error())
+		return 1
+	}
+	cases, err := rbac.LoadPolicyCases(casesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load cases: %s\n", err.Error())
+		return 1
+	}
+	failed := 0
+	for i, result := range rbac.CheckPolicy(context.Background(), policy, cases) {
+		c := result.Case
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("cases[%d]", i)
+		}
+		if result.Passed() {
+			fmt.Printf("ok   %s: %s %s %s -> %s\n", name, c.Principal, c.Action, c.Target, result.Actual)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s: %s %s %s -> %s, expected %s", name, c.Principal, c.Action, c.Target, result.Actual, c.Expected)
+		if result.Reason != "" {
+			fmt.Printf(" (%s)", result.Reason)
+		}
+		fmt.Println()
+	}
+	if failed > 0 {
+		fmt.Printf("FAIL %d of %d cases\n", failed, len(cases))
+		return 1
+	}
+	fmt.Printf("OK %d cases\n", len(cases))
+	return 0
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
+	"path"
+	"strings"
+	"sync/atomic"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
@@ -16,6 +20,9 @@ type Config struct {
 	// Port for HTTPS API listener
 	Port int `yaml:"port"`
 
+	// Port for the plaintext admin listener (/metrics); no TLS or authn, so keep it off public interfaces
+	AdminPort int `yaml:"adminPort"`
+
 	// HTTPS Timeouts
 	ReadTimeoutS  int `yaml:"readTimeoutS"`
 	WriteTimeoutS int `yaml:"writeTimeoutS"`
@@ -42,15 +49,49 @@ type Config struct {
 	// Config for work queue client
 	Queue QueueConfig `yaml:"queue"`
 
+	// Config for the job record store; shared with the worker
+	JobStore JobStoreConfig `yaml:"jobStore"`
+
+	// Where deployable artifacts live; used to check a version exists before deploying it
+	Artifacts ArtifactsConfig `yaml:"artifacts"`
+
+	// Config for the audit log of mutating actions
+	Audit AuditConfig `yaml:"audit"`
+
+	// Config for the API token store (machine credentials)
+	Tokens TokensConfig `yaml:"tokens"`
+
+	// Request rate limits and in-flight job caps
+	Limits LimitsConfig `yaml:"limits"`
+
+	// ID token verification, when authn is enabled
+	OIDC OIDCConfig `yaml:"oidc"`
+
+	// Where group memberships (UsersByGroups, by default) come from
+	Groups GroupsConfig `yaml:"groups"`
+
 	// RBAC
-	AuthnEnabled    bool                        `yaml:"authnEnabled"`
-	RBACEnabled     bool                        `yaml:"rbacEnabled"`
+	AuthnEnabled bool `yaml:"authnEnabled"`
+	RBACEnabled  bool `yaml:"rbacEnabled"`
+
+	// RBAC policy file (see Policy), watched and reloaded when it changes; checked every PolicyReloadS seconds
+	PolicyPath    string `yaml:"policyPath"`
+	PolicyReloadS int    `yaml:"policyReloadS"`
+	policy        atomic.Pointer[Policy]
+
+	// inline RBAC policy, only used when there's no PolicyPath; read these through Policy()
 	RoleMemberships map[Role][]GroupUrn         `yaml:"roleMemberships"`
 	AccessEntries   []AccessEntry               `yaml:"accessEntries"`
 	UsersByGroups   map[GroupUrn][]PrincipalUrn `yaml:"usersByGroups"`
 
+	// Where secrets are kept
+	Secrets SecretsConfig `yaml:"secrets"`
+
 	// ServiceAccounts for Secret access
 	SecretsServiceAccounts []string `yaml:"secretsServiceAccounts"`
+
+	// How often to look for secrets past their rotation date or expiry
+	StaleSecretsCheckS int `yaml:"staleSecretsCheckS"`
 }
 
 type GroupUrn string
@@ -58,9 +99,75 @@ type ResourceUrn string
 type PrincipalUrn string
 
 type AccessEntry struct {
-	Role       Role        `yaml:"role"`
-	Permission Permission  `yaml:"permission"`
-	Target     ResourceUrn `yaml:"target"`
+	Role       Role        `yaml:"role" json:"role"`
+	Permission Permission  `yaml:"permission" json:"permission"`
+	Target     ResourceUrn `yaml:"target" json:"target"`
+	Effect     Effect      `yaml:"effect" json:"effect"` // allow (default) or deny; a matching deny beats any allow
+}
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// env-qualified URNs look like urn:arryved:env:<env>:<kind>:<name>, e.g. urn:arryved:env:prod:app:pay
+const envUrnPrefix = "urn:arryved:env:"
+
+// Qualify a resource URN (urn:arryved:<kind>:<name>) with the env it's being acted on in
+func EnvUrn(env string, urn string) string {
+	return fmt.Sprintf("%s%s:%s", envUrnPrefix, env, strings.TrimPrefix(urn, "urn:arryved:"))
+}
+
+// Whether target is covered by this access entry (or token scope) target. Targets may be globs (path.Match
+// syntax, e.g. urn:arryved:app:pay-*, or "*" for anything). An unqualified URN covers the resource in every env;
+// an env-qualified one only in that env.
+func (u ResourceUrn) Matches(target string) bool {
+	if globMatch(string(u), target) {
+		return true
+	}
+	if strings.HasPrefix(string(u), envUrnPrefix) || !strings.HasPrefix(target, envUrnPrefix) {
+		return false
+	}
+	// strip the env off the target and try again
+	fields := strings.SplitN(strings.TrimPrefix(target, envUrnPrefix), ":", 2)
+	if len(fields) != 2 {
+		return false
+	}
+	return globMatch(string(u), "urn:arryved:"+fields[1])
+}
+
+// Whether some target could be covered by both this and other, as far as comparing the globs each way round can
+// tell. Envs are compared first, where both are qualified; an unqualified URN overlaps every env.
+func (u ResourceUrn) Overlaps(other ResourceUrn) bool {
+	uEnv, uRest := splitEnvUrn(string(u))
+	otherEnv, otherRest := splitEnvUrn(string(other))
+	if uEnv != "" && otherEnv != "" && !globMatch(uEnv, otherEnv) && !globMatch(otherEnv, uEnv) {
+		return false
+	}
+	return globMatch(uRest, otherRest) || globMatch(otherRest, uRest)
+}
+
+// the env of an env-qualified URN (blank if unqualified) and the URN without it
+func splitEnvUrn(urn string) (string, string) {
+	if !strings.HasPrefix(urn, envUrnPrefix) {
+		return "", urn
+	}
+	fields := strings.SplitN(strings.TrimPrefix(urn, envUrnPrefix), ":", 2)
+	if len(fields) != 2 {
+		return "", urn
+	}
+	return fields[0], "urn:arryved:" + fields[1]
+}
+
+func globMatch(pattern, target string) bool {
+	matched, err := path.Match(pattern, target)
+	if err != nil {
+		log.Warnf("invalid target pattern=%s err=%s", pattern, err.Error())
+		return false
+	}
+	return matched
 }
 
 type Role string
@@ -74,13 +181,18 @@ const (
 type Permission string
 
 const (
-	Deploy        Permission = "deploy"
-	Restart       Permission = "restart"
-	SecretsList   Permission = "secretsList"
-	SecretsRead   Permission = "secretsRead"
-	SecretsCreate Permission = "secretsCreate"
-	SecretsUpdate Permission = "secretsUpdate"
-	SecretsDelete Permission = "secretsDelete"
+	Deploy          Permission = "deploy"
+	Restart         Permission = "restart"
+	SecretsList     Permission = "secretsList"
+	SecretsRead     Permission = "secretsRead"
+	SecretsCreate   Permission = "secretsCreate"
+	SecretsUpdate   Permission = "secretsUpdate"
+	SecretsDelete   Permission = "secretsDelete"
+	SecretsVersions Permission = "secretsVersions" // list a secret's versions and read old ones
+	SecretsCopy     Permission = "secretsCopy"     // copy a secret's latest value into another env
+	SecretsBackup   Permission = "secretsBackup"   // export an env's secrets to, or import them from, an encrypted bundle
+	AuditRead       Permission = "auditRead"
+	TokensManage    Permission = "tokensManage"
 )
 
 type RoleMemberships map[Role][]string
@@ -117,6 +229,13 @@ type TLSConfig struct {
 
 	// minimum TLS version to use
 	MinVersion string
+
+	// optional mutual TLS; client certs chaining to a CA in this PEM bundle are accepted as credentials
+	ClientCAPath string `yaml:"clientCAPath"`
+
+	// principal for a client cert, by SAN (DNS name, email or URI); a URI SAN that is itself a
+	// urn:arryved:service: URN needs no entry
+	ClientPrincipals map[string]PrincipalUrn `yaml:"clientPrincipals"`
 }
 
 type QueueConfig struct {
@@ -125,6 +244,118 @@ type QueueConfig struct {
 	Subscription string
 }
 
+type JobStoreConfig struct {
+	// GCS bucket holding job records; if empty, records are only kept in memory
+	Bucket string `yaml:"bucket"`
+
+	// object name prefix for job records within the bucket
+	Prefix string `yaml:"prefix"`
+}
+
+type ArtifactsConfig struct {
+	// Artifact Registry project and location holding apt (per-cluster repo) and docker repositories
+	Project  string `yaml:"project"`
+	Location string `yaml:"location"`
+
+	// Artifact Registry docker repository holding GKE images
+	DockerRepo string `yaml:"dockerRepo"`
+
+	// GCS bucket holding configballs
+	ConfigBucket string `yaml:"configBucket"`
+}
+
+type AuditConfig struct {
+	// GCS bucket holding audit entries; if empty, entries are only kept in memory
+	Bucket string `yaml:"bucket"`
+
+	// object name prefix for audit entries within the bucket
+	Prefix string `yaml:"prefix"`
+}
+
+type RateLimit struct {
+	// sustained requests per minute; 0 for unlimited
+	PerMinute float64 `yaml:"perMinute"`
+
+	// requests allowed at once on top of the sustained rate
+	Burst int `yaml:"burst"`
+}
+
+type LimitsConfig struct {
+	// per principal, by endpoint class: status (fans out to every host), read, write
+	Rates map[string]RateLimit `yaml:"rates"`
+
+	// most QUEUED or RUNNING jobs allowed per env and per cluster; negative for no cap
+	MaxJobsPerEnv     int `yaml:"maxJobsPerEnv"`
+	MaxJobsPerCluster int `yaml:"maxJobsPerCluster"`
+
+	// in-flight slots claimed longer ago than this are freed, so a job the worker lost can't block forever
+	JobStaleS int `yaml:"jobStaleS"`
+
+	// Retry-After sent when a job cap turns a request away
+	JobRetryAfterS int `yaml:"jobRetryAfterS"`
+}
+
+type OIDCConfig struct {
+	// issuers whose ID tokens are accepted
+	Issuers []string `yaml:"issuers"`
+
+	// OAuth client ids an ID token must be issued for (aud); required with authnEnabled, or the API won't start
+	Audiences []string `yaml:"audiences"`
+
+	// if set, the token's hosted domain (hd) claim must be one of these
+	HostedDomains []string `yaml:"hostedDomains"`
+
+	// how long discovered provider metadata is used before it's fetched again; signing keys are re-fetched
+	// as soon as an unknown key id shows up
+	ProviderRefreshS int `yaml:"providerRefreshS"`
+}
+
+type GroupsConfig struct {
+	// static (usersByGroups in the RBAC policy; the default), file or directory (Google Workspace)
+	Source string `yaml:"source"`
+
+	// file source: yaml map of group URN to member URNs, same shape as usersByGroups; re-read when it changes
+	Path string `yaml:"path"`
+
+	// directory source: the Workspace admin the service account impersonates (domain-wide delegation)
+	AdminSubject string `yaml:"adminSubject"`
+
+	// how long a principal's groups are cached for; if the source is down, stale groups are used for up to 3x this
+	CacheTTLS int `yaml:"cacheTTLS"`
+}
+
+// Shared with app-controld, which reads the secrets its apps' config files refer to
+type SecretsConfig struct {
+	// gcp (Secret Manager in the env's project; the default) or local (encrypted files, for development and tests)
+	Backend string `yaml:"backend"`
+
+	// local backend: directory of secret files. The API keeps one subdirectory per env; app-controld reads this
+	// directory itself, as a host is only ever in one env.
+	Path string `yaml:"path"`
+
+	// local backend: file holding the base64-encoded 32 byte key that wraps each secret's data keys
+	MasterKeyPath string `yaml:"masterKeyPath"`
+
+	// API only: file holding the base64-encoded key (32 bytes or more) secret fingerprints are keyed with.
+	// Fingerprinting and comparison are refused if unset.
+	FingerprintKeyPath string `yaml:"fingerprintKeyPath"`
+
+	// API only: PEM file holding the RSA public key secret exports are encrypted to. Export is refused if unset.
+	BackupRecipientKeyPath string `yaml:"backupRecipientKeyPath"`
+
+	// API only: PEM file holding the matching RSA private key, for imports. Import is refused if unset, so it need
+	// only be set on the instance doing a restore.
+	BackupPrivateKeyPath string `yaml:"backupPrivateKeyPath"`
+}
+
+type TokensConfig struct {
+	// GCS bucket holding hashed API tokens; if empty, tokens are only kept in memory
+	Bucket string `yaml:"bucket"`
+
+	// object name prefix for tokens within the bucket
+	Prefix string `yaml:"prefix"`
+}
+
 // Load the config from provided path
 func Load(configPath string) *Config {
 	config := Config{}
@@ -148,6 +379,9 @@ func (c *Config) setDefaults() {
 	if c.Port == 0 {
 		c.Port = 1026
 	}
+	if c.AdminPort == 0 {
+		c.AdminPort = 1027
+	}
 	if c.KeyPath == "" {
 		c.KeyPath = "./var/service.key"
 	}
@@ -166,6 +400,73 @@ func (c *Config) setDefaults() {
 	if c.ServiceAccountKeyPath == "" {
 		c.ServiceAccountKeyPath = "/usr/local/etc/app-control-api-svc-acct-key.json"
 	}
+	if c.JobStore.Prefix == "" {
+		c.JobStore.Prefix = "jobs"
+	}
+	if c.Artifacts.Project == "" {
+		c.Artifacts.Project = "arryved-tools"
+	}
+	if c.Artifacts.Location == "" {
+		c.Artifacts.Location = "us-central1"
+	}
+	if c.Artifacts.DockerRepo == "" {
+		c.Artifacts.DockerRepo = "product-docker"
+	}
+	if c.Artifacts.ConfigBucket == "" {
+		c.Artifacts.ConfigBucket = "arryved-app-control-config"
+	}
+	if c.Audit.Prefix == "" {
+		c.Audit.Prefix = "audit"
+	}
+	defaultRates := map[string]RateLimit{
+		"status": {PerMinute: 30, Burst: 10},
+		"read":   {PerMinute: 300, Burst: 60},
+		"write":  {PerMinute: 30, Burst: 10},
+	}
+	if c.Limits.Rates == nil {
+		c.Limits.Rates = map[string]RateLimit{}
+	}
+	for class, rate := range defaultRates {
+		if _, ok := c.Limits.Rates[class]; !ok {
+			c.Limits.Rates[class] = rate
+		}
+	}
+	if c.Limits.MaxJobsPerEnv == 0 {
+		c.Limits.MaxJobsPerEnv = 10
+	}
+	if c.Limits.MaxJobsPerCluster == 0 {
+		c.Limits.MaxJobsPerCluster = 1
+	}
+	if c.Limits.JobStaleS == 0 {
+		c.Limits.JobStaleS = 3600
+	}
+	if c.Limits.JobRetryAfterS == 0 {
+		c.Limits.JobRetryAfterS = 30
+	}
+	if len(c.OIDC.Issuers) == 0 {
+		c.OIDC.Issuers = []string{"https://accounts.google.com"}
+	}
+	if c.OIDC.ProviderRefreshS == 0 {
+		c.OIDC.ProviderRefreshS = 3600
+	}
+	if c.PolicyReloadS == 0 {
+		c.PolicyReloadS = 10
+	}
+	if c.Groups.Source == "" {
+		c.Groups.Source = "static"
+	}
+	if c.Groups.CacheTTLS == 0 {
+		c.Groups.CacheTTLS = 300
+	}
+	if c.Secrets.Backend == "" {
+		c.Secrets.Backend = "gcp"
+	}
+	if c.StaleSecretsCheckS == 0 {
+		c.StaleSecretsCheckS = 3600
+	}
+	if c.Tokens.Prefix == "" {
+		c.Tokens.Prefix = "tokens"
+	}
 	if c.TLS == nil {
 		c.TLS = &TLSConfig{
 			Ciphers: []string{
@@ -175,6 +476,17 @@ func (c *Config) setDefaults() {
 			MinVersion: "1.2",
 		}
 	}
+	for i, entry := range c.AccessEntries {
+		switch entry.Effect {
+		case "":
+			c.AccessEntries[i].Effect = Allow
+		case Allow, Deny:
+		default:
+			// fail closed on a typo rather than quietly granting
+			log.Warnf("unknown access entry effect=%s role=%s target=%s; treating as deny", entry.Effect, entry.Role, entry.Target)
+			c.AccessEntries[i].Effect = Deny
+		}
+	}
 	for envName, env := range c.Topology {
 		for j, cluster := range env.Clusters {
 			if cluster.Id.Variant == "" {
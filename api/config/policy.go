@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// every permission an access entry can grant
+var Permissions = []Permission{
+	Deploy,
+	Restart,
+	SecretsList,
+	SecretsRead,
+	SecretsCreate,
+	SecretsUpdate,
+	SecretsDelete,
+	SecretsVersions,
+	SecretsCopy,
+	SecretsBackup,
+	AuditRead,
+	TokensManage,
+}
+
+// RBAC policy: which groups hold which roles, what each role may do, and (for the static group source) who is
+// in which group. Kept in its own file (policyPath) so it can change without a restart.
+type Policy struct {
+	RoleMemberships map[Role][]GroupUrn         `yaml:"roleMemberships"`
+	AccessEntries   []AccessEntry               `yaml:"accessEntries"`
+	UsersByGroups   map[GroupUrn][]PrincipalUrn `yaml:"usersByGroups"`
+}
+
+// Read and validate a policy file; unknown keys are errors, so a typo can't silently drop a rule
+func LoadPolicy(policyPath string) (*Policy, error) {
+	file, err := ioutil.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(file, policy); err != nil {
+		return nil, fmt.Errorf("could not parse policy path=%s: %w", policyPath, err)
+	}
+	for i := range policy.AccessEntries {
+		if policy.AccessEntries[i].Effect == "" {
+			policy.AccessEntries[i].Effect = Allow
+		}
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy path=%s: %w", policyPath, err)
+	}
+	return policy, nil
+}
+
+// Report every problem with the policy, not just the first
+func (p *Policy) Validate() error {
+	problems := []error{}
+	known := map[Permission]bool{}
+	for _, permission := range Permissions {
+		known[permission] = true
+	}
+	for role, groups := range p.RoleMemberships {
+		for _, group := range groups {
+			if !strings.HasPrefix(string(group), "urn:") {
+				problems = append(problems, fmt.Errorf("role=%s member=%s is not a group urn", role, group))
+			}
+		}
+	}
+	for i, entry := range p.AccessEntries {
+		if _, ok := p.RoleMemberships[entry.Role]; !ok {
+			problems = append(problems, fmt.Errorf("accessEntries[%d] role=%s has no roleMemberships", i, entry.Role))
+		}
+		if !known[entry.Permission] {
+			problems = append(problems, fmt.Errorf("accessEntries[%d] permission=%s is unknown", i, entry.Permission))
+		}
+		if entry.Target == "" {
+			problems = append(problems, fmt.Errorf("accessEntries[%d] has no target", i))
+		} else if _, err := path.Match(string(entry.Target), ""); err != nil {
+			problems = append(problems, fmt.Errorf("accessEntries[%d] target=%s is not a valid pattern", i, entry.Target))
+		}
+		if entry.Effect != Allow && entry.Effect != Deny {
+			problems = append(problems, fmt.Errorf("accessEntries[%d] effect=%s is neither allow nor deny", i, entry.Effect))
+		}
+	}
+	for group, members := range p.UsersByGroups {
+		if !strings.HasPrefix(string(group), "urn:") {
+			problems = append(problems, fmt.Errorf("usersByGroups group=%s is not a group urn", group))
+		}
+		for _, member := range members {
+			if !strings.HasPrefix(string(member), "urn:") {
+				problems = append(problems, fmt.Errorf("usersByGroups group=%s member=%s is not a principal urn", group, member))
+			}
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// The RBAC policy in force: the last one loaded from PolicyPath, or the inline settings if there isn't one
+func (c *Config) Policy() *Policy {
+	if policy := c.policy.Load(); policy != nil {
+		return policy
+	}
+	return &Policy{
+		RoleMemberships: c.RoleMemberships,
+		AccessEntries:   c.AccessEntries,
+		UsersByGroups:   c.UsersByGroups,
+	}
+}
+
+// Swap in a (validated) policy; requests already being authorized finish against the one they started with
+func (c *Config) SetPolicy(policy *Policy) {
+	c.policy.Store(policy)
+}
@@ -0,0 +1,60 @@
+//go:build !integration
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	assert := assert.New(t)
+	policy, err := LoadPolicy("mock-policy.yml")
+	assert.NoError(err)
+	assert.Len(policy.AccessEntries, 3)
+	assert.Equal(Allow, policy.AccessEntries[0].Effect)
+	assert.Equal(Deny, policy.AccessEntries[2].Effect)
+
+	// every problem is reported
+	path := filepath.Join(t.TempDir(), "policy.yml")
+	assert.NoError(os.WriteFile(path, []byte(`
+roleMemberships:
+  developer:
+    - dev-team@example.com
+accessEntries:
+  - role: developr
+    permission: deploy
+    target: "urn:arryved:app:["
+  - role: developer
+    permission: deplyo
+    target: urn:arryved:app:pay
+    effect: maybe
+`), 0600))
+	_, err = LoadPolicy(path)
+	assert.ErrorContains(err, "member=dev-team@example.com is not a group urn")
+	assert.ErrorContains(err, "accessEntries[0] role=developr has no roleMemberships")
+	assert.ErrorContains(err, "accessEntries[0] target=urn:arryved:app:[ is not a valid pattern")
+	assert.ErrorContains(err, "accessEntries[1] permission=deplyo is unknown")
+	assert.ErrorContains(err, "accessEntries[1] effect=maybe is neither allow nor deny")
+
+	// as are unknown keys
+	assert.NoError(os.WriteFile(path, []byte("accessEntries:\n  - role: developer\n    efect: deny\n"), 0600))
+	_, err = LoadPolicy(path)
+	assert.ErrorContains(err, "field efect not found")
+}
+
+func TestConfigPolicy(t *testing.T) {
+	assert := assert.New(t)
+	cfg := Load("mock-config.yml")
+
+	// inline settings until a policy is loaded
+	assert.Len(cfg.Policy().AccessEntries, 4)
+
+	policy, err := LoadPolicy("mock-policy.yml")
+	assert.NoError(err)
+	cfg.SetPolicy(policy)
+	assert.Same(policy, cfg.Policy())
+}
@@ -0,0 +1,93 @@
+package product
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ${urn:arryved:secret:<id>} stands for a secret's whole value, ${urn:arryved:secret:<id>#<key>} for one field of a
+// secret holding a JSON object
+var secretRefMatcher = regexp.MustCompile(`\$\{urn:arryved:secret:([^}#]+)(?:#([^}]+))?\}`)
+
+// One secret reference in a files value
+type SecretRef struct {
+	Text string // the reference as written, e.g. ${urn:arryved:secret:db-creds#password}
+	Id   string // db-creds
+	Key  string // password; empty for the whole value
+}
+
+// Fetches the latest value of a secret by id
+type SecretLookup func(secretId string) ([]byte, error)
+
+// Every secret reference in content, in order of appearance
+func ParseSecretRefs(content string) []SecretRef {
+	refs := []SecretRef{}
+	for _, match := range secretRefMatcher.FindAllStringSubmatch(content, -1) {
+		refs = append(refs, SecretRef{Text: match[0], Id: match[1], Key: match[2]})
+	}
+	return refs
+}
+
+// The contents of a file from its files value. A value that is nothing but one whole-secret reference (give or take
+// surrounding whitespace) becomes the secret's exact bytes, so binary secrets survive. Otherwise the value is a
+// template, and each reference in it is replaced with the secret's value or selected field.
+func RenderFile(content string, lookup SecretLookup) ([]byte, error) {
+	refs := ParseSecretRefs(content)
+	if len(refs) == 0 {
+		return []byte(content), nil
+	}
+	if len(refs) == 1 && refs[0].Key == "" && strings.TrimSpace(content) == refs[0].Text {
+		return lookup(refs[0].Id)
+	}
+
+	// look each secret up once, however often it's referenced
+	values := map[string][]byte{}
+	var renderErr error
+	rendered := secretRefMatcher.ReplaceAllStringFunc(content, func(text string) string {
+		if renderErr != nil {
+			return ""
+		}
+		ref := ParseSecretRefs(text)[0]
+		value, ok := values[ref.Id]
+		if !ok {
+			value, renderErr = lookup(ref.Id)
+			if renderErr != nil {
+				renderErr = fmt.Errorf("could not fetch secretId=%s err=%w", ref.Id, renderErr)
+				return ""
+			}
+			values[ref.Id] = value
+		}
+		if ref.Key == "" {
+			return string(value)
+		}
+		field, err := SecretField(value, ref.Key)
+		if err != nil {
+			renderErr = fmt.Errorf("secretId=%s: %w", ref.Id, err)
+			return ""
+		}
+		return field
+	})
+	if renderErr != nil {
+		return nil, renderErr
+	}
+	return []byte(rendered), nil
+}
+
+// A top-level field of a JSON object secret value: strings as they are, anything else as JSON
+func SecretField(value []byte, key string) (string, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return "", fmt.Errorf("value is not a JSON object, so key=%s can't be selected", key)
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("value has no key=%s", key)
+	}
+	var text string
+	if err := json.Unmarshal(field, &text); err == nil {
+		return text, nil
+	}
+	return string(field), nil
+}
@@ -0,0 +1,72 @@
+package product
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// looks secrets up in a map, counting lookups
+func mapLookup(values map[string]string, lookups *int) SecretLookup {
+	return func(secretId string) ([]byte, error) {
+		*lookups++
+		value, ok := values[secretId]
+		if !ok {
+			return nil, fmt.Errorf("code = NotFound")
+		}
+		return []byte(value), nil
+	}
+}
+
+func TestParseSecretRefs(t *testing.T) {
+	assert := assert.New(t)
+	refs := ParseSecretRefs("user=${urn:arryved:secret:db-creds#user} pass=${urn:arryved:secret:db-creds#password} key=${urn:arryved:secret:api-key}")
+	assert.Equal([]SecretRef{
+		{Text: "${urn:arryved:secret:db-creds#user}", Id: "db-creds", Key: "user"},
+		{Text: "${urn:arryved:secret:db-creds#password}", Id: "db-creds", Key: "password"},
+		{Text: "${urn:arryved:secret:api-key}", Id: "api-key"},
+	}, refs)
+	assert.Empty(ParseSecretRefs("no refs ${HOME} here"))
+}
+
+func TestRenderFile(t *testing.T) {
+	assert := assert.New(t)
+	lookups := 0
+	lookup := mapLookup(map[string]string{
+		"db-creds": `{"user": "pay", "password": "hunter2", "port": 5432}`,
+		"api-key":  "abc123",
+		"cert":     "\x00\x01binary\n",
+	}, &lookups)
+
+	// inline values pass through
+	contents, err := RenderFile("hello\n", lookup)
+	assert.NoError(err)
+	assert.Equal("hello\n", string(contents))
+	assert.Equal(0, lookups)
+
+	// a lone reference is the secret's exact bytes, as before
+	contents, err = RenderFile("${urn:arryved:secret:cert}\n", lookup)
+	assert.NoError(err)
+	assert.Equal("\x00\x01binary\n", string(contents))
+
+	// templates interpolate every reference, fetching each secret once
+	lookups = 0
+	contents, err = RenderFile("url=postgres://${urn:arryved:secret:db-creds#user}:${urn:arryved:secret:db-creds#password}@db:${urn:arryved:secret:db-creds#port}\nkey=${urn:arryved:secret:api-key}\n", lookup)
+	assert.NoError(err)
+	assert.Equal("url=postgres://pay:hunter2@db:5432\nkey=abc123\n", string(contents))
+	assert.Equal(2, lookups)
+
+	contents, err = RenderFile("${urn:arryved:secret:db-creds#password}", lookup)
+	assert.NoError(err)
+	assert.Equal("hunter2", string(contents))
+
+	// missing secrets and keys, and selecting from a non-JSON value, are errors that don't reveal the value
+	_, err = RenderFile("a=${urn:arryved:secret:missing}", lookup)
+	assert.ErrorContains(err, "missing")
+	_, err = RenderFile("${urn:arryved:secret:db-creds#nope}", lookup)
+	assert.ErrorContains(err, "no key=nope")
+	_, err = RenderFile("${urn:arryved:secret:api-key#user}", lookup)
+	assert.Error(err)
+	assert.NotContains(err.Error(), "abc123")
+}
@@ -0,0 +1,186 @@
+package product
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/config/storage"
+)
+
+var configBallMatcher = regexp.MustCompile(`^config-app=([^,]+),hash=[^,]*,version=(.+)\.tar\.gz$`)
+
+// One compiled config that references a secret from its files section
+type SecretUsage struct {
+	App     string `json:"app"`
+	Version string `json:"version"`
+	Env     string `json:"env"`
+	Region  string `json:"region"`
+	Variant string `json:"variant"`
+	File    string `json:"file"` // the files key (relative path) whose value holds the reference
+}
+
+// Scan every configball in bucketName, compiled for each cluster of its app in env, for references to secretId
+//
+// Positional params:
+//   - storageClient (storage.StorageClient) client for the config bucket
+//   - bucketName (string) the configball bucket
+//   - topology (config.Topology) clusters to compile for, by env
+//   - env (string) app-control short env name; secrets are per env, so only that env's configs are compiled
+//   - secretId (string) the secret id, i.e. the last part of its urn
+//
+// Returns:
+//   - ([]SecretUsage) the referencing configs, sorted by app, version, region, variant and file
+//   - ([]string) configballs (and clusters of them) that couldn't be read or compiled, so weren't checked; sorted
+//   - (error) error | nil
+func SecretUsages(storageClient storage.StorageClient, bucketName string, topology config.Topology,
+	env, secretId string) ([]SecretUsage, []string, error) {
+	clusters := map[string][]config.ClusterId{}
+	for _, cluster := range topology[env].Clusters {
+		clusters[cluster.Id.App] = append(clusters[cluster.Id.App], cluster.Id)
+	}
+
+	objects, err := storageClient.ListObjects(bucketName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list objects in bucket=%s err=%s", bucketName, err.Error())
+	}
+
+	usages := []SecretUsage{}
+	unchecked := []string{}
+	for _, object := range objects {
+		match := configBallMatcher.FindStringSubmatch(object.GetName())
+		if match == nil {
+			continue
+		}
+		app, version := match[1], match[2]
+		if len(clusters[app]) == 0 {
+			continue
+		}
+		data, err := object.GetContents()
+		if err != nil {
+			log.Warnf("skipping configball name=%s err=%s", object.GetName(), err.Error())
+			unchecked = append(unchecked, object.GetName())
+			continue
+		}
+		layers, err := configLayers(data)
+		if err != nil {
+			log.Warnf("skipping configball name=%s err=%s", object.GetName(), err.Error())
+			unchecked = append(unchecked, object.GetName())
+			continue
+		}
+		for _, id := range clusters[app] {
+			appConfig, err := MultiMerge(layers["defaults.yaml"], layers["env/"+env+".yaml"],
+				layers["region/"+id.Region+".yaml"], layers["variant/"+id.Variant+".yaml"])
+			if err != nil {
+				log.Warnf("skipping configball name=%s region=%s variant=%s err=%s",
+					object.GetName(), id.Region, id.Variant, err.Error())
+				unchecked = append(unchecked, fmt.Sprintf("%s region=%s variant=%s", object.GetName(), id.Region, id.Variant))
+				continue
+			}
+			for _, file := range SecretRefs(appConfig)[secretId] {
+				usages = append(usages, SecretUsage{
+					App:     app,
+					Version: version,
+					Env:     env,
+					Region:  id.Region,
+					Variant: id.Variant,
+					File:    file,
+				})
+			}
+		}
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		a, b := usages[i], usages[j]
+		if a.App != b.App {
+			return a.App < b.App
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		if a.Variant != b.Variant {
+			return a.Variant < b.Variant
+		}
+		return a.File < b.File
+	})
+	sort.Strings(unchecked)
+	return usages, unchecked, nil
+}
+
+// Secret ids referenced by a compiled config's files section, each with the files that reference it (a file that
+// selects several keys of one secret is listed once)
+func SecretRefs(appConfig *AppConfig) map[string][]string {
+	refs := map[string][]string{}
+	files, ok := appConfig.Other["files"]
+	if !ok {
+		return refs
+	}
+	filesMap, ok := files.Value.(map[string]Schemaless)
+	if !ok {
+		return refs
+	}
+	paths := []string{}
+	for path := range filesMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		content, ok := filesMap[path].Value.(string)
+		if !ok {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, ref := range ParseSecretRefs(content) {
+			if !seen[ref.Id] {
+				seen[ref.Id] = true
+				refs[ref.Id] = append(refs[ref.Id], path)
+			}
+		}
+	}
+	return refs
+}
+
+// The uncompiled layers in a configball, keyed by path under .arryved/config/ (e.g. env/dev.yaml)
+func configLayers(configBall []byte) (map[string]string, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(configBall))
+	if err != nil {
+		return nil, fmt.Errorf("could not gunzip err=%s", err.Error())
+	}
+	defer gzipReader.Close()
+
+	layers := map[string]string{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read tar err=%s", err.Error())
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if !strings.HasPrefix(name, ".arryved/config/") {
+			continue
+		}
+		contents, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file=%s err=%s", header.Name, err.Error())
+		}
+		layers[strings.TrimPrefix(name, ".arryved/config/")] = string(contents)
+	}
+	return layers, nil
+}
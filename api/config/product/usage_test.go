@@ -0,0 +1,102 @@
+package product
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/config/storage"
+)
+
+// gzipped tarball of files, as the configball build lays them out
+func configBall(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, contents := range files {
+		assert.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+		_, err := tarWriter.Write([]byte(contents))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tarWriter.Close())
+	assert.NoError(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+func storageObject(name string, contents []byte) *MockStorageObject {
+	object := new(MockStorageObject)
+	object.On("GetName").Return(name)
+	object.On("GetContents").Return(contents, nil)
+	return object
+}
+
+func TestSecretUsages(t *testing.T) {
+	assert := assert.New(t)
+	payBall := configBall(t, map[string]string{
+		"./.arryved/config/defaults.yaml": "name: pay\nkind: online\nruntime: GCE\nfiles:\n  conf/db.pw: ${urn:arryved:secret:db-password}\n  conf/motd: hello\n",
+		"./.arryved/config/env/prod.yaml": "files:\n  conf/db.pw: ${urn:arryved:secret:prod-db-password}\n",
+		// only the east variant uses the api key
+		"./.arryved/config/variant/east.yaml": "files:\n  conf/api.key: ${urn:arryved:secret:api-key}\n",
+	})
+	storageClient := new(MockStorageClient)
+	storageClient.On("ListObjects", "config-bucket").Return(
+		[]storage.StorageObject{
+			storageObject("config-app=pay,hash=abc,version=1.0.0.tar.gz", payBall),
+			storageObject("config-app=pay,hash=def,version=1.1.0.tar.gz", payBall),
+			storageObject("config-app=unused,hash=abc,version=1.0.0.tar.gz", payBall),
+			storageObject("not-a-configball.txt", []byte("ignored")),
+			storageObject("config-app=pay,hash=bad,version=1.2.0.tar.gz", []byte("not gzipped")),
+		},
+		nil,
+	)
+	topology := config.Topology{
+		"dev": config.Environment{Clusters: []config.Cluster{
+			{Id: config.ClusterId{App: "pay", Region: "central", Variant: "default"}},
+			{Id: config.ClusterId{App: "pay", Region: "central", Variant: "east"}},
+		}},
+		"prod": config.Environment{Clusters: []config.Cluster{
+			{Id: config.ClusterId{App: "pay", Region: "central", Variant: "default"}},
+		}},
+	}
+
+	usages, unchecked, err := SecretUsages(storageClient, "config-bucket", topology, "dev", "db-password")
+	assert.NoError(err)
+	assert.Len(usages, 4)
+	assert.Equal(SecretUsage{App: "pay", Version: "1.0.0", Env: "dev", Region: "central", Variant: "default", File: "conf/db.pw"}, usages[0])
+	assert.Equal("east", usages[1].Variant)
+	assert.Equal("1.1.0", usages[3].Version)
+	assert.Equal([]string{"config-app=pay,hash=bad,version=1.2.0.tar.gz"}, unchecked)
+
+	usages, unchecked, err = SecretUsages(storageClient, "config-bucket", topology, "dev", "api-key")
+	assert.NoError(err)
+	assert.Len(usages, 2)
+	assert.Equal("east", usages[0].Variant)
+
+	// the prod layer overrides the reference
+	usages, unchecked, err = SecretUsages(storageClient, "config-bucket", topology, "prod", "db-password")
+	assert.NoError(err)
+	assert.Empty(usages)
+	usages, unchecked, err = SecretUsages(storageClient, "config-bucket", topology, "prod", "prod-db-password")
+	assert.NoError(err)
+	assert.Len(usages, 2)
+}
+
+func TestSecretRefs(t *testing.T) {
+	assert := assert.New(t)
+	appConfig, err := ParseYaml([]byte("files:\n  a: ${urn:arryved:secret:one}\n  b: ${urn:arryved:secret:one}\n  c: plain\n"))
+	assert.NoError(err)
+	assert.Equal(map[string][]string{"one": {"a", "b"}}, SecretRefs(appConfig))
+
+	// selectors count as references to the whole secret, once per file
+	appConfig, err = ParseYaml([]byte("files:\n  a: ${urn:arryved:secret:creds#user}:${urn:arryved:secret:creds#password}\n"))
+	assert.NoError(err)
+	assert.Equal(map[string][]string{"creds": {"a"}}, SecretRefs(appConfig))
+
+	appConfig, err = ParseYaml([]byte("name: no-files\n"))
+	assert.NoError(err)
+	assert.Empty(SecretRefs(appConfig))
+}
@@ -0,0 +1,73 @@
+package groups
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+const (
+	userUrnPrefix  = "urn:arryved:user:"
+	groupUrnPrefix = "urn:arryved:group:"
+)
+
+// Resolver backed by the Google Workspace Directory API. Only user principals (urn:arryved:user:<email>) are
+// looked up; anything else (e.g. service principals) has no groups. Memberships are direct, not nested.
+type DirectoryResolver struct {
+	service *admin.Service
+}
+
+// The service account key must have domain-wide delegation for the group read-only scope, and adminSubject is
+// the Workspace admin it acts as
+func NewDirectoryResolver(ctx context.Context, keyPath string, adminSubject string) (*DirectoryResolver, error) {
+	if adminSubject == "" {
+		return nil, fmt.Errorf("groups source=directory needs an adminSubject")
+	}
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := google.CredentialsFromJSONWithParams(ctx, key, google.CredentialsParams{
+		Scopes:  []string{admin.AdminDirectoryGroupReadonlyScope},
+		Subject: adminSubject,
+	})
+	if err != nil {
+		return nil, err
+	}
+	service, err := admin.NewService(ctx, option.WithCredentials(credentials))
+	if err != nil {
+		return nil, err
+	}
+	return newDirectoryResolver(service), nil
+}
+
+func newDirectoryResolver(service *admin.Service) *DirectoryResolver {
+	return &DirectoryResolver{service: service}
+}
+
+func (r *DirectoryResolver) GroupsOf(ctx context.Context, principal config.PrincipalUrn) ([]config.GroupUrn, error) {
+	groups := []config.GroupUrn{}
+	if !strings.HasPrefix(string(principal), userUrnPrefix) {
+		return groups, nil
+	}
+	email := strings.TrimPrefix(string(principal), userUrnPrefix)
+	err := r.service.Groups.List().UserKey(email).Pages(ctx, func(page *admin.Groups) error {
+		for _, group := range page.Groups {
+			groups = append(groups, config.GroupUrn(groupUrnPrefix+strings.ToLower(group.Email)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list groups for principal=%s: %w", principal, err)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	return groups, nil
+}
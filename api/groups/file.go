@@ -0,0 +1,77 @@
+package groups
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// Resolver over a yaml file shaped like usersByGroups. The file is re-read whenever its modification time or
+// size changes, so memberships can be edited (or synced in by something else) without an API redeploy. A file
+// that fails to parse is logged and the previous contents are kept.
+type FileResolver struct {
+	path          string
+	mutex         sync.Mutex
+	modTime       time.Time
+	size          int64
+	usersByGroups map[config.GroupUrn][]config.PrincipalUrn
+}
+
+func NewFileResolver(path string) (*FileResolver, error) {
+	if path == "" {
+		return nil, fmt.Errorf("groups source=file needs a path")
+	}
+	resolver := &FileResolver{path: path}
+	if err := resolver.reload(); err != nil {
+		return nil, err
+	}
+	return resolver, nil
+}
+
+func (r *FileResolver) GroupsOf(ctx context.Context, principal config.PrincipalUrn) ([]config.GroupUrn, error) {
+	if err := r.reload(); err != nil {
+		log.Warnf("could not reload groups file path=%s, keeping previous memberships err=%s", r.path, err.Error())
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return membershipsOf(r.usersByGroups, principal), nil
+}
+
+// re-read the file if it changed since the last read
+func (r *FileResolver) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	unchanged := r.usersByGroups != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size
+	r.mutex.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	usersByGroups := map[config.GroupUrn][]config.PrincipalUrn{}
+	if err := yaml.Unmarshal(data, &usersByGroups); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.usersByGroups = usersByGroups
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	log.Infof("loaded groups file path=%s groups=%d", r.path, len(usersByGroups))
+	return nil
+}
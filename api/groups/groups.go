@@ -0,0 +1,123 @@
+package groups
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// Looks up which groups a principal is a member of; RBAC role and secret ownership checks go through one
+type GroupResolver interface {
+	// Groups principal is a direct member of, sorted; none (not an error) if it's unknown
+	GroupsOf(ctx context.Context, principal config.PrincipalUrn) ([]config.GroupUrn, error)
+}
+
+// Resolver over usersByGroups in the RBAC policy, following policy reloads
+type PolicyResolver struct {
+	cfg *config.Config
+}
+
+func NewPolicyResolver(cfg *config.Config) *PolicyResolver {
+	return &PolicyResolver{cfg: cfg}
+}
+
+func (r *PolicyResolver) GroupsOf(ctx context.Context, principal config.PrincipalUrn) ([]config.GroupUrn, error) {
+	return membershipsOf(r.cfg.Policy().UsersByGroups, principal), nil
+}
+
+func membershipsOf(usersByGroups map[config.GroupUrn][]config.PrincipalUrn, principal config.PrincipalUrn) []config.GroupUrn {
+	groups := []config.GroupUrn{}
+	for group, members := range usersByGroups {
+		for _, member := range members {
+			if member == principal {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	return groups
+}
+
+type cacheEntry struct {
+	groups    []config.GroupUrn
+	fetchedAt time.Time
+}
+
+// How many TTLs past its fetch a stale answer may still be served when refreshes fail
+const maxStaleTTLs = 3
+
+// Caches another resolver's answers per principal for a TTL. If a refresh fails, the stale answer is kept
+// (and logged) rather than failing every authorization while the backend is unavailable, but only for up to
+// maxStaleTTLs; after that it fails closed, so a removed member doesn't keep its access indefinitely.
+type CachedResolver struct {
+	next    GroupResolver
+	ttl     time.Duration
+	now     func() time.Time
+	mutex   sync.Mutex
+	entries map[config.PrincipalUrn]cacheEntry
+}
+
+func NewCachedResolver(next GroupResolver, ttl time.Duration) *CachedResolver {
+	return &CachedResolver{
+		next:    next,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[config.PrincipalUrn]cacheEntry{},
+	}
+}
+
+func (r *CachedResolver) GroupsOf(ctx context.Context, principal config.PrincipalUrn) ([]config.GroupUrn, error) {
+	r.mutex.Lock()
+	entry, ok := r.entries[principal]
+	r.mutex.Unlock()
+	if ok && r.now().Sub(entry.fetchedAt) < r.ttl {
+		return entry.groups, nil
+	}
+
+	groups, err := r.next.GroupsOf(ctx, principal)
+	if err != nil {
+		age := r.now().Sub(entry.fetchedAt)
+		if ok && age < maxStaleTTLs*r.ttl {
+			log.Warnf("could not refresh groups, using stale principal=%s age=%s err=%s", principal, age, err.Error())
+			return entry.groups, nil
+		}
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries[principal] = cacheEntry{groups: groups, fetchedAt: r.now()}
+	return groups, nil
+}
+
+// Build the resolver for cfg.Groups.Source, behind a cache
+func NewResolver(ctx context.Context, cfg *config.Config) (GroupResolver, error) {
+	var resolver GroupResolver
+	switch cfg.Groups.Source {
+	case "static":
+		resolver = NewPolicyResolver(cfg)
+	case "file":
+		fileResolver, err := NewFileResolver(cfg.Groups.Path)
+		if err != nil {
+			return nil, err
+		}
+		resolver = fileResolver
+	case "directory":
+		directoryResolver, err := NewDirectoryResolver(ctx, cfg.ServiceAccountKeyPath, cfg.Groups.AdminSubject)
+		if err != nil {
+			return nil, err
+		}
+		resolver = directoryResolver
+	default:
+		return nil, fmt.Errorf("unknown groups source=%s", cfg.Groups.Source)
+	}
+	log.Infof("resolving groups from source=%s cacheTTLS=%d", cfg.Groups.Source, cfg.Groups.CacheTTLS)
+	return NewCachedResolver(resolver, time.Duration(cfg.Groups.CacheTTLS)*time.Second), nil
+}
@@ -0,0 +1,170 @@
+//go:build !integration
+
+package groups
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/option"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+func TestPolicyResolver(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	resolver := NewPolicyResolver(cfg)
+
+	groups, err := resolver.GroupsOf(context.Background(), "urn:example:user:alice.sre@example.com")
+	assert.NoError(err)
+	assert.Equal([]config.GroupUrn{"urn:example:group:sre-team@example.com"}, groups)
+
+	groups, err = resolver.GroupsOf(context.Background(), "urn:example:user:nobody@example.com")
+	assert.NoError(err)
+	assert.Empty(groups)
+}
+
+type countingResolver struct {
+	calls  int
+	groups []config.GroupUrn
+	err    error
+}
+
+func (r *countingResolver) GroupsOf(ctx context.Context, principal config.PrincipalUrn) ([]config.GroupUrn, error) {
+	r.calls++
+	return r.groups, r.err
+}
+
+func TestCachedResolver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	backend := &countingResolver{groups: []config.GroupUrn{"urn:arryved:group:a@arryved.com"}}
+	resolver := NewCachedResolver(backend, time.Minute)
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	// fresh answers come from cache
+	for i := 0; i < 3; i++ {
+		groups, err := resolver.GroupsOf(ctx, "urn:arryved:user:a@arryved.com")
+		assert.NoError(err)
+		assert.Equal(backend.groups, groups)
+	}
+	assert.Equal(1, backend.calls)
+
+	// expired answers are refreshed
+	now = now.Add(2 * time.Minute)
+	backend.groups = []config.GroupUrn{"urn:arryved:group:b@arryved.com"}
+	groups, err := resolver.GroupsOf(ctx, "urn:arryved:user:a@arryved.com")
+	assert.NoError(err)
+	assert.Equal(backend.groups, groups)
+	assert.Equal(2, backend.calls)
+
+	// a failed refresh keeps the stale answer; with nothing cached, it's an error
+	now = now.Add(2 * time.Minute)
+	backend.err = errors.New("backend down")
+	groups, err = resolver.GroupsOf(ctx, "urn:arryved:user:a@arryved.com")
+	assert.NoError(err)
+	assert.Equal([]config.GroupUrn{"urn:arryved:group:b@arryved.com"}, groups)
+	_, err = resolver.GroupsOf(ctx, "urn:arryved:user:c@arryved.com")
+	assert.Error(err)
+
+	// past a few TTLs of failed refreshes, it fails closed
+	now = now.Add(2 * time.Minute)
+	_, err = resolver.GroupsOf(ctx, "urn:arryved:user:a@arryved.com")
+	assert.Error(err)
+
+	// and recovers once the backend does
+	backend.err = nil
+	groups, err = resolver.GroupsOf(ctx, "urn:arryved:user:a@arryved.com")
+	assert.NoError(err)
+	assert.Equal([]config.GroupUrn{"urn:arryved:group:b@arryved.com"}, groups)
+}
+
+func TestFileResolver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "groups.yml")
+	write := func(contents string, modTime time.Time) {
+		assert.NoError(os.WriteFile(path, []byte(contents), 0600))
+		assert.NoError(os.Chtimes(path, modTime, modTime))
+	}
+	modTime := time.Now().Add(-time.Hour)
+	write("urn:arryved:group:sre@arryved.com:\n  - urn:arryved:user:alice@arryved.com\n", modTime)
+
+	resolver, err := NewFileResolver(path)
+	assert.NoError(err)
+	groups, err := resolver.GroupsOf(ctx, "urn:arryved:user:alice@arryved.com")
+	assert.NoError(err)
+	assert.Equal([]config.GroupUrn{"urn:arryved:group:sre@arryved.com"}, groups)
+
+	// an edit is picked up without restarting
+	write("urn:arryved:group:sre@arryved.com:\n  - urn:arryved:user:bob@arryved.com\n", modTime.Add(time.Minute))
+	groups, err = resolver.GroupsOf(ctx, "urn:arryved:user:alice@arryved.com")
+	assert.NoError(err)
+	assert.Empty(groups)
+	groups, err = resolver.GroupsOf(ctx, "urn:arryved:user:bob@arryved.com")
+	assert.NoError(err)
+	assert.Equal([]config.GroupUrn{"urn:arryved:group:sre@arryved.com"}, groups)
+
+	// a broken edit keeps what was there
+	write("not: [valid", modTime.Add(2*time.Minute))
+	groups, err = resolver.GroupsOf(ctx, "urn:arryved:user:bob@arryved.com")
+	assert.NoError(err)
+	assert.Equal([]config.GroupUrn{"urn:arryved:group:sre@arryved.com"}, groups)
+
+	_, err = NewFileResolver(filepath.Join(t.TempDir(), "missing.yml"))
+	assert.Error(err)
+}
+
+func TestDirectoryResolver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/admin/directory/v1/groups", r.URL.Path)
+		assert.Equal("alice@arryved.com", r.URL.Query().Get("userKey"))
+		page := admin.Groups{Groups: []*admin.Group{{Email: "SRE@arryved.com"}}, NextPageToken: "2"}
+		if r.URL.Query().Get("pageToken") == "2" {
+			page = admin.Groups{Groups: []*admin.Group{{Email: "devs@arryved.com"}}}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+	service, err := admin.NewService(ctx, option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	assert.NoError(err)
+	resolver := newDirectoryResolver(service)
+
+	groups, err := resolver.GroupsOf(ctx, "urn:arryved:user:alice@arryved.com")
+	assert.NoError(err)
+	assert.Equal([]config.GroupUrn{"urn:arryved:group:devs@arryved.com", "urn:arryved:group:sre@arryved.com"}, groups)
+
+	// only users are looked up
+	groups, err = resolver.GroupsOf(ctx, "urn:arryved:service:ci-deployer")
+	assert.NoError(err)
+	assert.Empty(groups)
+}
+
+func TestNewResolver(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	assert.Equal("static", cfg.Groups.Source)
+
+	resolver, err := NewResolver(context.Background(), cfg)
+	assert.NoError(err)
+	groups, err := resolver.GroupsOf(context.Background(), "urn:example:user:bob.dev@example.com")
+	assert.NoError(err)
+	assert.Equal([]config.GroupUrn{"urn:example:group:dev-team@example.com"}, groups)
+
+	cfg.Groups.Source = "carrier-pigeon"
+	_, err = NewResolver(context.Background(), cfg)
+	assert.Error(err)
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const namespace = "app_control_api"
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by handler and status code.",
+	}, []string{"handler", "code"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by handler and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler", "code"})
+
+	JobsEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_enqueued_total",
+		Help:      "Jobs enqueued for the worker, by action and env.",
+	}, []string{"action", "env"})
+
+	PublishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pubsub_publish_failures_total",
+		Help:      "Jobs that could not be published to the job topic, by action.",
+	}, []string{"action"})
+
+	Throttled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "throttled_total",
+		Help:      "Requests turned away with a 429, by rate limit class or \"jobs\" for the in-flight job caps.",
+	}, []string{"class"})
+
+	PolicyReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "policy_reloads_total",
+		Help:      "RBAC policy file reloads, by outcome (loaded or rejected; a rejected file leaves the previous policy in force).",
+	}, []string{"outcome"})
+
+	StaleSecrets = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stale_secrets",
+		Help:      "Secrets past their rotation date or expiry as of the last check, by env and reason (rotationOverdue or expired).",
+	}, []string{"env", "reason"})
+
+	StaleSecretsCheckFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stale_secrets_check_failures_total",
+		Help:      "Stale secret checks that could not complete, by env; the stale_secrets gauge keeps its last value.",
+	}, []string{"env"})
+
+	HostStatusErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "appcontrold_status_errors_total",
+		Help:      "Failed /status fetches from app-controld, by host.",
+	}, []string{"host"})
+
+	gceCacheRefreshDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "gce_cache_refresh_duration_seconds",
+		Help:      "Time taken by a full GCECacheRunner refresh across all env/regions.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 20, 40, 60},
+	})
+
+	// unix nanos of the last completed refresh; 0 until the first one finishes
+	gceCacheRefreshedAt atomic.Int64
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "gce_cache_age_seconds",
+		Help:      "Seconds since the GCE instance cache last finished refreshing; -1 if it never has.",
+	}, func() float64 {
+		refreshedAt := gceCacheRefreshedAt.Load()
+		if refreshedAt == 0 {
+			return -1
+		}
+		return time.Since(time.Unix(0, refreshedAt)).Seconds()
+	})
+)
+
+// Record a completed GCECacheRunner refresh that started at start
+func GCECacheRefreshed(start time.Time) {
+	gceCacheRefreshDuration.Observe(time.Since(start).Seconds())
+	gceCacheRefreshedAt.Store(time.Now().UnixNano())
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusWriter) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+// lets http.ResponseController reach the underlying writer (flushing for event streams)
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Wrap a handler so its requests are counted and timed under the given handler label (the mux pattern)
+func Instrument(handler string, next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		writer := &statusWriter{ResponseWriter: w}
+		next(writer, r)
+		if writer.status == 0 {
+			writer.status = http.StatusOK
+		}
+		code := strconv.Itoa(writer.status)
+		requests.WithLabelValues(handler, code).Inc()
+		requestDuration.WithLabelValues(handler, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Serve /metrics in plaintext on the admin port; kept off the TLS/OIDC listener so Prometheus can scrape it directly
+func StartAdminListener(port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		log.Infof("Starting plaintext admin listener on port=%d", port)
+		err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux)
+		if err != nil {
+			log.Errorf("Error seen when starting admin listener: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,39 @@
+//go:build !integration
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+	assert := assert.New(t)
+	handler := Instrument("/test/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("{}"))
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/thing", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/thing", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/test/missing", nil))
+
+	assert.Equal(2.0, testutil.ToFloat64(requests.WithLabelValues("/test/", "200")))
+	assert.Equal(1.0, testutil.ToFloat64(requests.WithLabelValues("/test/", "404")))
+}
+
+func TestGCECacheAge(t *testing.T) {
+	assert := assert.New(t)
+	GCECacheRefreshed(time.Now().Add(-2 * time.Second))
+	age := time.Since(time.Unix(0, gceCacheRefreshedAt.Load())).Seconds()
+	assert.Less(age, 1.0)
+	assert.Equal(1, testutil.CollectAndCount(gceCacheRefreshDuration))
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// Header the worker uses to tell app-controld who an action is on behalf of; app-controld can't verify it
+const IdentityHeader = "X-App-Control-Identity"
+
+// Authentication methods an Identity can come from
+const (
+	AuthMethodOIDC  = "oidc"
+	AuthMethodNone  = "none"  // authn disabled; the email is unverified
+	AuthMethodToken = "token" // API token; scoped to Permissions on Targets
+	AuthMethodMTLS  = "mtls"  // client certificate
+)
+
+// Who asked for an action, as established by app-control-api from verified credentials. Travels with the job to
+// the worker and on to app-controld.
+type Identity struct {
+	Email      string   `json:"email"`
+	Urn        string   `json:"urn,omitempty"` // set for non-user principals (e.g. urn:arryved:service:ci-deployer)
+	Groups     []string `json:"groups"`
+	AuthMethod string   `json:"authMethod"`
+
+	// API token scope; the identity can only act with these permissions on these targets ("*" for any)
+	TokenId     string   `json:"tokenId,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Targets     []string `json:"targets,omitempty"`
+}
+
+func (i Identity) PrincipalUrn() string {
+	if i.Urn != "" {
+		return i.Urn
+	}
+	return fmt.Sprintf("urn:arryved:user:%s", i.Email)
+}
+
+// Email for users, the URN for anyone else
+func (i Identity) Name() string {
+	if i.Email != "" {
+		return i.Email
+	}
+	return i.Urn
+}
+
+// Whether action on target is within the identity's scope; only API tokens are scoped. Being in scope doesn't
+// grant anything by itself, RBAC still decides.
+func (i Identity) InScope(action, target string) bool {
+	if i.AuthMethod != AuthMethodToken {
+		return true
+	}
+	permitted := false
+	for _, permission := range i.Permissions {
+		if permission == action {
+			permitted = true
+			break
+		}
+	}
+	if !permitted {
+		return false
+	}
+	for _, scoped := range i.Targets {
+		if config.ResourceUrn(scoped).Matches(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode for IdentityHeader
+func (i Identity) Encode() string {
+	data, _ := json.Marshal(i)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode an IdentityHeader value
+func DecodeIdentity(value string) (*Identity, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode identity: %s", err.Error())
+	}
+	identity := &Identity{}
+	err = json.Unmarshal(data, identity)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal identity: %s", err.Error())
+	}
+	return identity, nil
+}
@@ -0,0 +1,55 @@
+//go:build !integration
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityEncodeDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	identity := Identity{
+		Email:      "mockuser@example.com",
+		Groups:     []string{"urn:arryved:group:eng"},
+		AuthMethod: AuthMethodOIDC,
+	}
+	decoded, err := DecodeIdentity(identity.Encode())
+	assert.NoError(err)
+	assert.Equal(identity, *decoded)
+	assert.Equal("urn:arryved:user:mockuser@example.com", decoded.PrincipalUrn())
+
+	_, err = DecodeIdentity("not base64!")
+	assert.Error(err)
+}
+
+func TestIdentityInScope(t *testing.T) {
+	assert := assert.New(t)
+
+	// logged-in users aren't scoped
+	user := Identity{Email: "mockuser@example.com", AuthMethod: AuthMethodOIDC}
+	assert.True(user.InScope("deploy", "urn:arryved:app:anything"))
+	assert.Equal("mockuser@example.com", user.Name())
+
+	service := Identity{
+		Urn:         "urn:arryved:service:ci-deployer",
+		AuthMethod:  AuthMethodToken,
+		Permissions: []string{"deploy"},
+		Targets:     []string{"urn:arryved:app:arryved-api"},
+	}
+	assert.Equal("urn:arryved:service:ci-deployer", service.PrincipalUrn())
+	assert.Equal("urn:arryved:service:ci-deployer", service.Name())
+	assert.True(service.InScope("deploy", "urn:arryved:app:arryved-api"))
+	assert.False(service.InScope("deploy", "urn:arryved:app:other"))
+	assert.False(service.InScope("restart", "urn:arryved:app:arryved-api"))
+	assert.True(service.InScope("deploy", "urn:arryved:env:prod:app:arryved-api"))
+
+	service.Targets = []string{"urn:arryved:env:dev:app:*"}
+	assert.True(service.InScope("deploy", "urn:arryved:env:dev:app:other"))
+	assert.False(service.InScope("deploy", "urn:arryved:env:prod:app:other"))
+
+	service.Targets = []string{"*"}
+	assert.True(service.InScope("deploy", "urn:arryved:app:other"))
+}
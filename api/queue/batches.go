@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// How many hosts to act on at once for a concurrency of either a count ("2") or a percentage of total ("25%").
+// Never less than 1, so a small percentage of a small cluster still makes progress.
+func BatchCount(concurrency string, total int) (int, error) {
+	batchCount := 0
+	if strings.HasSuffix(concurrency, "%") {
+		percentage, err := strconv.Atoi(strings.TrimSuffix(concurrency, "%"))
+		if err != nil || percentage <= 0 || percentage > 100 {
+			return 0, fmt.Errorf("invalid concurrency=%s; expected a count or a percentage between 1%% and 100%%", concurrency)
+		}
+		batchCount = int(math.Floor(float64(total) * float64(percentage) / 100))
+	} else {
+		count, err := strconv.Atoi(concurrency)
+		if err != nil || count <= 0 {
+			return 0, fmt.Errorf("invalid concurrency=%s; expected a count or a percentage between 1%% and 100%%", concurrency)
+		}
+		batchCount = count
+	}
+	if batchCount < 1 {
+		batchCount = 1
+	}
+	return batchCount, nil
+}
+
+// Split hosts into the batches a rollout works through, in order; hosts are sorted so plans are repeatable
+func Batches(hosts []string, batchCount int) [][]string {
+	sorted := append([]string{}, hosts...)
+	sort.Strings(sorted)
+	batches := [][]string{}
+	for start := 0; start < len(sorted); start += batchCount {
+		end := start + batchCount
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		batches = append(batches, sorted[start:end])
+	}
+	return batches
+}
@@ -0,0 +1,42 @@
+//go:build !integration
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchCount(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tc := range []struct {
+		concurrency string
+		total       int
+		expected    int
+	}{
+		{"1", 10, 1},
+		{"3", 10, 3},
+		{"50%", 10, 5},
+		{"25%", 10, 2},
+		{"10%", 3, 1},
+		{"100%", 4, 4},
+	} {
+		batchCount, err := BatchCount(tc.concurrency, tc.total)
+		assert.NoError(err)
+		assert.Equal(tc.expected, batchCount, "concurrency=%s total=%d", tc.concurrency, tc.total)
+	}
+
+	for _, concurrency := range []string{"", "0", "-1", "abc", "0%", "150%", "x%"} {
+		_, err := BatchCount(concurrency, 10)
+		assert.Error(err, "concurrency=%s", concurrency)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	assert := assert.New(t)
+	batches := Batches([]string{"host-c", "host-a", "host-e", "host-b", "host-d"}, 2)
+	assert.Equal([][]string{{"host-a", "host-b"}, {"host-c", "host-d"}, {"host-e"}}, batches)
+	assert.Empty(Batches([]string{}, 2))
+}
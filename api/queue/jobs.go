@@ -8,6 +8,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
 )
 
 type JobRequest interface {
@@ -27,20 +28,41 @@ func (djr DeployJobRequest) Action() string {
 
 // JobRequest Type for Restart
 type RestartJobRequest struct {
-	Cluster     config.ClusterId
+	Cluster     config.Cluster
 	Concurrency string
-	Version     string
 }
 
 func (rjr RestartJobRequest) Action() string {
 	return "RESTART"
 }
 
+// JobRequest Type for Rollback; Version is the known-good version being restored
+type RollbackJobRequest struct {
+	Cluster     config.Cluster
+	Concurrency string
+	Version     string
+	FromVersion string
+}
+
+func (rjr RollbackJobRequest) Action() string {
+	return "ROLLBACK"
+}
+
+// A rollback is applied exactly like a deploy of the older version
+func (rjr RollbackJobRequest) DeployRequest() *DeployJobRequest {
+	return &DeployJobRequest{
+		Cluster:     rjr.Cluster,
+		Concurrency: rjr.Concurrency,
+		Version:     rjr.Version,
+	}
+}
+
 type Job struct {
-	Id        string     `json:"id"`
-	Action    string     `json:"action"`
-	Principal string     `json:"principal"`
-	Request   JobRequest `json:"request"`
+	Id        string          `json:"id"`
+	Action    string          `json:"action"`
+	Principal string          `json:"principal"` // Identity.Name(); kept for readers that predate Identity
+	Identity  *model.Identity `json:"identity"`
+	Request   JobRequest      `json:"request"`
 }
 
 func (j *Job) UnmarshalJSON(data []byte) error {
@@ -72,16 +94,21 @@ func (j *Job) UnmarshalJSON(data []byte) error {
 			return err
 		}
 		j.Request = &req
-	// case "ROLLBACK":
+	case "ROLLBACK":
+		var req RollbackJobRequest
+		err := json.Unmarshal(temp.Request, &req)
+		if err != nil {
+			return err
+		}
+		j.Request = &req
 	// (add cases for other types as needed)
-	//
 	default:
 		return fmt.Errorf("unknown action=%s", j.Action)
 	}
 	return nil
 }
 
-func NewJob(principal string, request JobRequest) (*Job, error) {
+func NewJob(identity model.Identity, request JobRequest) (*Job, error) {
 	uuid, err := uuid.NewRandom()
 	if err != nil {
 		log.Errorf("Failed to generate job uuid: %v", err)
@@ -90,7 +117,8 @@ func NewJob(principal string, request JobRequest) (*Job, error) {
 	job := Job{
 		Id:        uuid.String(),
 		Action:    request.Action(),
-		Principal: principal,
+		Principal: identity.Name(),
+		Identity:  &identity,
 		Request:   request,
 	}
 	return &job, nil
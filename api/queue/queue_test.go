@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
 )
 
 func TestNewQueue(t *testing.T) {
@@ -29,7 +30,7 @@ func TestEnqueueDeploy(t *testing.T) {
 	queue := NewQueue(cfg.Queue, client)
 	assert.NotNil(queue)
 
-	job, err := NewJob("example@arryved.com", DeployJobRequest{
+	job, err := NewJob(model.Identity{Email: "example@arryved.com"}, DeployJobRequest{
 		Cluster: config.Cluster{
 			Id: config.ClusterId{
 				App:     "arryved-api",
@@ -0,0 +1,310 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+)
+
+var (
+	ErrJobNotFound       = errors.New("job record not found")
+	ErrNoRollbackVersion = errors.New("no previous known-good version")
+)
+
+type JobState string
+
+const (
+	JobQueued    JobState = "QUEUED"
+	JobRunning   JobState = "RUNNING"
+	JobSucceeded JobState = "SUCCEEDED"
+	JobFailed    JobState = "FAILED"
+)
+
+// Terminal states won't be changed by the worker again
+func (s JobState) Done() bool {
+	return s == JobSucceeded || s == JobFailed
+}
+
+// Outcome of an action against a single host (GCE instance); Code and Err mirror what app-controld reports
+type HostResult struct {
+	Code        int    `json:"code"`
+	Err         string `json:"err"`
+	StartedAt   int64  `json:"startedAt"`
+	CompletedAt int64  `json:"completedAt"`
+}
+
+// Types of progress events recorded against a job
+const (
+	EventRunning    = "running"     // worker picked the job up
+	EventBatchStart = "batch_start" // a batch of hosts is starting
+	EventHostStart  = "host_start"  // action started on a host
+	EventHostFinish = "host_finish" // action finished on a host; Code/Err are app-controld's result
+	EventConverged  = "converged"   // a batch (GCE) or rollout (GKE) settled; Err is set if it didn't converge healthy
+	EventComplete   = "complete"    // job reached a terminal State
+)
+
+// A single step of progress, in the order the worker produced it; Seq starts at 1
+type JobEvent struct {
+	Seq    int      `json:"seq"`
+	Type   string   `json:"type"`
+	At     int64    `json:"at"`
+	Batch  int      `json:"batch,omitempty"`
+	Hosts  []string `json:"hosts,omitempty"`
+	Host   string   `json:"host,omitempty"`
+	Code   int      `json:"code,omitempty"`
+	Err    string   `json:"err,omitempty"`
+	State  JobState `json:"state,omitempty"`
+	Detail string   `json:"detail,omitempty"`
+}
+
+// Persistent record of a job and what has happened to it since it was enqueued
+type JobRecord struct {
+	Id          string                 `json:"id"`
+	Action      string                 `json:"action"`
+	Principal   string                 `json:"principal"`
+	Identity    *model.Identity        `json:"identity,omitempty"`
+	Env         string                 `json:"env"`
+	Cluster     config.ClusterId       `json:"cluster"`
+	Version     string                 `json:"version"`
+	Concurrency string                 `json:"concurrency"`
+	State       JobState               `json:"state"`
+	Detail      string                 `json:"detail"`
+	Hosts       map[string]*HostResult `json:"hosts"`
+	Events      []*JobEvent            `json:"events"`
+	QueuedAt    int64                  `json:"queuedAt"`
+	StartedAt   int64                  `json:"startedAt"`
+	CompletedAt int64                  `json:"completedAt"`
+}
+
+func (r *JobRecord) MarkRunning() {
+	r.State = JobRunning
+	r.StartedAt = time.Now().Unix()
+	r.AddEvent(JobEvent{Type: EventRunning, State: r.State})
+}
+
+func (r *JobRecord) MarkComplete(err error) {
+	r.State = JobSucceeded
+	if err != nil {
+		r.State = JobFailed
+		r.Detail = err.Error()
+	}
+	r.CompletedAt = time.Now().Unix()
+	r.AddEvent(JobEvent{Type: EventComplete, State: r.State, Detail: r.Detail})
+}
+
+// Append a progress event, numbering and timestamping it
+func (r *JobRecord) AddEvent(event JobEvent) {
+	event.Seq = len(r.Events) + 1
+	event.At = time.Now().Unix()
+	r.Events = append(r.Events, &event)
+}
+
+func (r *JobRecord) clone() *JobRecord {
+	c := *r
+	c.Hosts = make(map[string]*HostResult, len(r.Hosts))
+	for name, result := range r.Hosts {
+		hostResult := *result
+		c.Hosts[name] = &hostResult
+	}
+	c.Events = make([]*JobEvent, 0, len(r.Events))
+	for _, event := range r.Events {
+		e := *event
+		c.Events = append(c.Events, &e)
+	}
+	return &c
+}
+
+// Build a QUEUED record for a job that's about to be enqueued
+func NewJobRecord(job *Job, env string) *JobRecord {
+	record := &JobRecord{
+		Id:        job.Id,
+		Action:    job.Action,
+		Principal: job.Principal,
+		Identity:  job.Identity,
+		Env:       env,
+		State:     JobQueued,
+		Hosts:     map[string]*HostResult{},
+		Events:    []*JobEvent{},
+		QueuedAt:  time.Now().Unix(),
+	}
+	switch request := job.Request.(type) {
+	case DeployJobRequest:
+		record.Cluster = request.Cluster.Id
+		record.Version = request.Version
+		record.Concurrency = request.Concurrency
+	case *DeployJobRequest:
+		record.Cluster = request.Cluster.Id
+		record.Version = request.Version
+		record.Concurrency = request.Concurrency
+	case RestartJobRequest:
+		record.Cluster = request.Cluster.Id
+		record.Concurrency = request.Concurrency
+	case *RestartJobRequest:
+		record.Cluster = request.Cluster.Id
+		record.Concurrency = request.Concurrency
+	case RollbackJobRequest:
+		record.Cluster = request.Cluster.Id
+		record.Version = request.Version
+		record.Concurrency = request.Concurrency
+	case *RollbackJobRequest:
+		record.Cluster = request.Cluster.Id
+		record.Version = request.Version
+		record.Concurrency = request.Concurrency
+	}
+	return record
+}
+
+// Find the version to roll a cluster back to, given its job records (most recent first). The current
+// version is taken from the latest deploy or rollback that got as far as running; the rollback target
+// is the most recent version before it that deployed successfully.
+func RollbackVersion(records []*JobRecord, env string, clusterId config.ClusterId) (current string, previous string, err error) {
+	for _, record := range records {
+		if record.Env != env || record.Cluster != clusterId {
+			continue
+		}
+		if record.Action != "DEPLOY" && record.Action != "ROLLBACK" {
+			continue
+		}
+		if current == "" {
+			if record.State != JobQueued {
+				current = record.Version
+			}
+			continue
+		}
+		if record.State == JobSucceeded && record.Version != current {
+			return current, record.Version, nil
+		}
+	}
+	return current, "", ErrNoRollbackVersion
+}
+
+// Storage for job records; written by the API on enqueue and by the worker as the job progresses
+type JobStore interface {
+	// Get a record by job id; returns ErrJobNotFound if there isn't one
+	Get(ctx context.Context, id string) (*JobRecord, error)
+	// List all records, most recently queued first
+	List(ctx context.Context) ([]*JobRecord, error)
+	// Create or replace a record
+	Put(ctx context.Context, record *JobRecord) error
+	// Atomically read-modify-write a record; returns ErrJobNotFound if there isn't one
+	Update(ctx context.Context, id string, fn func(*JobRecord) error) error
+	// Atomically claim one of limit in-flight slots under key for job id. A slot frees up once its job is done, or
+	// was claimed before staleBefore (unix seconds). Returns false if every slot is taken.
+	ClaimSlot(ctx context.Context, key string, limit int, id string, staleBefore int64) (bool, error)
+	// Give back the slot under key held by job id, if any; for jobs that never got recorded
+	ReleaseSlot(ctx context.Context, key string, id string) error
+}
+
+// In-memory JobStore; not persistent, used for tests and when no bucket is configured
+type MemoryJobStore struct {
+	mutex   sync.RWMutex
+	records map[string]*JobRecord
+	slots   map[string][]jobSlot
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		records: map[string]*JobRecord{},
+		slots:   map[string][]jobSlot{},
+	}
+}
+
+func (s *MemoryJobStore) Get(ctx context.Context, id string) (*JobRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	record, ok := s.records[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return record.clone(), nil
+}
+
+func (s *MemoryJobStore) List(ctx context.Context) ([]*JobRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	records := make([]*JobRecord, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record.clone())
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func (s *MemoryJobStore) Put(ctx context.Context, record *JobRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[record.Id] = record.clone()
+	return nil
+}
+
+func (s *MemoryJobStore) Update(ctx context.Context, id string, fn func(*JobRecord) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	record, ok := s.records[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	updated := record.clone()
+	if err := fn(updated); err != nil {
+		return err
+	}
+	s.records[id] = updated
+	return nil
+}
+
+func (s *MemoryJobStore) ClaimSlot(ctx context.Context, key string, limit int, id string, staleBefore int64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	claim := jobSlot{JobId: id, ClaimedAt: time.Now().Unix()}
+	held := s.slots[key]
+	for n := 0; n < len(held) && n < limit; n++ {
+		if held[n].free(s.records[held[n].JobId], staleBefore) {
+			held[n] = claim
+			return true, nil
+		}
+	}
+	if len(held) >= limit {
+		return false, nil
+	}
+	s.slots[key] = append(held, claim)
+	return true, nil
+}
+
+func (s *MemoryJobStore) ReleaseSlot(ctx context.Context, key string, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	held := s.slots[key]
+	for n := range held {
+		if held[n].JobId == id {
+			s.slots[key] = append(held[:n], held[n+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func sortRecords(records []*JobRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].QueuedAt > records[j].QueuedAt
+	})
+}
+
+// Who holds an in-flight slot, and since when
+type jobSlot struct {
+	JobId     string `json:"jobId"`
+	ClaimedAt int64  `json:"claimedAt"`
+}
+
+// Whether the slot can be claimed again: its job is done, or the slot has gone stale so a job the worker lost can't
+// hold it forever. A job that isn't recorded yet keeps its slot; the API records it right after claiming.
+func (s jobSlot) free(record *JobRecord, staleBefore int64) bool {
+	if s.ClaimedAt < staleBefore {
+		return true
+	}
+	return record != nil && record.State.Done()
+}
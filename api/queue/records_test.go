@@ -0,0 +1,146 @@
+//go:build !integration
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/model"
+)
+
+func TestMemoryJobStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+
+	job, err := NewJob(model.Identity{Email: "example@arryved.com"}, DeployJobRequest{
+		Cluster: config.Cluster{
+			Id: config.ClusterId{App: "arryved-api", Region: "central", Variant: "default"},
+		},
+		Concurrency: "1",
+		Version:     "0.1.1",
+	})
+	assert.NoError(err)
+
+	record := NewJobRecord(job, "dev")
+	assert.Equal(JobQueued, record.State)
+	assert.Equal("arryved-api", record.Cluster.App)
+	assert.NoError(store.Put(ctx, record))
+
+	// updates are applied to the stored copy
+	err = store.Update(ctx, job.Id, func(r *JobRecord) error {
+		r.MarkRunning()
+		r.Hosts["host-1"] = &HostResult{Code: 200}
+		return nil
+	})
+	assert.NoError(err)
+	got, err := store.Get(ctx, job.Id)
+	assert.NoError(err)
+	assert.Equal(JobRunning, got.State)
+	assert.Equal(200, got.Hosts["host-1"].Code)
+
+	// returned records are copies
+	got.Hosts["host-1"].Code = 500
+	again, _ := store.Get(ctx, job.Id)
+	assert.Equal(200, again.Hosts["host-1"].Code)
+
+	// a failed update leaves the record alone
+	err = store.Update(ctx, job.Id, func(r *JobRecord) error {
+		r.MarkComplete(nil)
+		return errors.New("nope")
+	})
+	assert.Error(err)
+	again, _ = store.Get(ctx, job.Id)
+	assert.False(again.State.Done())
+
+	// unknown ids
+	_, err = store.Get(ctx, "missing")
+	assert.ErrorIs(err, ErrJobNotFound)
+	assert.ErrorIs(store.Update(ctx, "missing", func(r *JobRecord) error { return nil }), ErrJobNotFound)
+
+	records, err := store.List(ctx)
+	assert.NoError(err)
+	assert.Len(records, 1)
+}
+
+func TestJobRecordMarkComplete(t *testing.T) {
+	assert := assert.New(t)
+
+	record := &JobRecord{}
+	record.MarkComplete(errors.New("2 of 3 hosts failed"))
+	assert.Equal(JobFailed, record.State)
+	assert.Equal("2 of 3 hosts failed", record.Detail)
+	assert.Greater(record.CompletedAt, int64(0))
+
+	record = &JobRecord{}
+	record.MarkComplete(nil)
+	assert.Equal(JobSucceeded, record.State)
+	assert.True(record.State.Done())
+}
+
+func TestRollbackVersion(t *testing.T) {
+	assert := assert.New(t)
+	clusterId := config.ClusterId{App: "arryved-api", Region: "central", Variant: "default"}
+	other := config.ClusterId{App: "arryved-pos", Region: "central", Variant: "default"}
+
+	// most recent first
+	records := []*JobRecord{
+		{Action: "DEPLOY", Env: "dev", Cluster: clusterId, Version: "0.1.4", State: JobQueued},
+		{Action: "DEPLOY", Env: "dev", Cluster: clusterId, Version: "0.1.3", State: JobFailed},
+		{Action: "DEPLOY", Env: "prod", Cluster: clusterId, Version: "0.1.2", State: JobSucceeded},
+		{Action: "DEPLOY", Env: "dev", Cluster: other, Version: "0.1.2", State: JobSucceeded},
+		{Action: "RESTART", Env: "dev", Cluster: clusterId, State: JobSucceeded},
+		{Action: "DEPLOY", Env: "dev", Cluster: clusterId, Version: "0.1.3", State: JobSucceeded},
+		{Action: "DEPLOY", Env: "dev", Cluster: clusterId, Version: "0.1.1", State: JobFailed},
+		{Action: "ROLLBACK", Env: "dev", Cluster: clusterId, Version: "0.1.0", State: JobSucceeded},
+	}
+	current, previous, err := RollbackVersion(records, "dev", clusterId)
+	assert.NoError(err)
+	assert.Equal("0.1.3", current)
+	assert.Equal("0.1.0", previous)
+
+	// nothing older to go back to
+	_, _, err = RollbackVersion(records[:6], "dev", clusterId)
+	assert.ErrorIs(err, ErrNoRollbackVersion)
+	_, _, err = RollbackVersion(records, "staging", clusterId)
+	assert.ErrorIs(err, ErrNoRollbackVersion)
+}
+
+func TestClaimSlot(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	now := time.Now().Unix()
+	claim := func(id string) bool {
+		claimed, err := store.ClaimSlot(ctx, "cluster/dev/arryved-api", 2, id, now-60)
+		assert.NoError(err)
+		return claimed
+	}
+
+	// up to the limit; a job not yet recorded keeps its slot
+	assert.True(claim("job-1"))
+	assert.True(claim("job-2"))
+	assert.False(claim("job-3"))
+	claimed, err := store.ClaimSlot(ctx, "env/dev", 2, "job-3", now-60)
+	assert.NoError(err)
+	assert.True(claimed)
+
+	// a finished job frees its slot, as does releasing it
+	assert.NoError(store.Put(ctx, &JobRecord{Id: "job-1", State: JobSucceeded}))
+	assert.NoError(store.Put(ctx, &JobRecord{Id: "job-2", State: JobRunning}))
+	assert.True(claim("job-3"))
+	assert.False(claim("job-4"))
+	assert.NoError(store.ReleaseSlot(ctx, "cluster/dev/arryved-api", "job-3"))
+	assert.True(claim("job-4"))
+
+	// and so does going stale
+	claimed, err = store.ClaimSlot(ctx, "cluster/dev/arryved-api", 2, "job-5", now+60)
+	assert.NoError(err)
+	assert.True(claimed)
+}
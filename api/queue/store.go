@@ -0,0 +1,249 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// how many times to retry a record update when another writer got there first
+const updateAttempts = 5
+
+// JobStore backed by a GCS bucket, one JSON object per job; shared by the API and the worker(s)
+type GCSJobStore struct {
+	client *storage.Client
+	cfg    config.JobStoreConfig
+}
+
+func (s *GCSJobStore) objectName(id string) string {
+	return path.Join(s.cfg.Prefix, fmt.Sprintf("%s.json", id))
+}
+
+func (s *GCSJobStore) read(ctx context.Context, id string) (*JobRecord, int64, error) {
+	reader, err := s.client.Bucket(s.cfg.Bucket).Object(s.objectName(id)).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, 0, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	record := &JobRecord{}
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, 0, err
+	}
+	return record, reader.Attrs.Generation, nil
+}
+
+func (s *GCSJobStore) write(ctx context.Context, record *JobRecord, conditions *storage.Conditions) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	object := s.client.Bucket(s.cfg.Bucket).Object(s.objectName(record.Id))
+	if conditions != nil {
+		object = object.If(*conditions)
+	}
+	writer := object.NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (s *GCSJobStore) Get(ctx context.Context, id string) (*JobRecord, error) {
+	record, _, err := s.read(ctx, id)
+	return record, err
+}
+
+// NOTE: this reads every record under the prefix; fine for the volume of jobs app-control sees, revisit if that changes
+func (s *GCSJobStore) List(ctx context.Context) ([]*JobRecord, error) {
+	records := []*JobRecord{}
+	// records sit directly under the prefix; the delimiter leaves out the slots below it
+	iter := s.client.Bucket(s.cfg.Bucket).Objects(ctx, &storage.Query{Prefix: s.cfg.Prefix + "/", Delimiter: "/"})
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Errorf("failed to list job records bucket=%s err=%s", s.cfg.Bucket, err.Error())
+			return []*JobRecord{}, err
+		}
+		if attrs.Name == "" {
+			continue
+		}
+		id := strings.TrimSuffix(path.Base(attrs.Name), ".json")
+		record, _, err := s.read(ctx, id)
+		if err != nil {
+			log.Warnf("could not read job record object=%s err=%s", attrs.Name, err.Error())
+			continue
+		}
+		records = append(records, record)
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+func (s *GCSJobStore) Put(ctx context.Context, record *JobRecord) error {
+	return s.write(ctx, record, nil)
+}
+
+func (s *GCSJobStore) Update(ctx context.Context, id string, fn func(*JobRecord) error) error {
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		record, generation, err := s.read(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+		// only write if nobody else has written since the read
+		err = s.write(ctx, record, &storage.Conditions{GenerationMatch: generation})
+		if preconditionFailed(err) {
+			log.Debugf("job record id=%s changed during update, retrying attempt=%d", id, attempt)
+			time.Sleep(time.Duration(attempt*100) * time.Millisecond)
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("could not update job record id=%s after %d attempts", id, updateAttempts)
+}
+
+// Slots are objects under <prefix>/slots/<key>/, numbered 0 to limit-1. A free number is claimed by creating its
+// object, and a taken one by overwriting it once free; both are conditional writes, so two claims can't both win.
+func (s *GCSJobStore) ClaimSlot(ctx context.Context, key string, limit int, id string, staleBefore int64) (bool, error) {
+	claim := jobSlot{JobId: id, ClaimedAt: time.Now().Unix()}
+	for n := 0; n < limit; n++ {
+		object := s.client.Bucket(s.cfg.Bucket).Object(path.Join(s.cfg.Prefix, "slots", key, fmt.Sprintf("%d.json", n)))
+		err := s.writeSlot(ctx, object.If(storage.Conditions{DoesNotExist: true}), claim)
+		if !preconditionFailed(err) {
+			return err == nil, err
+		}
+
+		held, generation, err := s.readSlot(ctx, object)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			// released since; leave it to the next claim rather than chase it
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		record, _, err := s.read(ctx, held.JobId)
+		if err != nil && !errors.Is(err, ErrJobNotFound) {
+			return false, err
+		}
+		if !held.free(record, staleBefore) {
+			continue
+		}
+		err = s.writeSlot(ctx, object.If(storage.Conditions{GenerationMatch: generation}), claim)
+		if !preconditionFailed(err) {
+			return err == nil, err
+		}
+	}
+	return false, nil
+}
+
+func (s *GCSJobStore) ReleaseSlot(ctx context.Context, key string, id string) error {
+	iter := s.client.Bucket(s.cfg.Bucket).Objects(ctx, &storage.Query{Prefix: path.Join(s.cfg.Prefix, "slots", key) + "/"})
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		object := s.client.Bucket(s.cfg.Bucket).Object(attrs.Name)
+		held, generation, err := s.readSlot(ctx, object)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if held.JobId != id {
+			continue
+		}
+		err = object.If(storage.Conditions{GenerationMatch: generation}).Delete(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) || preconditionFailed(err) {
+			// someone has claimed it since
+			return nil
+		}
+		return err
+	}
+}
+
+func (s *GCSJobStore) readSlot(ctx context.Context, object *storage.ObjectHandle) (*jobSlot, int64, error) {
+	reader, err := object.NewReader(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	held := &jobSlot{}
+	if err := json.Unmarshal(data, held); err != nil {
+		return nil, 0, err
+	}
+	return held, reader.Attrs.Generation, nil
+}
+
+func (s *GCSJobStore) writeSlot(ctx context.Context, object *storage.ObjectHandle, claim jobSlot) error {
+	data, err := json.Marshal(claim)
+	if err != nil {
+		return err
+	}
+	writer := object.NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// a conditional write or delete lost to another writer
+func preconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// Pick a JobStore implementation based on config; falls back to memory if no bucket is configured
+func NewJobStore(cfg config.JobStoreConfig) (JobStore, error) {
+	if cfg.Bucket == "" {
+		log.Warnf("no jobStore bucket configured, job records will not persist across restarts")
+		return NewMemoryJobStore(), nil
+	}
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		log.Errorf("Failed to create storage client for cfg=%v, err=%s", cfg, err.Error())
+		return nil, err
+	}
+	return &GCSJobStore{
+		client: client,
+		cfg:    cfg,
+	}, nil
+}
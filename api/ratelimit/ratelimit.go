@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// buckets idle (full) for this long are dropped, so the map doesn't grow with every principal ever seen
+const idleAfter = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Token buckets by key (e.g. principal); each holds up to burst tokens, refilled at perMinute
+type Limiter struct {
+	mutex     sync.Mutex
+	perSecond float64
+	burst     float64
+	buckets   map[string]*bucket
+	swept     time.Time
+}
+
+func New(perMinute float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		perSecond: perMinute / 60,
+		burst:     float64(burst),
+		buckets:   map[string]*bucket{},
+		swept:     time.Now(),
+	}
+}
+
+// Take a token for key if there is one. If not, returns how long until there will be.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.perSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.perSecond <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	wait := (1 - b.tokens) / l.perSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < idleAfter {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleAfter {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
@@ -0,0 +1,52 @@
+//go:build !integration
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	limiter := New(60, 2) // one a second, bursts of two
+
+	// the burst is available right away, then it's empty
+	ok, _ := limiter.Allow("alice", now)
+	assert.True(ok)
+	ok, _ = limiter.Allow("alice", now)
+	assert.True(ok)
+	ok, wait := limiter.Allow("alice", now)
+	assert.False(ok)
+	assert.Equal(time.Second, wait)
+
+	// other keys have their own bucket
+	ok, _ = limiter.Allow("bob", now)
+	assert.True(ok)
+
+	// refills over time, but never past the burst
+	ok, _ = limiter.Allow("alice", now.Add(time.Second))
+	assert.True(ok)
+	later := now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		ok, _ = limiter.Allow("alice", later)
+		assert.True(ok)
+	}
+	ok, _ = limiter.Allow("alice", later)
+	assert.False(ok)
+}
+
+func TestLimiterSweep(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	limiter := New(60, 1)
+	limiter.Allow("alice", now)
+	limiter.Allow("bob", now.Add(idleAfter))
+	assert.Len(limiter.buckets, 2)
+
+	limiter.Allow("bob", now.Add(2*idleAfter))
+	assert.Len(limiter.buckets, 1)
+}
@@ -0,0 +1,71 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// One expectation about a policy, e.g. that a developer may not deploy pay to prod
+type PolicyCase struct {
+	Name      string              `yaml:"name"`
+	Principal config.PrincipalUrn `yaml:"principal"`
+	Action    config.Permission   `yaml:"action"`
+	Target    string              `yaml:"target"`   // e.g. urn:arryved:env:prod:app:pay
+	Expected  config.Effect       `yaml:"expected"` // allow or deny
+}
+
+type PolicyCaseResult struct {
+	Case   PolicyCase
+	Actual config.Effect
+	Reason string // why not allowed, when it isn't
+}
+
+func (r PolicyCaseResult) Passed() bool {
+	return r.Actual == r.Case.Expected
+}
+
+// Read a YAML table of cases (a top-level `cases:` list)
+func LoadPolicyCases(casesPath string) ([]PolicyCase, error) {
+	file, err := ioutil.ReadFile(casesPath)
+	if err != nil {
+		return nil, err
+	}
+	table := struct {
+		Cases []PolicyCase `yaml:"cases"`
+	}{}
+	if err := yaml.UnmarshalStrict(file, &table); err != nil {
+		return nil, fmt.Errorf("could not parse cases path=%s: %w", casesPath, err)
+	}
+	for i, c := range table.Cases {
+		if c.Expected != config.Allow && c.Expected != config.Deny {
+			return nil, fmt.Errorf("cases[%d] expected=%s is neither allow nor deny", i, c.Expected)
+		}
+		if strings.HasPrefix(c.Target, "urn:arryved:secret") {
+			return nil, fmt.Errorf("cases[%d] target=%s: secret ownership lives in Secret Manager and can't be checked offline", i, c.Target)
+		}
+	}
+	return table.Cases, nil
+}
+
+// Evaluate cases against policy the way Authorized would with RBAC on, resolving groups from the policy's
+// usersByGroups. Nothing outside the policy is consulted, so this works offline.
+func CheckPolicy(ctx context.Context, policy *config.Policy, cases []PolicyCase) []PolicyCaseResult {
+	cfg := &config.Config{RBACEnabled: true}
+	cfg.SetPolicy(policy)
+	results := []PolicyCaseResult{}
+	for _, c := range cases {
+		result := PolicyCaseResult{Case: c, Actual: config.Allow}
+		if err := Authorized(ctx, cfg, nil, c.Principal, c.Action, c.Target); err != nil {
+			result.Actual = config.Deny
+			result.Reason = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -35,16 +35,99 @@ func Authorized(
 	return ConfigAuthorizer(ctx, cfg, client, principal, action, target)
 }
 
-// AUTHORIZER for locally-configured access entries (e.g. deploy action)
+// AUTHORIZER for a grant over every target pattern covers (pattern may be a glob, as in a token's scope): the
+// principal must be authorized for pattern itself, and hold no deny for action on anything pattern could cover
+func AuthorizedAll(
+	ctx context.Context, cfg *config.Config, client interface{},
+	principal config.PrincipalUrn, action config.Permission, pattern string) error {
+	if err := Authorized(ctx, cfg, client, principal, action, pattern); err != nil || !cfg.RBACEnabled {
+		return err
+	}
+	roles := utility.RolesOf(ctx, cfg, principal)
+	for _, entry := range cfg.Policy().AccessEntries {
+		if entry.Effect != config.Deny || entry.Permission != action || !entry.Target.Overlaps(config.ResourceUrn(pattern)) {
+			continue
+		}
+		for _, role := range roles {
+			if role == entry.Role {
+				return fmt.Errorf("denied principal=%s action=%s within target=%s entryTarget=%s", principal, action, pattern, entry.Target)
+			}
+		}
+	}
+	return nil
+}
+
+// AUTHORIZER for locally-configured access entries (e.g. deploy action); target may be env-qualified
+// (urn:arryved:env:prod:app:pay). Any matching deny entry wins over the allows.
 func ConfigAuthorizer(ctx context.Context, cfg *config.Config, client interface{},
 	principal config.PrincipalUrn, action config.Permission, target string) error {
-	for _, entry := range cfg.AccessEntries {
-		targetStr := string(entry.Target)
-		if entry.Permission == action && (targetStr == target || targetStr == "*") {
-			if utility.PrincipalHasRole(cfg, principal, entry.Role) {
-				return nil
-			}
+	entries := matchingEntries(cfg, utility.RolesOf(ctx, cfg, principal), action, target)
+	for _, entry := range entries {
+		if entry.Effect == config.Deny {
+			return fmt.Errorf("denied principal=%s action=%s target=%s entryTarget=%s", principal, action, target, entry.Target)
 		}
 	}
+	if len(entries) > 0 {
+		return nil
+	}
 	return fmt.Errorf("not authorized principal=%s action=%s target=%s", principal, action, target)
 }
+
+// the access entries for action on target that apply to any of roles
+func matchingEntries(cfg *config.Config, roles []config.Role, action config.Permission, target string) []config.AccessEntry {
+	entries := []config.AccessEntry{}
+	for _, entry := range cfg.Policy().AccessEntries {
+		if entry.Permission != action || !entry.Target.Matches(target) {
+			continue
+		}
+		for _, role := range roles {
+			if role == entry.Role {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// What an authorization decision for principal is based on; see Explain
+type Explanation struct {
+	Principal    config.PrincipalUrn  `json:"principal"`
+	Action       config.Permission    `json:"action"`
+	Target       string               `json:"target"`
+	RBACEnabled  bool                 `json:"rbacEnabled"`
+	Groups       []config.GroupUrn    `json:"groups"`
+	Roles        []config.Role        `json:"roles"`
+	Entries      []config.AccessEntry `json:"entries"`                // matching entries held through Roles
+	SecretOwners *secrets.Owners      `json:"secretOwners,omitempty"` // for owner-only secret actions
+}
+
+// Gathers the bindings Authorized bases its decision on, using the same lookups, so callers can explain a
+// decision. It doesn't make the decision itself; ask Authorized for that.
+func Explain(
+	ctx context.Context, cfg *config.Config, client interface{},
+	principal config.PrincipalUrn, action config.Permission, target string) (Explanation, error) {
+	roles := utility.RolesOf(ctx, cfg, principal)
+	explanation := Explanation{
+		Principal:   principal,
+		Action:      action,
+		Target:      target,
+		RBACEnabled: cfg.RBACEnabled,
+		Groups:      utility.GroupsOf(ctx, cfg, principal),
+		Roles:       roles,
+		Entries:     []config.AccessEntry{},
+	}
+	if strings.HasPrefix(target, "urn:arryved:secret") {
+		if !secrets.OwnerOnly(action) {
+			return explanation, nil
+		}
+		owners, err := secrets.SecretOwners(ctx, client, target)
+		if err != nil {
+			return explanation, err
+		}
+		explanation.SecretOwners = &owners
+		return explanation, nil
+	}
+	explanation.Entries = matchingEntries(cfg, roles, action, target)
+	return explanation, nil
+}
@@ -27,3 +27,97 @@ func TestAuthorized(t *testing.T) {
 	assert.NoError(Authorized(ctx, cfg, nil, "urn:example:user:angus.cto@example.com", "deploy", "urn:example:app:app2"))
 	assert.Error(Authorized(ctx, cfg, nil, "urn:example:user:angus.cto@example.com", "deploy", "urn:example:app:app3"))
 }
+
+func TestAuthorizedPatterns(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	cfg.RBACEnabled = true
+	ctx := context.Background()
+	bob := config.PrincipalUrn("urn:example:user:bob.dev@example.com")
+	cfg.AccessEntries = []config.AccessEntry{
+		{Role: "developer", Permission: "deploy", Target: "urn:arryved:app:pay-*", Effect: config.Allow},
+		{Role: "developer", Permission: "restart", Target: "urn:arryved:env:dev:app:*", Effect: config.Allow},
+		{Role: "developer", Permission: "deploy", Target: "urn:arryved:env:prod:app:*", Effect: config.Deny},
+	}
+
+	// globs
+	assert.NoError(Authorized(ctx, cfg, nil, bob, "deploy", "urn:arryved:app:pay-api"))
+	assert.Error(Authorized(ctx, cfg, nil, bob, "deploy", "urn:arryved:app:payroll"))
+
+	// an unqualified entry applies in every env, unless denied there
+	assert.NoError(Authorized(ctx, cfg, nil, bob, "deploy", "urn:arryved:env:dev:app:pay-api"))
+	assert.NoError(Authorized(ctx, cfg, nil, bob, "deploy", "urn:arryved:env:stg:app:pay-api"))
+	assert.Error(Authorized(ctx, cfg, nil, bob, "deploy", "urn:arryved:env:prod:app:pay-api"))
+
+	// an env-qualified entry only in its env
+	assert.NoError(Authorized(ctx, cfg, nil, bob, "restart", "urn:arryved:env:dev:app:anything"))
+	assert.Error(Authorized(ctx, cfg, nil, bob, "restart", "urn:arryved:env:prod:app:anything"))
+	assert.Error(Authorized(ctx, cfg, nil, bob, "restart", "urn:arryved:app:anything"))
+
+	// a deny wins regardless of where it sits relative to the allow
+	cfg.AccessEntries = []config.AccessEntry{
+		{Role: "developer", Permission: "deploy", Target: "urn:arryved:app:pay", Effect: config.Deny},
+		{Role: "developer", Permission: "deploy", Target: "*", Effect: config.Allow},
+	}
+	assert.Error(Authorized(ctx, cfg, nil, bob, "deploy", "urn:arryved:env:dev:app:pay"))
+	assert.NoError(Authorized(ctx, cfg, nil, bob, "deploy", "urn:arryved:env:dev:app:other"))
+
+	// denies only bite the roles they name
+	alice := config.PrincipalUrn("urn:example:user:alice.sre@example.com")
+	cfg.AccessEntries = append(cfg.AccessEntries, config.AccessEntry{Role: "operator", Permission: "deploy", Target: "*", Effect: config.Allow})
+	assert.NoError(Authorized(ctx, cfg, nil, alice, "deploy", "urn:arryved:env:dev:app:pay"))
+}
+
+func TestEnvUrn(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("urn:arryved:env:prod:app:pay", config.EnvUrn("prod", "urn:arryved:app:pay"))
+	assert.True(config.ResourceUrn("urn:arryved:app:pay").Matches(config.EnvUrn("prod", "urn:arryved:app:pay")))
+	assert.True(config.ResourceUrn("*").Matches("urn:arryved:env:prod:app:pay"))
+	assert.False(config.ResourceUrn("urn:arryved:app:[").Matches("urn:arryved:app:pay"))
+}
+
+func TestAuthorizedAll(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	cfg.RBACEnabled = true
+	ctx := context.Background()
+	bob := config.PrincipalUrn("urn:example:user:bob.dev@example.com")
+	cfg.AccessEntries = []config.AccessEntry{
+		{Role: "developer", Permission: "deploy", Target: "urn:arryved:app:pay-*", Effect: config.Allow},
+		{Role: "developer", Permission: "deploy", Target: "urn:arryved:env:prod:app:pay-ledger", Effect: config.Deny},
+	}
+
+	// patterns within the allow that steer clear of the deny
+	assert.NoError(AuthorizedAll(ctx, cfg, nil, bob, "deploy", "urn:arryved:app:pay-api"))
+	assert.NoError(AuthorizedAll(ctx, cfg, nil, bob, "deploy", "urn:arryved:env:dev:app:pay-*"))
+
+	// patterns that would reach the denied app, or past the allow
+	assert.Error(AuthorizedAll(ctx, cfg, nil, bob, "deploy", "urn:arryved:app:pay-*"))
+	assert.Error(AuthorizedAll(ctx, cfg, nil, bob, "deploy", "urn:arryved:env:prod:app:pay-ledger"))
+	assert.Error(AuthorizedAll(ctx, cfg, nil, bob, "deploy", "urn:arryved:app:*"))
+	assert.Error(AuthorizedAll(ctx, cfg, nil, bob, "restart", "urn:arryved:app:pay-api"))
+
+	assert.True(config.ResourceUrn("urn:arryved:env:prod:app:*").Overlaps("urn:arryved:app:pay-api"))
+	assert.False(config.ResourceUrn("urn:arryved:env:prod:app:*").Overlaps("urn:arryved:env:dev:app:pay-api"))
+	assert.False(config.ResourceUrn("urn:arryved:app:pay-*").Overlaps("urn:arryved:app:payroll"))
+}
+
+func TestCheckPolicy(t *testing.T) {
+	assert := assert.New(t)
+	policy, err := config.LoadPolicy("../config/mock-policy.yml")
+	assert.NoError(err)
+	cases, err := LoadPolicyCases("../config/mock-policy-cases.yml")
+	assert.NoError(err)
+	assert.Len(cases, 5)
+
+	for _, result := range CheckPolicy(context.Background(), policy, cases) {
+		assert.True(result.Passed(), result.Case.Name)
+	}
+
+	// a wrong expectation fails, with the reason
+	cases[2].Expected = config.Allow
+	result := CheckPolicy(context.Background(), policy, cases[2:3])[0]
+	assert.False(result.Passed())
+	assert.Equal(config.Deny, result.Actual)
+	assert.Contains(result.Reason, "denied")
+}
@@ -1,24 +1,71 @@
 package utility
 
 import (
+	"context"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
 	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/groups"
 )
 
+// where group memberships come from; until SetGroupResolver is called, usersByGroups in the RBAC policy
+var groupResolver groups.GroupResolver
+
+func SetGroupResolver(resolver groups.GroupResolver) {
+	groupResolver = resolver
+}
+
+// UTILITY for listing the groups principal is a member of; empty if they can't be resolved
+func GroupsOf(ctx context.Context, cfg *config.Config, principal config.PrincipalUrn) []config.GroupUrn {
+	resolver := groupResolver
+	if resolver == nil {
+		resolver = groups.NewPolicyResolver(cfg)
+	}
+	memberships, err := resolver.GroupsOf(ctx, principal)
+	if err != nil {
+		log.Errorf("could not resolve groups, treating as member of none principal=%s err=%s", principal, err.Error())
+		return []config.GroupUrn{}
+	}
+	return memberships
+}
+
 // UTILITY for asserting role for principal
-func PrincipalHasRole(cfg *config.Config, principal config.PrincipalUrn, role config.Role) bool {
-	for _, group := range cfg.RoleMemberships[role] {
-		if PrincipalInGroup(cfg, principal, group) {
+func PrincipalHasRole(ctx context.Context, cfg *config.Config, principal config.PrincipalUrn, role config.Role) bool {
+	memberships := GroupsOf(ctx, cfg, principal)
+	for _, group := range cfg.Policy().RoleMemberships[role] {
+		if containsGroup(memberships, group) {
 			return true
 		}
 	}
 	return false
 }
 
+// UTILITY for listing the roles principal holds through its groups
+func RolesOf(ctx context.Context, cfg *config.Config, principal config.PrincipalUrn) []config.Role {
+	memberships := GroupsOf(ctx, cfg, principal)
+	roles := []config.Role{}
+	for role, roleGroups := range cfg.Policy().RoleMemberships {
+		for _, group := range roleGroups {
+			if containsGroup(memberships, group) {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i] < roles[j] })
+	return roles
+}
+
 // UTILITY for asserting group membership for principal
-func PrincipalInGroup(cfg *config.Config, principal config.PrincipalUrn, group config.GroupUrn) bool {
-	// TODO replace this with GWS group membership lookup
-	for _, p := range cfg.UsersByGroups[group] {
-		if p == principal {
+func PrincipalInGroup(ctx context.Context, cfg *config.Config, principal config.PrincipalUrn, group config.GroupUrn) bool {
+	return containsGroup(GroupsOf(ctx, cfg, principal), group)
+}
+
+func containsGroup(memberships []config.GroupUrn, group config.GroupUrn) bool {
+	for _, membership := range memberships {
+		if membership == group {
 			return true
 		}
 	}
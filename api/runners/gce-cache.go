@@ -9,6 +9,7 @@ import (
 
 	"github.com/arryved/app-ctrl/api/config"
 	"github.com/arryved/app-ctrl/api/gce"
+	"github.com/arryved/app-ctrl/api/metrics"
 )
 
 type GCECache struct {
@@ -52,6 +53,7 @@ func (r *GCECacheRunner) Start() {
 		envRegions := r.regionsFromConfig()
 		log.Infof("envRegions covered in config=%v", envRegions)
 		for {
+			start := time.Now()
 			for envRegion := range envRegions {
 				client := gce.NewClient(envRegion.Env, envRegion.Region)
 				instancesByEnvRegion, err := client.GetRegionAppControlInstances()
@@ -60,6 +62,7 @@ func (r *GCECacheRunner) Start() {
 				}
 				r.Cache.Set(instancesByEnvRegion)
 			}
+			metrics.GCECacheRefreshed(start)
 			// update cache with instancesByEnvRegion
 			log.Info("GCECacheRunner going to sleep for a bit")
 			time.Sleep(time.Second * 60)
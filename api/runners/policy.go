@@ -0,0 +1,73 @@
+package runners
+
+import (
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/metrics"
+)
+
+// Watches the RBAC policy file and swaps a new policy in once it parses and validates; an invalid edit is
+// logged and the policy already in force is kept
+type PolicyRunner struct {
+	cfg     *config.Config
+	modTime time.Time
+	size    int64
+}
+
+func NewPolicyRunner(cfg *config.Config) *PolicyRunner {
+	return &PolicyRunner{
+		cfg: cfg,
+	}
+}
+
+// Load the policy file, failing if it's invalid, then keep watching it. Without a policyPath, the inline
+// settings in the config are used and there's nothing to watch.
+func (r *PolicyRunner) Start() error {
+	if r.cfg.PolicyPath == "" {
+		log.Warn("no policyPath configured, using the RBAC settings inline in the config")
+		return nil
+	}
+	if _, err := r.reload(); err != nil {
+		return err
+	}
+	go func() {
+		log.Infof("started PolicyRunner path=%s", r.cfg.PolicyPath)
+		for {
+			time.Sleep(time.Duration(r.cfg.PolicyReloadS) * time.Second)
+			if _, err := r.reload(); err != nil {
+				log.Errorf("rejected policy change, keeping the current policy err=%s", err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// load the policy file if it changed since the last load; reports whether a new policy was swapped in
+func (r *PolicyRunner) reload() (bool, error) {
+	info, err := os.Stat(r.cfg.PolicyPath)
+	if err != nil {
+		metrics.PolicyReloads.WithLabelValues("rejected").Inc()
+		return false, err
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false, nil
+	}
+	// remember the file either way, so a bad edit is reported once rather than on every check
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+
+	policy, err := config.LoadPolicy(r.cfg.PolicyPath)
+	if err != nil {
+		metrics.PolicyReloads.WithLabelValues("rejected").Inc()
+		return false, err
+	}
+	r.cfg.SetPolicy(policy)
+	metrics.PolicyReloads.WithLabelValues("loaded").Inc()
+	log.Infof("loaded policy path=%s roles=%d accessEntries=%d groups=%d",
+		r.cfg.PolicyPath, len(policy.RoleMemberships), len(policy.AccessEntries), len(policy.UsersByGroups))
+	return true, nil
+}
@@ -0,0 +1,58 @@
+//go:build !integration
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+func TestPolicyRunnerReload(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	cfg.PolicyPath = filepath.Join(t.TempDir(), "policy.yml")
+	modTime := time.Now().Add(-time.Hour)
+	write := func(contents string) {
+		modTime = modTime.Add(time.Minute)
+		assert.NoError(os.WriteFile(cfg.PolicyPath, []byte(contents), 0600))
+		assert.NoError(os.Chtimes(cfg.PolicyPath, modTime, modTime))
+	}
+	runner := NewPolicyRunner(cfg)
+
+	// a missing or invalid policy is refused at startup
+	assert.Error(runner.Start())
+	write("accessEntries:\n  - role: nobody\n")
+	assert.Error(runner.Start())
+
+	valid := "roleMemberships:\n  operator: [urn:example:group:sre-team@example.com]\n" +
+		"accessEntries:\n  - {role: operator, permission: deploy, target: \"*\"}\n"
+	write(valid)
+	assert.NoError(runner.Start())
+	first := cfg.Policy()
+	assert.Len(first.AccessEntries, 1)
+
+	// unchanged file, nothing to do
+	swapped, err := runner.reload()
+	assert.NoError(err)
+	assert.False(swapped)
+
+	// a bad edit keeps the policy in force
+	write("accessEntries: [")
+	swapped, err = runner.reload()
+	assert.Error(err)
+	assert.False(swapped)
+	assert.Same(first, cfg.Policy())
+
+	// a good one is swapped in
+	write(valid + "  - {role: operator, permission: restart, target: \"*\"}\n")
+	swapped, err = runner.reload()
+	assert.NoError(err)
+	assert.True(swapped)
+	assert.Len(cfg.Policy().AccessEntries, 2)
+}
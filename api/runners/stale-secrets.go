@@ -0,0 +1,103 @@
+package runners
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/metrics"
+	"github.com/arryved/app-ctrl/api/secrets"
+)
+
+type staleSecretsCheck struct {
+	stale     []secrets.StaleSecret
+	checkedAt time.Time
+}
+
+// The secrets found stale in each env by the last StaleSecretsRunner check
+type StaleSecretsCache struct {
+	sync.RWMutex
+	data map[string]staleSecretsCheck
+}
+
+// Stale secrets in env and when that was determined; ok is false until env has been checked once
+func (c *StaleSecretsCache) Get(env string) ([]secrets.StaleSecret, time.Time, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	check, ok := c.data[env]
+	return check.stale, check.checkedAt, ok
+}
+
+func (c *StaleSecretsCache) Set(env string, stale []secrets.StaleSecret, checkedAt time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.data[env] = staleSecretsCheck{stale: stale, checkedAt: checkedAt}
+}
+
+// Periodically looks through each env's secrets for ones past their rotation date or expiry
+type StaleSecretsRunner struct {
+	cfg   *config.Config
+	Cache *StaleSecretsCache
+}
+
+func NewStaleSecretsRunner(cfg *config.Config) *StaleSecretsRunner {
+	return &StaleSecretsRunner{
+		cfg: cfg,
+		Cache: &StaleSecretsCache{
+			data: map[string]staleSecretsCheck{},
+		},
+	}
+}
+
+func (r *StaleSecretsRunner) Start() {
+	go func() {
+		log.Infof("started StaleSecretsRunner checkS=%d", r.cfg.StaleSecretsCheckS)
+		envs := []string{}
+		for env := range r.cfg.Topology {
+			envs = append(envs, env)
+		}
+		sort.Strings(envs)
+		for {
+			for _, env := range envs {
+				if err := r.checkEnv(context.Background(), env); err != nil {
+					metrics.StaleSecretsCheckFailures.WithLabelValues(env).Inc()
+					log.Warnf("could not check for stale secrets env=%s err=%s", env, err.Error())
+				}
+			}
+			time.Sleep(time.Duration(r.cfg.StaleSecretsCheckS) * time.Second)
+		}
+	}()
+}
+
+func (r *StaleSecretsRunner) checkEnv(ctx context.Context, env string) error {
+	store, err := secrets.NewEnvStore(ctx, r.cfg, env)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return r.check(ctx, env, store, time.Now())
+}
+
+// check env's secrets as of now, updating the cache and metrics
+func (r *StaleSecretsRunner) check(ctx context.Context, env string, store secrets.Store, now time.Time) error {
+	stale, err := secrets.SecretsStale(ctx, store, now)
+	if err != nil {
+		return err
+	}
+	r.Cache.Set(env, stale, now)
+
+	counts := map[string]int{secrets.RotationOverdue: 0, secrets.Expired: 0}
+	for _, secret := range stale {
+		counts[secret.Reason]++
+	}
+	for reason, count := range counts {
+		metrics.StaleSecrets.WithLabelValues(env, reason).Set(float64(count))
+	}
+	log.Infof("checked for stale secrets env=%s rotationOverdue=%d expired=%d",
+		env, counts[secrets.RotationOverdue], counts[secrets.Expired])
+	return nil
+}
@@ -0,0 +1,56 @@
+//go:build !integration
+
+package runners
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	smpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/metrics"
+	"github.com/arryved/app-ctrl/api/secrets"
+)
+
+func TestStaleSecretsRunnerCheck(t *testing.T) {
+	assert := assert.New(t)
+	cfg := config.Load("../config/mock-config.yml")
+	runner := NewStaleSecretsRunner(cfg)
+	created := &timestamppb.Timestamp{Seconds: 1724043000}
+	store := secrets.NewGCPStore(secrets.MockSecretClient{
+		SecretsList: []*smpb.Secret{
+			{Name: "projects/000000000000/secrets/monthly", CreateTime: created,
+				Annotations: map[string]string{"app-control.rotation-period-days": "30"}},
+			{Name: "projects/000000000000/secrets/untracked", CreateTime: created},
+		},
+		Versions: []*smpb.SecretVersion{
+			{Name: "projects/000000000000/secrets/monthly/versions/1", State: smpb.SecretVersion_ENABLED, CreateTime: created},
+		},
+	}, "000000000000", nil)
+
+	// not checked yet
+	_, _, ok := runner.Cache.Get("dev")
+	assert.False(ok)
+
+	now := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(runner.check(context.Background(), "dev", store, now))
+	stale, checkedAt, ok := runner.Cache.Get("dev")
+	assert.True(ok)
+	assert.Equal(now, checkedAt)
+	assert.Len(stale, 1)
+	assert.Equal("urn:arryved:secret:monthly", stale[0].Urn)
+	assert.Equal(1.0, testutil.ToFloat64(metrics.StaleSecrets.WithLabelValues("dev", secrets.RotationOverdue)))
+	assert.Equal(0.0, testutil.ToFloat64(metrics.StaleSecrets.WithLabelValues("dev", secrets.Expired)))
+
+	// as of a day after the last rotation, nothing is stale and the gauge goes back down
+	now = time.Unix(1724043000+86400, 0)
+	assert.NoError(runner.check(context.Background(), "dev", store, now))
+	stale, _, _ = runner.Cache.Get("dev")
+	assert.Empty(stale)
+	assert.Equal(0.0, testutil.ToFloat64(metrics.StaleSecrets.WithLabelValues("dev", secrets.RotationOverdue)))
+}
@@ -0,0 +1,291 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BundleFormat identifies the bundle layout; bump it on incompatible changes
+const BundleFormat = "app-control-secrets/v1"
+
+// What an import does with a secret that already exists in the env
+const (
+	OnConflictSkip      = "skip"      // leave the existing secret be
+	OnConflictOverwrite = "overwrite" // add the bundled value as a new version, and replace owners and rotation policy
+	OnConflictFail      = "fail"      // refuse the whole import before changing anything
+)
+
+var ErrConflict = errors.New("secrets already exist")
+
+// Everything needed to recreate an env's secrets: the latest value of each, its owners and its rotation policy.
+// Older versions aren't kept; a restored secret starts over at version 1.
+type Bundle struct {
+	Env             string         `json:"env"`
+	ExportedEpochNs int64          `json:"exportedEpochNs"`
+	Secrets         []BundleSecret `json:"secrets"`
+}
+
+type BundleSecret struct {
+	Id             string         `json:"id"`
+	CreatedEpochNs int64          `json:"createdEpochNs"` // when the original was created; informational
+	Value          []byte         `json:"value"`
+	Owners         Owners         `json:"owners"`
+	Rotation       SecretRotation `json:"rotation"`
+}
+
+// A Bundle envelope-encrypted to a recipient: the bundle is sealed (AES-256-GCM) with a random data key, and the
+// data key with the recipient's RSA public key (OAEP, SHA-256). The plain fields are bound to the ciphertext, so
+// they can be read without the private key but not changed.
+type EncryptedBundle struct {
+	Format          string `json:"format"`
+	Env             string `json:"env"`
+	ExportedEpochNs int64  `json:"exportedEpochNs"`
+	Count           int    `json:"count"`      // secrets in the bundle
+	WrappedKey      []byte `json:"wrappedKey"` // the data key, encrypted to the recipient
+	Ciphertext      []byte `json:"ciphertext"` // the bundle JSON sealed with the data key, nonce first
+}
+
+// What an import did, by secret id
+type ImportResult struct {
+	Created     []string `json:"created"`
+	Overwritten []string `json:"overwritten"`
+	Skipped     []string `json:"skipped"`
+	Failed      []string `json:"failed"` // see the API log for why
+}
+
+// Read every secret in store into a bundle for env
+func Export(ctx context.Context, store Store, env string) (*Bundle, error) {
+	entries, err := store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list secrets env=%s err=%w", env, err)
+	}
+	bundle := &Bundle{Env: env, ExportedEpochNs: time.Now().UnixNano(), Secrets: []BundleSecret{}}
+	for _, entry := range entries {
+		secretId := secretIdOf(entry.Urn)
+		value, err := store.Read(ctx, secretId, "latest")
+		if err != nil {
+			return nil, fmt.Errorf("could not read secret=%s env=%s err=%w", secretId, env, err)
+		}
+		owners, err := store.Owners(ctx, secretId)
+		if err != nil {
+			return nil, fmt.Errorf("could not get owners of secret=%s env=%s err=%w", secretId, env, err)
+		}
+		bundle.Secrets = append(bundle.Secrets, BundleSecret{
+			Id:             secretId,
+			CreatedEpochNs: entry.CreatedEpochNs,
+			Value:          value,
+			Owners:         owners,
+			Rotation:       entry.SecretRotation,
+		})
+	}
+	sort.Slice(bundle.Secrets, func(i, j int) bool { return bundle.Secrets[i].Id < bundle.Secrets[j].Id })
+	return bundle, nil
+}
+
+// Recreate bundle's secrets in store, handling existing ones per onConflict (see the OnConflict constants).
+// A failure on one secret doesn't stop the rest; it's logged and reported in the result.
+func Import(ctx context.Context, store Store, bundle *Bundle, onConflict string) (ImportResult, error) {
+	result := ImportResult{Created: []string{}, Overwritten: []string{}, Skipped: []string{}, Failed: []string{}}
+	if onConflict != OnConflictSkip && onConflict != OnConflictOverwrite && onConflict != OnConflictFail {
+		return result, fmt.Errorf("unknown onConflict=%s", onConflict)
+	}
+	if onConflict == OnConflictFail {
+		existing, err := existingIds(ctx, store, bundle)
+		if err != nil {
+			return result, err
+		}
+		if len(existing) > 0 {
+			return result, fmt.Errorf("%w: %v", ErrConflict, existing)
+		}
+	}
+
+	for _, secret := range bundle.Secrets {
+		err := store.Create(ctx, secret.Id, secret.Value, secret.Owners, secret.Rotation)
+		switch {
+		case err == nil:
+			result.Created = append(result.Created, secret.Id)
+		case !isAlreadyExists(err):
+			log.Errorf("could not import secret=%s err=%s", secret.Id, err.Error())
+			result.Failed = append(result.Failed, secret.Id)
+		case onConflict == OnConflictOverwrite:
+			if err := overwrite(ctx, store, secret); err != nil {
+				log.Errorf("could not overwrite secret=%s err=%s", secret.Id, err.Error())
+				result.Failed = append(result.Failed, secret.Id)
+				continue
+			}
+			result.Overwritten = append(result.Overwritten, secret.Id)
+		default:
+			// skip, or fail where the secret was created since the check above
+			result.Skipped = append(result.Skipped, secret.Id)
+		}
+	}
+	log.Infof("imported secrets env=%s created=%d overwritten=%d skipped=%d failed=%d", bundle.Env,
+		len(result.Created), len(result.Overwritten), len(result.Skipped), len(result.Failed))
+	return result, nil
+}
+
+// ids in bundle that are already in store
+func existingIds(ctx context.Context, store Store, bundle *Bundle) ([]string, error) {
+	entries, err := store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list secrets err=%w", err)
+	}
+	present := map[string]bool{}
+	for _, entry := range entries {
+		present[secretIdOf(entry.Urn)] = true
+	}
+	existing := []string{}
+	for _, secret := range bundle.Secrets {
+		if present[secret.Id] {
+			existing = append(existing, secret.Id)
+		}
+	}
+	return existing, nil
+}
+
+func overwrite(ctx context.Context, store Store, secret BundleSecret) error {
+	if err := store.Update(ctx, secret.Id, secret.Value); err != nil {
+		return err
+	}
+	if err := store.SetOwners(ctx, secret.Id, secret.Owners); err != nil {
+		return err
+	}
+	rotation := secret.Rotation
+	_, err := store.SetRotation(ctx, secret.Id, SecretRotationUpdate{
+		RotationPeriodDays: &rotation.RotationPeriodDays,
+		ExpiresEpochNs:     &rotation.ExpiresEpochNs,
+		Description:        &rotation.Description,
+	})
+	return err
+}
+
+// Secret Manager and the local store both report it in the error text
+func isAlreadyExists(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "AlreadyExists")
+}
+
+// Encrypt bundle to recipient
+func SealBundle(bundle *Bundle, recipient *rsa.PublicKey) (*EncryptedBundle, error) {
+	plaintext, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, recipient, dataKey, []byte(BundleFormat))
+	if err != nil {
+		return nil, fmt.Errorf("could not wrap bundle key err=%w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := &EncryptedBundle{
+		Format:          BundleFormat,
+		Env:             bundle.Env,
+		ExportedEpochNs: bundle.ExportedEpochNs,
+		Count:           len(bundle.Secrets),
+		WrappedKey:      wrappedKey,
+	}
+	encrypted.Ciphertext, err = sealWith(aead, plaintext, encrypted.aad())
+	if err != nil {
+		return nil, err
+	}
+	return encrypted, nil
+}
+
+// Decrypt encrypted with the recipient's private key
+func OpenBundle(encrypted *EncryptedBundle, key *rsa.PrivateKey) (*Bundle, error) {
+	if encrypted.Format != BundleFormat {
+		return nil, fmt.Errorf("unsupported bundle format=%s", encrypted.Format)
+	}
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, encrypted.WrappedKey, []byte(BundleFormat))
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap bundle key; wrong private key? err=%w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := openWith(aead, encrypted.Ciphertext, encrypted.aad())
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt bundle err=%w", err)
+	}
+	bundle := &Bundle{}
+	if err := json.Unmarshal(plaintext, bundle); err != nil {
+		return nil, fmt.Errorf("could not parse bundle err=%w", err)
+	}
+	return bundle, nil
+}
+
+func (e *EncryptedBundle) aad() []byte {
+	return []byte(fmt.Sprintf("%s/%s/%d/%d", e.Format, e.Env, e.ExportedEpochNs, e.Count))
+}
+
+// The RSA public key in the PEM file at path (PKIX "PUBLIC KEY" or PKCS #1 "RSA PUBLIC KEY")
+func LoadBundleRecipient(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse public key path=%s err=%w", path, err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key path=%s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+// The RSA private key in the PEM file at path (PKCS #8 "PRIVATE KEY" or PKCS #1 "RSA PRIVATE KEY")
+func LoadBundleKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key path=%s err=%w", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key path=%s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key path=%s err=%w", path, err)
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in key path=%s", path)
+	}
+	return block, nil
+}
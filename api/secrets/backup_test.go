@@ -0,0 +1,127 @@
+//go:build !integration
+
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundleSealOpen(t *testing.T) {
+	assert := assert.New(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+	bundle := &Bundle{Env: "prod", ExportedEpochNs: 1, Secrets: []BundleSecret{
+		{Id: "db-password", Value: []byte("hunter2"), Owners: Owners{Users: []string{}, Groups: []string{"team@arryved.com"}}},
+	}}
+
+	encrypted, err := SealBundle(bundle, &key.PublicKey)
+	assert.NoError(err)
+	assert.Equal(BundleFormat, encrypted.Format)
+	assert.Equal(1, encrypted.Count)
+	assert.NotContains(string(encrypted.Ciphertext), "hunter2")
+	opened, err := OpenBundle(encrypted, key)
+	assert.NoError(err)
+	assert.Equal(bundle, opened)
+
+	// the plain fields can't be changed
+	tampered := *encrypted
+	tampered.Env = "dev"
+	_, err = OpenBundle(&tampered, key)
+	assert.Error(err)
+
+	// nor opened with another key
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+	_, err = OpenBundle(encrypted, otherKey)
+	assert.Error(err)
+}
+
+func TestBundleKeys(t *testing.T) {
+	assert := assert.New(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+	dir := t.TempDir()
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(err)
+	publicPath, privatePath := filepath.Join(dir, "backup.pub"), filepath.Join(dir, "backup.key")
+	assert.NoError(os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0600))
+	assert.NoError(os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600))
+
+	recipient, err := LoadBundleRecipient(publicPath)
+	assert.NoError(err)
+	assert.True(recipient.Equal(&key.PublicKey))
+	private, err := LoadBundleKey(privatePath)
+	assert.NoError(err)
+	assert.True(private.Equal(key))
+
+	_, err = LoadBundleRecipient(privatePath)
+	assert.Error(err)
+	_, err = LoadBundleKey(filepath.Join(dir, "missing.key"))
+	assert.Error(err)
+}
+
+func TestExportImport(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	source, _ := localStore(t)
+	owners := Owners{Users: []string{"owner@arryved.com"}, Groups: []string{"team@arryved.com"}}
+	assert.NoError(source.Create(ctx, "db-password", []byte("v1"), owners, SecretRotation{RotationPeriodDays: 30}))
+	assert.NoError(source.Update(ctx, "db-password", []byte("v2")))
+	assert.NoError(source.Create(ctx, "api-key", []byte("key"), owners, SecretRotation{}))
+
+	bundle, err := Export(ctx, source, "prod")
+	assert.NoError(err)
+	assert.Len(bundle.Secrets, 2)
+	assert.Equal("api-key", bundle.Secrets[0].Id)
+	assert.Equal([]byte("v2"), bundle.Secrets[1].Value)
+	assert.Equal(owners, bundle.Secrets[1].Owners)
+	assert.Equal(30, bundle.Secrets[1].Rotation.RotationPeriodDays)
+
+	// into an empty env, everything is created
+	destination, _ := localStore(t)
+	result, err := Import(ctx, destination, bundle, OnConflictFail)
+	assert.NoError(err)
+	assert.Equal([]string{"api-key", "db-password"}, result.Created)
+	value, err := destination.Read(ctx, "db-password", "latest")
+	assert.NoError(err)
+	assert.Equal([]byte("v2"), value)
+	restoredOwners, err := destination.Owners(ctx, "db-password")
+	assert.NoError(err)
+	assert.Equal(owners, restoredOwners)
+
+	// again: fail changes nothing, skip leaves them be, overwrite adds a version
+	assert.NoError(destination.Update(ctx, "db-password", []byte("local change")))
+	_, err = Import(ctx, destination, bundle, OnConflictFail)
+	assert.ErrorIs(err, ErrConflict)
+	result, err = Import(ctx, destination, bundle, OnConflictSkip)
+	assert.NoError(err)
+	assert.Equal([]string{"api-key", "db-password"}, result.Skipped)
+	value, err = destination.Read(ctx, "db-password", "latest")
+	assert.NoError(err)
+	assert.Equal([]byte("local change"), value)
+
+	assert.NoError(destination.SetOwners(ctx, "db-password", Owners{Groups: []string{"other@arryved.com"}}))
+	result, err = Import(ctx, destination, bundle, OnConflictOverwrite)
+	assert.NoError(err)
+	assert.Equal([]string{"api-key", "db-password"}, result.Overwritten)
+	value, err = destination.Read(ctx, "db-password", "latest")
+	assert.NoError(err)
+	assert.Equal([]byte("v2"), value)
+	restoredOwners, err = destination.Owners(ctx, "db-password")
+	assert.NoError(err)
+	assert.Equal(owners, restoredOwners)
+
+	_, err = Import(ctx, destination, bundle, "merge")
+	assert.Error(err)
+}
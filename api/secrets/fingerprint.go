@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// shortest fingerprint key accepted, in bytes
+const minFingerprintKeyLength = 32
+
+// Keyed fingerprints of secret values: HMAC-SHA256 under a server-side key. Equal values have equal fingerprints, so
+// they can be compared across envs, versions or time, and without the key a fingerprint can't be brute-forced
+// offline.
+type Fingerprinter struct {
+	key []byte
+}
+
+// A fingerprinter keyed with the base64-encoded key (32 bytes or more) in keyPath. With no keyPath there's no
+// fingerprinter (nil), rather than one with a key made up on the spot that would change fingerprints on every restart
+// and differ between instances.
+func NewFingerprinter(keyPath string) (*Fingerprinter, error) {
+	if keyPath == "" {
+		return nil, nil
+	}
+	encodedKey, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read fingerprint key path=%s err=%w", keyPath, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedKey)))
+	if err != nil || len(key) < minFingerprintKeyLength {
+		return nil, fmt.Errorf("fingerprint key path=%s is not a base64-encoded key of at least %d bytes", keyPath, minFingerprintKeyLength)
+	}
+	return &Fingerprinter{key: key}, nil
+}
+
+// hex HMAC-SHA256 of value
+func (f *Fingerprinter) Fingerprint(value []byte) string {
+	mac := hmac.New(sha256.New, f.key)
+	mac.Write(value)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Whether two fingerprints are of the same value, in constant time
+func FingerprintsEqual(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
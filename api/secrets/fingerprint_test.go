@@ -0,0 +1,43 @@
+//go:build !integration
+
+package secrets
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprinter(t *testing.T) {
+	assert := assert.New(t)
+	keyPath := filepath.Join(t.TempDir(), "fingerprint.key")
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(os.WriteFile(keyPath, []byte(key+"\n"), 0600))
+
+	fingerprinter, err := NewFingerprinter(keyPath)
+	assert.NoError(err)
+	// HMAC-SHA256 of "hunter2" under the key above
+	assert.Equal("3920d54ec70f500ee54e1da041d2364a8e57dd252f7a81ed8acd58ad6cf3b6d0", fingerprinter.Fingerprint([]byte("hunter2")))
+	assert.True(FingerprintsEqual(fingerprinter.Fingerprint([]byte("hunter2")), fingerprinter.Fingerprint([]byte("hunter2"))))
+	assert.False(FingerprintsEqual(fingerprinter.Fingerprint([]byte("hunter2")), fingerprinter.Fingerprint([]byte("hunter3"))))
+
+	// the same key file gives the same fingerprints
+	again, err := NewFingerprinter(keyPath)
+	assert.NoError(err)
+	assert.Equal(fingerprinter.Fingerprint([]byte("hunter2")), again.Fingerprint([]byte("hunter2")))
+
+	// without one there's no fingerprinting
+	unconfigured, err := NewFingerprinter("")
+	assert.NoError(err)
+	assert.Nil(unconfigured)
+
+	shortPath := filepath.Join(t.TempDir(), "short.key")
+	assert.NoError(os.WriteFile(shortPath, []byte(base64.StdEncoding.EncodeToString([]byte("too short"))), 0600))
+	_, err = NewFingerprinter(shortPath)
+	assert.Error(err)
+	_, err = NewFingerprinter(filepath.Join(t.TempDir(), "missing.key"))
+	assert.Error(err)
+}
@@ -0,0 +1,428 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// same rule as the API applies to new secret ids; it also keeps ids from escaping the store's directory
+var localSecretIdPattern = regexp.MustCompile(`^[a-zA-Z0-9-_]+$`)
+
+// Store backed by a directory of files, one per secret, for development and tests. Each version's value is
+// envelope-encrypted: sealed (AES-256-GCM) with its own random data key, which is sealed in turn with the master key.
+type LocalStore struct {
+	dir       string
+	masterKey cipher.AEAD
+	// serializes read-modify-write of secret files; reads don't need it, files are replaced atomically
+	mutex sync.Mutex
+}
+
+// on-disk format of a secret
+type localSecret struct {
+	CreatedEpochNs int64          `json:"createdEpochNs"`
+	Owners         Owners         `json:"owners"`
+	Rotation       SecretRotation `json:"rotation"`
+	Versions       []localVersion `json:"versions"` // oldest first
+}
+
+type localVersion struct {
+	Version        int64  `json:"version"`
+	CreatedEpochNs int64  `json:"createdEpochNs"`
+	WrappedKey     []byte `json:"wrappedKey"` // the data key sealed with the master key, nonce first
+	Value          []byte `json:"value"`      // the value sealed with the data key, nonce first
+}
+
+// Open (creating if needed) a store in dir, with the base64-encoded 32 byte key in masterKeyPath
+func NewLocalStore(dir, masterKeyPath string) (*LocalStore, error) {
+	encodedKey, err := os.ReadFile(masterKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read master key path=%s err=%w", masterKeyPath, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedKey)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("master key path=%s is not a base64-encoded 32 byte key", masterKeyPath)
+	}
+	masterKey, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir, masterKey: masterKey}, nil
+}
+
+func (s *LocalStore) Create(
+	ctx context.Context, secretId string, value []byte, owners Owners, rotation SecretRotation) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err := s.load(secretId)
+	if err == nil {
+		return fmt.Errorf("%w: secret=%s already exists", ErrAlreadyExists, secretId)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	secret := &localSecret{
+		CreatedEpochNs: time.Now().UnixNano(),
+		Owners:         owners.Normalized(),
+		Rotation:       rotation,
+		Versions:       []localVersion{},
+	}
+	if _, err := s.addVersion(secretId, secret, value); err != nil {
+		return err
+	}
+	log.Infof("Created local secret dir=%s secretId=%s", s.dir, secretId)
+	return nil
+}
+
+func (s *LocalStore) Read(ctx context.Context, secretId, version string) ([]byte, error) {
+	secret, err := s.load(secretId)
+	if err != nil {
+		return []byte{}, err
+	}
+	if version == "latest" {
+		return s.open(secretId, secret.Versions[len(secret.Versions)-1])
+	}
+	number, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return []byte{}, fmt.Errorf("invalid version=%s", version)
+	}
+	for _, v := range secret.Versions {
+		if v.Version == number {
+			return s.open(secretId, v)
+		}
+	}
+	return []byte{}, fmt.Errorf("%w: secret=%s version=%d", ErrNotFound, secretId, number)
+}
+
+func (s *LocalStore) Update(ctx context.Context, secretId string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secret, err := s.load(secretId)
+	if err != nil {
+		return err
+	}
+	_, err = s.addVersion(secretId, secret, value)
+	return err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, secretId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secretPath, err := s.path(secretId)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(secretPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: secret=%s", ErrNotFound, secretId)
+		}
+		return err
+	}
+	log.Infof("Deleted local secret dir=%s secretId=%s", s.dir, secretId)
+	return nil
+}
+
+func (s *LocalStore) List(ctx context.Context) ([]SecretEntry, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return []SecretEntry{}, err
+	}
+	result := []SecretEntry{}
+	for _, file := range files {
+		secretId, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok || file.IsDir() {
+			continue
+		}
+		secret, err := s.load(secretId)
+		if errors.Is(err, ErrNotFound) {
+			// deleted since the directory was read
+			continue
+		}
+		if err != nil {
+			return []SecretEntry{}, err
+		}
+		entry := SecretEntry{
+			Urn:            fmt.Sprintf("urn:arryved:secret:%s", secretId),
+			CreatedEpochNs: secret.CreatedEpochNs,
+			SecretRotation: secret.Rotation,
+		}
+		entry.SetOwners(secret.Owners)
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedEpochNs > result[j].CreatedEpochNs
+	})
+	return result, nil
+}
+
+func (s *LocalStore) Owners(ctx context.Context, secretId string) (Owners, error) {
+	secret, err := s.load(secretId)
+	if err != nil {
+		return Owners{}, err
+	}
+	return secret.Owners.Normalized(), nil
+}
+
+func (s *LocalStore) SetOwners(ctx context.Context, secretId string, owners Owners) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secret, err := s.load(secretId)
+	if err != nil {
+		return err
+	}
+	secret.Owners = owners.Normalized()
+	if err := s.save(secretId, secret); err != nil {
+		return err
+	}
+	log.Infof("Set owners of local secret=%s users=%v groups=%v", secretId, secret.Owners.Users, secret.Owners.Groups)
+	return nil
+}
+
+// Versions are never disabled or destroyed here, so they're all ENABLED and fingerprinted
+func (s *LocalStore) Versions(ctx context.Context, secretId string) (*SecretVersionList, error) {
+	secret, err := s.load(secretId)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	result := &SecretVersionList{
+		Salt:     hex.EncodeToString(salt),
+		Versions: []SecretVersionEntry{},
+	}
+	for i := len(secret.Versions) - 1; i >= 0; i-- {
+		version := secret.Versions[i]
+		value, err := s.open(secretId, version)
+		if err != nil {
+			return nil, err
+		}
+		result.Versions = append(result.Versions, SecretVersionEntry{
+			Version:        version.Version,
+			CreatedEpochNs: version.CreatedEpochNs,
+			State:          "ENABLED",
+			Fingerprint:    fingerprint(salt, value),
+		})
+	}
+	return result, nil
+}
+
+func (s *LocalStore) Rollback(ctx context.Context, secretId string, version int64) (int64, error) {
+	value, err := s.Read(ctx, secretId, strconv.FormatInt(version, 10))
+	if err != nil {
+		return 0, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secret, err := s.load(secretId)
+	if err != nil {
+		return 0, err
+	}
+	newVersion, err := s.addVersion(secretId, secret, value)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Rolled back local secret=%s to version=%d as version=%d", secretId, version, newVersion)
+	return newVersion, nil
+}
+
+func (s *LocalStore) SetRotation(ctx context.Context, secretId string, update SecretRotationUpdate) (SecretRotation, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	secret, err := s.load(secretId)
+	if err != nil {
+		return SecretRotation{}, err
+	}
+	if update.RotationPeriodDays != nil {
+		secret.Rotation.RotationPeriodDays = *update.RotationPeriodDays
+	}
+	if update.ExpiresEpochNs != nil {
+		secret.Rotation.ExpiresEpochNs = *update.ExpiresEpochNs
+	}
+	if update.Description != nil {
+		secret.Rotation.Description = *update.Description
+	}
+	if err := s.save(secretId, secret); err != nil {
+		return SecretRotation{}, err
+	}
+	return secret.Rotation, nil
+}
+
+func (s *LocalStore) LastRotated(ctx context.Context, secretId string) (int64, error) {
+	secret, err := s.load(secretId)
+	if err != nil {
+		return 0, err
+	}
+	return secret.Versions[len(secret.Versions)-1].CreatedEpochNs, nil
+}
+
+func (s *LocalStore) Close() error {
+	return nil
+}
+
+func (s *LocalStore) path(secretId string) (string, error) {
+	if !localSecretIdPattern.MatchString(secretId) {
+		return "", fmt.Errorf("invalid secret id=%s", secretId)
+	}
+	return filepath.Join(s.dir, secretId+".json"), nil
+}
+
+func (s *LocalStore) load(secretId string) (*localSecret, error) {
+	secretPath, err := s.path(secretId)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(secretPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: secret=%s", ErrNotFound, secretId)
+		}
+		return nil, err
+	}
+	secret := &localSecret{}
+	if err := json.Unmarshal(contents, secret); err != nil {
+		return nil, fmt.Errorf("could not parse secret path=%s err=%w", secretPath, err)
+	}
+	if len(secret.Versions) == 0 {
+		return nil, fmt.Errorf("secret path=%s has no versions", secretPath)
+	}
+	return secret, nil
+}
+
+// write to a temp file and rename it into place, so readers never see a partial file
+func (s *LocalStore) save(secretId string, secret *localSecret) error {
+	secretPath, err := s.path(secretId)
+	if err != nil {
+		return err
+	}
+	contents, err := json.Marshal(secret)
+	if err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(s.dir, ".tmp-"+secretId+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(contents); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), secretPath)
+}
+
+// seal value as the next version of secret and save it; returns the new version number
+func (s *LocalStore) addVersion(secretId string, secret *localSecret, value []byte) (int64, error) {
+	number := int64(1)
+	if len(secret.Versions) > 0 {
+		number = secret.Versions[len(secret.Versions)-1].Version + 1
+	}
+	version, err := s.seal(secretId, number, value)
+	if err != nil {
+		return 0, err
+	}
+	secret.Versions = append(secret.Versions, version)
+	if err := s.save(secretId, secret); err != nil {
+		return 0, err
+	}
+	log.Infof("Added local secret version secretId=%s version=%d", secretId, number)
+	return number, nil
+}
+
+// both layers are bound to the secret id and version, so sealed values can't be swapped between them
+func versionAAD(secretId string, number int64) []byte {
+	return []byte(fmt.Sprintf("%s/versions/%d", secretId, number))
+}
+
+func (s *LocalStore) seal(secretId string, number int64, value []byte) (localVersion, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return localVersion{}, err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return localVersion{}, err
+	}
+	aad := versionAAD(secretId, number)
+	sealedValue, err := sealWith(dataAEAD, value, aad)
+	if err != nil {
+		return localVersion{}, err
+	}
+	wrappedKey, err := sealWith(s.masterKey, dataKey, aad)
+	if err != nil {
+		return localVersion{}, err
+	}
+	return localVersion{
+		Version:        number,
+		CreatedEpochNs: time.Now().UnixNano(),
+		WrappedKey:     wrappedKey,
+		Value:          sealedValue,
+	}, nil
+}
+
+func (s *LocalStore) open(secretId string, version localVersion) ([]byte, error) {
+	aad := versionAAD(secretId, version.Version)
+	dataKey, err := openWith(s.masterKey, version.WrappedKey, aad)
+	if err != nil {
+		return []byte{}, fmt.Errorf("could not unwrap data key secret=%s version=%d; wrong master key? err=%w",
+			secretId, version.Version, err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return []byte{}, err
+	}
+	value, err := openWith(dataAEAD, version.Value, aad)
+	if err != nil {
+		return []byte{}, fmt.Errorf("could not decrypt secret=%s version=%d err=%w", secretId, version.Version, err)
+	}
+	return value, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce || ciphertext
+func sealWith(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func openWith(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed data too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
@@ -0,0 +1,136 @@
+//go:build !integration
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// a local store in a temp dir, and the path of its master key
+func localStore(t *testing.T) (*LocalStore, string) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	keyPath := filepath.Join(t.TempDir(), "master.key")
+	assert.NoError(t, os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "dev"), keyPath)
+	assert.NoError(t, err)
+	return store, keyPath
+}
+
+func TestLocalStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store, _ := localStore(t)
+	rotation := SecretRotation{RotationPeriodDays: 30}
+	owners := Owners{Users: []string{"owner@arryved.com"}, Groups: []string{"team@arryved.com"}}
+
+	assert.NoError(store.Create(ctx, "db-password", []byte("hunter2"), owners, rotation))
+	assert.ErrorIs(store.Create(ctx, "db-password", []byte("again"), owners, rotation), ErrAlreadyExists)
+
+	value, err := store.Read(ctx, "db-password", "latest")
+	assert.NoError(err)
+	assert.Equal([]byte("hunter2"), value)
+
+	// the value isn't on disk in the clear
+	contents, err := os.ReadFile(filepath.Join(store.dir, "db-password.json"))
+	assert.NoError(err)
+	assert.False(bytes.Contains(contents, []byte("hunter2")))
+	assert.False(bytes.Contains(contents, []byte(base64.StdEncoding.EncodeToString([]byte("hunter2")))))
+
+	assert.NoError(store.Update(ctx, "db-password", []byte("correct-horse")))
+	value, err = store.Read(ctx, "db-password", "latest")
+	assert.NoError(err)
+	assert.Equal([]byte("correct-horse"), value)
+	value, err = store.Read(ctx, "db-password", "1")
+	assert.NoError(err)
+	assert.Equal([]byte("hunter2"), value)
+	_, err = store.Read(ctx, "db-password", "9")
+	assert.ErrorIs(err, ErrNotFound)
+
+	versions, err := store.Versions(ctx, "db-password")
+	assert.NoError(err)
+	assert.Len(versions.Versions, 2)
+	assert.Equal(int64(2), versions.Versions[0].Version)
+
+	newVersion, err := store.Rollback(ctx, "db-password", 1)
+	assert.NoError(err)
+	assert.Equal(int64(3), newVersion)
+	versions, err = store.Versions(ctx, "db-password")
+	assert.NoError(err)
+	assert.Equal(versions.Versions[2].Fingerprint, versions.Versions[0].Fingerprint)
+
+	found, err := store.Owners(ctx, "db-password")
+	assert.NoError(err)
+	assert.Equal(owners, found)
+
+	// a transfer to another team
+	transferred := Owners{Users: []string{}, Groups: []string{"other-team@arryved.com", "sre@arryved.com"}}
+	assert.NoError(store.SetOwners(ctx, "db-password", Owners{Groups: []string{"sre@arryved.com", "other-team@arryved.com"}}))
+	found, err = store.Owners(ctx, "db-password")
+	assert.NoError(err)
+	assert.Equal(transferred, found)
+	assert.ErrorIs(store.SetOwners(ctx, "missing", transferred), ErrNotFound)
+
+	description := "from the vendor portal"
+	updated, err := store.SetRotation(ctx, "db-password", SecretRotationUpdate{Description: &description})
+	assert.NoError(err)
+	assert.Equal(SecretRotation{RotationPeriodDays: 30, Description: description}, updated)
+
+	entries, err := store.List(ctx)
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal("urn:arryved:secret:db-password", entries[0].Urn)
+	assert.Equal("other-team@arryved.com", entries[0].OwnerGroup)
+	assert.Equal(transferred.Groups, entries[0].OwnerGroups)
+	assert.Empty(entries[0].OwnerUser)
+	assert.Equal(updated, entries[0].SecretRotation)
+
+	assert.NoError(store.Delete(ctx, "db-password"))
+	assert.ErrorIs(store.Delete(ctx, "db-password"), ErrNotFound)
+	_, err = store.Read(ctx, "db-password", "latest")
+	assert.ErrorIs(err, ErrNotFound)
+	entries, err = store.List(ctx)
+	assert.NoError(err)
+	assert.Empty(entries)
+}
+
+func TestLocalStoreKeys(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store, _ := localStore(t)
+	assert.NoError(store.Create(ctx, "api-key", []byte("value"), Owners{Groups: []string{"team@arryved.com"}}, SecretRotation{}))
+
+	// another master key can't read it
+	other, _ := localStore(t)
+	other.dir = store.dir
+	_, err := other.Read(ctx, "api-key", "latest")
+	assert.ErrorContains(err, "wrong master key")
+
+	// nor can a sealed value be moved to another secret
+	assert.NoError(store.Create(ctx, "other-key", []byte("other"), Owners{Groups: []string{"team@arryved.com"}}, SecretRotation{}))
+	contents, err := os.ReadFile(filepath.Join(store.dir, "api-key.json"))
+	assert.NoError(err)
+	assert.NoError(os.WriteFile(filepath.Join(store.dir, "other-key.json"), contents, 0600))
+	_, err = store.Read(ctx, "other-key", "latest")
+	assert.Error(err)
+
+	// ids can't escape the directory
+	_, err = store.Read(ctx, "../dev/api-key", "latest")
+	assert.ErrorContains(err, "invalid secret id")
+
+	// bad master keys
+	keyPath := filepath.Join(t.TempDir(), "short.key")
+	assert.NoError(os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString([]byte("too short"))), 0600))
+	_, err = NewLocalStore(t.TempDir(), keyPath)
+	assert.Error(err)
+	_, err = NewLocalStore(t.TempDir(), filepath.Join(t.TempDir(), "missing.key"))
+	assert.Error(err)
+}
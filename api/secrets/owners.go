@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"sort"
+	"strings"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+)
+
+// The principals that own a secret, as plain email addresses. Any owner user, or member of any owner group, may
+// update or delete the secret and read back its versions.
+type Owners struct {
+	Users  []string `json:"users"`
+	Groups []string `json:"groups"`
+}
+
+// o with other's users and groups added
+func (o Owners) Union(other Owners) Owners {
+	return Owners{
+		Users:  append(append([]string{}, o.Users...), other.Users...),
+		Groups: append(append([]string{}, o.Groups...), other.Groups...),
+	}.Normalized()
+}
+
+// o sorted, without blanks or duplicates
+func (o Owners) Normalized() Owners {
+	return Owners{Users: normalizedMembers(o.Users), Groups: normalizedMembers(o.Groups)}
+}
+
+func normalizedMembers(members []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, member := range members {
+		member = strings.TrimSpace(member)
+		if member == "" || seen[member] {
+			continue
+		}
+		seen[member] = true
+		result = append(result, member)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Fill in e's owner fields from owners
+func (e *SecretEntry) SetOwners(owners Owners) {
+	owners = owners.Normalized()
+	e.OwnerUsers = owners.Users
+	e.OwnerGroups = owners.Groups
+	e.OwnerUser = ""
+	if len(owners.Users) > 0 {
+		e.OwnerUser = owners.Users[0]
+	}
+	e.OwnerGroup = ""
+	if len(owners.Groups) > 0 {
+		e.OwnerGroup = owners.Groups[0]
+	}
+}
+
+// every user and group with the accessor role; service accounts are left out so they can't be used to act on secrets
+// through app-control. Other roles are ignored, the idea being to funnel users into the API and hide the
+// implementation specifics.
+func ownersFromPolicy(policy *iampb.Policy) Owners {
+	owners := Owners{}
+	for _, binding := range policy.Bindings {
+		if binding.Role != accessorRole {
+			continue
+		}
+		for _, member := range binding.Members {
+			if strings.HasPrefix(member, "user:") {
+				owners.Users = append(owners.Users, normalizeMember(member))
+			}
+			if strings.HasPrefix(member, "group:") {
+				owners.Groups = append(owners.Groups, normalizeMember(member))
+			}
+		}
+	}
+	return owners.Normalized()
+}
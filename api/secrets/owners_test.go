@@ -0,0 +1,59 @@
+//go:build !integration
+
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/rbac/utility"
+)
+
+type staticGroups map[config.PrincipalUrn][]config.GroupUrn
+
+func (g staticGroups) GroupsOf(ctx context.Context, principal config.PrincipalUrn) ([]config.GroupUrn, error) {
+	return g[principal], nil
+}
+
+func TestOwnersUnion(t *testing.T) {
+	assert := assert.New(t)
+	owners := Owners{Users: []string{"b@arryved.com", "a@arryved.com"}, Groups: []string{"team@arryved.com"}}
+	union := owners.Union(Owners{Users: []string{"a@arryved.com", " "}, Groups: []string{"sre@arryved.com"}})
+	assert.Equal(Owners{
+		Users:  []string{"a@arryved.com", "b@arryved.com"},
+		Groups: []string{"sre@arryved.com", "team@arryved.com"},
+	}, union)
+	// the original is left be
+	assert.Equal([]string{"b@arryved.com", "a@arryved.com"}, owners.Users)
+}
+
+func TestSecretsAuthorizerOwners(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	cfg := config.Load("../config/mock-config.yml")
+	utility.SetGroupResolver(staticGroups{
+		"urn:arryved:user:sre@arryved.com":      {"urn:arryved:group:sre@arryved.com"},
+		"urn:arryved:user:outsider@arryved.com": {"urn:arryved:group:other@arryved.com"},
+	})
+	defer utility.SetGroupResolver(nil)
+	store := NewGCPStore(MockSecretClient{
+		OwnerUser:  "creator@arryved.com",
+		OwnerGroup: "team@arryved.com",
+		MoreOwners: Owners{Users: []string{"second@arryved.com"}, Groups: []string{"sre@arryved.com"}},
+	}, "000000000000", nil)
+	target := "urn:arryved:secret:db-password"
+
+	// any owner user or member of any owner group will do
+	for _, principal := range []config.PrincipalUrn{
+		"urn:arryved:user:creator@arryved.com",
+		"urn:arryved:user:second@arryved.com",
+		"urn:arryved:user:sre@arryved.com",
+	} {
+		assert.NoError(SecretsAuthorizer(ctx, cfg, store, principal, config.SecretsUpdate, target), principal)
+	}
+	assert.Error(SecretsAuthorizer(ctx, cfg, store, "urn:arryved:user:outsider@arryved.com", config.SecretsUpdate, target))
+	assert.NoError(SecretsAuthorizer(ctx, cfg, store, "urn:arryved:user:outsider@arryved.com", config.SecretsList, target))
+}
@@ -0,0 +1,198 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+	smpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Secret Manager annotation keys for the rotation policy; annotations (unlike labels) take free-form values
+const (
+	rotationPeriodAnnotation = "app-control.rotation-period-days"
+	expiresAnnotation        = "app-control.expires-epoch-ns"
+	descriptionAnnotation    = "app-control.description"
+)
+
+// Why a secret is reported as stale
+const (
+	RotationOverdue = "rotationOverdue"
+	Expired         = "expired"
+)
+
+// Owner-provided rotation policy for a secret; zero values mean none
+type SecretRotation struct {
+	RotationPeriodDays int    `json:"rotationPeriodDays,omitempty"` // the value should be replaced this often
+	ExpiresEpochNs     int64  `json:"expiresEpochNs,omitempty"`     // the value stops working (or must not be used) after this
+	Description        string `json:"description,omitempty"`        // what it is and how to rotate it
+}
+
+// Changes to a secret's rotation policy; nil leaves a field as it is, a zero value clears it
+type SecretRotationUpdate struct {
+	RotationPeriodDays *int
+	ExpiresEpochNs     *int64
+	Description        *string
+}
+
+// A secret past its rotation date or expiry
+type StaleSecret struct {
+	SecretEntry
+	LastRotatedEpochNs int64  `json:"lastRotatedEpochNs"`           // created time of the newest enabled version
+	RotationDueEpochNs int64  `json:"rotationDueEpochNs,omitempty"` // only with a rotation period
+	Reason             string `json:"reason"`                       // rotationOverdue or expired
+}
+
+func (s SecretRotation) annotations() map[string]string {
+	annotations := map[string]string{}
+	if s.RotationPeriodDays > 0 {
+		annotations[rotationPeriodAnnotation] = strconv.Itoa(s.RotationPeriodDays)
+	}
+	if s.ExpiresEpochNs > 0 {
+		annotations[expiresAnnotation] = strconv.FormatInt(s.ExpiresEpochNs, 10)
+	}
+	if s.Description != "" {
+		annotations[descriptionAnnotation] = s.Description
+	}
+	return annotations
+}
+
+func rotationFromAnnotations(secretName string, annotations map[string]string) SecretRotation {
+	rotation := SecretRotation{Description: annotations[descriptionAnnotation]}
+	if value, ok := annotations[rotationPeriodAnnotation]; ok {
+		days, err := strconv.Atoi(value)
+		if err != nil {
+			log.Warnf("ignoring invalid rotation period secret=%s value=%s", secretName, value)
+		}
+		rotation.RotationPeriodDays = days
+	}
+	if value, ok := annotations[expiresAnnotation]; ok {
+		expires, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Warnf("ignoring invalid expiry secret=%s value=%s", secretName, value)
+		}
+		rotation.ExpiresEpochNs = expires
+	}
+	return rotation
+}
+
+// Whether the secret has any policy that can make it stale
+func (s SecretRotation) Tracked() bool {
+	return s.RotationPeriodDays > 0 || s.ExpiresEpochNs > 0
+}
+
+// When the value should next be replaced, given when it last was; 0 without a rotation period
+func (s SecretRotation) RotationDue(lastRotatedEpochNs int64) int64 {
+	if s.RotationPeriodDays <= 0 {
+		return 0
+	}
+	return lastRotatedEpochNs + int64(s.RotationPeriodDays)*int64(24*time.Hour)
+}
+
+// ROTATION POLICY UPDATE unit. Applies update to the secret's annotations, leaving any other annotations alone, and
+// returns the resulting policy. Does not authorize. Use the RBAC module in concert with this
+func SecretRotationSet(
+	ctx context.Context, client SecretManagerClient, projectNumber, secretId string, update SecretRotationUpdate) (SecretRotation, error) {
+	secretName := fmt.Sprintf("projects/%s/secrets/%s", projectNumber, secretId)
+	secret, err := client.GetSecret(ctx, &smpb.GetSecretRequest{Name: secretName})
+	if err != nil {
+		return SecretRotation{}, err
+	}
+	rotation := rotationFromAnnotations(secretName, secret.Annotations)
+	if update.RotationPeriodDays != nil {
+		rotation.RotationPeriodDays = *update.RotationPeriodDays
+	}
+	if update.ExpiresEpochNs != nil {
+		rotation.ExpiresEpochNs = *update.ExpiresEpochNs
+	}
+	if update.Description != nil {
+		rotation.Description = *update.Description
+	}
+
+	annotations := map[string]string{}
+	for key, value := range secret.Annotations {
+		if key != rotationPeriodAnnotation && key != expiresAnnotation && key != descriptionAnnotation {
+			annotations[key] = value
+		}
+	}
+	for key, value := range rotation.annotations() {
+		annotations[key] = value
+	}
+	req := &smpb.UpdateSecretRequest{
+		Secret: &smpb.Secret{
+			Name:        secretName,
+			Annotations: annotations,
+			Etag:        secret.Etag,
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"annotations"}},
+	}
+	result, err := client.UpdateSecret(ctx, req)
+	if err != nil {
+		return SecretRotation{}, err
+	}
+	log.Infof("Updated rotation policy secret=%s rotation=%+v", secretName, rotation)
+	return rotationFromAnnotations(secretName, result.Annotations), nil
+}
+
+// Created time of the newest enabled version of a secret, i.e. when its value was last set; 0 if none is enabled
+func SecretLastRotated(ctx context.Context, client SecretManagerClient, projectNumber, secretId string) (int64, error) {
+	secretName := fmt.Sprintf("projects/%s/secrets/%s", projectNumber, secretId)
+	listIter := client.ListSecretVersions(ctx, &smpb.ListSecretVersionsRequest{Parent: secretName})
+	lastRotated := int64(0)
+	for {
+		version, err := listIter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if version.State != smpb.SecretVersion_ENABLED || version.CreateTime == nil {
+			continue
+		}
+		created := version.CreateTime.Seconds*1e9 + int64(version.CreateTime.Nanos)
+		if created > lastRotated {
+			lastRotated = created
+		}
+	}
+	return lastRotated, nil
+}
+
+// STALE unit. Secrets with a rotation policy that are past their rotation date or expiry as of now, in List order.
+// Untracked secrets are skipped without looking at their versions. Does not authorize or authenticate.
+func SecretsStale(ctx context.Context, store Store, now time.Time) ([]StaleSecret, error) {
+	entries, err := store.List(ctx)
+	if err != nil {
+		return []StaleSecret{}, err
+	}
+	result := []StaleSecret{}
+	for _, entry := range entries {
+		if !entry.Tracked() {
+			continue
+		}
+		secretId := secretIdOf(entry.Urn)
+		lastRotated, err := store.LastRotated(ctx, secretId)
+		if err != nil {
+			return []StaleSecret{}, fmt.Errorf("could not get versions of secret=%s err=%w", secretId, err)
+		}
+		stale := StaleSecret{
+			SecretEntry:        entry,
+			LastRotatedEpochNs: lastRotated,
+			RotationDueEpochNs: entry.RotationDue(lastRotated),
+		}
+		// an expired secret is the more urgent problem, so that's the reason given when it's both
+		if entry.ExpiresEpochNs > 0 && now.UnixNano() >= entry.ExpiresEpochNs {
+			stale.Reason = Expired
+		} else if stale.RotationDueEpochNs > 0 && now.UnixNano() >= stale.RotationDueEpochNs {
+			stale.Reason = RotationOverdue
+		} else {
+			continue
+		}
+		result = append(result, stale)
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+//go:build !integration
+
+package secrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	smpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func rotationClient() MockSecretClient {
+	client := versionsClient()
+	created := &timestamppb.Timestamp{Seconds: 1724043000}
+	client.SecretsList = []*smpb.Secret{
+		{Name: "projects/000000000000/secrets/monthly", CreateTime: created,
+			Annotations: map[string]string{rotationPeriodAnnotation: "30", descriptionAnnotation: "rotate in the vendor portal"}},
+		{Name: "projects/000000000000/secrets/yearly", CreateTime: created,
+			Annotations: map[string]string{rotationPeriodAnnotation: "365", "other-tool": "keep"}},
+		{Name: "projects/000000000000/secrets/expiring", CreateTime: created,
+			Annotations: map[string]string{expiresAnnotation: "1725148800000000000"}},
+		{Name: "projects/000000000000/secrets/untracked", CreateTime: created},
+	}
+	return client
+}
+
+func TestSecretListRotation(t *testing.T) {
+	assert := assert.New(t)
+	entries, err := SecretList(context.Background(), rotationClient(), "000000000000")
+	assert.NoError(err)
+	byUrn := map[string]SecretEntry{}
+	for _, entry := range entries {
+		byUrn[entry.Urn] = entry
+	}
+	assert.Equal(SecretRotation{RotationPeriodDays: 30, Description: "rotate in the vendor portal"}, byUrn["urn:arryved:secret:monthly"].SecretRotation)
+	assert.Equal(int64(1725148800000000000), byUrn["urn:arryved:secret:expiring"].ExpiresEpochNs)
+	assert.False(byUrn["urn:arryved:secret:untracked"].Tracked())
+}
+
+func TestSecretLastRotated(t *testing.T) {
+	assert := assert.New(t)
+	// newest enabled version wins; the destroyed one doesn't count
+	lastRotated, err := SecretLastRotated(context.Background(), versionsClient(), "000000000000", "my-secret-id")
+	assert.NoError(err)
+	assert.Equal(int64(1724043037000000000), lastRotated)
+}
+
+func TestSecretsStale(t *testing.T) {
+	assert := assert.New(t)
+	store := NewGCPStore(rotationClient(), "000000000000", nil)
+	now := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	stale, err := SecretsStale(context.Background(), store, now)
+	assert.NoError(err)
+	assert.Len(stale, 2)
+	byUrn := map[string]StaleSecret{}
+	for _, entry := range stale {
+		byUrn[entry.Urn] = entry
+	}
+
+	monthly := byUrn["urn:arryved:secret:monthly"]
+	assert.Equal(RotationOverdue, monthly.Reason)
+	assert.Equal(int64(1724043037000000000), monthly.LastRotatedEpochNs)
+	assert.Equal(int64(1724043037000000000)+int64(30*24*time.Hour), monthly.RotationDueEpochNs)
+
+	expiring := byUrn["urn:arryved:secret:expiring"]
+	assert.Equal(Expired, expiring.Reason)
+	assert.Zero(expiring.RotationDueEpochNs)
+
+	// nothing is stale a day after the last rotation
+	stale, err = SecretsStale(context.Background(), store, time.Unix(1724043037+86400, 0))
+	assert.NoError(err)
+	assert.Empty(stale)
+}
+
+func TestSecretRotationSet(t *testing.T) {
+	assert := assert.New(t)
+	days := 90
+	description := ""
+	rotation, err := SecretRotationSet(context.Background(), rotationClient(), "000000000000", "monthly",
+		SecretRotationUpdate{RotationPeriodDays: &days, Description: &description})
+	assert.NoError(err)
+	assert.Equal(SecretRotation{RotationPeriodDays: 90}, rotation)
+
+	// fields not in the update are kept
+	expires := int64(1725148800000000000)
+	rotation, err = SecretRotationSet(context.Background(), rotationClient(), "000000000000", "yearly",
+		SecretRotationUpdate{ExpiresEpochNs: &expires})
+	assert.NoError(err)
+	assert.Equal(SecretRotation{RotationPeriodDays: 365, ExpiresEpochNs: expires}, rotation)
+
+	_, err = SecretRotationSet(context.Background(), rotationClient(), "000000000000", "missing", SecretRotationUpdate{})
+	assert.ErrorContains(err, "NotFound")
+}
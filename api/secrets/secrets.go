@@ -2,10 +2,7 @@ package secrets
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/sha256"
 	"fmt"
-	"io"
 	"sort"
 	"strings"
 	"sync"
@@ -32,10 +29,17 @@ const listIamConcurrency = 32
 
 // Body format for an app-control-api secret request
 type SecretRequest struct {
-	Id         string `json:"id"`         // a secret name matching `^[a-zA-Z0-9-_]+$`; 255 byte max length
-	OwnerGroup string `json:"ownerGroup"` // just the plain email address
-	OwnerUser  string `json:"ownerUser"`  // just the plain email address
-	Value      string `json:"value"`      // expects b64-encoded bytes in a json string; decoded size limit is 64k bytes
+	Id          string   `json:"id"`                    // a secret name matching `^[a-zA-Z0-9-_]+$`; 255 byte max length
+	OwnerGroup  string   `json:"ownerGroup"`            // just the plain email address
+	OwnerUser   string   `json:"ownerUser"`             // just the plain email address
+	OwnerGroups []string `json:"ownerGroups,omitempty"` // more owner groups, in addition to ownerGroup
+	OwnerUsers  []string `json:"ownerUsers,omitempty"`  // more owner users, in addition to ownerUser
+	Value       string   `json:"value"`                 // expects b64-encoded bytes in a json string; decoded size limit is 64k bytes
+
+	// optional rotation policy; on update, only the fields present are changed
+	RotationPeriodDays *int    `json:"rotationPeriodDays,omitempty"`
+	ExpiresEpochNs     *int64  `json:"expiresEpochNs,omitempty"`
+	Description        *string `json:"description,omitempty"`
 }
 
 // Abstraction for an app-control-api secret. Hides implementation details. Think before allowing them to leak in.
@@ -43,9 +47,12 @@ type SecretEntry struct {
 	Urn string `json:"urn"`
 	// I don't think this code will be here in 290 years so int64 is probably fine
 	// as of 2024 the delivered precision from GCP is ms, this just honoring their aspirational precision format (ns, int64 + int32)
-	CreatedEpochNs int64  `json:"createdEpochNs"`
-	OwnerGroup     string `json:"ownerGroup"`
-	OwnerUser      string `json:"ownerUser"`
+	CreatedEpochNs int64    `json:"createdEpochNs"`
+	OwnerGroup     string   `json:"ownerGroup"` // the first of OwnerGroups, for clients that only know of one
+	OwnerUser      string   `json:"ownerUser"`  // the first of OwnerUsers, likewise
+	OwnerGroups    []string `json:"ownerGroups"`
+	OwnerUsers     []string `json:"ownerUsers"`
+	SecretRotation
 }
 
 // Generalized interface for the SecretManager methods we use in the API; allows client mocking
@@ -54,9 +61,12 @@ type SecretManagerClient interface {
 	AddSecretVersion(context.Context, *smpb.AddSecretVersionRequest, ...gax.CallOption) (*smpb.SecretVersion, error)
 	CreateSecret(context.Context, *smpb.CreateSecretRequest, ...gax.CallOption) (*smpb.Secret, error)
 	DeleteSecret(context.Context, *smpb.DeleteSecretRequest, ...gax.CallOption) error
+	GetSecret(context.Context, *smpb.GetSecretRequest, ...gax.CallOption) (*smpb.Secret, error)
 	GetIamPolicy(context.Context, *iampb.GetIamPolicyRequest, ...gax.CallOption) (*iampb.Policy, error)
 	IAM(string) *iam.Handle
 	ListSecrets(context.Context, *smpb.ListSecretsRequest, ...gax.CallOption) *secretmanager.SecretIterator
+	ListSecretVersions(context.Context, *smpb.ListSecretVersionsRequest, ...gax.CallOption) *secretmanager.SecretVersionIterator
+	UpdateSecret(context.Context, *smpb.UpdateSecretRequest, ...gax.CallOption) (*smpb.Secret, error)
 }
 
 // Generalized interface for the IAM methods we use in the API; allows client mocking
@@ -67,13 +77,16 @@ type IamHandle interface {
 	V3() *iam.Handle3
 }
 
-// CREATE unit. Does not do auth by itself; use the RBAC module in concert
-func SecretCreate(ctx context.Context, client SecretManagerClient, projectNumber, secretId string, valueBytes []byte) error {
+// CREATE unit. The rotation policy is kept in the secret's annotations. Does not do auth by itself; use the RBAC
+// module in concert
+func SecretCreate(
+	ctx context.Context, client SecretManagerClient, projectNumber, secretId string, valueBytes []byte, rotation SecretRotation) error {
 	// add a secret
 	req := &smpb.CreateSecretRequest{
 		Parent:   fmt.Sprintf("projects/%s", projectNumber),
 		SecretId: secretId,
 		Secret: &smpb.Secret{
+			Annotations: rotation.annotations(),
 			Replication: &smpb.Replication{
 				Replication: &smpb.Replication_Automatic_{
 					Automatic: &smpb.Replication_Automatic{},
@@ -88,7 +101,7 @@ func SecretCreate(ctx context.Context, client SecretManagerClient, projectNumber
 	log.Infof("Created secret project=%s secretId=%s result=%v", projectNumber, secretId, result)
 
 	// add a version
-	err = addSecretVersion(ctx, client, result.Name, valueBytes)
+	_, err = addSecretVersion(ctx, client, result.Name, valueBytes)
 	if err != nil {
 		return err
 	}
@@ -96,7 +109,8 @@ func SecretCreate(ctx context.Context, client SecretManagerClient, projectNumber
 	return nil
 }
 
-func addSecretVersion(ctx context.Context, client SecretManagerClient, secretName string, valueBytes []byte) error {
+// returns the new version's name
+func addSecretVersion(ctx context.Context, client SecretManagerClient, secretName string, valueBytes []byte) (string, error) {
 	addSecretVersionReq := &smpb.AddSecretVersionRequest{
 		Parent: secretName,
 		Payload: &smpb.SecretPayload{
@@ -105,10 +119,10 @@ func addSecretVersion(ctx context.Context, client SecretManagerClient, secretNam
 	}
 	version, err := client.AddSecretVersion(ctx, addSecretVersionReq)
 	if err != nil {
-		return err
+		return "", err
 	}
 	log.Infof("Added secret version secretName=%s versionName=%s", secretName, version.Name)
-	return nil
+	return version.Name, nil
 }
 
 // Set Secret IAM unit. Does not authorize; this grants permissions. Use the RBAC module in concert with this
@@ -116,13 +130,16 @@ func addSecretVersion(ctx context.Context, client SecretManagerClient, secretNam
 // bind IAM permissions to the secret:
 // - secret accessor for default compute account
 // - secret accessor for workload identity account(s)
-// - secret accessor for the creator principal
-// - secret accessor for a supplied owner group principal
+// - secret accessor for each owner user (the creator, at first)
+// - secret accessor for each owner group
 // ...Create/Update/Delete will be allowed through the tool for any of these principals
 //
 //	this will let people see secrets in GCP console but they'll have to use app-control to C/U/D
+//
+// The owners are set exactly: users and groups bound before that aren't in owners lose access. Service accounts are
+// only ever added.
 func SecretIamSet(
-	ctx context.Context, client SecretManagerClient, secretName string, ownerUser, ownerGroup string, serviceAccounts []string) error {
+	ctx context.Context, client SecretManagerClient, secretName string, owners Owners, serviceAccounts []string) error {
 	handle := client.IAM(secretName)
 	log.Debugf("handle=%v", handle)
 	policy, err := handle.Policy(ctx)
@@ -138,13 +155,21 @@ func SecretIamSet(
 		policy.Add(member, role)
 	}
 
-	// Grant the owner user permission
-	memberUser := fmt.Sprintf("user:%s", ownerUser)
-	policy.Add(memberUser, role)
+	// Revoke former owners; copied since Remove edits the binding's members in place
+	for _, member := range append([]string{}, policy.Members(role)...) {
+		if strings.HasPrefix(member, "user:") || strings.HasPrefix(member, "group:") {
+			policy.Remove(member, role)
+		}
+	}
 
-	// Grant the owner group permissions
-	groupMember := fmt.Sprintf("group:%s", ownerGroup)
-	policy.Add(groupMember, role)
+	// Grant the owner users and groups permission
+	owners = owners.Normalized()
+	for _, ownerUser := range owners.Users {
+		policy.Add(fmt.Sprintf("user:%s", ownerUser), role)
+	}
+	for _, ownerGroup := range owners.Groups {
+		policy.Add(fmt.Sprintf("group:%s", ownerGroup), role)
+	}
 
 	err = handle.SetPolicy(ctx, policy)
 	if err != nil {
@@ -157,61 +182,21 @@ func SecretIamSet(
 // READ unit. Does not authorize; this grants permissions. Use the RBAC module in concert with this
 func SecretRead(
 	ctx context.Context, client SecretManagerClient, projectNumber, secretId string) ([]byte, error) {
-	accessRequest := &smpb.AccessSecretVersionRequest{
-		Name: fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectNumber, secretId),
-	}
-	result, err := client.AccessSecretVersion(ctx, accessRequest)
-	if err != nil {
-		return []byte{}, err
-	}
-	valueBytes := result.Payload.Data
-
-	// GCP uses crc32c in their console UI but you can see the secret there anyway... safer to use salt w/ sha256 when logging
-	salt := make([]byte, 16)
-	_, err = io.ReadFull(rand.Reader, salt)
-	if err != nil {
-		return []byte{}, err
-	}
-	saltedValue := append(salt, valueBytes...)
-	hash := sha256.Sum256(saltedValue)
-	log.Infof("result type=%T name=%s, salt=%x, sha256=%x", result, result.Name, salt, hash)
-
-	return valueBytes, nil
+	return SecretReadVersion(ctx, client, projectNumber, secretId, "latest")
 }
 
-// Secret IAM get unit. Retrieves IAM bindings for a secret. To be used in concert with RBAC module for authorization.
+// Secret IAM get unit. Retrieves the owners from the IAM bindings for a secret. To be used in concert with RBAC module
+// for authorization.
 func SecretIamGet(
-	ctx context.Context, client SecretManagerClient, secretName string) (map[string]string, error) {
+	ctx context.Context, client SecretManagerClient, secretName string) (Owners, error) {
 	req := &iampb.GetIamPolicyRequest{
 		Resource: secretName,
 	}
 	policy, err := client.GetIamPolicy(ctx, req)
 	if err != nil {
-		return map[string]string{}, err
-	}
-
-	members := map[string]string{
-		"ownerUser":  "",
-		"ownerGroup": "",
-	}
-	for _, binding := range policy.Bindings {
-		// app-control keys off of accessor role as a hint... ignores other roles, the ideas is to funnel users into the API
-		// and hide the implementation specifics
-		if binding.Role == accessorRole {
-			for _, member := range binding.Members {
-				// exclude service accounts from the list to prevent abuse
-				// note: if multiple users, last one wins. by convention (initially) only one user accessor binding per secret
-				if strings.HasPrefix(member, "user") {
-					members["ownerUser"] = normalizeMember(member)
-				}
-				// note: if multiple groups, last one wins. by convention (initially) only one group accessor binding per secret
-				if strings.HasPrefix(member, "group") {
-					members["ownerGroup"] = normalizeMember(member)
-				}
-			}
-		}
+		return Owners{}, err
 	}
-	return members, nil
+	return ownersFromPolicy(policy), nil
 }
 
 // UPDATE unit. Does not authorize. Use the RBAC module in concert with this
@@ -221,7 +206,7 @@ func SecretUpdate(ctx context.Context, client SecretManagerClient, projectNumber
 	log.Infof("Attempting to update secret=%s", secretName)
 
 	// add a version
-	err := addSecretVersion(ctx, client, secretName, valueBytes)
+	_, err := addSecretVersion(ctx, client, secretName, valueBytes)
 	if err != nil {
 		return err
 	}
@@ -294,71 +279,72 @@ func SecretList(ctx context.Context, client SecretManagerClient, projectNumber s
 
 func convertGcpSecretToSecretEntry(ctx context.Context, client SecretManagerClient, secret *smpb.Secret) SecretEntry {
 	log.Infof("**** secret=%s", secret.Name)
-	ownerUser := ""
-	ownerGroup := ""
+	owners := Owners{}
 	policy, err := client.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: secret.Name})
 	if err != nil {
 		log.Warnf("could not get policy for secret=%s, ownership not determined", secret.Name)
 	} else {
-		// only supporting one each by convention, last found of each wins
-		for _, binding := range policy.Bindings {
-			if binding.Role == accessorRole {
-				// log.Infof("secret=%v binding role=%v members=%v", secret.Name, binding.Role, binding.Members)
-				for _, member := range binding.Members {
-					if strings.HasPrefix(member, "user") {
-						ownerUser = normalizeMember(member)
-					}
-					if strings.HasPrefix(member, "group") {
-						ownerGroup = normalizeMember(member)
-					}
-				}
-			}
-		}
+		owners = ownersFromPolicy(policy)
 	}
 	nameParts := strings.Split(secret.Name, "/")
 	urn := fmt.Sprintf("urn:arryved:secret:%s", nameParts[len(nameParts)-1])
 	result := SecretEntry{
 		Urn:            urn,
-		OwnerGroup:     ownerGroup,
-		OwnerUser:      ownerUser,
 		CreatedEpochNs: secret.CreateTime.Seconds*1e9 + int64(secret.CreateTime.Nanos),
+		SecretRotation: rotationFromAnnotations(secret.Name, secret.Annotations),
 	}
-	if ownerUser == "" {
+	result.SetOwners(owners)
+	if result.OwnerUser == "" {
 		log.Warnf("secret %s has no user owner", result.Urn)
 	}
-	if ownerGroup == "" {
+	if result.OwnerGroup == "" {
 		log.Warnf("secret %s has no group owner", result.Urn)
 	}
 	return result
 }
 
+// Whether action on a secret is limited to its ownerUser and members of its ownerGroup
+func OwnerOnly(action config.Permission) bool {
+	return action == config.SecretsUpdate || action == config.SecretsDelete || action == config.SecretsVersions ||
+		action == config.SecretsCopy
+}
+
+// The owners of a secret target (urn:arryved:secret:<id>), as SecretsAuthorizer checks them; client is the env's Store
+func SecretOwners(ctx context.Context, client interface{}, target string) (Owners, error) {
+	store, ok := client.(Store)
+	if !ok {
+		return Owners{}, fmt.Errorf("no secret store for target=%s", target)
+	}
+	return store.Owners(ctx, secretIdOf(target))
+}
+
 func SecretsAuthorizer(
 	ctx context.Context, cfg *config.Config, client interface{},
 	principal config.PrincipalUrn, action config.Permission, target string) error {
 	// get the iam details
-	projectNumber := ctx.Value("projectNumber").(string)
-	mutation := action == config.SecretsUpdate || action == config.SecretsDelete
-
-	if mutation {
-		// UPDATE | DELETE - allowed only for ownerUser or a member of ownerGroup
-		secretName := fmt.Sprintf("projects/%s/secrets/%s", projectNumber, strings.Split(target, ":")[3])
-		principalMap, err := SecretIamGet(ctx, client.(SecretManagerClient), secretName)
+	if OwnerOnly(action) {
+		// UPDATE | DELETE | VERSIONS | COPY - allowed only for an owner user or a member of an owner group
+		owners, err := SecretOwners(ctx, client, target)
 		if err != nil {
 			return err
 		}
-		ownerGroup := principalMap["ownerGroup"]
-		ownerUser := principalMap["ownerUser"]
-		userUrn := config.PrincipalUrn(fmt.Sprintf("urn:arryved:user:%s", ownerUser))
-		groupUrn := config.GroupUrn(fmt.Sprintf("urn:arryved:group:%s", ownerGroup))
 		log.Infof("authorizing principal=%s action=%s target=%s", principal, action, target)
-		log.Infof("iam for secret=%s found ownerGroup=%s ownerUser=%s", secretName, ownerGroup, ownerUser)
-		// if the principal is the owner user or the principal is the owner group, then authorize
-		if userUrn == principal || utility.PrincipalInGroup(cfg, principal, groupUrn) {
-			log.Infof("authorized principal=%s action=%s target=%s", principal, action, target)
-			return nil
-		} else {
-			return fmt.Errorf("principal=%s does not own target=%s", principal, target)
+		log.Infof("iam for secret=%s found ownerGroups=%v ownerUsers=%v", target, owners.Groups, owners.Users)
+		// if the principal is an owner user or in an owner group, then authorize
+		for _, ownerUser := range owners.Users {
+			if config.PrincipalUrn(fmt.Sprintf("urn:arryved:user:%s", ownerUser)) == principal {
+				log.Infof("authorized principal=%s action=%s target=%s", principal, action, target)
+				return nil
+			}
+		}
+		for _, ownerGroup := range owners.Groups {
+			groupUrn := config.GroupUrn(fmt.Sprintf("urn:arryved:group:%s", ownerGroup))
+			if utility.PrincipalInGroup(ctx, cfg, principal, groupUrn) {
+				log.Infof("authorized principal=%s action=%s target=%s via group=%s", principal, action, target, groupUrn)
+				return nil
+			}
 		}
+		return fmt.Errorf("principal=%s does not own target=%s", principal, target)
 	} else {
 		// CREATE | LIST - anyone can do these (assuming they are authenticated)
 		return nil
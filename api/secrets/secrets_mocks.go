@@ -18,11 +18,18 @@ import (
 )
 
 type MockSecretClient struct {
-	Name        string
-	Value       []byte
-	OwnerUser   string
-	OwnerGroup  string
+	Name       string
+	Value      []byte
+	OwnerUser  string
+	OwnerGroup string
+	// more owners, bound along with OwnerUser and OwnerGroup
+	MoreOwners  Owners
 	SecretsList []*smpb.Secret
+	Versions    []*smpb.SecretVersion
+	// values by version name, for AccessSecretVersion; anything else gets Value
+	VersionValues map[string][]byte
+	// when set, the bindings of the last policy set through the IAM handle are recorded here
+	SetPolicy *iampb.Policy
 }
 
 func (m MockSecretClient) CreateSecret(
@@ -57,6 +64,9 @@ func (m MockSecretClient) DeleteSecret(
 
 func (m MockSecretClient) AccessSecretVersion(
 	ctx context.Context, req *smpb.AccessSecretVersionRequest, options ...gax.CallOption) (*smpb.AccessSecretVersionResponse, error) {
+	if value, ok := m.VersionValues[req.Name]; ok {
+		return &smpb.AccessSecretVersionResponse{Name: req.Name, Payload: &smpb.SecretPayload{Data: value}}, nil
+	}
 	mockResult := &smpb.AccessSecretVersionResponse{
 		Name: fmt.Sprintf("%s/versions/1", m.Name),
 		Payload: &smpb.SecretPayload{
@@ -72,28 +82,58 @@ func (m MockSecretClient) AddSecretVersion(
 	if hex20Matcher.MatchString(m.Name) {
 		return nil, fmt.Errorf("the secret doesn't exist")
 	}
-	mockResult := &smpb.SecretVersion{}
+	mockResult := &smpb.SecretVersion{
+		Name: fmt.Sprintf("%s/versions/%d", req.Parent, len(m.Versions)+1),
+	}
 	return mockResult, nil
 }
 
+// a secret from SecretsList by name
+func (m MockSecretClient) GetSecret(
+	ctx context.Context, req *smpb.GetSecretRequest, options ...gax.CallOption) (*smpb.Secret, error) {
+	for _, secret := range m.SecretsList {
+		if secret.Name == req.Name {
+			return secret, nil
+		}
+	}
+	return nil, fmt.Errorf("[mock response] rpc error: code = NotFound desc = secret name=%s not found", req.Name)
+}
+
+// echoes the update back, as if it had been applied
+func (m MockSecretClient) UpdateSecret(
+	ctx context.Context, req *smpb.UpdateSecretRequest, options ...gax.CallOption) (*smpb.Secret, error) {
+	if _, err := m.GetSecret(ctx, &smpb.GetSecretRequest{Name: req.Secret.Name}); err != nil {
+		return nil, err
+	}
+	return req.Secret, nil
+}
+
 func (m MockSecretClient) IAM(name string) *iam.Handle {
 	return iam.InternalNewHandleClient(m, name)
 }
 
+// same policy as GetIamPolicy
 func (m MockSecretClient) Get(ctx context.Context, name string) (*iampb.Policy, error) {
-	return nil, nil
+	return m.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: name})
 }
 
 func (m MockSecretClient) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest, options ...gax.CallOption) (*iampb.Policy, error) {
+	members := []string{
+		fmt.Sprintf("user:%s", m.OwnerUser),
+		fmt.Sprintf("group:%s", m.OwnerGroup),
+		fmt.Sprintf("serviceAccount:000000000000-compute@developer.gserviceaccount.com"),
+	}
+	for _, user := range m.MoreOwners.Users {
+		members = append(members, fmt.Sprintf("user:%s", user))
+	}
+	for _, group := range m.MoreOwners.Groups {
+		members = append(members, fmt.Sprintf("group:%s", group))
+	}
 	mockResult := &iampb.Policy{
 		Bindings: []*iampb.Binding{
 			&iampb.Binding{
-				Members: []string{
-					fmt.Sprintf("user:%s", m.OwnerUser),
-					fmt.Sprintf("group:%s", m.OwnerGroup),
-					fmt.Sprintf("serviceAccount:000000000000-compute@developer.gserviceaccount.com"),
-				},
-				Role: accessorRole,
+				Members: members,
+				Role:    accessorRole,
 			},
 		},
 	}
@@ -143,9 +183,40 @@ func (m MockSecretClient) ListSecrets(ctx context.Context, req *smpb.ListSecrets
 }
 
 func (m MockSecretClient) Set(ctx context.Context, name string, policy *iampb.Policy) error {
+	if m.SetPolicy != nil {
+		m.SetPolicy.Bindings = policy.Bindings
+	}
 	return nil
 }
 
 func (m MockSecretClient) Test(ctx context.Context, value string, values []string) ([]string, error) {
 	return []string{}, nil
 }
+
+func (m MockSecretClient) ListSecretVersions(ctx context.Context, req *smpb.ListSecretVersionsRequest, options ...gax.CallOption) *secretmanager.SecretVersionIterator {
+	versions := m.Versions
+	it := &secretmanager.SecretVersionIterator{
+		InternalFetch: func(pageSize int, pageToken string) ([]*smpb.SecretVersion, string, error) {
+			return versions, "", nil
+		},
+	}
+	// same reflection monkeypatch as ListSecrets, for SecretVersionIterator.nextFunc
+	index := 0
+	nextPatch := func() error {
+		if index < len(versions) {
+			val := reflect.ValueOf(it).Elem()
+			itemsField := val.FieldByName("items")
+			itemsField = reflect.NewAt(itemsField.Type(), unsafe.Pointer(itemsField.UnsafeAddr())).Elem()
+			itemsField.Set(reflect.ValueOf(versions[index : index+1]))
+			index++
+			return nil
+		}
+		return iterator.Done
+	}
+	val := reflect.ValueOf(it).Elem()
+	field := val.FieldByName("nextFunc")
+	field = reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+	field.Set(reflect.ValueOf(nextPatch))
+
+	return it
+}
@@ -12,6 +12,7 @@ import (
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/stretchr/testify/assert"
 	smpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
 	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -36,7 +37,7 @@ func TestSecretCreateOK(t *testing.T) {
 	// client, err := secretmanager.NewClient(ctx)
 	client := MockSecretClient{Name: secretId}
 
-	err := SecretCreate(ctx, client, projectNumber, secretId, valueBytes)
+	err := SecretCreate(ctx, client, projectNumber, secretId, valueBytes, SecretRotation{})
 
 	assert.NoError(err)
 }
@@ -51,7 +52,7 @@ func TestSecretCreateExists(t *testing.T) {
 	// client, err := secretmanager.NewClient(ctx)
 	client := MockSecretClient{Name: secretId}
 
-	err := SecretCreate(ctx, client, projectNumber, secretId, valueBytes)
+	err := SecretCreate(ctx, client, projectNumber, secretId, valueBytes, SecretRotation{})
 
 	assert.Error(err)
 }
@@ -70,11 +71,22 @@ func TestSecretIamSet(t *testing.T) {
 	ctx := context.Background()
 	// keep this commented out normally; to develop other cases, uncomment this real client, then mock the interaction when done
 	// client, err := secretmanager.NewClient(ctx)
-	client := MockSecretClient{Name: secretId}
+	// the mock's existing bindings are for a former owner
+	setPolicy := &iampb.Policy{}
+	client := MockSecretClient{Name: secretId, OwnerUser: "former@arryved.com", OwnerGroup: "former-team@arryved.com", SetPolicy: setPolicy}
 
-	err := SecretIamSet(ctx, client, secretName, ownerUser, ownerGroup, serviceAccounts)
+	owners := Owners{Users: []string{ownerUser}, Groups: []string{ownerGroup, "sre@arryved.com"}}
+	err := SecretIamSet(ctx, client, secretName, owners, serviceAccounts)
 
 	assert.NoError(err)
+	assert.Len(setPolicy.Bindings, 1)
+	assert.ElementsMatch([]string{
+		"serviceAccount:000000000000-compute@developer.gserviceaccount.com",
+		"serviceAccount:gke-workload-abcd@my-project.iam.gserviceaccount.com",
+		"user:wwest@arryved.com",
+		"group:todo@example.com",
+		"group:sre@arryved.com",
+	}, setPolicy.Bindings[0].Members)
 }
 
 func TestSecretRead(t *testing.T) {
@@ -101,10 +113,12 @@ func TestSecretIamGet(t *testing.T) {
 	ctx := context.Background()
 	// keep this commented out normally; to develop other cases, uncomment this real client, then mock the interaction when done
 	// client, err := secretmanager.NewClient(ctx)
-	client := MockSecretClient{Name: secretName, OwnerUser: ownerUser, OwnerGroup: ownerGroup}
-	expected := map[string]string{
-		"ownerUser":  ownerUser,
-		"ownerGroup": ownerGroup,
+	client := MockSecretClient{Name: secretName, OwnerUser: ownerUser, OwnerGroup: ownerGroup,
+		MoreOwners: Owners{Users: []string{"other@arryved.com"}, Groups: []string{"sre@arryved.com"}}}
+	// every owner, not just the last of each kind; service accounts aren't owners
+	expected := Owners{
+		Users:  []string{"other@arryved.com", ownerUser},
+		Groups: []string{"sre@arryved.com", ownerGroup},
 	}
 	principals, err := SecretIamGet(ctx, client, secretName)
 	assert.NoError(err)
@@ -213,11 +227,15 @@ func TestSecretList(t *testing.T) {
 		CreatedEpochNs: int64(1724043037009875000),
 		OwnerGroup:     "some-group@arryved.com",
 		OwnerUser:      "some-user@arryved.com",
+		OwnerGroups:    []string{"some-group@arryved.com"},
+		OwnerUsers:     []string{"some-user@arryved.com"},
 	}, list[0])
 	assert.Equal(SecretEntry{
 		Urn:            "urn:arryved:secret:secret2",
 		CreatedEpochNs: int64(1724043036001235000),
 		OwnerGroup:     "some-group@arryved.com",
 		OwnerUser:      "some-user@arryved.com",
+		OwnerGroups:    []string{"some-group@arryved.com"},
+		OwnerUsers:     []string{"some-user@arryved.com"},
 	}, list[1])
 }
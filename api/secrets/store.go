@@ -0,0 +1,149 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/config"
+	"github.com/arryved/app-ctrl/api/gce"
+)
+
+// Backend-neutral secret storage for one env. Secrets are addressed by id (the last field of their URN). Nothing
+// here authorizes; use the RBAC module in concert with it.
+type Store interface {
+	// new secret holding value as version 1, owned by owners
+	Create(ctx context.Context, secretId string, value []byte, owners Owners, rotation SecretRotation) error
+	// value of a version ("latest" or a number)
+	Read(ctx context.Context, secretId, version string) ([]byte, error)
+	// add value as the new latest version
+	Update(ctx context.Context, secretId string, value []byte) error
+	Delete(ctx context.Context, secretId string) error
+	// every secret, newest first
+	List(ctx context.Context) ([]SecretEntry, error)
+	Owners(ctx context.Context, secretId string) (Owners, error)
+	// replace the owners with exactly these
+	SetOwners(ctx context.Context, secretId string, owners Owners) error
+
+	Versions(ctx context.Context, secretId string) (*SecretVersionList, error)
+	Rollback(ctx context.Context, secretId string, version int64) (int64, error)
+	SetRotation(ctx context.Context, secretId string, update SecretRotationUpdate) (SecretRotation, error)
+	// created time of the newest enabled version
+	LastRotated(ctx context.Context, secretId string) (int64, error)
+
+	Close() error
+}
+
+// Store errors. The text matches the status codes Secret Manager reports, so callers can check for either the same way.
+var (
+	ErrNotFound           = errors.New("code = NotFound")
+	ErrAlreadyExists      = errors.New("code = AlreadyExists")
+	ErrFailedPrecondition = errors.New("code = FailedPrecondition")
+)
+
+// The store for env, per cfg.Secrets.Backend
+func NewEnvStore(ctx context.Context, cfg *config.Config, env string) (Store, error) {
+	switch cfg.Secrets.Backend {
+	case "gcp":
+		projectNumber, err := gce.GetProjectNumber(gce.ProjectMap[env])
+		if err != nil {
+			return nil, fmt.Errorf("could not get a project number env=%s err=%w", env, err)
+		}
+		client, err := secretmanager.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not get a secret client err=%w", err)
+		}
+		return NewGCPStore(client, projectNumber, cfg.SecretsServiceAccounts), nil
+	case "local":
+		return NewLocalStore(filepath.Join(cfg.Secrets.Path, env), cfg.Secrets.MasterKeyPath)
+	default:
+		return nil, fmt.Errorf("unknown secrets backend=%s", cfg.Secrets.Backend)
+	}
+}
+
+// Store backed by GCP Secret Manager in one project. Ownership is kept as accessor IAM bindings and rotation
+// policy as annotations.
+type GCPStore struct {
+	client          SecretManagerClient
+	projectNumber   string
+	serviceAccounts []string // also granted access to every secret created
+}
+
+func NewGCPStore(client SecretManagerClient, projectNumber string, serviceAccounts []string) *GCPStore {
+	return &GCPStore{
+		client:          client,
+		projectNumber:   projectNumber,
+		serviceAccounts: serviceAccounts,
+	}
+}
+
+func (s *GCPStore) Create(
+	ctx context.Context, secretId string, value []byte, owners Owners, rotation SecretRotation) error {
+	if err := SecretCreate(ctx, s.client, s.projectNumber, secretId, value, rotation); err != nil {
+		return err
+	}
+	// secret was created, so set the resource permissions
+	secretName := fmt.Sprintf("projects/%s/secrets/%s", s.projectNumber, secretId)
+	if err := SecretIamSet(ctx, s.client, secretName, owners, s.serviceAccounts); err != nil {
+		log.Warnf("error setting permissions on secret err=%s", err.Error())
+	}
+	return nil
+}
+
+func (s *GCPStore) Read(ctx context.Context, secretId, version string) ([]byte, error) {
+	return SecretReadVersion(ctx, s.client, s.projectNumber, secretId, version)
+}
+
+func (s *GCPStore) Update(ctx context.Context, secretId string, value []byte) error {
+	return SecretUpdate(ctx, s.client, s.projectNumber, secretId, value)
+}
+
+func (s *GCPStore) Delete(ctx context.Context, secretId string) error {
+	return SecretDelete(ctx, s.client, s.projectNumber, secretId)
+}
+
+func (s *GCPStore) List(ctx context.Context) ([]SecretEntry, error) {
+	return SecretList(ctx, s.client, s.projectNumber)
+}
+
+func (s *GCPStore) Owners(ctx context.Context, secretId string) (Owners, error) {
+	return SecretIamGet(ctx, s.client, fmt.Sprintf("projects/%s/secrets/%s", s.projectNumber, secretId))
+}
+
+func (s *GCPStore) SetOwners(ctx context.Context, secretId string, owners Owners) error {
+	return SecretIamSet(ctx, s.client, fmt.Sprintf("projects/%s/secrets/%s", s.projectNumber, secretId), owners, s.serviceAccounts)
+}
+
+func (s *GCPStore) Versions(ctx context.Context, secretId string) (*SecretVersionList, error) {
+	return SecretVersions(ctx, s.client, s.projectNumber, secretId)
+}
+
+func (s *GCPStore) Rollback(ctx context.Context, secretId string, version int64) (int64, error) {
+	return SecretRollback(ctx, s.client, s.projectNumber, secretId, version)
+}
+
+func (s *GCPStore) SetRotation(ctx context.Context, secretId string, update SecretRotationUpdate) (SecretRotation, error) {
+	return SecretRotationSet(ctx, s.client, s.projectNumber, secretId, update)
+}
+
+func (s *GCPStore) LastRotated(ctx context.Context, secretId string) (int64, error) {
+	return SecretLastRotated(ctx, s.client, s.projectNumber, secretId)
+}
+
+func (s *GCPStore) Close() error {
+	if closer, ok := s.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// the id of a secret target, urn:arryved:secret:<id>
+func secretIdOf(target string) string {
+	return strings.TrimPrefix(target, "urn:arryved:secret:")
+}
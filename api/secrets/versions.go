@@ -0,0 +1,137 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+	smpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// One version of a secret, without its value
+type SecretVersionEntry struct {
+	Version        int64  `json:"version"`
+	CreatedEpochNs int64  `json:"createdEpochNs"`
+	State          string `json:"state"`                 // ENABLED, DISABLED or DESTROYED
+	Fingerprint    string `json:"fingerprint,omitempty"` // sha256 of salt+value, hex; only for ENABLED versions
+}
+
+// A secret's versions, newest first. Fingerprints use a fresh salt per listing, so they can be compared with each
+// other (which versions hold the same value?) or against a known value, but not across listings.
+type SecretVersionList struct {
+	Salt     string               `json:"salt"` // hex
+	Versions []SecretVersionEntry `json:"versions"`
+}
+
+// LIST VERSIONS unit. Does not authorize. Use the RBAC module in concert with this
+func SecretVersions(ctx context.Context, client SecretManagerClient, projectNumber, secretId string) (*SecretVersionList, error) {
+	secretName := fmt.Sprintf("projects/%s/secrets/%s", projectNumber, secretId)
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	result := &SecretVersionList{
+		Salt:     hex.EncodeToString(salt),
+		Versions: []SecretVersionEntry{},
+	}
+
+	listIter := client.ListSecretVersions(ctx, &smpb.ListSecretVersionsRequest{Parent: secretName})
+	for {
+		version, err := listIter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		number, err := versionNumber(version.Name)
+		if err != nil {
+			return nil, err
+		}
+		entry := SecretVersionEntry{
+			Version: number,
+			State:   version.State.String(),
+		}
+		if version.CreateTime != nil {
+			entry.CreatedEpochNs = version.CreateTime.Seconds*1e9 + int64(version.CreateTime.Nanos)
+		}
+		if version.State == smpb.SecretVersion_ENABLED {
+			accessResult, err := client.AccessSecretVersion(ctx, &smpb.AccessSecretVersionRequest{Name: version.Name})
+			if err != nil {
+				return nil, err
+			}
+			entry.Fingerprint = fingerprint(salt, accessResult.Payload.Data)
+		}
+		result.Versions = append(result.Versions, entry)
+	}
+	sort.Slice(result.Versions, func(i, j int) bool {
+		return result.Versions[i].Version > result.Versions[j].Version
+	})
+	return result, nil
+}
+
+// READ unit for a specific version ("latest" or a number). Does not authorize. Use the RBAC module in concert with this
+func SecretReadVersion(
+	ctx context.Context, client SecretManagerClient, projectNumber, secretId, version string) ([]byte, error) {
+	if version != "latest" {
+		if _, err := strconv.ParseInt(version, 10, 64); err != nil {
+			return []byte{}, fmt.Errorf("invalid version=%s", version)
+		}
+	}
+	accessRequest := &smpb.AccessSecretVersionRequest{
+		Name: fmt.Sprintf("projects/%s/secrets/%s/versions/%s", projectNumber, secretId, version),
+	}
+	result, err := client.AccessSecretVersion(ctx, accessRequest)
+	if err != nil {
+		return []byte{}, err
+	}
+	valueBytes := result.Payload.Data
+
+	// GCP uses crc32c in their console UI but you can see the secret there anyway... safer to use salt w/ sha256 when logging
+	salt := make([]byte, 16)
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return []byte{}, err
+	}
+	log.Infof("result type=%T name=%s, salt=%x, sha256=%s", result, result.Name, salt, fingerprint(salt, valueBytes))
+
+	return valueBytes, nil
+}
+
+// ROLLBACK unit. Re-adds an old version's value as the newest version and returns the new version number; the old
+// version itself is untouched. Does not authorize. Use the RBAC module in concert with this
+func SecretRollback(ctx context.Context, client SecretManagerClient, projectNumber, secretId string, version int64) (int64, error) {
+	valueBytes, err := SecretReadVersion(ctx, client, projectNumber, secretId, strconv.FormatInt(version, 10))
+	if err != nil {
+		return 0, err
+	}
+	secretName := fmt.Sprintf("projects/%s/secrets/%s", projectNumber, secretId)
+	versionName, err := addSecretVersion(ctx, client, secretName, valueBytes)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Rolled back secret=%s to version=%d as versionName=%s", secretName, version, versionName)
+	return versionNumber(versionName)
+}
+
+func fingerprint(salt []byte, valueBytes []byte) string {
+	hash := sha256.Sum256(append(append([]byte{}, salt...), valueBytes...))
+	return hex.EncodeToString(hash[:])
+}
+
+// the number at the end of projects/{p}/secrets/{s}/versions/{n}
+func versionNumber(versionName string) (int64, error) {
+	number, err := strconv.ParseInt(path.Base(versionName), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected version name=%s", versionName)
+	}
+	return number, nil
+}
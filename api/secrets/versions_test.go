@@ -0,0 +1,76 @@
+//go:build !integration
+
+package secrets
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	smpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const versionsSecret = "projects/000000000000/secrets/my-secret-id"
+
+func versionsClient() MockSecretClient {
+	return MockSecretClient{
+		Name: "my-secret-id",
+		Versions: []*smpb.SecretVersion{
+			// API sends them newest first
+			{Name: versionsSecret + "/versions/3", State: smpb.SecretVersion_ENABLED, CreateTime: &timestamppb.Timestamp{Seconds: 1724043037}},
+			{Name: versionsSecret + "/versions/2", State: smpb.SecretVersion_DESTROYED, CreateTime: &timestamppb.Timestamp{Seconds: 1724043036}},
+			{Name: versionsSecret + "/versions/1", State: smpb.SecretVersion_ENABLED, CreateTime: &timestamppb.Timestamp{Seconds: 1724043035}},
+		},
+		VersionValues: map[string][]byte{
+			versionsSecret + "/versions/3": []byte("new-value"),
+			versionsSecret + "/versions/1": []byte("old-value"),
+		},
+	}
+}
+
+func TestSecretVersions(t *testing.T) {
+	assert := assert.New(t)
+	list, err := SecretVersions(context.Background(), versionsClient(), "000000000000", "my-secret-id")
+	assert.NoError(err)
+	assert.Len(list.Versions, 3)
+	salt, err := hex.DecodeString(list.Salt)
+	assert.NoError(err)
+	assert.Len(salt, 16)
+
+	assert.Equal(int64(3), list.Versions[0].Version)
+	assert.Equal("ENABLED", list.Versions[0].State)
+	assert.Equal(int64(1724043037000000000), list.Versions[0].CreatedEpochNs)
+	assert.Equal(fingerprint(salt, []byte("new-value")), list.Versions[0].Fingerprint)
+
+	// destroyed versions can't be read, so have no fingerprint
+	assert.Equal("DESTROYED", list.Versions[1].State)
+	assert.Empty(list.Versions[1].Fingerprint)
+
+	assert.Equal(fingerprint(salt, []byte("old-value")), list.Versions[2].Fingerprint)
+	assert.NotEqual(list.Versions[0].Fingerprint, list.Versions[2].Fingerprint)
+
+	// fresh salt each time
+	again, err := SecretVersions(context.Background(), versionsClient(), "000000000000", "my-secret-id")
+	assert.NoError(err)
+	assert.NotEqual(list.Salt, again.Salt)
+	assert.NotEqual(list.Versions[0].Fingerprint, again.Versions[0].Fingerprint)
+}
+
+func TestSecretReadVersion(t *testing.T) {
+	assert := assert.New(t)
+	value, err := SecretReadVersion(context.Background(), versionsClient(), "000000000000", "my-secret-id", "1")
+	assert.NoError(err)
+	assert.Equal([]byte("old-value"), value)
+
+	_, err = SecretReadVersion(context.Background(), versionsClient(), "000000000000", "my-secret-id", "../../other")
+	assert.Error(err)
+}
+
+func TestSecretRollback(t *testing.T) {
+	assert := assert.New(t)
+	newVersion, err := SecretRollback(context.Background(), versionsClient(), "000000000000", "my-secret-id", 1)
+	assert.NoError(err)
+	assert.Equal(int64(4), newVersion)
+}
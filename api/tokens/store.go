@@ -0,0 +1,103 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// Store backed by a GCS bucket, one JSON object per token; shared by all API instances
+type GCSStore struct {
+	client *storage.Client
+	cfg    config.TokensConfig
+}
+
+func (s *GCSStore) objectName(id string) string {
+	return path.Join(s.cfg.Prefix, fmt.Sprintf("%s.json", id))
+}
+
+func (s *GCSStore) Get(ctx context.Context, id string) (*Token, error) {
+	reader, err := s.client.Bucket(s.cfg.Bucket).Object(s.objectName(id)).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{}
+	err = json.Unmarshal(data, token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *GCSStore) List(ctx context.Context) ([]*Token, error) {
+	tokens := []*Token{}
+	iter := s.client.Bucket(s.cfg.Bucket).Objects(ctx, &storage.Query{Prefix: s.cfg.Prefix + "/"})
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Errorf("failed to list api tokens bucket=%s err=%s", s.cfg.Bucket, err.Error())
+			return []*Token{}, err
+		}
+		id := strings.TrimSuffix(path.Base(attrs.Name), ".json")
+		token, err := s.Get(ctx, id)
+		if err != nil {
+			log.Warnf("could not read api token object=%s err=%s", attrs.Name, err.Error())
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	sortTokens(tokens)
+	return tokens, nil
+}
+
+func (s *GCSStore) Put(ctx context.Context, token *Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	writer := s.client.Bucket(s.cfg.Bucket).Object(s.objectName(token.Id)).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// Pick a Store implementation based on config; falls back to memory if no bucket is configured
+func NewStore(cfg config.TokensConfig) (Store, error) {
+	if cfg.Bucket == "" {
+		log.Warnf("no tokens bucket configured, api tokens will not persist across restarts")
+		return NewMemoryStore(), nil
+	}
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		log.Errorf("Failed to create storage client for cfg=%v, err=%s", cfg, err.Error())
+		return nil, err
+	}
+	return &GCSStore{
+		client: client,
+		cfg:    cfg,
+	}, nil
+}
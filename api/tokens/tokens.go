@@ -0,0 +1,174 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+// Every API token starts with this, which tells them apart from Google ID tokens in an Authorization header
+const Prefix = "act_"
+
+// Only service principals get API tokens; people log in
+const ServicePrincipalPrefix = "urn:arryved:service:"
+
+var ErrTokenNotFound = errors.New("api token not found")
+var ErrInvalidToken = errors.New("invalid api token")
+
+// A long-lived machine credential. Only the hash of the secret is stored; the secret itself is handed out once,
+// at creation.
+type Token struct {
+	Id          string              `json:"id"`
+	Principal   config.PrincipalUrn `json:"principal"`
+	Description string              `json:"description"`
+	Permissions []config.Permission `json:"permissions"` // the token can only be used for these...
+	Targets     []string            `json:"targets"`     // ...against these resource URNs ("*" for any)
+	Hash        string              `json:"hash"`        // hex sha256 of the secret
+	CreatedBy   string              `json:"createdBy"`
+	CreatedAt   int64               `json:"createdAt"`
+	ExpiresAt   int64               `json:"expiresAt"` // 0 for never
+	RevokedAt   int64               `json:"revokedAt"` // 0 while not revoked
+}
+
+func (t *Token) Active(now int64) bool {
+	if t.RevokedAt != 0 {
+		return false
+	}
+	return t.ExpiresAt == 0 || now < t.ExpiresAt
+}
+
+// Make a new token for principal with the given scope; returns the token to store and the secret to hand back
+// to the caller. Valid for ttl, or forever if ttl is 0.
+func New(principal config.PrincipalUrn, description string, permissions []config.Permission, targets []string,
+	createdBy string, ttl time.Duration) (*Token, string, error) {
+	if !strings.HasPrefix(string(principal), ServicePrincipalPrefix) || len(principal) == len(ServicePrincipalPrefix) {
+		return nil, "", fmt.Errorf("principal must be of the form %s<name>", ServicePrincipalPrefix)
+	}
+	if len(permissions) == 0 || len(targets) == 0 {
+		return nil, "", fmt.Errorf("at least one permission and one target are required")
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	id := uuid.New().String()
+	secret := fmt.Sprintf("%s%s.%s", Prefix, id, base64.RawURLEncoding.EncodeToString(random))
+
+	now := time.Now()
+	token := &Token{
+		Id:          id,
+		Principal:   principal,
+		Description: description,
+		Permissions: permissions,
+		Targets:     targets,
+		Hash:        hash(secret),
+		CreatedBy:   createdBy,
+		CreatedAt:   now.Unix(),
+	}
+	if ttl > 0 {
+		token.ExpiresAt = now.Add(ttl).Unix()
+	}
+	return token, secret, nil
+}
+
+func IsToken(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Look up and check a presented secret; returns ErrInvalidToken for anything that doesn't check out
+func Verify(ctx context.Context, store Store, secret string) (*Token, error) {
+	id, _, found := strings.Cut(strings.TrimPrefix(secret, Prefix), ".")
+	if !IsToken(secret) || !found {
+		return nil, ErrInvalidToken
+	}
+	token, err := store.Get(ctx, id)
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash(secret))) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if !token.Active(time.Now().Unix()) {
+		return nil, ErrInvalidToken
+	}
+	return token, nil
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Storage for API tokens
+type Store interface {
+	// Get a token by id; returns ErrTokenNotFound if there isn't one
+	Get(ctx context.Context, id string) (*Token, error)
+	// List all tokens, newest first
+	List(ctx context.Context) ([]*Token, error)
+	// Create or replace a token
+	Put(ctx context.Context, token *Token) error
+}
+
+// In-memory Store; not persistent, used for tests and when no bucket is configured
+type MemoryStore struct {
+	mutex  sync.RWMutex
+	tokens map[string]Token
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens: map[string]Token{},
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Token, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	token, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return &token, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*Token, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	tokens := make([]*Token, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		token := token
+		tokens = append(tokens, &token)
+	}
+	sortTokens(tokens)
+	return tokens, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, token *Token) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens[token.Id] = *token
+	return nil
+}
+
+func sortTokens(tokens []*Token) {
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt > tokens[j].CreatedAt
+	})
+}
@@ -0,0 +1,77 @@
+//go:build !integration
+
+package tokens
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/api/config"
+)
+
+func TestNewAndVerify(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	token, secret, err := New("urn:arryved:service:ci-deployer", "ci", []config.Permission{config.Deploy},
+		[]string{"urn:arryved:app:arryved-api"}, "urn:arryved:user:mockuser@example.com", 0)
+	assert.NoError(err)
+	assert.True(IsToken(secret))
+	assert.NotContains(token.Hash, strings.TrimPrefix(secret, Prefix))
+	assert.NoError(store.Put(ctx, token))
+
+	// the secret checks out
+	verified, err := Verify(ctx, store, secret)
+	assert.NoError(err)
+	assert.Equal(token.Id, verified.Id)
+	assert.Equal(config.PrincipalUrn("urn:arryved:service:ci-deployer"), verified.Principal)
+
+	// a tampered secret or unknown id doesn't
+	_, err = Verify(ctx, store, secret+"x")
+	assert.ErrorIs(err, ErrInvalidToken)
+	_, err = Verify(ctx, store, Prefix+"no-such-id.abc")
+	assert.ErrorIs(err, ErrInvalidToken)
+	_, err = Verify(ctx, store, "eyJhbGciOi.not.ours")
+	assert.ErrorIs(err, ErrInvalidToken)
+
+	// nor does a revoked one
+	token.RevokedAt = time.Now().Unix()
+	assert.NoError(store.Put(ctx, token))
+	_, err = Verify(ctx, store, secret)
+	assert.ErrorIs(err, ErrInvalidToken)
+}
+
+func TestExpiry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	token, secret, err := New("urn:arryved:service:ci-deployer", "", []config.Permission{config.Deploy},
+		[]string{"*"}, "", time.Hour)
+	assert.NoError(err)
+	assert.True(token.Active(time.Now().Unix()))
+	assert.False(token.Active(time.Now().Add(2 * time.Hour).Unix()))
+
+	token.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	assert.NoError(store.Put(ctx, token))
+	_, err = Verify(ctx, store, secret)
+	assert.ErrorIs(err, ErrInvalidToken)
+}
+
+func TestNewValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := New("urn:arryved:user:someone@example.com", "", []config.Permission{config.Deploy}, []string{"*"}, "", 0)
+	assert.Error(err)
+	_, _, err = New("urn:arryved:service:", "", []config.Permission{config.Deploy}, []string{"*"}, "", 0)
+	assert.Error(err)
+	_, _, err = New("urn:arryved:service:ci-deployer", "", []config.Permission{}, []string{"*"}, "", 0)
+	assert.Error(err)
+	_, _, err = New("urn:arryved:service:ci-deployer", "", []config.Permission{config.Deploy}, nil, "", 0)
+	assert.Error(err)
+}
@@ -0,0 +1,87 @@
+import click
+import click_spinner
+import json
+import math
+import requests
+import warnings
+
+from appcontrol.common import constants
+from appcontrol.auth import token
+
+
+warnings.filterwarnings("ignore")
+
+
+@click.group()
+def authz():
+    pass
+
+
+def handle_error(response):
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+def whoami(environment):
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/whoami")
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.get(url, headers=headers, verify=True)
+
+    handle_error(response)
+    result = json.loads(response.text)
+    click.echo(click.style(f"principal: {result['principal']}", fg="cyan"))
+    click.echo(f"groups:    {', '.join(result['groups']) or '-'}")
+    click.echo(f"roles:     {', '.join(result['roles']) or '-'}")
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-a', '--action', required=True, help="e.g. deploy")
+@click.option('-t', '--target', required=True, help="e.g. urn:arryved:app:arryved-api")
+def check(environment, action, target):
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/authz/check")
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        body = {
+                "action": action,
+                "target": target,
+                "env": environment,
+        }
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.post(url, json=body, headers=headers, verify=True)
+
+    handle_error(response)
+    result = json.loads(response.text)
+    if result["allowed"]:
+        click.echo(click.style(f"ALLOWED {action} on {result['target']}", fg="green"))
+    else:
+        click.echo(click.style(f"DENIED {action} on {result['target']}: {result.get('reason', '')}", fg="red"))
+    click.echo(f"roles:   {', '.join(result['roles']) or '-'}")
+    for entry in result["entries"]:
+        click.echo(f"entry:   {entry['effect']} {entry['role']} {entry['permission']} {entry['target']}")
+    owners = result.get("secretOwners")
+    if owners:
+        click.echo(f"owner users:  {', '.join(owners['users']) or '-'}")
+        click.echo(f"owner groups: {', '.join(owners['groups']) or '-'}")
+    if not result["allowed"]:
+        exit(2)
+
+
+authz.add_command(whoami)
+authz.add_command(check)
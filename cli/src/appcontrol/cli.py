@@ -7,12 +7,15 @@ import subprocess
 import tempfile
 import time
 
+from appcontrol.authz import authz
 from appcontrol.restart import restart
+from appcontrol.rollback import rollback
 from appcontrol.status import status
 from appcontrol.config import config
 from appcontrol.deploy import deploy
 from appcontrol.version import version
 from appcontrol.secrets import secrets
+from appcontrol.tokens import tokens
 
 
 def cleanup():
@@ -86,11 +89,14 @@ def cli():
         os.environ["REQUESTS_CA_BUNDLE"] = merge_ca()
 
 
+cli.add_command(authz)
 cli.add_command(config)
 cli.add_command(deploy)
 cli.add_command(restart)
+cli.add_command(rollback)
 cli.add_command(secrets)
 cli.add_command(status)
+cli.add_command(tokens)
 cli.add_command(version)
 
 if __name__ == "__main__":
@@ -18,7 +18,8 @@ warnings.filterwarnings("ignore")
 @click.option('-r', '--region', required=False, default="central")
 @click.option('-t', '--variant', required=False, default="default")
 @click.option('-n', '--version', required=True)
-def deploy(environment, application, region, variant, version):
+@click.option('-d', '--dry-run', is_flag=True, default=False, help="show the deploy plan without deploying anything")
+def deploy(environment, application, region, variant, version, dry_run):
     action = "deploy"
     api_host = constants["api_hosts_by_env"][environment]
     url = (f"{api_host}/{action}/{environment}/{application}/{region}/{variant}")
@@ -29,6 +30,7 @@ def deploy(environment, application, region, variant, version):
                 # "principal": "",  # deprecated, this can/should be pulled server-side from the validated token
                 "concurrency": "1",
                 "version": version,
+                "dryRun": dry_run,
         }
         # TODO - use CA cert
         id_token = token().get("id_token")
@@ -1,12 +1,44 @@
 import click
+import click_spinner
+import json
+import math
+import requests
+import warnings
+
+from appcontrol.common import constants
+from appcontrol.auth import token
+
+
+warnings.filterwarnings("ignore")
 
 
 @click.command()
-@click.option("-a", "--application", required=True, help="the target application")
-@click.option("-H", "--hosts", default=None, help="comma-separated list of specific hosts to restart, will restart all otherwise")
-@click.option("-c", "--concurrency", default=1, help="restart concurrency as a number or percentage of instances, default=1")
-def restart(application: str, hosts: str, concurrency: int):
-    # hosts = "<all hosts>" if hosts is None else hosts.split(",")
-    # click.echo(f"restart {application} on {hosts} with concurrency {concurrency}")
-    click.echo(click.style("this command is not yet implemented", fg="yellow"))
-    exit(1)
+@click.option('-e', '--environment', required=True)
+@click.option('-a', '--application', required=True)
+@click.option('-r', '--region', required=False, default="central")
+@click.option('-t', '--variant', required=False, default="default")
+@click.option('-c', '--concurrency', required=False, default="1",
+              help="restart concurrency as a number or percentage of instances, default=1")
+def restart(environment, application, region, variant, concurrency):
+    action = "restart"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}/{application}/{region}/{variant}")
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"))
+
+    with click_spinner.spinner():
+        body = {
+                "concurrency": str(concurrency),
+        }
+        # TODO - use CA cert
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.post(url, json=body, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        decoded = json.loads(response.text)
+        click.echo(click.style(f"Server experienced an error: {decoded}", fg="red"), err=True)
+        exit()
+
+    result = json.loads(response.text)
+    print(result)
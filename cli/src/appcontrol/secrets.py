@@ -37,12 +37,31 @@ def get_encoded_secret(file):
     return base64.b64encode(secret).decode('utf-8')
 
 
+def rotation_fields(rotation_days, expires, description):
+    # only the options given; the API leaves the rest of the rotation policy alone on update
+    fields = {}
+    if rotation_days is not None:
+        fields["rotationPeriodDays"] = rotation_days
+    if expires is not None:
+        fields["expiresEpochNs"] = 0
+        if expires:
+            expires_at = datetime.datetime.strptime(expires, '%Y-%m-%d').replace(tzinfo=pytz.utc)
+            fields["expiresEpochNs"] = int(expires_at.timestamp()) * 1000000000
+    if description is not None:
+        fields["description"] = description
+    return fields
+
+
 @click.command()
 @click.option('-e', '--environment', required=True)
 @click.option('-n', '--name', required=True)
-@click.option('-g', '--group', required=True)
+@click.option('-g', '--group', required=True, multiple=True, help='owner group; repeat for more than one')
+@click.option('-u', '--user', required=False, multiple=True, help='owner user besides yourself; repeat for more than one')
 @click.option('-f', '--file', required=False)
-def create(environment, name, group, file):
+@click.option('--rotation-days', required=False, type=int, help='how often the value should be rotated')
+@click.option('--expires', required=False, help='date (YYYY-MM-DD, UTC) the value stops being usable')
+@click.option('--description', required=False, help='what the secret is and how to rotate it')
+def create(environment, name, group, user, file, rotation_days, expires, description):
     value = get_encoded_secret(file)
 
     action = "secrets"
@@ -52,8 +71,10 @@ def create(environment, name, group, file):
     with click_spinner.spinner():
         body = {
                 "id": name,
-                "ownerGroup": group,
+                "ownerGroups": [*group],
+                "ownerUsers": [*user],
                 "value": value,
+                **rotation_fields(rotation_days, expires, description),
         }
         id_token = token().get("id_token")
         headers = {"Authorization": f"Bearer {id_token}"}
@@ -89,10 +110,13 @@ def is_binary(data):
 @click.option('-e', '--environment', required=True)
 @click.option('-n', '--name', required=True)
 @click.option('-f', '--file', required=False)
-def get(environment, name, file):
+@click.option('-v', '--version', required=False, help='a version number; defaults to the latest')
+def get(environment, name, file, version):
     action = "secrets"
     api_host = constants["api_hosts_by_env"][environment]
     url = (f"{api_host}/{action}/{environment}/{name}")
+    if version:
+        url = (f"{url}/versions/{version}")
 
     click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
     with click_spinner.spinner():
@@ -145,18 +169,43 @@ def ns_to_human_time(ns_epoch, utc=False):
 def print_secrets_table(results, utc):
     table = ANSITable(
         Column("Name", headstyle="bold"),
-        Column("Owner Group", headstyle="bold"),
-        Column("Owner User", headstyle="bold"),
+        Column("Owner Groups", headstyle="bold"),
+        Column("Owner Users", headstyle="bold"),
         Column("Created", headstyle="bold"),
+        Column("Rotation", headstyle="bold"),
+        Column("Expires", headstyle="bold"),
         border="thin"
     )
 
     for result in results:
         name = result["urn"].split(":")[-1]
-        group = result["ownerGroup"]
-        user = result["ownerUser"]
+        group = "\n".join(result.get("ownerGroups") or [result["ownerGroup"]])
+        user = "\n".join(result.get("ownerUsers") or [result["ownerUser"]])
         created = ns_to_human_time(result["createdEpochNs"], utc=utc)
-        table.row(name, group, user, created)
+        rotation = f"{result['rotationPeriodDays']}d" if result.get("rotationPeriodDays") else "-"
+        expires = ns_to_human_time(result["expiresEpochNs"], utc=utc) if result.get("expiresEpochNs") else "-"
+        table.row(name, group, user, created, rotation, expires)
+
+    table.print()
+
+
+def print_stale_table(results, utc):
+    table = ANSITable(
+        Column("Name", headstyle="bold"),
+        Column("Owner Group", headstyle="bold"),
+        Column("Reason", headstyle="bold"),
+        Column("Last Rotated", headstyle="bold"),
+        Column("Due", headstyle="bold"),
+        Column("Expires", headstyle="bold"),
+        border="thin"
+    )
+
+    for result in results:
+        name = result["urn"].split(":")[-1]
+        last_rotated = ns_to_human_time(result["lastRotatedEpochNs"], utc=utc) if result["lastRotatedEpochNs"] else "-"
+        due = ns_to_human_time(result["rotationDueEpochNs"], utc=utc) if result.get("rotationDueEpochNs") else "-"
+        expires = ns_to_human_time(result["expiresEpochNs"], utc=utc) if result.get("expiresEpochNs") else "-"
+        table.row(name, result["ownerGroup"], result["reason"], last_rotated, due, expires)
 
     table.print()
 
@@ -164,10 +213,13 @@ def print_secrets_table(results, utc):
 @click.command()
 @click.option('-e', '--environment', required=True)
 @click.option('-u', '--utc', default=False, is_flag=True, help='show time in UTC instead of local tz')
-def list(environment, utc):
+@click.option('-s', '--stale', default=False, is_flag=True, help='only secrets past their rotation date or expiry')
+def list(environment, utc, stale):
     action = "secrets"
     api_host = constants["api_hosts_by_env"][environment]
     url = (f"{api_host}/{action}/{environment}")
+    if stale:
+        url = (f"{url}?stale=true")
 
     click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
     with click_spinner.spinner():
@@ -187,7 +239,10 @@ def list(environment, utc):
         exit(2)
 
     if status_code == 2:
-        print_secrets_table(json.loads(response.text), utc)
+        if stale:
+            print_stale_table(json.loads(response.text), utc)
+        else:
+            print_secrets_table(json.loads(response.text), utc)
         exit(0)
 
 
@@ -195,8 +250,13 @@ def list(environment, utc):
 @click.option('-e', '--environment', required=True)
 @click.option('-n', '--name', required=True)
 @click.option('-f', '--file', required=False)
-def update(environment, name, file):
-    value = get_encoded_secret(file)
+@click.option('--rotation-days', required=False, type=int, help='how often the value should be rotated; 0 clears')
+@click.option('--expires', required=False, help='date (YYYY-MM-DD, UTC) the value stops being usable; "" clears')
+@click.option('--description', required=False, help='what the secret is and how to rotate it')
+def update(environment, name, file, rotation_days, expires, description):
+    rotation = rotation_fields(rotation_days, expires, description)
+    # with only rotation options, just the rotation policy changes and the value is left alone
+    value = get_encoded_secret(file) if file or not rotation else None
 
     action = "secrets"
     api_host = constants["api_hosts_by_env"][environment]
@@ -204,8 +264,10 @@ def update(environment, name, file):
     click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
     with click_spinner.spinner():
         body = {
-                "value": value,
+                **rotation,
         }
+        if value is not None:
+            body["value"] = value
         id_token = token().get("id_token")
         headers = {"Authorization": f"Bearer {id_token}"}
         response = requests.patch(url, json=body, headers=headers, verify=True)
@@ -229,10 +291,13 @@ def update(environment, name, file):
 @click.command()
 @click.option('-e', '--environment', required=True)
 @click.option('-n', '--name', required=True)
-def delete(environment, name):
+@click.option('--force', default=False, is_flag=True, help='delete even if app configs still reference it')
+def delete(environment, name, force):
     action = "secrets"
     api_host = constants["api_hosts_by_env"][environment]
     url = (f"{api_host}/{action}/{environment}/{name}")
+    if force:
+        url += "?force=true"
 
     click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
     with click_spinner.spinner():
@@ -247,8 +312,11 @@ def delete(environment, name):
         exit(1)
 
     if status_code == 4:
-        error = json.loads(response.text).get("error", str(response.text))
+        result = json.loads(response.text)
+        error = result.get("error", str(response.text))
         click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        if result.get("usages"):
+            print_usages_table(result["usages"])
         exit(2)
 
     if status_code == 2:
@@ -256,8 +324,390 @@ def delete(environment, name):
         exit(0)
 
 
+def print_versions_table(result, utc):
+    table = ANSITable(
+        Column("Version", headstyle="bold"),
+        Column("State", headstyle="bold"),
+        Column("Created", headstyle="bold"),
+        Column("Fingerprint", headstyle="bold"),
+        border="thin"
+    )
+
+    for version in result["versions"]:
+        created = ns_to_human_time(version["createdEpochNs"], utc=utc)
+        table.row(version["version"], version["state"], created, version.get("fingerprint", "")[:16] or "-")
+
+    table.print()
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-n', '--name', required=True)
+@click.option('-u', '--utc', default=False, is_flag=True, help='show time in UTC instead of local tz')
+def versions(environment, name, utc):
+    action = "secrets"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}/{name}/versions")
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.get(url, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        print_versions_table(json.loads(response.text), utc)
+        exit(0)
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-n', '--name', required=True)
+@click.option('-v', '--version', required=True, type=int, help='the version whose value to restore')
+def rollback(environment, name, version):
+    action = "secrets"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}/{name}/rollback")
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        body = {
+                "version": version,
+        }
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.post(url, json=body, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        result = json.loads(response.text)
+        click.echo(click.style(f"Secret urn:arryved:secret:{name} rolled back in env={environment}; version {result['version']} now holds the value of version {result['restoredFrom']}", fg="green"), err=True)
+        exit(0)
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-n', '--name', required=True)
+@click.option('-g', '--group', required=False, multiple=True, help='owner group; repeat for more than one')
+@click.option('-u', '--user', required=False, multiple=True, help='owner user; repeat for more than one')
+@click.option('--add', default=False, is_flag=True, help='add these owners instead of replacing the current ones')
+def owners(environment, name, group, user, add):
+    if not group and not user:
+        click.echo(click.style("At least one --group or --user is required", fg="yellow"), err=True)
+        exit(2)
+
+    action = "secrets"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}/{name}/owners")
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        body = {
+                "ownerGroups": [*group],
+                "ownerUsers": [*user],
+                "add": add,
+        }
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.put(url, json=body, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        result = json.loads(response.text)
+        click.echo(click.style(f"Secret urn:arryved:secret:{name} in env={environment} is now owned by", fg="green"), err=True)
+        click.echo(f"groups: {', '.join(result['groups']) or '-'}")
+        click.echo(f"users:  {', '.join(result['users']) or '-'}")
+        exit(0)
+
+
+@click.command()
+@click.option('-e', '--environment', required=True, help='env to copy from')
+@click.option('-n', '--name', required=True)
+@click.option('-d', '--destination', required=True, help='env to copy to')
+@click.option('--to', 'destination_name', required=False, help='name in the destination env; defaults to the same name')
+def copy(environment, name, destination, destination_name):
+    action = "secrets"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}/{name}/copy")
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        body = {
+                "destinationEnv": destination,
+        }
+        if destination_name:
+            body["destinationId"] = destination_name
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.post(url, json=body, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        result = json.loads(response.text)
+        verb = "created" if result["created"] else "updated with a new version"
+        click.echo(click.style(f"Secret urn:arryved:secret:{name} copied from env={environment}; {result['urn']} {verb} in env={result['env']}", fg="green"), err=True)
+        exit(0)
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-n', '--name', required=True)
+@click.option('-v', '--version', required=False, default="latest", help='the version to fingerprint; defaults to latest')
+def fingerprint(environment, name, version):
+    action = "secrets"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}/{name}/fingerprint")
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        params = {
+                "version": version,
+        }
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.get(url, params=params, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        result = json.loads(response.text)
+        click.echo(result["fingerprint"])
+        exit(0)
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-n', '--name', required=True)
+@click.option('-v', '--version', required=False, default="latest", help='the version to compare; defaults to latest')
+@click.option('--other-env', required=False, help='env of the secret to compare with; defaults to the same env')
+@click.option('--other-name', required=False, help='name of the secret to compare with; defaults to the same name')
+@click.option('--other-version', required=False, default="latest", help='version to compare with; defaults to latest')
+def compare(environment, name, version, other_env, other_name, other_version):
+    action = "secrets"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}/{name}/compare")
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        params = {
+                "version": version,
+                "otherEnv": other_env or environment,
+                "otherId": other_name or name,
+                "otherVersion": other_version,
+        }
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.get(url, params=params, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        result = json.loads(response.text)
+        secret, other = result["secret"], result["other"]
+        description = (f"{secret['urn']} env={secret['env']} version={secret['version']} and "
+                       f"{other['urn']} env={other['env']} version={other['version']}")
+        if result["equal"]:
+            click.echo(click.style(f"Same value: {description}", fg="green"))
+            exit(0)
+        click.echo(click.style(f"Different values: {description}", fg="yellow"))
+        exit(3)
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-o', '--output', required=True, type=click.Path(dir_okay=False, writable=True), help='file to write the encrypted bundle to')
+def export(environment, output):
+    action = "secrets-backup"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}")
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.get(url, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        result = json.loads(response.text)
+        with open(output, "w") as bundle_file:
+            bundle_file.write(response.text)
+        click.echo(click.style(f"Exported {result['count']} secrets from env={environment} to {output}", fg="green"), err=True)
+        exit(0)
+
+
+@click.command(name="import")
+@click.option('-e', '--environment', required=True, help='env to import into')
+@click.option('-i', '--input', 'input_path', required=True, type=click.Path(exists=True, dir_okay=False), help='encrypted bundle, as exported')
+@click.option('--on-conflict', required=False, default="fail", type=click.Choice(["skip", "overwrite", "fail"]), help='what to do with secrets that already exist; fail changes nothing')
+def import_bundle(environment, input_path, on_conflict):
+    action = "secrets-backup"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}")
+
+    with open(input_path) as bundle_file:
+        bundle = bundle_file.read()
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        params = {
+                "onConflict": on_conflict,
+        }
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}", "Content-Type": "application/json"}
+        response = requests.post(url, data=bundle, params=params, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        result = json.loads(response.text)
+        for outcome in ["created", "overwritten", "skipped", "failed"]:
+            click.echo(f"{outcome}: {', '.join(result[outcome]) or '-'}")
+        if result["failed"]:
+            click.echo(click.style(f"Some secrets could not be imported into env={environment}; have the app administrator check the logs", fg="red"), err=True)
+            exit(1)
+        exit(0)
+
+
+def print_usages_table(results):
+    table = ANSITable(
+        Column("App", headstyle="bold"),
+        Column("Version", headstyle="bold"),
+        Column("Region", headstyle="bold"),
+        Column("Variant", headstyle="bold"),
+        Column("File", headstyle="bold"),
+        border="thin"
+    )
+
+    for usage in results:
+        table.row(usage["app"], usage["version"], usage["region"], usage["variant"], usage["file"])
+
+    table.print()
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-n', '--name', required=True)
+def usages(environment, name):
+    action = "secrets"
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/{action}/{environment}/{name}/usages")
+
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.get(url, headers=headers, verify=True)
+
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+    if status_code == 2:
+        results = json.loads(response.text)
+        if not results:
+            click.echo(click.style(f"No configs in env={environment} reference urn:arryved:secret:{name}", fg="green"), err=True)
+        else:
+            print_usages_table(results)
+        exit(0)
+
+
 secrets.add_command(create)
 secrets.add_command(get)
 secrets.add_command(list)
 secrets.add_command(update)
 secrets.add_command(delete)
+secrets.add_command(versions)
+secrets.add_command(rollback)
+secrets.add_command(usages)
+secrets.add_command(owners)
+secrets.add_command(copy)
+secrets.add_command(fingerprint)
+secrets.add_command(compare)
+secrets.add_command(export)
+secrets.add_command(import_bundle)
@@ -0,0 +1,124 @@
+import click
+import click_spinner
+import datetime
+import json
+import math
+import requests
+import warnings
+
+from ansitable import ANSITable, Column
+
+from appcontrol.common import constants
+from appcontrol.auth import token
+
+
+warnings.filterwarnings("ignore")
+
+
+@click.group()
+def tokens():
+    pass
+
+
+def handle_error(response):
+    status_code = math.floor(response.status_code / 100)
+    if status_code == 5:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Server experienced an error: {error}", fg="red"), err=True)
+        exit(1)
+
+    if status_code == 4:
+        error = json.loads(response.text).get("error", str(response.text))
+        click.echo(click.style(f"Request error: {error}", fg="yellow"), err=True)
+        exit(2)
+
+
+def epoch_to_human_time(epoch):
+    if not epoch:
+        return "-"
+    return datetime.datetime.fromtimestamp(epoch).strftime('%Y-%m-%d %H:%M:%S')
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-p', '--principal', required=True, help="e.g. urn:arryved:service:ci-deployer")
+@click.option('-d', '--description', required=False, default="")
+@click.option('-P', '--permission', 'permissions', required=True, multiple=True, help="e.g. deploy; repeatable")
+@click.option('-t', '--target', 'targets', required=True, multiple=True, help="e.g. urn:arryved:app:arryved-api; repeatable")
+@click.option('--ttl', required=False, default=0, help="lifetime in seconds; 0 for no expiry")
+def create(environment, principal, description, permissions, targets, ttl):
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/tokens")
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        body = {
+                "principal": principal,
+                "description": description,
+                "permissions": list(permissions),
+                "targets": list(targets),
+                "ttlS": ttl,
+        }
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.post(url, json=body, headers=headers, verify=True)
+
+    handle_error(response)
+    result = json.loads(response.text)
+    click.echo(click.style(f"Token id={result['entry']['id']} created for {principal}; it won't be shown again", fg="green"), err=True)
+    click.echo(result["token"])
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+def list(environment):
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/tokens")
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.get(url, headers=headers, verify=True)
+
+    handle_error(response)
+    table = ANSITable(
+        Column("Id", headstyle="bold"),
+        Column("Principal", headstyle="bold"),
+        Column("Permissions", headstyle="bold"),
+        Column("Targets", headstyle="bold"),
+        Column("Created", headstyle="bold"),
+        Column("Expires", headstyle="bold"),
+        Column("Revoked", headstyle="bold"),
+        border="thin"
+    )
+    for entry in json.loads(response.text):
+        table.row(
+            entry["id"],
+            entry["principal"],
+            ",".join(entry["permissions"]),
+            ",".join(entry["targets"]),
+            epoch_to_human_time(entry["createdAt"]),
+            epoch_to_human_time(entry["expiresAt"]),
+            epoch_to_human_time(entry["revokedAt"]),
+        )
+    table.print()
+
+
+@click.command()
+@click.option('-e', '--environment', required=True)
+@click.option('-i', '--id', 'token_id', required=True)
+def revoke(environment, token_id):
+    api_host = constants["api_hosts_by_env"][environment]
+    url = (f"{api_host}/tokens/{token_id}")
+    click.echo(click.style(f"Connecting to {url} ...", fg="green"), err=True)
+    with click_spinner.spinner():
+        id_token = token().get("id_token")
+        headers = {"Authorization": f"Bearer {id_token}"}
+        response = requests.delete(url, headers=headers, verify=True)
+
+    handle_error(response)
+    click.echo(click.style(f"Token id={token_id} revoked", fg="green"), err=True)
+
+
+tokens.add_command(create)
+tokens.add_command(list)
+tokens.add_command(revoke)
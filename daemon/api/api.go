@@ -25,6 +25,7 @@ func (a *Api) Start() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status", NewConfiguredHandlerStatus(cfg, a.StatusCache))
 	mux.HandleFunc("/deploy", NewConfiguredHandlerDeploy(cfg, a.StatusCache, a.DeployCache))
+	mux.HandleFunc("/restart", NewConfiguredHandlerRestart(cfg, a.StatusCache, a.DeployCache))
 	mux.HandleFunc("/healthz", NewConfiguredHandlerHealthz(cfg, a.StatusCache))
 
 	tlsConfig := &tls.Config{
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	apimodel "github.com/arryved/app-ctrl/api/model"
 	"github.com/arryved/app-ctrl/daemon/config"
 	"github.com/arryved/app-ctrl/daemon/model"
 )
@@ -66,6 +67,22 @@ func handleMarshalError(w http.ResponseWriter, err error) {
 	w.Write([]byte(errorBody))
 }
 
+// Principal named by the worker's identity header, or "unknown". app-controld doesn't authenticate its callers (the
+// worker's PSK isn't checked here), so the header is unverified and anyone who can reach the port can claim any
+// principal; it's only fit for logs.
+func requestedBy(r *http.Request) string {
+	value := r.Header.Get(apimodel.IdentityHeader)
+	if value == "" {
+		return "unknown"
+	}
+	identity, err := apimodel.DecodeIdentity(value)
+	if err != nil {
+		log.Warnf("ignoring malformed identity header err=%s", err.Error())
+		return "unknown"
+	}
+	return identity.Name()
+}
+
 // Handler for /deploy?app=<APP>&version=<VERSION>
 func NewConfiguredHandlerDeploy(cfg *config.Config, statusCache *model.StatusCache, deployCache *model.DeployCache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -87,7 +104,7 @@ func NewConfiguredHandlerDeploy(cfg *config.Config, statusCache *model.StatusCac
 		defer cancel()
 		ch := make(chan DeployResult, 1)
 		go func() {
-			ch <- Deploy(cfg, statusCache, deployCache, app, version)
+			ch <- Deploy(cfg, statusCache, deployCache, app, version, requestedBy(r))
 		}()
 
 		// wait for deploy completion or timeout
@@ -110,16 +127,17 @@ func NewConfiguredHandlerDeploy(cfg *config.Config, statusCache *model.StatusCac
 	}
 }
 
-func Deploy(cfg *config.Config, statusCache *model.StatusCache, deployCache *model.DeployCache, app, version string) DeployResult {
+func Deploy(cfg *config.Config, statusCache *model.StatusCache, deployCache *model.DeployCache, app, version, requestedBy string) DeployResult {
 	// this doesn't call *directly* ; instead, it sets a desired version in a shared map, and then
 	// waits a max amount of time for a bg runner to complete successfully & converge at the intended version.
 	// if it does not complete, a failure is returned
 	// if it does complete, a success is returned
 
-	log.Debugf("Deploy() app=%s version=%s", app, version)
+	log.Infof("Deploy() app=%s version=%s requestedBy=%s", app, version, requestedBy)
 	deploy := model.Deploy{
 		App:         app,
 		Version:     version,
+		RequestedBy: requestedBy,
 		RequestedAt: time.Now().Unix(),
 	}
 
@@ -133,18 +151,7 @@ func Deploy(cfg *config.Config, statusCache *model.StatusCache, deployCache *mod
 	defer deployCache.DeleteDeploy(app)
 
 	// wait for deploy action to complete
-	latestState := deployCache.GetDeploys()[app]
-	interval := time.Duration(float64(cfg.WriteTimeoutS) * 0.05 * float64(time.Second))
-	for {
-		log.Debugf("checking for completion %v", latestState)
-		time.Sleep(time.Duration(interval))
-		latestState = deployCache.GetDeploys()[app]
-		if latestState.CompletedAt != 0 {
-			log.Infof("deploy marked completed app=%s, state=%v", app, latestState)
-			break
-		}
-		log.Debugf("deploy completion not seen yet app=%s", app)
-	}
+	latestState := waitForCompletion(cfg, deployCache, app)
 
 	// if any error attached to deploy, return now
 	if latestState.Err != nil {
@@ -179,6 +186,22 @@ func Deploy(cfg *config.Config, statusCache *model.StatusCache, deployCache *mod
 	}
 }
 
+// poll the deploy cache until the runner marks the app's entry completed
+func waitForCompletion(cfg *config.Config, deployCache *model.DeployCache, app string) model.Deploy {
+	latestState := deployCache.GetDeploys()[app]
+	interval := time.Duration(float64(cfg.WriteTimeoutS) * 0.05 * float64(time.Second))
+	for {
+		log.Debugf("checking for completion %v", latestState)
+		time.Sleep(time.Duration(interval))
+		latestState = deployCache.GetDeploys()[app]
+		if latestState.CompletedAt != 0 {
+			log.Infof("deploy marked completed app=%s, state=%v", app, latestState)
+			return latestState
+		}
+		log.Debugf("deploy completion not seen yet app=%s", app)
+	}
+}
+
 func getConvergenceMsg(statusCache *model.StatusCache, app, version string) string {
 	latestStatuses := statusCache.GetStatuses()
 	installedVersion := latestStatuses[app].Versions.Installed
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/daemon/config"
+	"github.com/arryved/app-ctrl/daemon/model"
+	"github.com/arryved/app-ctrl/daemon/runners"
+)
+
+// Handler for /restart?app=<APP>
+func NewConfiguredHandlerRestart(cfg *config.Config, statusCache *model.StatusCache, deployCache *model.DeployCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Infof("Call to /restart: addr=%s method=%s url=%s", r.RemoteAddr, r.Method, r.URL)
+		w.Header().Set("content-type", "application/json")
+
+		// param validation
+		log.Debugf("Checking for uri params")
+		app := r.URL.Query().Get("app")
+		if app == "" {
+			handleError(w, http.StatusBadRequest, "Required query param missing, provide app")
+			return
+		}
+		if _, ok := cfg.AppDefs[app]; !ok {
+			handleError(w, http.StatusNotFound, fmt.Sprintf("No app definition for app=%s", app))
+			return
+		}
+
+		// run restart in bg
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(cfg.WriteTimeoutS)*time.Second)
+		defer cancel()
+		ch := make(chan DeployResult, 1)
+		go func() {
+			ch <- Restart(cfg, statusCache, deployCache, app, requestedBy(r))
+		}()
+
+		// wait for restart completion or timeout
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				handleError(w, http.StatusRequestTimeout, "Timeout exceeded waiting for restart")
+			} else {
+				handleError(w, http.StatusInternalServerError, fmt.Sprintf("Context finished with unknown err=%v", ctx.Err()))
+			}
+		case result := <-ch:
+			if result.Err != "" {
+				handleError(w, result.Code, fmt.Sprintf("Restart failed err=%s", result.Err))
+			} else {
+				logMsg := fmt.Sprintf("Restart succeeded /restart: addr=%s method=%s url=%s", r.RemoteAddr, r.Method, r.URL)
+				handleSuccess(w, result.Code, result, logMsg)
+			}
+		}
+		return
+	}
+}
+
+func Restart(cfg *config.Config, statusCache *model.StatusCache, deployCache *model.DeployCache, app, requestedBy string) DeployResult {
+	// like Deploy(), this hands the restart to the bg runner via the shared deploy map, so a restart and a deploy
+	// of the same app can't overlap. Success means the runner finished and the app reports healthy again.
+
+	log.Infof("Restart() app=%s requestedBy=%s", app, requestedBy)
+	restart := model.Deploy{
+		App:         app,
+		Restart:     true,
+		RequestedBy: requestedBy,
+		RequestedAt: time.Now().Unix(),
+	}
+
+	// an app that's already OOR is left that way by the restart, and OOR forces its health checks unhealthy
+	wasOOR := runners.IsOOR(cfg.AppDefs[app])
+
+	// try to insert into DeployCache; if insert fails, then something's already in flight; return 429 in this case
+	if !deployCache.AddDeploy(app, restart) {
+		return DeployResult{
+			Code: http.StatusTooManyRequests,
+			Err:  fmt.Sprintf("deploy or restart already requested for %s", app),
+		}
+	}
+	defer deployCache.DeleteDeploy(app)
+
+	latestState := waitForCompletion(cfg, deployCache, app)
+	if latestState.Err != nil {
+		return DeployResult{
+			Code:  http.StatusInternalServerError,
+			Err:   latestState.Err.Error(),
+			State: &latestState,
+		}
+	}
+
+	// the app should come back healthy before the converge timeout, going by status collected since the restart
+	restartedAt := time.Now()
+	if !waitForHealthy(statusCache, app, wasOOR, restartedAt, time.Duration(cfg.ConvergeTimeoutS)*time.Second) {
+		msg := fmt.Sprintf("restart did not converge on healthy app=%s, health=%v", app, statusCache.GetStatuses()[app].Health)
+		log.Error(msg)
+		return DeployResult{
+			Code:  http.StatusRequestTimeout,
+			Err:   msg,
+			State: &latestState,
+		}
+	}
+
+	return DeployResult{
+		Code:  http.StatusOK,
+		State: &latestState,
+	}
+}
+
+// Wait for status collected after since to show app healthy. An app with no health checks is taken as healthy, as
+// is an OOR one if it was OOR before the restart, since OOR forces its checks unhealthy.
+func waitForHealthy(statusCache *model.StatusCache, app string, wasOOR bool, since time.Time, duration time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			log.Debugf("checking for healthy app=%s", app)
+			if statusCache.CollectedAt().Before(since) {
+				log.Debugf("no status collected since the restart yet app=%s", app)
+				continue
+			}
+			healthy := true
+			for _, result := range statusCache.GetStatuses()[app].Health {
+				if result.OOR && wasOOR {
+					continue
+				}
+				if !result.Healthy || result.OOR {
+					healthy = false
+				}
+			}
+			if healthy {
+				return true
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+//go:build !integration
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	apimodel "github.com/arryved/app-ctrl/api/model"
+	"github.com/arryved/app-ctrl/daemon/model"
+)
+
+func TestRestartHandlerSucceeded(t *testing.T) {
+	// setup
+	assert := assert.New(t)
+	statusCache := model.NewStatusCache()
+	deployCache := model.NewDeployCache()
+	handler := http.HandlerFunc(NewConfiguredHandlerRestart(getMockConfig(), statusCache, deployCache))
+
+	// background client request using a test handler + responder pair
+	responder := httptest.NewRecorder()
+	result := DeployResult{}
+	req, err := http.NewRequest("GET", "/restart?app=arryved-api", nil)
+	identity := apimodel.Identity{Email: "mockuser@example.com", AuthMethod: apimodel.AuthMethodOIDC}
+	req.Header.Set(apimodel.IdentityHeader, identity.Encode())
+	bgClientCh := make(chan error, 1)
+	go func() {
+		handler.ServeHTTP(responder, req)
+		bgClientCh <- json.Unmarshal(responder.Body.Bytes(), &result)
+	}()
+
+	// check that the restart gets populated as expected
+	waitForRestart(deployCache, "arryved-api")
+	assert.True(deployCache.GetDeploys()["arryved-api"].Restart)
+	assert.Equal("mockuser@example.com", deployCache.GetDeploys()["arryved-api"].RequestedBy)
+	assert.Equal(int64(0), deployCache.GetDeploys()["arryved-api"].CompletedAt)
+
+	// mark the restart as started and completed with nil error, app reports healthy
+	assert.True(deployCache.MarkDeployStart("arryved-api"))
+	assert.True(deployCache.MarkDeployComplete("arryved-api", nil))
+	done := make(chan struct{})
+	go keepReporting(statusCache, map[string]model.Status{
+		"arryved-api": {
+			Health: []model.HealthResult{{Port: 10010, Healthy: true}},
+		},
+	}, done)
+
+	// block until the request returns, then check
+	err = <-bgClientCh
+	close(done)
+	assert.NoError(err)
+	assert.Equal(200, responder.Code)
+	assert.Equal(200, result.Code)
+	assert.Equal("arryved-api", result.State.App)
+	assert.True(result.State.Restart)
+}
+
+func TestRestartHandlerFailed(t *testing.T) {
+	// setup
+	assert := assert.New(t)
+	statusCache := model.NewStatusCache()
+	deployCache := model.NewDeployCache()
+	handler := http.HandlerFunc(NewConfiguredHandlerRestart(getMockConfig(), statusCache, deployCache))
+
+	// background client request using a test handler + responder pair
+	responder := httptest.NewRecorder()
+	result := DeployResult{}
+	req, err := http.NewRequest("GET", "/restart?app=arryved-api", nil)
+	bgClientCh := make(chan error, 1)
+	go func() {
+		handler.ServeHTTP(responder, req)
+		bgClientCh <- json.Unmarshal(responder.Body.Bytes(), &result)
+	}()
+
+	// mark the restart as started, completed with error
+	waitForRestart(deployCache, "arryved-api")
+	assert.True(deployCache.MarkDeployStart("arryved-api"))
+	assert.True(deployCache.MarkDeployComplete("arryved-api", fmt.Errorf("systemd restart failed")))
+
+	err = <-bgClientCh
+	assert.NoError(err)
+	assert.Equal(500, responder.Code)
+	assert.Contains(result.Err, "systemd restart failed")
+}
+
+func TestRestartConvergence(t *testing.T) {
+	assert := assert.New(t)
+	cfg := getMockConfig()
+	cfg.ConvergeTimeoutS = 2
+	restart := func(statuses map[string]model.Status) DeployResult {
+		deployCache := model.NewDeployCache()
+		statusCache := model.NewStatusCache()
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			waitForRestart(deployCache, "arryved-api")
+			deployCache.MarkDeployStart("arryved-api")
+			deployCache.MarkDeployComplete("arryved-api", nil)
+			keepReporting(statusCache, statuses, done)
+		}()
+		return Restart(cfg, statusCache, deployCache, "arryved-api", "unknown")
+	}
+	oor := map[string]model.Status{"arryved-api": {Health: []model.HealthResult{{Port: 10010, OOR: true}}}}
+
+	// no health checks to wait on
+	assert.Equal(200, restart(map[string]model.Status{"arryved-api": {Health: []model.HealthResult{}}}).Code)
+
+	// an app pulled before the restart stays OOR, which is all its checks can say
+	appDef := cfg.AppDefs["arryved-api"]
+	appDef.AppRoot = t.TempDir()
+	cfg.AppDefs["arryved-api"] = appDef
+	assert.NoError(os.WriteFile(filepath.Join(appDef.AppRoot, ".oor"), []byte{}, 0644))
+	assert.Equal(200, restart(oor).Code)
+
+	// but one that wasn't should be back in rotation
+	assert.NoError(os.Remove(filepath.Join(appDef.AppRoot, ".oor")))
+	assert.Equal(408, restart(oor).Code)
+}
+
+func TestRestartIgnoresStatusFromBeforeRestart(t *testing.T) {
+	assert := assert.New(t)
+	cfg := getMockConfig()
+	cfg.ConvergeTimeoutS = 2
+	deployCache := model.NewDeployCache()
+	statusCache := model.NewStatusCache()
+
+	// healthy, but only as of before the restart finished
+	statusCache.SetStatuses(map[string]model.Status{
+		"arryved-api": {Health: []model.HealthResult{{Port: 10010, Healthy: true}}},
+	})
+	go func() {
+		waitForRestart(deployCache, "arryved-api")
+		deployCache.MarkDeployStart("arryved-api")
+		deployCache.MarkDeployComplete("arryved-api", nil)
+	}()
+
+	assert.Equal(408, Restart(cfg, statusCache, deployCache, "arryved-api", "unknown").Code)
+}
+
+func TestRestartHandlerUnknownApp(t *testing.T) {
+	assert := assert.New(t)
+	handler := http.HandlerFunc(NewConfiguredHandlerRestart(getMockConfig(), model.NewStatusCache(), model.NewDeployCache()))
+
+	responder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/restart?app=no-such-app", nil)
+	handler.ServeHTTP(responder, req)
+
+	assert.Equal(404, responder.Code)
+}
+
+func TestRestartRejectedDuringDeploy(t *testing.T) {
+	assert := assert.New(t)
+	deployCache := model.NewDeployCache()
+	deployCache.AddDeploy("arryved-api", model.Deploy{App: "arryved-api", Version: "1.2.3", RequestedAt: time.Now().Unix()})
+
+	result := Restart(getMockConfig(), model.NewStatusCache(), deployCache, "arryved-api", "unknown")
+
+	assert.Equal(429, result.Code)
+}
+
+func waitForRestart(cache *model.DeployCache, app string) {
+	for {
+		time.Sleep(10 * time.Millisecond)
+		if cache.GetDeploys()[app].Restart {
+			break
+		}
+	}
+}
+
+// report statuses as the status runner would, collected afresh every so often, until done
+func keepReporting(cache *model.StatusCache, statuses map[string]model.Status, done chan struct{}) {
+	for {
+		cache.SetStatuses(statuses)
+		select {
+		case <-done:
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
@@ -42,6 +42,9 @@ type Config struct {
 
 	// TLS Settings
 	TLS *common.TLSConfig `yaml:"tls"`
+
+	// Where the secrets app config files refer to are kept
+	Secrets common.SecretsConfig `yaml:"secrets"`
 }
 
 type AppDef struct {
@@ -169,6 +172,9 @@ func (c *Config) setDefaults() {
 	if c.PollIntervalS == 0 {
 		c.PollIntervalS = 5
 	}
+	if c.Secrets.Backend == "" {
+		c.Secrets.Backend = "gcp"
+	}
 	if c.DeployIntervalS == 0 {
 		c.DeployIntervalS = 15
 	}
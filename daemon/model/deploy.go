@@ -15,6 +15,8 @@ const (
 type Deploy struct {
 	App         string `json:"app"`
 	Version     string `json:"version"`
+	Restart     bool   `json:"restart"`     // restart only; nothing is installed and Version is unused
+	RequestedBy string `json:"requestedBy"` // principal the caller says the action is on behalf of; unverified
 	RequestedAt int64  `json:"requestedAt"`
 	StartedAt   int64  `json:"startedAt"`
 	CompletedAt int64  `json:"completedAt"`
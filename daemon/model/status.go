@@ -2,6 +2,7 @@ package model
 
 import (
 	"sync"
+	"time"
 )
 
 type Status struct {
@@ -10,8 +11,9 @@ type Status struct {
 }
 
 type StatusCache struct {
-	mutex    sync.RWMutex
-	statuses map[string]Status
+	mutex       sync.RWMutex
+	statuses    map[string]Status
+	collectedAt time.Time // when collection of the current statuses began
 }
 
 func NewStatusCache() *StatusCache {
@@ -31,9 +33,22 @@ func (sc *StatusCache) GetStatuses() map[string]Status {
 }
 
 func (sc *StatusCache) SetStatuses(newStatuses map[string]Status) {
+	sc.SetStatusesCollectedAt(newStatuses, time.Now())
+}
+
+// Set statuses whose collection began at collectedAt, so readers can tell whether they reflect some earlier change
+func (sc *StatusCache) SetStatusesCollectedAt(newStatuses map[string]Status, collectedAt time.Time) {
 	sc.mutex.Lock()
 	defer sc.mutex.Unlock()
 	sc.statuses = newStatuses
+	sc.collectedAt = collectedAt
+}
+
+// When collection of the current statuses began; zero if there are none yet
+func (sc *StatusCache) CollectedAt() time.Time {
+	sc.mutex.RLock()
+	defer sc.mutex.RUnlock()
+	return sc.collectedAt
 }
 
 type Versions struct {
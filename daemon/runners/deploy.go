@@ -20,14 +20,12 @@ import (
 
 	apiconfig "github.com/arryved/app-ctrl/api/config"
 	productconfig "github.com/arryved/app-ctrl/api/config/product"
-	"github.com/arryved/app-ctrl/api/gce"
-	secrets "github.com/arryved/app-ctrl/api/secrets"
 	"github.com/arryved/app-ctrl/daemon/cli"
 	"github.com/arryved/app-ctrl/daemon/config"
 	"github.com/arryved/app-ctrl/daemon/model"
 )
 
-func DeployRunner(cfg *config.Config, secretsClient secrets.SecretManagerClient, cache *model.DeployCache, executor *cli.Executor) {
+func DeployRunner(cfg *config.Config, secretStore *SecretStore, cache *model.DeployCache, executor *cli.Executor) {
 	for {
 		// insert pause to prevent hard busy-wait
 		log.Debugf("Deploy runner going to sleep for %d seconds", cfg.DeployIntervalS)
@@ -44,13 +42,29 @@ func DeployRunner(cfg *config.Config, secretsClient secrets.SecretManagerClient,
 		// construct targets from deploys list
 		log.Debug("Construct targets from deploys list")
 		aptTargets := []string{}
+		restartTargets := []string{}
 		for _, deploy := range deploys {
 			if deploy.CompletedAt == 0 {
-				aptTargets = append(aptTargets, fmt.Sprintf("%s=%s", deploy.App, deploy.Version))
+				if deploy.Restart {
+					restartTargets = append(restartTargets, deploy.App)
+				} else {
+					log.Infof("Deploy target app=%s version=%s requestedBy=%s", deploy.App, deploy.Version, deploy.RequestedBy)
+					aptTargets = append(aptTargets, fmt.Sprintf("%s=%s", deploy.App, deploy.Version))
+				}
 				cache.MarkDeployStart(deploy.App)
 			}
 		}
 
+		// Restarts don't touch packages or config, so handle them on their own ahead of the apt batch
+		for _, app := range restartTargets {
+			log.Infof("Restarting app=%s requestedBy=%s", app, deploys[app].RequestedBy)
+			err := RestartApp(executor, cfg.AppDefs[app], app)
+			log.Infof("Restart finished app=%s err=%v", app, err)
+			if !cache.MarkDeployComplete(app, err) {
+				log.Warnf("Unexpected failure to mark restart as completed app=%s, cache=%v", app, cache.GetDeploys())
+			}
+		}
+
 		// Restart loop/go back to sleep if no targets
 		if len(aptTargets) == 0 {
 			log.Debug("No deploy targets, so nothing to do")
@@ -71,7 +85,7 @@ func DeployRunner(cfg *config.Config, secretsClient secrets.SecretManagerClient,
 		//       per machine. If batching is causing problems, reduce cfg.DeployIntervalS and/or
 		//       add splay when kicking off multiple app deployments.
 		log.Infof("Deploying the latest desired app=version set=%v", aptTargets)
-		err := aptInstallAndRestart(cfg, secretsClient, aptTargets, executor)
+		err := aptInstallAndRestart(cfg, secretStore, aptTargets, executor)
 		log.Infof("Deploy finished; err=%v", err)
 
 		// Unset OOR for all targets (generally safe since the LB won't add the node back if the health check fails)
@@ -96,7 +110,7 @@ func targetComponents(target string) (string, string) {
 	return list[0], list[1]
 }
 
-func aptInstallAndRestart(cfg *config.Config, secretsClient secrets.SecretManagerClient, aptTargets []string, executor *cli.Executor) error {
+func aptInstallAndRestart(cfg *config.Config, secretStore *SecretStore, aptTargets []string, executor *cli.Executor) error {
 	log.Infof("Installing and restarting apt package for targets=%v", aptTargets)
 	err := cli.AptUpdate(executor)
 	if err != nil {
@@ -112,7 +126,7 @@ func aptInstallAndRestart(cfg *config.Config, secretsClient secrets.SecretManage
 		return fmt.Errorf(msg)
 	}
 
-	err = pullAndMergeConfigs(executor, cfg, secretsClient, aptTargets)
+	err = pullAndMergeConfigs(executor, cfg, secretStore, aptTargets)
 	if err != nil {
 		msg := fmt.Sprintf("Pull or merge of one or more configs failed err=%v", err)
 		log.Errorf(msg)
@@ -135,7 +149,7 @@ func aptInstallAndRestart(cfg *config.Config, secretsClient secrets.SecretManage
 	return nil
 }
 
-func pullAndMergeConfigs(executor *cli.Executor, cfg *config.Config, secretsClient secrets.SecretManagerClient, targets []string) error {
+func pullAndMergeConfigs(executor *cli.Executor, cfg *config.Config, secretStore *SecretStore, targets []string) error {
 	log.Infof("Pulling and merging configs for targets=%v", targets)
 	for _, target := range targets {
 		// get clusterId from VM metadata
@@ -203,7 +217,7 @@ func pullAndMergeConfigs(executor *cli.Executor, cfg *config.Config, secretsClie
 			return fmt.Errorf(msg)
 		}
 		// Extract files (anything not included in tarball has either inline contents or a secret urn
-		err = extractFiles(executor, secretsClient, targetPath)
+		err = extractFiles(executor, secretStore, targetPath)
 		if err != nil {
 			msg := fmt.Sprintf("error extracting files from config err=%s", err.Error())
 			return fmt.Errorf(msg)
@@ -212,18 +226,7 @@ func pullAndMergeConfigs(executor *cli.Executor, cfg *config.Config, secretsClie
 	return nil
 }
 
-func extractFiles(executor *cli.Executor, secretsClient secrets.SecretManagerClient, targetPath string) error {
-	// get projectId for secrets fetching
-	projectIdBytes, err := getMetadata("project/project-id")
-	if err != nil {
-		return fmt.Errorf("metadata fetch failed for project/project-id err=%s", err.Error())
-	}
-	projectNumber, err := gce.GetProjectNumber(string(projectIdBytes))
-	if err != nil {
-		return fmt.Errorf("error getting a project number: err=%s", err.Error())
-	}
-	log.Debugf("project number=%s", projectNumber)
-
+func extractFiles(executor *cli.Executor, secretStore *SecretStore, targetPath string) error {
 	// read in config yaml
 	configFilePath := filepath.Join(targetPath, "config.yaml")
 	yamlBytes, err := ioutil.ReadFile(configFilePath)
@@ -250,33 +253,32 @@ func extractFiles(executor *cli.Executor, secretsClient secrets.SecretManagerCli
 		filesMap = files.Value.(map[string]productconfig.Schemaless)
 	}
 	log.Debugf("filesMap=%v", filesMap)
+	lookup := func(secretId string) ([]byte, error) {
+		store, err := secretStore.Get(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("could not get a secret store err=%s", err.Error())
+		}
+		return store.Read(context.Background(), secretId, "latest")
+	}
 	for relativePath, value := range filesMap {
 		content := value.Value.(string)
 		outPath := filepath.Join(tmpDir, relativePath)
 		log.Infof("outPath=%s content=(%s)", outPath, content)
-		secretMatcher := regexp.MustCompile(`\$\{urn:arryved:secret:(.+)\}`)
-		match := secretMatcher.FindStringSubmatch(content)
-		if len(match) > 0 {
-			// in this case, try to fetch the secret at the urn and write it to the file
-			secretId := match[1]
-			secretBytes, err := secrets.SecretRead(context.Background(), secretsClient, projectNumber, secretId)
-			if err != nil {
-				log.Warnf("failed to fetch secretId=%s, files extract is incomplete, err=%s", secretId, err.Error())
-				continue
-			}
-			err = writeToFile(executor, outPath, targetPath, secretBytes)
-			if err != nil {
-				log.Warnf("failed to write secretId=%s to file=%s, files extract is incomplete, err=%s", secretId, outPath, err.Error())
-				continue
-			}
-			log.Infof("dumped secret=%s to path=%s", secretId, outPath)
+		// either inline content, or a template of secret references (whole values, or keys of JSON values)
+		contents, err := productconfig.RenderFile(content, lookup)
+		if err != nil {
+			log.Warnf("failed to resolve secrets for file=%s, files extract is incomplete, err=%s", outPath, err.Error())
+			continue
+		}
+		err = writeToFile(executor, outPath, targetPath, contents)
+		if err != nil {
+			log.Warnf("failed to write value to file=%s, files extract is incomplete, err=%s", outPath, err.Error())
+			continue
+		}
+		refs := productconfig.ParseSecretRefs(content)
+		if len(refs) > 0 {
+			log.Infof("dumped %d secret references to path=%s", len(refs), outPath)
 		} else {
-			// in this case, just write the inline content to the file
-			err := writeToFile(executor, outPath, targetPath, []byte(content))
-			if err != nil {
-				log.Warnf("failed to write value to file=%s, files extract is incomplete, err=%s", outPath, err.Error())
-				continue
-			}
 			log.Infof("dumped inline value to path=%s", outPath)
 		}
 	}
@@ -10,7 +10,8 @@ import (
 
 const oorFilename = ".oor"
 
-func isOOR(appDef config.AppDef) bool {
+// Whether the app's OOR file is on disk
+func IsOOR(appDef config.AppDef) bool {
 	root := appDef.AppRoot
 	path := fmt.Sprintf("%s/%s", root, oorFilename)
 	_, err := os.Stat(path)
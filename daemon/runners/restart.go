@@ -0,0 +1,44 @@
+package runners
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/daemon/cli"
+	"github.com/arryved/app-ctrl/daemon/config"
+)
+
+// Restart an app's service, taking it out of rotation for the duration. If the app was already OOR (e.g. an
+// operator pulled it), it's left that way afterward.
+func RestartApp(executor cli.GenericExecutor, appDef config.AppDef, app string) error {
+	wasOOR := IsOOR(appDef)
+	if !wasOOR {
+		err := SetOOR(executor, appDef)
+		if err != nil {
+			msg := fmt.Sprintf("could not set OOR before restart app=%s err=%v", app, err)
+			log.Error(msg)
+			return fmt.Errorf(msg)
+		}
+	} else {
+		log.Infof("app=%s already OOR, will leave it OOR after restart", app)
+	}
+
+	restartErr := cli.SystemdRestart(executor, []string{app})
+	if restartErr != nil {
+		restartErr = fmt.Errorf("Systemd restart failed err=%v", restartErr)
+		log.Error(restartErr)
+	}
+
+	// unset OOR even when the restart failed; the LB won't add the node back if the health check fails
+	if !wasOOR {
+		err := UnsetOOR(executor, appDef)
+		if err != nil {
+			log.Warnf("could not unset OOR after restart app=%s err=%v", app, err)
+			if restartErr == nil {
+				return fmt.Errorf("could not unset OOR after restart err=%v", err)
+			}
+		}
+	}
+	return restartErr
+}
@@ -0,0 +1,30 @@
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/daemon/cli"
+	"github.com/arryved/app-ctrl/daemon/config"
+)
+
+func TestRestartApp(t *testing.T) {
+	assert := assert.New(t)
+	appDef := config.AppDef{AppRoot: t.TempDir()}
+
+	// in rotation: OOR is set and then unset around the restart, so rm is the last command run
+	executor := &cli.MockExecutor{}
+	assert.NoError(RestartApp(executor, appDef, "arryved-api"))
+	assert.Contains(executor.Args, "/usr/bin/rm")
+	assert.Contains(executor.Args, filepath.Join(appDef.AppRoot, ".oor"))
+	assert.NotContains(executor.Args, "restart")
+
+	// already OOR: left alone, so the restart is the last command run
+	assert.NoError(os.WriteFile(filepath.Join(appDef.AppRoot, ".oor"), []byte{}, 0644))
+	executor = &cli.MockExecutor{}
+	assert.NoError(RestartApp(executor, appDef, "arryved-api"))
+	assert.Contains(executor.Args, "restart")
+}
@@ -0,0 +1,77 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/arryved/app-ctrl/api/gce"
+	secrets "github.com/arryved/app-ctrl/api/secrets"
+	"github.com/arryved/app-ctrl/daemon/config"
+)
+
+// The store the secrets in app config files are read from, per cfg.Secrets.Backend. It's set up on first use rather
+// than at startup, so a metadata or network hiccup only fails the extract that needed it (the next one tries again)
+// instead of keeping app-controld, and its status reporting, from starting.
+type SecretStore struct {
+	cfg   *config.Config
+	mutex sync.Mutex
+	store secrets.Store
+}
+
+func NewSecretStore(cfg *config.Config) *SecretStore {
+	return &SecretStore{cfg: cfg}
+}
+
+// The store, set up now if it hasn't been yet
+func (s *SecretStore) Get(ctx context.Context) (secrets.Store, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.store != nil {
+		return s.store, nil
+	}
+	store, err := newSecretStore(ctx, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	return store, nil
+}
+
+func (s *SecretStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.store == nil {
+		return nil
+	}
+	return s.store.Close()
+}
+
+// A store per cfg.Secrets.Backend; for gcp, that's Secret Manager in this host's project
+func newSecretStore(ctx context.Context, cfg *config.Config) (secrets.Store, error) {
+	switch cfg.Secrets.Backend {
+	case "gcp":
+		projectId, err := getMetadata("project/project-id")
+		if err != nil {
+			return nil, fmt.Errorf("metadata fetch failed for project/project-id err=%s", err.Error())
+		}
+		projectNumber, err := gce.GetProjectNumber(projectId)
+		if err != nil {
+			return nil, fmt.Errorf("error getting a project number: err=%s", err.Error())
+		}
+		log.Debugf("project number=%s", projectNumber)
+		client, err := secretmanager.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting a secret client: err=%s", err.Error())
+		}
+		return secrets.NewGCPStore(client, projectNumber, nil), nil
+	case "local":
+		log.Infof("reading secrets from local store path=%s", cfg.Secrets.Path)
+		return secrets.NewLocalStore(cfg.Secrets.Path, cfg.Secrets.MasterKeyPath)
+	default:
+		return nil, fmt.Errorf("unknown secrets backend=%s", cfg.Secrets.Backend)
+	}
+}
@@ -0,0 +1,38 @@
+package runners
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/arryved/app-ctrl/daemon/config"
+)
+
+func TestSecretStoreSetUpOnFirstUse(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &config.Config{}
+	cfg.Secrets.Backend = "local"
+	cfg.Secrets.Path = t.TempDir()
+	cfg.Secrets.MasterKeyPath = filepath.Join(t.TempDir(), "master.key")
+
+	// nothing's set up until it's needed, and a store that can't be set up yet fails just that use
+	secretStore := NewSecretStore(cfg)
+	_, err := secretStore.Get(context.Background())
+	assert.Error(err)
+
+	// the next use tries again
+	key := make([]byte, 32)
+	rand.Read(key)
+	assert.NoError(os.WriteFile(cfg.Secrets.MasterKeyPath, []byte(base64.StdEncoding.EncodeToString(key)), 0600))
+	store, err := secretStore.Get(context.Background())
+	assert.NoError(err)
+	again, err := secretStore.Get(context.Background())
+	assert.NoError(err)
+	assert.Same(store, again)
+	assert.NoError(secretStore.Close())
+}
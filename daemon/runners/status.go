@@ -17,6 +17,7 @@ import (
 func StatusRunner(cfg *config.Config, cache *model.StatusCache) {
 	for {
 		// get the latest values
+		collectedAt := time.Now()
 		statuses, err := GetStatuses(cfg)
 		if err != nil {
 			log.Errorf("error getting statuses: %v", err)
@@ -27,7 +28,7 @@ func StatusRunner(cfg *config.Config, cache *model.StatusCache) {
 
 		// update the cache
 		log.Debugf("Updating the cache")
-		cache.SetStatuses(statuses)
+		cache.SetStatusesCollectedAt(statuses, collectedAt)
 
 		// insert pause to prevent hard busy-wait
 		log.Debug("status runner sleeping")
@@ -86,7 +87,7 @@ func runHealthChecks(appDef config.AppDef) []model.HealthResult {
 		return results
 	}
 
-	oor := isOOR(appDef)
+	oor := IsOOR(appDef)
 
 	for i := range appDef.Healthz {
 		result := healthz.Check(appDef.Healthz[i])
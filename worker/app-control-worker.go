@@ -45,12 +45,18 @@ func main() {
 		panic(msg)
 	}
 	jobQueue := queue.NewQueue(cfg.Queue, client)
+	jobStore, err := queue.NewJobStore(cfg.JobStore)
+	if err != nil {
+		msg := fmt.Sprintf("Could not get job store, err=%s", err.Error())
+		log.Error(msg)
+		panic(msg)
+	}
 	gceClient := gce.NewClient(cfg.Env)
 
 	// TODO - ship logs to fluentd/log aggregation
 	// TODO - collect and expose metrics
 
 	// start app-control-worker thread(s)
-	worker := worker.New(cfg, jobQueue, gceClient)
+	worker := worker.New(cfg, jobQueue, jobStore, gceClient)
 	worker.Start()
 }
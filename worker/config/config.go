@@ -32,14 +32,22 @@ type Config struct {
 	// Config for work queue client
 	Queue apiconfig.QueueConfig `yaml:"queue"`
 
+	// Config for the job record store; should match the API's
+	JobStore apiconfig.JobStoreConfig `yaml:"jobStore"`
+
 	// Google Service Account Key Path
 	ServiceAccountKeyPath string `yaml:"serviceAccountKeyPath"`
 
 	// Name of template is key, root path containing templates is value
 	AppTemplates map[string]string `yaml:"appTemplates"`
 
-	// Whether or not to keep temp directory of generated files/config; useful for debugging
+	// Whether or not to keep temp directory of generated files/config; useful for debugging. Generated resources
+	// include the rendered files section, secret values and all.
 	KeepTempDir bool `yaml:"keepTempDir"`
+
+	// Secret store the files section's secret references are resolved from when generating k8s resources; same
+	// settings as the API's, applied to this worker's env
+	Secrets apiconfig.SecretsConfig `yaml:"secrets"`
 }
 
 func (c *Config) setDefaults() {
@@ -61,9 +69,15 @@ func (c *Config) setDefaults() {
 	if c.KubeConfigPath == "" {
 		c.KubeConfigPath = "/usr/local/etc/app-control-api-kubeconfig.yml"
 	}
+	if c.JobStore.Prefix == "" {
+		c.JobStore.Prefix = "jobs"
+	}
 	if c.MaxJobThreads == 0 {
 		c.MaxJobThreads = 8
 	}
+	if c.Secrets.Backend == "" {
+		c.Secrets.Backend = "gcp"
+	}
 	if c.ServiceAccountKeyPath == "" {
 		c.ServiceAccountKeyPath = "/usr/local/etc/app-control-api-svc-acct-key.json"
 	}
@@ -2,6 +2,7 @@ package gke
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -15,8 +16,10 @@ import (
 
 	compute "cloud.google.com/go/compute/apiv1"
 	log "github.com/sirupsen/logrus"
+	apiconfig "github.com/arryved/app-ctrl/api/config"
 	productconfig "github.com/arryved/app-ctrl/api/config/product"
 	"github.com/arryved/app-ctrl/api/queue"
+	"github.com/arryved/app-ctrl/api/secrets"
 	"github.com/arryved/app-ctrl/worker/config"
 	"google.golang.org/api/iterator"
 	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
@@ -30,10 +33,23 @@ type AppTemplateParams struct {
 	GCPProjectId      string
 	GKEServiceAccount string
 	PreSharedCert     string
-	Secrets           []string
+	Secrets           []string       // ids of the secrets the files section references, mounted whole by the CSI driver
+	Files             []RenderedFile // the files section with secret references resolved
 	Version           string
 }
 
+// One entry of the files section, as a key of the app's files Secret
+type RenderedFile struct {
+	Key     string // Secret data key; paths can't be keys, so entries are numbered
+	Path    string // relative path the file is mounted at
+	Content string // base64
+}
+
+// the env's secret store, for resolving the files section; a var so tests can swap it out
+var newSecretStore = func(ctx context.Context, cfg *config.Config) (secrets.Store, error) {
+	return secrets.NewEnvStore(ctx, &apiconfig.Config{Secrets: cfg.Secrets}, cfg.Env)
+}
+
 var projectIdByEnv = map[string]string{
 	"cde":       "676200789565",
 	"dev":       "676571955389",
@@ -71,10 +87,17 @@ func GenerateFromTemplate(cfg *config.Config, compiledConfigPath, arryvedDir str
 		return err
 	}
 
+	secretIds, files, err := renderFiles(context.Background(), cfg, appConfig)
+	if err != nil {
+		err = fmt.Errorf("could not render files for appName=%s config dir=%s err=%s", appName, configDir, err.Error())
+		log.Error(err)
+		return err
+	}
+
 	switch kind {
 	case productconfig.KindOnline:
 		if templatePath, ok := templateMap[string(kind)]; ok {
-			err = generateOnlineResources(env, templatePath, arryvedDir, compiledConfigPath, request.Version, gkeServiceAccount, appConfig)
+			err = generateOnlineResources(env, templatePath, arryvedDir, compiledConfigPath, request.Version, gkeServiceAccount, appConfig, secretIds, files)
 		} else {
 			err = fmt.Errorf("could not find template for appName=%s config dir=%s, kind=%s", appName, configDir, kind)
 		}
@@ -90,7 +113,7 @@ func GenerateFromTemplate(cfg *config.Config, compiledConfigPath, arryvedDir str
 	return err
 }
 
-func generateOnlineResources(env, templatePath, arryvedDir, compiledConfigPath, version, gkeServiceAccount string, appConfig productconfig.AppConfig) error {
+func generateOnlineResources(env, templatePath, arryvedDir, compiledConfigPath, version, gkeServiceAccount string, appConfig productconfig.AppConfig, secretIds []string, appFiles []RenderedFile) error {
 	k8sDir := fmt.Sprintf("%s/.gke/%s", arryvedDir, env)
 	controlScriptPath := fmt.Sprintf("%s/control", arryvedDir)
 	log.Infof("rendered resources will be in k8sDir=%s", k8sDir)
@@ -133,13 +156,15 @@ func generateOnlineResources(env, templatePath, arryvedDir, compiledConfigPath,
 		Version:           version,
 		GKEServiceAccount: gkeServiceAccount,
 		GCPProjectId:      getGCPProjectId(env),
-		Secrets:           []string{"dummy"},
+		Secrets:           secretIds,
+		Files:             appFiles,
 		PreSharedCert:     preSharedCert,
 	}
 
 	// set up any in-template util functions
 	funcMap := template.FuncMap{
 		"tolower": strings.ToLower,
+		"quote":   escapeYamlString,
 	}
 
 	for _, file := range files {
@@ -168,6 +193,73 @@ func generateOnlineResources(env, templatePath, arryvedDir, compiledConfigPath,
 	return nil
 }
 
+// Resolve the files section the way app-controld does on GCE: inline values as they are, secret references (whole
+// values, or keys of JSON values) filled in from cfg's secret store. Unlike there, a secret that can't be resolved
+// fails the generation rather than leaving the file out. Also returns the referenced secret ids; with none, there's
+// a placeholder so the SecretProviderClass isn't empty.
+func renderFiles(ctx context.Context, cfg *config.Config, appConfig productconfig.AppConfig) ([]string, []RenderedFile, error) {
+	filesMap := map[string]productconfig.Schemaless{}
+	if files, ok := appConfig.Other["files"]; ok {
+		filesMap, ok = files.Value.(map[string]productconfig.Schemaless)
+		if !ok {
+			return nil, nil, fmt.Errorf("files is not a map")
+		}
+	}
+	paths := []string{}
+	for path := range filesMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// only the ids are needed up front, so the store isn't opened for configs without references
+	secretIds := []string{}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		content, _ := filesMap[path].Value.(string)
+		for _, ref := range productconfig.ParseSecretRefs(content) {
+			if !seen[ref.Id] {
+				seen[ref.Id] = true
+				secretIds = append(secretIds, ref.Id)
+			}
+		}
+	}
+	lookup := func(secretId string) ([]byte, error) {
+		return nil, fmt.Errorf("no secret store")
+	}
+	if len(secretIds) > 0 {
+		store, err := newSecretStore(ctx, cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not get a secret store err=%s", err.Error())
+		}
+		defer store.Close()
+		lookup = func(secretId string) ([]byte, error) {
+			return store.Read(ctx, secretId, "latest")
+		}
+	}
+
+	files := []RenderedFile{}
+	for i, path := range paths {
+		content, ok := filesMap[path].Value.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("file=%s is not a string", path)
+		}
+		contents, err := productconfig.RenderFile(content, lookup)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not render file=%s err=%s", path, err.Error())
+		}
+		files = append(files, RenderedFile{
+			Key:     fmt.Sprintf("file-%d", i),
+			Path:    path,
+			Content: base64.StdEncoding.EncodeToString(contents),
+		})
+	}
+	log.Infof("rendered %d files referencing secrets=%v", len(files), secretIds)
+	if len(secretIds) == 0 {
+		secretIds = []string{"dummy"}
+	}
+	return secretIds, files, nil
+}
+
 func escapeYamlString(s string) string {
 	// Escape special characters for YAML
 	replacer := strings.NewReplacer(
@@ -1,7 +1,18 @@
 package gke
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	productconfig "github.com/arryved/app-ctrl/api/config/product"
+	"github.com/arryved/app-ctrl/api/secrets"
+	"github.com/arryved/app-ctrl/worker/config"
 )
 
 func TestGenerateFromTemplate(t *testing.T) {}
@@ -11,3 +22,51 @@ func TestGenerateFromTemplate(t *testing.T) {}
 // render cron kind
 
 // render stateful kind
+
+func TestRenderFiles(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	key := make([]byte, 32)
+	rand.Read(key)
+	keyPath := filepath.Join(t.TempDir(), "master.key")
+	assert.NoError(os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)), 0600))
+	store, err := secrets.NewLocalStore(t.TempDir(), keyPath)
+	assert.NoError(err)
+	owners := secrets.Owners{Groups: []string{"team@arryved.com"}}
+	assert.NoError(store.Create(ctx, "db-creds", []byte(`{"user": "pay", "password": "hunter2"}`), owners, secrets.SecretRotation{}))
+	assert.NoError(store.Create(ctx, "api-key", []byte("abc123"), owners, secrets.SecretRotation{}))
+	opened := 0
+	originalNewSecretStore := newSecretStore
+	defer func() { newSecretStore = originalNewSecretStore }()
+	newSecretStore = func(ctx context.Context, cfg *config.Config) (secrets.Store, error) {
+		opened++
+		return store, nil
+	}
+
+	appConfig, err := productconfig.ParseYaml([]byte("files:\n  conf/db.properties: |\n    user=${urn:arryved:secret:db-creds#user}\n    password=${urn:arryved:secret:db-creds#password}\n  conf/api.key: ${urn:arryved:secret:api-key}\n  conf/motd: hello\n"))
+	assert.NoError(err)
+	secretIds, files, err := renderFiles(ctx, &config.Config{}, *appConfig)
+	assert.NoError(err)
+	assert.Equal([]string{"api-key", "db-creds"}, secretIds)
+	assert.Equal([]RenderedFile{
+		{Key: "file-0", Path: "conf/api.key", Content: base64.StdEncoding.EncodeToString([]byte("abc123"))},
+		{Key: "file-1", Path: "conf/db.properties", Content: base64.StdEncoding.EncodeToString([]byte("user=pay\npassword=hunter2\n"))},
+		{Key: "file-2", Path: "conf/motd", Content: base64.StdEncoding.EncodeToString([]byte("hello"))},
+	}, files)
+
+	// a missing key fails the generation
+	appConfig, err = productconfig.ParseYaml([]byte("files:\n  conf/db.pw: ${urn:arryved:secret:db-creds#pw}\n"))
+	assert.NoError(err)
+	_, _, err = renderFiles(ctx, &config.Config{}, *appConfig)
+	assert.Error(err)
+
+	// without references the store isn't needed
+	opened = 0
+	appConfig, err = productconfig.ParseYaml([]byte("files:\n  conf/motd: hello\n"))
+	assert.NoError(err)
+	secretIds, files, err = renderFiles(ctx, &config.Config{}, *appConfig)
+	assert.NoError(err)
+	assert.Equal([]string{"dummy"}, secretIds)
+	assert.Len(files, 1)
+	assert.Equal(0, opened)
+}
@@ -19,10 +19,21 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// The k8s client for kubeconfigPath; a var so tests can substitute a fake clientset
+var newK8sClient = func(kubeconfigPath string) (kubernetes.Interface, error) {
+	return createK8sClient(kubeconfigPath)
+}
+
 func LoadDeployYaml(resourceDir string) ([][]byte, error) {
+	return loadYamlOfKinds(resourceDir, "Deployment", "StatefulSet")
+}
+
+// Load the yamls in resourceDir whose objects are one of kinds
+func loadYamlOfKinds(resourceDir string, kinds ...string) ([][]byte, error) {
 	// list of yaml files in specified path
 	files, err := ioutil.ReadDir(resourceDir)
 	if err != nil {
@@ -52,8 +63,10 @@ func LoadDeployYaml(resourceDir string) ([][]byte, error) {
 				return nil, err
 			}
 			objKind := obj.GetObjectKind().GroupVersionKind().Kind
-			if objKind == "Deployment" || objKind == "StatefulSet" {
-				yamls = append(yamls, data)
+			for _, kind := range kinds {
+				if objKind == kind {
+					yamls = append(yamls, data)
+				}
 			}
 		}
 	}
@@ -61,11 +74,79 @@ func LoadDeployYaml(resourceDir string) ([][]byte, error) {
 	return yamls, nil
 }
 
+// Apply the resources a deployment depends on, i.e. the Secrets in resourceDir (like the app's files), so they're in
+// place before its pods roll
+func ApplySupportingResources(kubeconfigPath, resourceDir string) error {
+	secretYamls, err := loadYamlOfKinds(resourceDir, "Secret")
+	if err != nil {
+		return err
+	}
+	log.Debugf("%d k8s secrets loaded", len(secretYamls))
+	if len(secretYamls) == 0 {
+		return nil
+	}
+
+	clientset, err := newK8sClient(kubeconfigPath)
+	if err != nil {
+		err = fmt.Errorf("could not create k8s client err=%s", err.Error())
+		log.Error(err)
+		return err
+	}
+	for _, secretYaml := range secretYamls {
+		secret, err := DecodeYAMLToSecret(secretYaml)
+		if err != nil {
+			err = fmt.Errorf("error while decoding secret object err=%s", err.Error())
+			log.Error(err)
+			return err
+		}
+		err = applySecretObject(clientset, secret)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create the secret, or replace the data of the existing one
+func applySecretObject(clientset kubernetes.Interface, secret *apiv1.Secret) error {
+	secretsClient := clientset.CoreV1().Secrets(apiv1.NamespaceDefault)
+
+	// check status. if doesn't exist Create else Update
+	existing, err := secretsClient.Get(context.TODO(), secret.Name, metav1.GetOptions{})
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			err = fmt.Errorf("unhandled error getting secret name=%s err=%s", secret.Name, err.Error())
+			log.Error(err)
+			return err
+		}
+		log.Infof("secret doesn't exist yet; creating secret name=%s", secret.Name)
+		_, err = secretsClient.Create(context.TODO(), secret, metav1.CreateOptions{})
+		if err != nil {
+			err = fmt.Errorf("could not create secret name=%s err=%s", secret.Name, err.Error())
+			log.Error(err)
+			return err
+		}
+		log.Infof("created secret name=%s", secret.Name)
+		return nil
+	}
+
+	log.Infof("secret already exists; updating secret name=%s", secret.Name)
+	secret.ResourceVersion = existing.ResourceVersion
+	_, err = secretsClient.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	if err != nil {
+		err = fmt.Errorf("could not update secret name=%s err=%s", secret.Name, err.Error())
+		log.Error(err)
+		return err
+	}
+	log.Infof("secret update succeeded name=%s", secret.Name)
+	return nil
+}
+
 func ApplyDeployObject(kubeconfigPath string, deployment *v1.Deployment) error {
 	log.Infof("apply/restart deploy object kubeconfig=%s", kubeconfigPath)
 
 	// build a k8s clientset
-	clientset, err := createK8sClient(kubeconfigPath)
+	clientset, err := newK8sClient(kubeconfigPath)
 	if err != nil {
 		err = fmt.Errorf("could not create k8s client err=%s", err.Error())
 		log.Error(err)
@@ -106,33 +187,76 @@ func ApplyDeployObject(kubeconfigPath string, deployment *v1.Deployment) error {
 		}
 		log.Infof("deployment update succeeded name=%s", deployment.Name)
 		// Rolling Restart via patch, in case it didn't happen as a consequence of the update; deploy implies at least one restart
-		timestamp := time.Now().Format(time.RFC3339)
-		patch := []byte(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"` + timestamp + `"}}}}}`)
-		_, err = deploymentsClient.Patch(context.TODO(), deployment.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		err = rollingRestart(deploymentsClient, deployment.Name)
 		if err != nil {
-			err = fmt.Errorf("could not patch deployment for rolling restart name=%s err=%s", deployment.Name, err.Error())
-			log.Error(err)
 			return err
 		}
-		log.Infof("deployment patch for rolling update succeeded name=%s", deployment.Name)
 	}
 
+	return waitForSettle(clientset, deployment.Name)
+}
+
+// Restart an existing deployment's pods without changing its spec, the same as `kubectl rollout restart`
+func RestartDeployment(kubeconfigPath, name string) error {
+	log.Infof("restart deploy object name=%s kubeconfig=%s", name, kubeconfigPath)
+
+	clientset, err := newK8sClient(kubeconfigPath)
+	if err != nil {
+		err = fmt.Errorf("could not create k8s client err=%s", err.Error())
+		log.Error(err)
+		return err
+	}
+	deploymentsClient := clientset.AppsV1().Deployments(apiv1.NamespaceDefault)
+
+	// a restart only makes sense for something that's already deployed
+	_, err = deploymentsClient.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		err = fmt.Errorf("could not get deployment for restart name=%s err=%s", name, err.Error())
+		log.Error(err)
+		return err
+	}
+
+	err = rollingRestart(deploymentsClient, name)
+	if err != nil {
+		return err
+	}
+	return waitForSettle(clientset, name)
+}
+
+// Trigger a rolling restart by bumping the pod template's restartedAt annotation
+func rollingRestart(deploymentsClient typedappsv1.DeploymentInterface, name string) error {
+	timestamp := time.Now().Format(time.RFC3339)
+	patch := []byte(`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"` + timestamp + `"}}}}}`)
+	_, err := deploymentsClient.Patch(context.TODO(), name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		err = fmt.Errorf("could not patch deployment for rolling restart name=%s err=%s", name, err.Error())
+		log.Error(err)
+		return err
+	}
+	log.Infof("deployment patch for rolling update succeeded name=%s", name)
+	return nil
+}
+
+// How long waitForSettle holds off before, and then between, checks of the deployment's pods
+var settleDelay, settlePollInterval = 3 * time.Second, 5 * time.Second
+
+// Wait for the deployment's pods to settle i.e. they're in some perm/semi-perm state
+func waitForSettle(clientset kubernetes.Interface, name string) error {
 	// account for hysteresis to avoid false positive for brief initial Running states
-	time.Sleep(3 * time.Second)
+	time.Sleep(settleDelay)
 
-	// wait for deploy status to settle i.e. pods are in some perm/semi-perm state
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(settlePollInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			err = fmt.Errorf("timeout expired waiting for cluster status")
+			err := fmt.Errorf("timeout expired waiting for cluster status")
 			log.Error(err)
 			return err
 		case <-ticker.C:
-			clusterStatus, err := getClusterStatus(clientset, deployment.Name)
+			clusterStatus, err := getClusterStatus(clientset, name)
 			if err != nil {
 				err = fmt.Errorf("error getting cluster status err=%s", err.Error())
 				log.Error(err)
@@ -147,7 +271,7 @@ func ApplyDeployObject(kubeconfigPath string, deployment *v1.Deployment) error {
 	}
 }
 
-func getClusterStatus(k8sClient *kubernetes.Clientset, deploymentName string) (bool, error) {
+func getClusterStatus(k8sClient kubernetes.Interface, deploymentName string) (bool, error) {
 	podsClient := k8sClient.CoreV1().Pods("")
 	pods, err := podsClient.List(context.TODO(), metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("app=%s", deploymentName),
@@ -210,3 +334,16 @@ func DecodeYAMLToDeployment(yamlData []byte) (*v1.Deployment, error) {
 	}
 	return &deployment, nil
 }
+
+func DecodeYAMLToSecret(yamlData []byte) (*apiv1.Secret, error) {
+	dec := serializer.NewCodecFactory(scheme.Scheme).UniversalDeserializer()
+	obj, _, err := dec.Decode(yamlData, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding YAML: %v", err)
+	}
+	secret, ok := obj.(*apiv1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("decoded object is not a *v1.Secret")
+	}
+	return secret, nil
+}
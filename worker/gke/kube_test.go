@@ -1,12 +1,103 @@
 package gke
 
 import (
-	"github.com/stretchr/testify/assert"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
 	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	productconfig "github.com/arryved/app-ctrl/api/config/product"
 )
 
-func TestNoop(t *testing.T) {
+const testDeploymentYaml = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: pay
+spec:
+  template:
+    spec:
+      containers:
+      - name: pay
+        image: pay:1.0.0
+`
+
+// render the online files template into resourceDir alongside a deployment
+func writeOnlineResources(t *testing.T, resourceDir string, files []RenderedFile) {
+	templatePath := "../templates/online/files.yaml.tmpl"
+	tmpl, err := template.New(filepath.Base(templatePath)).ParseFiles(templatePath)
+	assert.NoError(t, err)
+	output, err := os.Create(filepath.Join(resourceDir, "files.yaml"))
+	assert.NoError(t, err)
+	defer output.Close()
+	params := AppTemplateParams{AppConfig: productconfig.AppConfig{Name: "pay"}, Files: files}
+	assert.NoError(t, tmpl.Execute(output, params))
+	assert.NoError(t, os.WriteFile(filepath.Join(resourceDir, "deployment.yaml"), []byte(testDeploymentYaml), 0600))
+}
+
+func TestApplySupportingResources(t *testing.T) {
 	assert := assert.New(t)
-	assert.True(true)
-	// TODO add mocked cases for apply
+	clientset := fake.NewSimpleClientset()
+	originalNewK8sClient := newK8sClient
+	defer func() { newK8sClient = originalNewK8sClient }()
+	newK8sClient = func(kubeconfigPath string) (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+	resourceDir := t.TempDir()
+	encode := base64.StdEncoding.EncodeToString
+	writeOnlineResources(t, resourceDir, []RenderedFile{{Key: "file-0", Path: "db.conf", Content: encode([]byte("password=hunter2"))}})
+
+	// the files secret isn't a deployable object, but it is applied
+	deployYamls, err := LoadDeployYaml(resourceDir)
+	assert.NoError(err)
+	assert.Len(deployYamls, 1)
+	assert.NoError(ApplySupportingResources("kubeconfig", resourceDir))
+	secret, err := clientset.CoreV1().Secrets("default").Get(context.Background(), "pay-files", metav1.GetOptions{})
+	assert.NoError(err)
+	assert.Equal("password=hunter2", string(secret.Data["file-0"]))
+
+	// a later deploy replaces its contents
+	writeOnlineResources(t, resourceDir, []RenderedFile{{Key: "file-0", Path: "db.conf", Content: encode([]byte("password=swordfish"))}})
+	assert.NoError(ApplySupportingResources("kubeconfig", resourceDir))
+	secret, err = clientset.CoreV1().Secrets("default").Get(context.Background(), "pay-files", metav1.GetOptions{})
+	assert.NoError(err)
+	assert.Equal("password=swordfish", string(secret.Data["file-0"]))
+	deployments, err := clientset.AppsV1().Deployments("default").List(context.Background(), metav1.ListOptions{})
+	assert.NoError(err)
+	assert.Empty(deployments.Items)
+}
+
+func TestRestartDeployment(t *testing.T) {
+	assert := assert.New(t)
+	clientset := fake.NewSimpleClientset(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "pay", Namespace: "default"}})
+	originalNewK8sClient, originalSettleDelay, originalSettlePollInterval := newK8sClient, settleDelay, settlePollInterval
+	defer func() {
+		newK8sClient, settleDelay, settlePollInterval = originalNewK8sClient, originalSettleDelay, originalSettlePollInterval
+	}()
+	newK8sClient = func(kubeconfigPath string) (kubernetes.Interface, error) {
+		return clientset, nil
+	}
+	settleDelay, settlePollInterval = 0, time.Millisecond
+
+	// the pod template gets a restartedAt annotation, and nothing else about it changes
+	assert.NoError(RestartDeployment("kubeconfig", "pay"))
+	deployment, err := clientset.AppsV1().Deployments("default").Get(context.Background(), "pay", metav1.GetOptions{})
+	assert.NoError(err)
+	restartedAt, err := time.Parse(time.RFC3339, deployment.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"])
+	assert.NoError(err)
+	assert.WithinDuration(time.Now(), restartedAt, time.Minute)
+	assert.Len(deployment.Spec.Template.Annotations, 1)
+
+	// only something that's already deployed can be restarted
+	assert.Error(RestartDeployment("kubeconfig", "tip"))
+	_, err = clientset.AppsV1().Deployments("default").Get(context.Background(), "tip", metav1.GetOptions{})
+	assert.Error(err)
 }
@@ -11,12 +11,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +28,7 @@ import (
 
 	apiconfig "github.com/arryved/app-ctrl/api/config"
 	productconfig "github.com/arryved/app-ctrl/api/config/product"
+	"github.com/arryved/app-ctrl/api/model"
 	"github.com/arryved/app-ctrl/api/queue"
 	"github.com/arryved/app-ctrl/worker/config"
 	"github.com/arryved/app-ctrl/worker/gce"
@@ -39,7 +39,11 @@ import (
 type Worker struct {
 	cfg     *config.Config
 	queue   *queue.Queue
+	records queue.JobStore
 	compute *gce.Client
+
+	// per job id; serializes one job's record updates (its hosts report concurrently) without holding up other jobs
+	recordMus sync.Map
 }
 
 type JobResult struct {
@@ -82,13 +86,37 @@ func (w *Worker) Start() {
 }
 
 func (w *Worker) ProcessJob(job *queue.Job) (*JobResult, error) {
+	if job.Identity != nil {
+		log.Infof("job id=%s action=%s requested by principal=%s groups=%v authMethod=%s",
+			job.Id, job.Action, job.Identity.Email, job.Identity.Groups, job.Identity.AuthMethod)
+	} else {
+		log.Infof("job id=%s action=%s requested by principal=%s (no identity)", job.Id, job.Action, job.Principal)
+	}
+	w.updateRecord(job, func(record *queue.JobRecord) {
+		record.MarkRunning()
+	})
+	result, err := w.dispatchJob(job)
+	w.updateRecord(job, func(record *queue.JobRecord) {
+		record.MarkComplete(jobOutcome(result, err))
+	})
+	w.recordMus.Delete(job.Id)
+	return result, err
+}
+
+func (w *Worker) dispatchJob(job *queue.Job) (*JobResult, error) {
 	switch job.Action {
 	case "DEPLOY":
 		msg := fmt.Sprintf("%s action detected for job id=%s", job.Action, job.Id)
 		log.Infof(msg)
 		return w.processDeployJob(job)
-	// TODO implement RESTART if still desired
-	//case "RESTART":
+	case "RESTART":
+		msg := fmt.Sprintf("%s action detected for job id=%s", job.Action, job.Id)
+		log.Infof(msg)
+		return w.processRestartJob(job)
+	case "ROLLBACK":
+		msg := fmt.Sprintf("%s action detected for job id=%s", job.Action, job.Id)
+		log.Infof(msg)
+		return w.processRollbackJob(job)
 	default:
 		msg := fmt.Sprintf("unsupported action=%s", job.Action)
 		log.Warnf(msg)
@@ -96,6 +124,62 @@ func (w *Worker) ProcessJob(job *queue.Job) (*JobResult, error) {
 	}
 }
 
+// reduce a job's result and error to the error (if any) that gets recorded against it
+func jobOutcome(result *JobResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return fmt.Errorf("job finished without a result")
+	}
+	if result.ActionStatus != "COMPLETE" {
+		return fmt.Errorf("job finished with status=%s detail=%s", result.ActionStatus, result.Detail)
+	}
+	return nil
+}
+
+// Apply a change to the job's record. Record keeping is best-effort; a store problem doesn't fail the job.
+func (w *Worker) updateRecord(job *queue.Job, fn func(*queue.JobRecord)) {
+	if w.records == nil {
+		return
+	}
+	recordMu, _ := w.recordMus.LoadOrStore(job.Id, &sync.Mutex{})
+	recordMu.(*sync.Mutex).Lock()
+	defer recordMu.(*sync.Mutex).Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := w.records.Update(ctx, job.Id, func(record *queue.JobRecord) error {
+		fn(record)
+		return nil
+	})
+	if errors.Is(err, queue.ErrJobNotFound) {
+		// the API didn't record this job, so start a record here
+		record := queue.NewJobRecord(job, w.cfg.Env)
+		fn(record)
+		err = w.records.Put(ctx, record)
+	}
+	if err != nil {
+		log.Warnf("could not update record for job id=%s err=%s", job.Id, err.Error())
+	}
+}
+
+// Record a progress event against the job, for GET /{action}/{jobId}/events
+func (w *Worker) recordEvent(job *queue.Job, event queue.JobEvent) {
+	w.updateRecord(job, func(record *queue.JobRecord) {
+		record.AddEvent(event)
+	})
+}
+
+// Convergence event for a GKE rollout, which settles (or not) as a single batch
+func convergedEvent(deployment string, err error) queue.JobEvent {
+	event := queue.JobEvent{Type: queue.EventConverged, Batch: 1, Hosts: []string{deployment}}
+	if err != nil {
+		event.Err = err.Error()
+	}
+	return event
+}
+
 func (w *Worker) processDeployJob(job *queue.Job) (*JobResult, error) {
 	runtime := job.Request.(*queue.DeployJobRequest).Cluster.Runtime
 	switch runtime {
@@ -111,6 +195,30 @@ func (w *Worker) processDeployJob(job *queue.Job) (*JobResult, error) {
 	}
 }
 
+// A rollback redeploys the known-good version chosen by the API: package and configball on GCE, image tag on GKE
+func (w *Worker) processRollbackJob(job *queue.Job) (*JobResult, error) {
+	request := job.Request.(*queue.RollbackJobRequest)
+	log.Infof("rolling back job id=%s from version=%s to version=%s", job.Id, request.FromVersion, request.Version)
+	deployJob := *job
+	deployJob.Request = request.DeployRequest()
+	return w.processDeployJob(&deployJob)
+}
+
+func (w *Worker) processRestartJob(job *queue.Job) (*JobResult, error) {
+	runtime := job.Request.(*queue.RestartJobRequest).Cluster.Runtime
+	switch runtime {
+	case "GCE":
+		log.Infof("detected runtime=%s for job id=%s", runtime, job.Id)
+		return w.processRestartJobGCE(job)
+	case "GKE":
+		log.Infof("detected runtime=%s for job id=%s", runtime, job.Id)
+		return w.processRestartJobGKE(job)
+	default:
+		err := fmt.Errorf("unsupported runtime=%s for job id=%s", runtime, job.Id)
+		return nil, err
+	}
+}
+
 func (w *Worker) getConfigBall(cluster apiconfig.Cluster, version string) ([]byte, error) {
 	// spin up a GCP storage client
 	ctx := context.Background()
@@ -362,14 +470,18 @@ func (w *Worker) gkeApplyDeployment(arryvedDir, compiledConfigPath string, reque
 	deployment.Spec.Template.Spec.Containers[0].Image = updatedImage
 	log.Infof("updated image in container spec image=%s", deployment.Spec.Template.Spec.Containers[0].Image)
 
+	// apply what the deployment mounts (e.g. the app's files secret) ahead of it, so new pods find it current
+	err = gke.ApplySupportingResources(w.cfg.KubeConfigPath, resourceDir)
+	if err != nil {
+		err = fmt.Errorf("could not apply supporting k8s resources err=%s", err.Error())
+		log.Error(err)
+		return err
+	}
+
 	// apply deployable resource object
 	return gke.ApplyDeployObject(w.cfg.KubeConfigPath, deployment)
 }
 
-//func (w *Worker) gkeApplySupportingResources(resourceDir string, request *queue.DeployJobRequest) error {
-//    // load yamls for resources other than deployment, statefulset
-//}
-
 func (w *Worker) processDeployJobGKE(job *queue.Job) (*JobResult, error) {
 	log.Infof("processing job id=%s as GKE deploy", job.Id)
 	result := JobResult{
@@ -422,7 +534,10 @@ func (w *Worker) processDeployJobGKE(job *queue.Job) (*JobResult, error) {
 	//}
 
 	// apply the k8s deploy resources for the current env
+	// kubernetes rolls the deployment itself, so the whole thing is one batch as far as events go
+	w.recordEvent(job, queue.JobEvent{Type: queue.EventBatchStart, Batch: 1, Hosts: []string{request.Cluster.Id.App}})
 	err = w.gkeApplyDeployment(arryvedDir, compiledConfigPath, request)
+	w.recordEvent(job, convergedEvent(request.Cluster.Id.App, err))
 	if err != nil {
 		log.Infof("error encountered during apply/redeploy err=%s", err.Error())
 	}
@@ -441,18 +556,63 @@ func (w *Worker) processDeployJobGKE(job *queue.Job) (*JobResult, error) {
 	return &result, nil
 }
 
-func (w *Worker) processDeployJobGCE(job *queue.Job) (*JobResult, error) {
-	log.Infof("processing job id=%s as GCE deploy", job.Id)
+func (w *Worker) processRestartJobGKE(job *queue.Job) (*JobResult, error) {
+	log.Infof("processing job id=%s as GKE restart", job.Id)
 	result := JobResult{
 		ActionStatus:  "INCOMPLETE",
 		ClusterStatus: "UNKNOWN",
 		Detail:        "",
 	}
+	request := job.Request.(*queue.RestartJobRequest)
+
+	// deployments are named for the app, see templates/*/deployment.yaml.tmpl
+	w.recordEvent(job, queue.JobEvent{Type: queue.EventBatchStart, Batch: 1, Hosts: []string{request.Cluster.Id.App}})
+	err := gke.RestartDeployment(w.cfg.KubeConfigPath, request.Cluster.Id.App)
+	w.recordEvent(job, convergedEvent(request.Cluster.Id.App, err))
+	if err != nil {
+		log.Infof("error encountered during restart err=%s", err.Error())
+		result.ActionStatus = "FAILED"
+		result.ClusterStatus = "UNHEALTHY"
+		result.Detail = err.Error()
+	} else {
+		result.ActionStatus = "COMPLETE"
+		result.ClusterStatus = "HEALTHY"
+	}
+	log.Infof("job id=%s processed with result=%v", job.Id, result)
+	return &result, nil
+}
+
+func (w *Worker) processDeployJobGCE(job *queue.Job) (*JobResult, error) {
+	log.Infof("processing job id=%s as GCE deploy", job.Id)
 	request := job.Request.(*queue.DeployJobRequest)
-	app := request.Cluster.Id.App
-	region := request.Cluster.Id.Region
-	variant := request.Cluster.Id.Variant
 	version := request.Version
+	return w.processJobGCE(job, "deploy", request.Cluster.Id, request.Concurrency, false,
+		func(ctx context.Context, instance *compute.Instance) *appcontrold.DeployResult {
+			return w.gceDeploy(ctx, instance, job.Identity, request.Cluster.Id, version)
+		})
+}
+
+func (w *Worker) processRestartJobGCE(job *queue.Job) (*JobResult, error) {
+	log.Infof("processing job id=%s as GCE restart", job.Id)
+	request := job.Request.(*queue.RestartJobRequest)
+	return w.processJobGCE(job, "restart", request.Cluster.Id, request.Concurrency, true,
+		func(ctx context.Context, instance *compute.Instance) *appcontrold.DeployResult {
+			return w.gceRestart(ctx, instance, job.Identity, request.Cluster.Id)
+		})
+}
+
+// Run an app-controld action against every instance in the cluster, at most concurrency at a time. With
+// stopOnFailure, the first batch with a failed instance ends the job and later batches aren't attempted.
+func (w *Worker) processJobGCE(job *queue.Job, action string, clusterId apiconfig.ClusterId, concurrency string,
+	stopOnFailure bool, perInstance func(context.Context, *compute.Instance) *appcontrold.DeployResult) (*JobResult, error) {
+	result := JobResult{
+		ActionStatus:  "INCOMPLETE",
+		ClusterStatus: "UNKNOWN",
+		Detail:        "",
+	}
+	app := clusterId.App
+	region := clusterId.Region
+	variant := clusterId.Variant
 
 	// get all instances for cluster
 	instanceMap, err := w.compute.GetInstancesForCluster(app, region, variant)
@@ -463,65 +623,125 @@ func (w *Worker) processDeployJobGCE(job *queue.Job) (*JobResult, error) {
 		return &result, fmt.Errorf(msg)
 	}
 
-	batchCount := w.concurrencyToBatchCount(request.Concurrency, len(instanceMap))
-	log.Infof("Deployment with concurrency of %d nodes requested against total of %d GCE instances", batchCount, len(instanceMap))
-
-	// parallelize app-controld deploys only up to the requested concurrency's batchCount
-	var wg sync.WaitGroup
-	ch := make(chan struct{}, batchCount)
-	for name, instance := range instanceMap {
-		wg.Add(1)
-		go func(name string, instance *compute.Instance) {
-			defer wg.Done()
-			// reserve a channel position
-			ch <- struct{}{}
-			defer func() {
-				// release the channel position
-				<-ch
-			}()
-
-			// set up timeout context
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.cfg.GCEDeployTimeoutS)*time.Second)
-			defer cancel()
-
-			// kick off the deployment
-			log.Infof("starting deployment on instance %s for app=%s region=%s variant=%s version=%s", name, app, region, variant, version)
-			result := w.gceDeploy(ctx, instance, request.Cluster.Id, version)
-			log.Infof("finished deployment for=%s, result=%v", name, result)
-		}(name, instance)
+	batchCount, err := queue.BatchCount(concurrency, len(instanceMap))
+	if err != nil {
+		log.Error(err)
+		result.Detail = err.Error()
+		return &result, err
 	}
-	wg.Wait()
-	// TODO return a job result w/ details as reported by app-controld (failed|succeeded)
-	return nil, nil
-}
+	log.Infof("%s with concurrency of %d nodes requested against total of %d GCE instances", action, batchCount, len(instanceMap))
+
+	// work through the instances in batches of batchCount, waiting for each batch to finish; same batches as a dry-run plan
+	names := make([]string, 0, len(instanceMap))
+	for name := range instanceMap {
+		names = append(names, name)
+	}
+	failed := []string{}
+	skipped := 0
+	batches := queue.Batches(names, batchCount)
+	for i, batchNames := range batches {
+		batch := i + 1
+		log.Infof("starting %s batch=%d instances=%v", action, batch, batchNames)
+		w.recordEvent(job, queue.JobEvent{Type: queue.EventBatchStart, Batch: batch, Hosts: batchNames})
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		batchFailed := []string{}
+		for _, name := range batchNames {
+			wg.Add(1)
+			go func(name string, instance *compute.Instance) {
+				defer wg.Done()
+
+				// set up timeout context
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.cfg.GCEDeployTimeoutS)*time.Second)
+				defer cancel()
+
+				// kick off the action
+				log.Infof("starting %s on instance %s for app=%s region=%s variant=%s", action, name, app, region, variant)
+				startedAt := time.Now().Unix()
+				w.updateRecord(job, func(record *queue.JobRecord) {
+					record.Hosts[name] = &queue.HostResult{StartedAt: startedAt}
+					record.AddEvent(queue.JobEvent{Type: queue.EventHostStart, Batch: batch, Host: name})
+				})
+				result := perInstance(ctx, instance)
+				log.Infof("finished %s for=%s, result=%v", action, name, result)
+				w.updateRecord(job, func(record *queue.JobRecord) {
+					record.Hosts[name] = &queue.HostResult{
+						Code:        result.Code,
+						Err:         result.Err,
+						StartedAt:   startedAt,
+						CompletedAt: time.Now().Unix(),
+					}
+					record.AddEvent(queue.JobEvent{Type: queue.EventHostFinish, Batch: batch, Host: name, Code: result.Code, Err: result.Err})
+				})
+				if result.Err != "" {
+					mu.Lock()
+					batchFailed = append(batchFailed, name)
+					mu.Unlock()
+				}
+			}(name, instanceMap[name])
+		}
+		wg.Wait()
 
-func (w *Worker) concurrencyToBatchCount(concurrency string, total int) int {
-	if strings.Contains(concurrency, "%") {
-		percentage, err := strconv.Atoi(strings.TrimSuffix(concurrency, "%"))
-		if err != nil {
-			log.Fatal(err)
+		// app-controld only answers once an instance is healthy (or gives up), so a finished batch has converged
+		converged := queue.JobEvent{Type: queue.EventConverged, Batch: batch, Hosts: batchNames}
+		if len(batchFailed) > 0 {
+			sort.Strings(batchFailed)
+			converged.Err = fmt.Sprintf("%d of %d instances did not converge: %s", len(batchFailed), len(batchNames), strings.Join(batchFailed, ","))
 		}
-		return int(math.Floor(float64(total) * float64(percentage) / 100))
+		w.recordEvent(job, converged)
+		failed = append(failed, batchFailed...)
+
+		// a restart changes nothing on the instances, so one that leaves a batch unhealthy won't do better on the next;
+		// stop rather than take the rest of the cluster down with it
+		if stopOnFailure && len(batchFailed) > 0 {
+			for _, remaining := range batches[batch:] {
+				skipped += len(remaining)
+			}
+			if skipped > 0 {
+				log.Warnf("stopping %s after failed batch=%d; %d instances not attempted", action, batch, skipped)
+			}
+			break
+		}
+	}
+
+	if len(failed) == 0 {
+		result.ActionStatus = "COMPLETE"
+		result.ClusterStatus = "HEALTHY"
 	} else {
-		batchCount, err := strconv.Atoi(concurrency)
-		if err != nil {
-			log.Fatal(err)
+		sort.Strings(failed)
+		result.ActionStatus = "FAILED"
+		result.ClusterStatus = "UNHEALTHY"
+		result.Detail = fmt.Sprintf("%s failed on %d of %d instances: %s", action, len(failed), len(instanceMap), strings.Join(failed, ","))
+		if skipped > 0 {
+			result.Detail += fmt.Sprintf("; stopped with %d instances not attempted", skipped)
 		}
-		return batchCount
 	}
+	log.Infof("job id=%s processed with result=%v", job.Id, result)
+	return &result, nil
 }
 
-func (w *Worker) gceDeploy(ctx context.Context, instance *compute.Instance, clusterId apiconfig.ClusterId, version string) *appcontrold.DeployResult {
+func (w *Worker) gceDeploy(ctx context.Context, instance *compute.Instance, identity *model.Identity, clusterId apiconfig.ClusterId, version string) *appcontrold.DeployResult {
+	query := fmt.Sprintf("app=%s&variant=%s&version=%s", clusterId.App, clusterId.Variant, version)
+	return w.gceCall(ctx, instance, identity, "deploy", query)
+}
+
+func (w *Worker) gceRestart(ctx context.Context, instance *compute.Instance, identity *model.Identity, clusterId apiconfig.ClusterId) *appcontrold.DeployResult {
+	query := fmt.Sprintf("app=%s", clusterId.App)
+	return w.gceCall(ctx, instance, identity, "restart", query)
+}
+
+// Call an app-controld endpoint (deploy, restart) on an instance on behalf of identity (if known) and wait for its
+// result or the ctx timeout
+func (w *Worker) gceCall(ctx context.Context, instance *compute.Instance, identity *model.Identity, endpoint, query string) *appcontrold.DeployResult {
 	ch := make(chan appcontrold.DeployResult, 1)
-	app := clusterId.App
-	variant := clusterId.Variant
 
 	go func(ctx context.Context, ch chan appcontrold.DeployResult) {
-		log.Infof("processing deploy job for instance=%s", instance.Name)
+		log.Infof("processing %s job for instance=%s", endpoint, instance.Name)
 		result := appcontrold.DeployResult{}
 		psk := fmt.Sprintf("Bearer %s", readPSKFromPath(w.cfg.AppControlDPSKPath))
-		url := fmt.Sprintf("%s://%s:%d/deploy?app=%s&variant=%s&version=%s",
-			w.cfg.AppControlDScheme, instance.Name, w.cfg.AppControlDPort, app, variant, version)
+		url := fmt.Sprintf("%s://%s:%d/%s?%s",
+			w.cfg.AppControlDScheme, instance.Name, w.cfg.AppControlDPort, endpoint, query)
 		// TODO fix by including/referencing CA cert and issuing certs with the correct hostnames on all app-controld targets
 		client := &http.Client{
 			Transport: &http.Transport{
@@ -532,26 +752,32 @@ func (w *Worker) gceDeploy(ctx context.Context, instance *compute.Instance, clus
 		}
 		req, err := http.NewRequest("GET", url, nil)
 		if err != nil {
-			msg := fmt.Sprintf("Failed to execute /deploy request to app-controld on instance=%s, err=%v", instance.Name, err)
+			msg := fmt.Sprintf("Failed to execute /%s request to app-controld on instance=%s, err=%v", endpoint, instance.Name, err)
 			log.Warn(msg)
 			result.Err = msg
 			ch <- result
+			return
 		}
 		req.Header.Set("Authorization", psk)
+		if identity != nil {
+			req.Header.Set(model.IdentityHeader, identity.Encode())
+		}
 
 		resp, err := client.Do(req)
 		if err != nil {
-			msg := fmt.Sprintf("Failed to execute /deploy request to app-controld on instance=%s, err=%v", instance.Name, err)
+			msg := fmt.Sprintf("Failed to execute /%s request to app-controld on instance=%s, err=%v", endpoint, instance.Name, err)
 			log.Warn(msg)
 			result.Err = msg
 			ch <- result
+			return
 		}
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			msg := fmt.Sprintf("Failed body read on /status request to app-controld on instance=%s, err=%v", instance.Name, err)
+			msg := fmt.Sprintf("Failed body read on /%s request to app-controld on instance=%s, err=%v", endpoint, instance.Name, err)
 			log.Warn(msg)
 			result.Err = msg
 			ch <- result
+			return
 		}
 		err = json.Unmarshal(body, &result)
 		if err != nil {
@@ -559,19 +785,20 @@ func (w *Worker) gceDeploy(ctx context.Context, instance *compute.Instance, clus
 			log.Warn(msg)
 			result.Err = msg
 			ch <- result
+			return
 		}
-		log.Infof("finished deploy job for instance %v, result=%v", instance.Name, result)
+		log.Infof("finished %s job for instance %v, result=%v", endpoint, instance.Name, result)
 		ch <- result
 	}(ctx, ch)
 
 	// wait for completion or timeout
 	select {
 	case <-ctx.Done():
-		msg := fmt.Sprintf("Deployment for instance %s timed out\n", instance.Name)
+		msg := fmt.Sprintf("%s for instance %s timed out\n", endpoint, instance.Name)
 		log.Warn(msg)
 		return &appcontrold.DeployResult{Err: msg}
 	case result := <-ch:
-		log.Infof("Deployment for instance finished result=%v", result)
+		log.Infof("%s for instance finished result=%v", endpoint, result)
 		return &result
 	}
 }
@@ -643,11 +870,12 @@ func readPSKFromPath(pskPath string) string {
 	return strings.TrimSpace(string(pskFromFile))
 }
 
-func New(cfg *config.Config, jobQueue *queue.Queue, compute *gce.Client) *Worker {
+func New(cfg *config.Config, jobQueue *queue.Queue, records queue.JobStore, compute *gce.Client) *Worker {
 	worker := Worker{
 		cfg:     cfg,
 		compute: compute,
 		queue:   jobQueue,
+		records: records,
 	}
 	return &worker
 }
@@ -24,7 +24,7 @@ func TestWorkerGKE(t *testing.T) {
 
 	// worker object can be created
 	jobQueue := queue.NewQueue(cfg.Queue, client)
-	worker := New(cfg, jobQueue, nil)
+	worker := New(cfg, jobQueue, queue.NewMemoryJobStore(), nil)
 	assert.NotNil(worker)
 
 	// the worker can process a Job object
@@ -64,7 +64,7 @@ func TestWorkerGCE(t *testing.T) {
 	// worker object can be created
 	jobQueue := queue.NewQueue(cfg.Queue, client)
 	compute := gce.NewClient("dev", "central")
-	worker := New(cfg, jobQueue, compute)
+	worker := New(cfg, jobQueue, queue.NewMemoryJobStore(), compute)
 	assert.NotNil(worker)
 
 	// the worker can process a Job object